@@ -0,0 +1,5 @@
+// Package userv1 contains the protobuf messages and gRPC service for the
+// user API, generated from user.proto.
+package userv1
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative --go-grpc_out=../../.. --go-grpc_opt=paths=source_relative api/user/v1/user.proto
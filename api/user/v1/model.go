@@ -0,0 +1,40 @@
+package userv1
+
+import (
+	"time"
+	"user-service/internal/model"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// States maps lifecycle states to their protobuf values.
+var States = map[model.UserState]UserState{
+	model.StatePending:     UserState_USER_STATE_PENDING,
+	model.StateActive:      UserState_USER_STATE_ACTIVE,
+	model.StateSuspended:   UserState_USER_STATE_SUSPENDED,
+	model.StateDeactivated: UserState_USER_STATE_DEACTIVATED,
+}
+
+// FromModel returns the message for u. It is shared by the gRPC server
+// and the REST handlers, which serve it as application/x-protobuf.
+func FromModel(u *model.User) *User {
+	return &User{
+		Id:             u.ID,
+		Email:          u.Email,
+		Name:           u.Name,
+		Age:            int32(u.Age),
+		State:          States[u.State],
+		StateChangedAt: timestamp(u.StateChangedAt),
+		StateReason:    u.StateReason,
+		VerifiedAt:     timestamp(u.VerifiedAt),
+		CreatedAt:      timestamp(u.CreatedAt),
+		UpdatedAt:      timestamp(u.UpdatedAt),
+	}
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
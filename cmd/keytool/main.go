@@ -0,0 +1,67 @@
+// Command keytool manages the key file used to encrypt PII at rest.
+//
+//	keytool init <file> <key-id>   create a key file with a first key
+//	keytool add <file> <key-id>    add a key and make it current
+//
+// After adding a key, send the server SIGHUP to reload the file and call
+// POST /admin/keys/rotate to re-encrypt existing records with it. Old keys
+// can be removed from the file once rotation reports no remaining records.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"user-service/internal/encryption"
+)
+
+func main() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, "usage: keytool init|add <file> <key-id>")
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2], os.Args[3]); err != nil {
+		fmt.Fprintln(os.Stderr, "keytool:", err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd, path, keyID string) error {
+	var kf *encryption.KeyFile
+	switch cmd {
+	case "init":
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		}
+		var err error
+		if kf, err = encryption.NewKeyFile(keyID); err != nil {
+			return err
+		}
+	case "add":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		kf = &encryption.KeyFile{}
+		if err := json.Unmarshal(data, kf); err != nil {
+			return err
+		}
+		if err := kf.AddKey(keyID); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash cannot leave a truncated
+	// key file behind.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultForcedStop is how long each component still gets to stop once
+// the shutdown deadline has passed, so logs and traces can be flushed.
+const defaultForcedStop = time.Second
+
+// component is a part of the server that is started and stopped in order.
+// Either function may be nil.
+type component struct {
+	name  string
+	start func(ctx context.Context) error
+	stop  func(ctx context.Context) error
+}
+
+// lifecycle starts components in the order they were added and stops the
+// started ones in reverse order.
+type lifecycle struct {
+	logger     *zap.Logger
+	components []component
+	started    int
+	// forcedStop overrides defaultForcedStop.
+	forcedStop time.Duration
+}
+
+func (l *lifecycle) add(name string, start, stop func(ctx context.Context) error) {
+	l.components = append(l.components, component{name: name, start: start, stop: stop})
+}
+
+// start starts every component. If one fails, the components already
+// started are left for stop.
+func (l *lifecycle) start(ctx context.Context) error {
+	for _, c := range l.components[l.started:] {
+		if c.start != nil {
+			if err := c.start(ctx); err != nil {
+				return fmt.Errorf("starting %s: %w", c.name, err)
+			}
+		}
+		l.started++
+		l.logger.Debug("Started component", zap.String("component", c.name))
+	}
+	return nil
+}
+
+// blockedError reports a component that did not stop before the shutdown
+// deadline.
+type blockedError struct {
+	component string
+	waited    time.Duration
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("%s blocked shutdown for %s", e.component, e.waited.Round(time.Millisecond))
+}
+
+// stop stops the started components in reverse order. A component still
+// running when ctx is done is reported with a blockedError; the remaining
+// components are stopped anyway, each with a short grace period.
+func (l *lifecycle) stop(ctx context.Context) error {
+	forcedStop := l.forcedStop
+	if forcedStop == 0 {
+		forcedStop = defaultForcedStop
+	}
+	var errs []error
+	for l.started > 0 {
+		l.started--
+		c := l.components[l.started]
+		if c.stop == nil {
+			continue
+		}
+
+		stopCtx, cancel := ctx, context.CancelFunc(func() {})
+		if ctx.Err() != nil {
+			stopCtx, cancel = context.WithTimeout(context.Background(), forcedStop)
+		}
+		begin := time.Now()
+		done := make(chan error, 1)
+		go func() { done <- c.stop(stopCtx) }()
+
+		var err error
+		select {
+		case err = <-done:
+		case <-stopCtx.Done():
+			select {
+			case err = <-done:
+			default:
+				err = &blockedError{component: c.name, waited: time.Since(begin)}
+			}
+		}
+		// Components that give up when their context ends blocked too.
+		if err != nil && stopCtx.Err() != nil && errors.Is(err, stopCtx.Err()) {
+			err = &blockedError{component: c.name, waited: time.Since(begin)}
+		}
+		cancel()
+
+		var blocked *blockedError
+		switch {
+		case errors.As(err, &blocked):
+			l.logger.Error("Component blocked shutdown", zap.String("component", c.name), zap.Error(err))
+			errs = append(errs, err)
+		case err != nil:
+			errs = append(errs, fmt.Errorf("stopping %s: %w", c.name, err))
+		default:
+			l.logger.Debug("Stopped component", zap.String("component", c.name), zap.Duration("duration", time.Since(begin)))
+		}
+	}
+	return errors.Join(errs...)
+}
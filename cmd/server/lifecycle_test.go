@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestLifecycleOrder(t *testing.T) {
+	var events []string
+	record := func(event string) func(context.Context) error {
+		return func(context.Context) error {
+			events = append(events, event)
+			return nil
+		}
+	}
+	lc := &lifecycle{logger: zaptest.NewLogger(t)}
+	lc.add("logger", nil, record("stop logger"))
+	lc.add("worker", record("start worker"), record("stop worker"))
+	lc.add("http", record("start http"), record("stop http"))
+
+	if err := lc.start(context.Background()); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if err := lc.stop(context.Background()); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	want := "start worker,start http,stop http,stop worker,stop logger"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestLifecycleReportsBlockedComponent(t *testing.T) {
+	flushed := false
+	release := make(chan struct{})
+	defer close(release)
+	lc := &lifecycle{logger: zaptest.NewLogger(t), forcedStop: 20 * time.Millisecond}
+	lc.add("logger", nil, func(ctx context.Context) error {
+		flushed = true
+		return nil
+	})
+	lc.add("worker", nil, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	lc.add("http", nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := lc.start(context.Background()); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := lc.stop(ctx)
+
+	var blocked *blockedError
+	if !errors.As(err, &blocked) || blocked.component != "http" {
+		t.Fatalf("expected http to be reported as blocking, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "worker blocked shutdown") {
+		t.Errorf("expected worker to be reported too, got %v", err)
+	}
+	if !flushed {
+		t.Error("expected the logger to be flushed after the deadline")
+	}
+}
+
+func TestLifecycleStartFailure(t *testing.T) {
+	stopped := false
+	lc := &lifecycle{logger: zaptest.NewLogger(t)}
+	lc.add("worker", nil, func(context.Context) error {
+		stopped = true
+		return nil
+	})
+	lc.add("http", func(context.Context) error { return errors.New("address in use") }, nil)
+
+	err := lc.start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "starting http") {
+		t.Fatalf("expected start error naming http, got %v", err)
+	}
+	if err := lc.stop(context.Background()); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if !stopped {
+		t.Error("expected components started before the failure to be stopped")
+	}
+}
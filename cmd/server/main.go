@@ -2,90 +2,536 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	"user-service/internal/encryption"
+	"user-service/internal/gql"
+	"user-service/internal/grpcserver"
 	"user-service/internal/handler"
+	"user-service/internal/health"
+	"user-service/internal/mailer"
 	"user-service/internal/repository"
+	"user-service/internal/search"
 	"user-service/internal/service"
+	"user-service/internal/tracing"
+	"user-service/internal/worker"
 	"user-service/pkg/logger"
 
-	"github.com/gorilla/mux"
 	"github.com/hashicorp/go-memdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
 )
 
 func main() {
 	// Setup logger
-	zapLogger, err := logger.NewLogger()
+	logLevel := zap.NewAtomicLevel()
+	logOpts, err := loggerOptions(logLevel)
 	if err != nil {
-		log.Fatalf("cannot initialize logger: %v", err)
+		log.Fatalf("invalid logger configuration: %v", err)
 	}
-	defer func() {
-		if err := zapLogger.Sync(); err != nil {
-			log.Printf("failed to sync logger: %v", err)
-		}
-	}()
-
-	// Setup in-memory DB schema
-	schema := &memdb.DBSchema{
-		Tables: map[string]*memdb.TableSchema{
-			"user": {
-				Name: "user",
-				Indexes: map[string]*memdb.IndexSchema{
-					"email": {
-						Name:    "email",
-						Unique:  true,
-						Indexer: &memdb.StringFieldIndex{Field: "Email"},
-					},
-				},
-			},
-		},
+	zapLogger, err := logger.NewLogger(logOpts...)
+	if err != nil {
+		log.Fatalf("cannot initialize logger: %v", err)
 	}
+	// Components are stopped in the reverse order they are added, so the
+	// logger is flushed last.
+	lc := &lifecycle{logger: zapLogger}
+	lc.add("logger", nil, func(ctx context.Context) error { return syncLogger(zapLogger) })
 
-	db, err := memdb.NewMemDB(schema)
+	// Setup in-memory DB
+	db, err := memdb.NewMemDB(repository.Schema())
 	if err != nil {
 		zapLogger.Fatal("failed to create memdb", zap.Error(err))
 	}
 
+	// Metrics are exposed in Prometheus format on /metrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	// Traces are exported as configured by OTEL_TRACES_EXPORTER
+	tracerProvider, err := tracing.NewProvider(context.Background(), tracing.Config{
+		Exporter: os.Getenv("OTEL_TRACES_EXPORTER"),
+		File:     os.Getenv("OTEL_TRACES_FILE"),
+	})
+	if err != nil {
+		zapLogger.Fatal("failed to set up tracing", zap.Error(err))
+	}
+	lc.add("traces", nil, tracerProvider.Shutdown)
+
 	// Initialize repository, service, handler
-	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepo)
-	userHandler := handler.NewUserHandler(userService, zapLogger)
+	var repoOpts []repository.UserRepositoryOption
+	// Emails stored outside the user table are sealed with the same keys
+	var emailOpts []repository.RepositoryOption
+	keyring := loadKeyring(zapLogger)
+	if keyring != nil {
+		enc, err := repository.NewFieldEncryptor(keyring, encryptedFields()...)
+		if err != nil {
+			zapLogger.Fatal("invalid ENCRYPTED_FIELDS", zap.Error(err))
+		}
+		repoOpts = append(repoOpts, repository.WithFieldEncryptor(enc))
+		emailOpts = append(emailOpts, repository.WithEmailEncryptor(enc))
+	}
+	userRepo := repository.NewUserRepository(db, repoOpts...)
+	mail := newMailer(zapLogger)
+	registry.MustRegister(repository.NewUserCountCollector(userRepo))
+	mfaRepo := repository.NewMFARepository(db, emailOpts...)
+	auditRepo := repository.NewAuditRepository(db, emailOpts...)
+	tokenRepo := repository.NewTokenRepository(db, emailOpts...)
+	tombstoneRepo := repository.NewTombstoneRepository(db)
+	groupRepo := repository.NewGroupRepository(db, emailOpts...)
+	instrumentedRepo := repository.NewTracingUserRepository(
+		repository.NewInstrumentedUserRepository(userRepo, registry), tracerProvider)
+	// Users are indexed for search as they are written
+	searchIndex := search.NewIndex()
+	indexedRepo, err := search.NewIndexingUserRepository(context.Background(), instrumentedRepo, searchIndex)
+	if err != nil {
+		zapLogger.Fatal("failed to index users", zap.Error(err))
+	}
+	userService := service.NewUserService(indexedRepo,
+		service.WithMFARepository(mfaRepo),
+		service.WithAuditRepository(auditRepo),
+		service.WithTokenRepository(tokenRepo),
+		service.WithTombstoneRepository(tombstoneRepo),
+		service.WithGroupRepository(groupRepo),
+		service.WithPseudonymKey([]byte(os.Getenv("PSEUDONYM_KEY"))),
+		service.WithLogger(zapLogger),
+		service.WithMailer(mail),
+		service.WithLinkBaseURL(os.Getenv("LINK_BASE_URL")),
+		service.WithRetention(envDuration(zapLogger, "DELETED_USER_RETENTION", service.DefaultRetention)),
+		service.WithEmailReuse(os.Getenv("ALLOW_EMAIL_REUSE") == "true"),
+		service.WithKeyRotator(repository.KeyRotators(
+			userRepo.(repository.KeyRotator),
+			mfaRepo.(repository.KeyRotator),
+			tokenRepo.(repository.KeyRotator),
+			auditRepo.(repository.KeyRotator),
+			groupRepo.(repository.KeyRotator),
+		)),
+		service.WithSearchIndex(searchIndex),
+	)
+	// Password reset emails still being sent finish after the servers stop
+	lc.add("password reset emails", nil, userService.(service.Drainer).Drain)
+	userService = service.NewTracingUserService(userService, tracerProvider)
+	groupService := service.NewGroupService(groupRepo, indexedRepo)
+
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	purgeWorker, err := worker.NewPurgeWorker(userService, envDuration(zapLogger, "PURGE_INTERVAL", time.Hour), zapLogger)
+	if err != nil {
+		zapLogger.Fatal("invalid PURGE_INTERVAL", zap.Error(err))
+	}
+	expvar.Publish("purge", expvar.Func(func() interface{} { return purgeWorker.Stats() }))
+	purgeDone := make(chan struct{})
+	lc.add("purge worker", func(ctx context.Context) error {
+		go func() {
+			defer close(purgeDone)
+			purgeWorker.Run(workerCtx)
+		}()
+		return nil
+	}, func(ctx context.Context) error {
+		stopWorkers()
+		select {
+		case <-purgeDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	// Subsystems register health checks served on /readyz
+	healthChecks := health.NewRegistry(0)
+	healthChecks.Register("repository", func(ctx context.Context) error { return repository.Ping(db) })
+	if checker, ok := mail.(mailer.Checker); ok {
+		healthChecks.RegisterNonCritical("mailer", checker.Check)
+	}
+	healthChecks.RegisterNonCritical("purge", purgeWorker.Check)
 
 	// Setup router and routes
-	r := mux.NewRouter()
-	r.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
-	r.HandleFunc("/users", userHandler.ListUsers).Methods("GET")
-	r.HandleFunc("/users/{email}", userHandler.GetUser).Methods("GET")
-	r.HandleFunc("/users/{email}", userHandler.UpdateUser).Methods("PUT")
-	r.HandleFunc("/users/{email}", userHandler.DeleteUser).Methods("DELETE")
+	limiterCfg, err := rateLimiterConfig()
+	if err != nil {
+		zapLogger.Fatal("invalid rate limit configuration", zap.Error(err))
+	}
+	// HTTP and gRPC calls take from the same buckets
+	limiter := handler.NewRateLimiter(limiterCfg)
+	versions, err := apiVersioning()
+	if err != nil {
+		zapLogger.Fatal("invalid API versioning configuration", zap.Error(err))
+	}
+	r, err := newRouter(routerConfig{
+		users:          userService,
+		groups:         groupService,
+		logger:         zapLogger,
+		metrics:        registry,
+		limiter:        limiter,
+		graphqlLimits:  graphqlLimits(zapLogger),
+		versions:       versions,
+		health:         healthChecks,
+		logLevel:       logLevel,
+		adminToken:     os.Getenv("ADMIN_TOKEN"),
+		scimToken:      os.Getenv("SCIM_TOKEN"),
+		trustedProxies: limiterCfg.TrustedProxies,
+	})
+	if err != nil {
+		zapLogger.Fatal("failed to set up routes", zap.Error(err))
+	}
 
 	srv := &http.Server{
 		Addr:    ":8080",
-		Handler: r,
+		Handler: handler.Tracing(tracerProvider, r)(handler.RequestLogger(zapLogger, r)),
 	}
 
-	go func() {
-		zapLogger.Info("Starting server on :8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			zapLogger.Fatal("Server failed", zap.Error(err))
+	serveErr := make(chan error, 2)
+	lc.add("http server", func(ctx context.Context) error {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			return err
 		}
-	}()
+		zapLogger.Info("Starting server on " + srv.Addr)
+		go func() {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
+		return nil
+	}, srv.Shutdown)
 
-	// Graceful shutdown on SIGINT/SIGTERM
+	// The gRPC API is served on its own port
+	grpcSrv := grpcserver.NewGRPCServer(grpcserver.NewServer(userService, zapLogger),
+		grpc.ChainUnaryInterceptor(grpcserver.UnaryLogger(zapLogger), grpcserver.UnaryRateLimit(limiter)),
+		grpc.ChainStreamInterceptor(grpcserver.StreamLogger(zapLogger), grpcserver.StreamRateLimit(limiter)),
+	)
+	grpcAddr := envOr("GRPC_ADDR", ":9090")
+	lc.add("grpc server", func(ctx context.Context) error {
+		ln, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return err
+		}
+		zapLogger.Info("Starting gRPC server on " + grpcAddr)
+		go func() {
+			if err := grpcSrv.Serve(ln); err != nil {
+				serveErr <- err
+			}
+		}()
+		return nil
+	}, func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			grpcSrv.Stop()
+			return ctx.Err()
+		}
+	})
+
+	if err := lc.start(context.Background()); err != nil {
+		zapLogger.Error("Startup failed", zap.Error(err))
+		shutdown(lc, zapLogger, 5*time.Second)
+		os.Exit(1)
+	}
+
+	// SIGHUP reloads the encryption key file
+	if keyring != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := keyring.Reload(); err != nil {
+					zapLogger.Error("Failed to reload encryption keys", zap.Error(err))
+					continue
+				}
+				zapLogger.Info("Reloaded encryption keys", zap.String("current_key", keyring.CurrentKeyID()))
+			}
+		}()
+	}
+
+	// Graceful shutdown on SIGINT/SIGTERM. Readiness fails for the drain
+	// delay first, so load balancers stop routing here before the server
+	// stops accepting connections.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	exitCode := 0
+	select {
+	case <-quit:
+	case err := <-serveErr:
+		zapLogger.Error("Server failed", zap.Error(err))
+		exitCode = 1
+	}
+
+	healthChecks.SetShuttingDown()
+	if drain := envDuration(zapLogger, "SHUTDOWN_DRAIN_DELAY", 0); drain > 0 && exitCode == 0 {
+		zapLogger.Info("Draining before shutdown", zap.Duration("delay", drain))
+		select {
+		case <-time.After(drain):
+		case <-quit:
+			zapLogger.Info("Second signal received, skipping drain")
+		}
+	}
 
 	zapLogger.Info("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if !shutdown(lc, zapLogger, envDuration(zapLogger, "SHUTDOWN_TIMEOUT", 5*time.Second)) {
+		exitCode = 1
+	}
+	os.Exit(exitCode)
+}
+
+// shutdown stops every started component within timeout and reports
+// whether they all stopped cleanly. Failures are written to the standard
+// logger, as the zap logger has been synced by then.
+func shutdown(lc *lifecycle, zapLogger *zap.Logger, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		zapLogger.Fatal("Server forced to shutdown", zap.Error(err))
+	if err := lc.stop(ctx); err != nil {
+		log.Printf("shutdown incomplete: %v", err)
+		return false
 	}
 	zapLogger.Info("Server exited properly")
+	return true
+}
+
+// syncLogger flushes buffered log entries. Syncing fails on terminals and
+// pipes, which have nothing to flush, so those errors are ignored.
+func syncLogger(zapLogger *zap.Logger) error {
+	if err := zapLogger.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+		return err
+	}
+	return nil
+}
+
+// newMailer delivers through SMTP_ADDR when set. Otherwise messages are kept
+// in an outbox, written to MAIL_OUTBOX_DIR if that is set.
+func newMailer(zapLogger *zap.Logger) mailer.Mailer {
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		})
+	}
+	if dir := os.Getenv("MAIL_OUTBOX_DIR"); dir != "" {
+		outbox, err := mailer.NewFileOutbox(dir)
+		if err != nil {
+			zapLogger.Fatal("failed to create mail outbox", zap.Error(err))
+		}
+		return outbox
+	}
+	zapLogger.Warn("SMTP_ADDR and MAIL_OUTBOX_DIR are unset, emails will not be delivered")
+	return mailer.NewOutbox()
+}
+
+// envDuration parses the duration in environment variable name, returning
+// def when it is unset.
+func envDuration(zapLogger *zap.Logger, name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		zapLogger.Fatal("invalid duration", zap.String("variable", name), zap.Error(err))
+	}
+	return d
+}
+
+// graphqlLimits reads GRAPHQL_MAX_DEPTH, GRAPHQL_MAX_INTROSPECTION_DEPTH,
+// GRAPHQL_MAX_COMPLEXITY and GRAPHQL_MAX_MUTATIONS.
+func graphqlLimits(zapLogger *zap.Logger) gql.Limits {
+	limits := gql.DefaultLimits()
+	for name, dst := range map[string]*int{
+		"GRAPHQL_MAX_DEPTH":               &limits.MaxDepth,
+		"GRAPHQL_MAX_INTROSPECTION_DEPTH": &limits.MaxIntrospectionDepth,
+		"GRAPHQL_MAX_COMPLEXITY":          &limits.MaxComplexity,
+		"GRAPHQL_MAX_MUTATIONS":           &limits.MaxMutations,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				zapLogger.Fatal("invalid GraphQL limit", zap.String("variable", name), zap.Error(err))
+			}
+			*dst = n
+		}
+	}
+	return limits
+}
+
+// loadKeyring loads ENCRYPTION_KEY_FILE, or returns nil to store PII in
+// plaintext when it is unset.
+func loadKeyring(zapLogger *zap.Logger) *encryption.LocalKeyring {
+	path := os.Getenv("ENCRYPTION_KEY_FILE")
+	if path == "" {
+		zapLogger.Warn("ENCRYPTION_KEY_FILE is unset, PII is stored unencrypted")
+		return nil
+	}
+	keyring, err := encryption.LoadKeyFile(path)
+	if err != nil {
+		zapLogger.Fatal("failed to load encryption keys", zap.Error(err))
+	}
+	return keyring
+}
+
+// rateLimiterConfig reads RATE_LIMIT, RATE_LIMIT_ROUTES,
+// RATE_LIMIT_API_KEY_HEADER and TRUSTED_PROXIES. Probes and metrics are
+// never limited, so orchestrators and scrapers behind one address are not
+// locked out. RATE_LIMIT_ROUTES overrides routes on top of these defaults
+// and the stricter limits on creating users and on GraphQL mutations.
+func rateLimiterConfig() (handler.RateLimiterConfig, error) {
+	cfg := handler.RateLimiterConfig{
+		Routes: map[string]handler.RateLimit{
+			"GET /healthz":    {},
+			"GET /readyz":     {},
+			"GET /metrics":    {},
+			"POST /users":     {Rate: 1, Burst: 10},
+			"POST /v1/users":  {Rate: 1, Burst: 10},
+			"POST /v2/users":  {Rate: 1, Burst: 10},
+			gql.MutationRoute: {Rate: 1, Burst: 10},
+		},
+		APIKeyHeader: os.Getenv("RATE_LIMIT_API_KEY_HEADER"),
+	}
+	var err error
+	if cfg.Default, err = handler.ParseRateLimit(envOr("RATE_LIMIT", "20/50")); err != nil {
+		return cfg, err
+	}
+	routes, err := handler.ParseRouteRateLimits(os.Getenv("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		return cfg, err
+	}
+	for route, limit := range routes {
+		cfg.Routes[route] = limit
+	}
+	cfg.TrustedProxies, err = handler.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	return cfg, err
+}
+
+// v1DeprecatedAt is when v2 of the user API was released.
+var v1DeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// apiVersioning announces the deprecation of v1 of the user API, and its
+// sunset on the date in API_V1_SUNSET, such as 2027-06-30, if it is set.
+func apiVersioning() (handler.Versioning, error) {
+	v1 := handler.Deprecation{Since: v1DeprecatedAt, Successor: "/v2/users"}
+	if v := os.Getenv("API_V1_SUNSET"); v != "" {
+		sunset, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return handler.Versioning{}, fmt.Errorf("API_V1_SUNSET: %w", err)
+		}
+		v1.Sunset = sunset
+	}
+	return handler.Versioning{Deprecations: map[int]handler.Deprecation{handler.V1: v1}}, nil
+}
+
+// envOr returns the value of the environment variable name, or def if it
+// is unset.
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return def
+}
+
+// encryptedFields returns the comma separated model.User fields in
+// ENCRYPTED_FIELDS, or repository.DefaultPIIFields.
+func encryptedFields() []string {
+	v := os.Getenv("ENCRYPTED_FIELDS")
+	if v == "" {
+		return repository.DefaultPIIFields
+	}
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// loggerOptions builds logger options from LOG_* variables. The level is
+// set through level so it can be changed at runtime.
+func loggerOptions(level zap.AtomicLevel) ([]logger.Option, error) {
+	opts := []logger.Option{logger.WithLevel(level)}
+	lvl := zapcore.InfoLevel
+	if os.Getenv("LOG_DEVELOPMENT") == "true" {
+		opts = append(opts, logger.WithDevelopment())
+		lvl = zapcore.DebugLevel
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		var err error
+		if lvl, err = zapcore.ParseLevel(v); err != nil {
+			return nil, err
+		}
+	}
+	level.SetLevel(lvl)
+	if v := os.Getenv("LOG_ENCODING"); v != "" {
+		opts = append(opts, logger.WithEncoding(v))
+	}
+	if v := os.Getenv("LOG_SAMPLING"); v != "" {
+		initial, thereafter, err := parseSampling(v)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, logger.WithSampling(initial, thereafter))
+	}
+
+	switch out := os.Getenv("LOG_OUTPUT"); out {
+	case "", "stderr":
+	case "stdout":
+		opts = append(opts, logger.WithOutput(zapcore.Lock(os.Stdout)))
+	default:
+		var r logger.Rotation
+		for name, dst := range map[string]*int{
+			"LOG_MAX_SIZE_MB":  &r.MaxSizeMB,
+			"LOG_MAX_BACKUPS":  &r.MaxBackups,
+			"LOG_MAX_AGE_DAYS": &r.MaxAgeDays,
+		} {
+			if v := os.Getenv(name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				*dst = n
+			}
+		}
+		r.Compress = os.Getenv("LOG_COMPRESS") == "true"
+		opts = append(opts, logger.WithFile(out, r))
+	}
+	return opts, nil
+}
+
+// parseSampling parses LOG_SAMPLING as "initial/thereafter", or "off".
+func parseSampling(v string) (int, int, error) {
+	if v == "off" {
+		return 0, 0, nil
+	}
+	a, b, ok := strings.Cut(v, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("LOG_SAMPLING must be initial/thereafter or off, got %q", v)
+	}
+	initial, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, 0, fmt.Errorf("LOG_SAMPLING: %w", err)
+	}
+	thereafter, err := strconv.Atoi(b)
+	if err != nil {
+		return 0, 0, fmt.Errorf("LOG_SAMPLING: %w", err)
+	}
+	return initial, thereafter, nil
 }
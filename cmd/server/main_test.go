@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"user-service/internal/handler"
+)
+
+func TestRateLimiterConfig(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ROUTES", "GET /users=5/10,POST /v1/users=off")
+	cfg, err := rateLimiterConfig()
+	if err != nil {
+		t.Fatalf("rateLimiterConfig failed: %v", err)
+	}
+	expected := map[string]handler.RateLimit{
+		"GET /users":     {Rate: 5, Burst: 10},
+		"POST /v1/users": {},
+		"POST /users":    {Rate: 1, Burst: 10},
+		"POST /v2/users": {Rate: 1, Burst: 10},
+		"GET /metrics":   {},
+	}
+	for route, limit := range expected {
+		if got, ok := cfg.Routes[route]; !ok || got != limit {
+			t.Errorf("%s: expected %+v, got %+v", route, limit, got)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"user-service/internal/gql"
+	"user-service/internal/handler"
+	"user-service/internal/health"
+	"user-service/internal/openapi"
+	"user-service/internal/scim"
+)
+
+// apiSpec describes every route newRouter registers. The router test
+// fails when the two disagree.
+func apiSpec(limiter *handler.RateLimiter) *openapi.Document {
+	doc := openapi.New("User Service", "1.0.0", "Manages users, their lifecycle, MFA and privacy requests.")
+	handler.Describe(doc)
+	gql.Describe(doc, "/graphql")
+	scim.Describe(doc)
+
+	verbose := []*openapi.Parameter{{
+		Name: "verbose", In: "query", Schema: openapi.String(),
+		Description: "Answer with a JSON report of every check instead of the plain status.",
+	}}
+	report := doc.Define("HealthReport", health.Report{})
+	status := func(description string) *openapi.Response {
+		return &openapi.Response{
+			Description: description,
+			Content: map[string]*openapi.MediaType{
+				openapi.Text: {Schema: &openapi.Schema{
+					Type:        openapi.Types{"string"},
+					Description: "The overall status and a newline.",
+					Enum:        []interface{}{health.StatusOK, health.StatusDegraded, health.StatusUnavailable},
+				}},
+				openapi.JSON: {Schema: report},
+			},
+		}
+	}
+	doc.Add("GET", "/healthz", &openapi.Operation{
+		OperationID: "liveness", Summary: "Report whether the process can serve requests", Tags: []string{"operations"},
+		Parameters: verbose,
+		Responses:  map[string]*openapi.Response{"200": status("Alive")},
+	})
+	doc.Add("GET", "/readyz", &openapi.Operation{
+		OperationID: "readiness", Summary: "Report whether dependencies are usable", Tags: []string{"operations"},
+		Parameters: verbose,
+		Responses: map[string]*openapi.Response{
+			"200": status("Ready, possibly degraded"),
+			"503": status("A critical check failed or the server is shutting down"),
+		},
+	})
+	doc.Add("GET", "/metrics", &openapi.Operation{
+		OperationID: "metrics", Summary: "Prometheus metrics", Tags: []string{"operations"},
+		Responses: map[string]*openapi.Response{
+			"200": openapi.RespondWith("Metrics in the Prometheus text format", openapi.Text, openapi.String()),
+		},
+	})
+	doc.Add("GET", "/openapi.json", &openapi.Operation{
+		OperationID: "openapi", Summary: "This document", Tags: []string{"operations"},
+		Responses: map[string]*openapi.Response{
+			"200": openapi.RespondWith("The OpenAPI document", openapi.JSON, openapi.MapOf(openapi.Any())),
+		},
+	})
+
+	security := handler.AdminSecurity(doc)
+	adminErrors := func(responses map[string]*openapi.Response) map[string]*openapi.Response {
+		responses["401"] = openapi.RespondWith("Missing or invalid token", openapi.Text, openapi.String())
+		responses["403"] = openapi.RespondWith("Admin API disabled", openapi.Text, openapi.String())
+		return responses
+	}
+	doc.Add("GET", "/admin/debug/vars", &openapi.Operation{
+		OperationID: "debugVars", Summary: "Runtime and purge worker statistics", Tags: []string{"admin"},
+		Security: security,
+		Responses: adminErrors(map[string]*openapi.Response{
+			"200": openapi.RespondWith("expvar variables", openapi.JSON, openapi.MapOf(openapi.Any())),
+		}),
+	})
+	level := openapi.Object(map[string]*openapi.Schema{"level": {
+		Type: openapi.Types{"string"}, Enum: []interface{}{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"},
+	}})
+	levelError := openapi.Object(map[string]*openapi.Schema{"error": openapi.String()})
+	doc.Add("GET", "/admin/log/level", &openapi.Operation{
+		OperationID: "getLogLevel", Summary: "Get the log level", Tags: []string{"admin"},
+		Security: security,
+		Responses: adminErrors(map[string]*openapi.Response{
+			"200": openapi.RespondWith("The current level", openapi.JSON, level),
+		}),
+	})
+	doc.Add("PUT", "/admin/log/level", &openapi.Operation{
+		OperationID: "setLogLevel", Summary: "Change the log level without restarting", Tags: []string{"admin"},
+		Security:    security,
+		RequestBody: openapi.Body(openapi.JSON, level, map[string]string{"level": "debug"}),
+		Responses: adminErrors(map[string]*openapi.Response{
+			"200": openapi.RespondWith("The new level", openapi.JSON, level),
+			"400": openapi.RespondWith("Invalid level", openapi.JSON, levelError),
+		}),
+	})
+
+	limiter.Describe(doc)
+	return doc
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"expvar"
+	"net"
+	"net/http"
+	"user-service/internal/gql"
+	"user-service/internal/handler"
+	"user-service/internal/health"
+	"user-service/internal/openapi"
+	"user-service/internal/scim"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// routerConfig holds everything the HTTP routes are served with.
+type routerConfig struct {
+	users         service.UserService
+	groups        service.GroupService
+	logger        *zap.Logger
+	metrics       *prometheus.Registry
+	limiter       *handler.RateLimiter
+	graphqlLimits gql.Limits
+	versions      handler.Versioning
+	health        *health.Registry
+	logLevel      http.Handler
+	adminToken    string
+	scimToken     string
+	// trustedProxies report client addresses in X-Forwarded-For.
+	trustedProxies []*net.IPNet
+}
+
+// newRouter registers every HTTP route, and serves their OpenAPI
+// description on /openapi.json.
+func newRouter(cfg routerConfig) (*mux.Router, error) {
+	userHandler := handler.NewUserHandler(cfg.users, cfg.logger,
+		handler.WithGroups(cfg.groups), handler.WithTrustedProxies(cfg.trustedProxies))
+	limiter := cfg.limiter
+
+	r := mux.NewRouter()
+	r.Use(handler.RequestMetrics(cfg.metrics))
+	r.Use(limiter.Middleware)
+	r.Handle("/metrics", promhttp.HandlerFor(cfg.metrics, promhttp.HandlerOpts{Registry: cfg.metrics})).Methods("GET")
+
+	// User reads are revalidated with their ETag on every use; nothing else
+	// is stored
+	reads := func(f http.HandlerFunc) http.Handler { return handler.CacheControl(handler.CacheRevalidate)(f) }
+	writes := func(f http.HandlerFunc) http.Handler { return handler.CacheControl(handler.CacheNoStore)(f) }
+
+	// Registered before /users/{email}, which would match it
+	r.HandleFunc("/users/search", userHandler.SearchUsers).Methods("GET")
+
+	// Unversioned user routes serve the version the Accept header asks for
+	negotiated := cfg.versions.Negotiate
+	r.Handle("/users", negotiated(writes(userHandler.CreateUser))).Methods("POST")
+	r.Handle("/users", negotiated(reads(userHandler.ListUsers))).Methods("GET")
+	r.Handle("/users/{email}", negotiated(reads(userHandler.GetUser))).Methods("GET")
+	r.Handle("/users/{email}", negotiated(writes(userHandler.UpdateUser))).Methods("PUT")
+	r.Handle("/users/{email}", negotiated(writes(userHandler.DeleteUser))).Methods("DELETE")
+
+	// Versioned user routes: v1 addresses users by email, v2 by ID
+	v1 := r.PathPrefix("/v1").Subrouter()
+	v1.Use(cfg.versions.Pin(handler.V1))
+	v1.Handle("/users", writes(userHandler.CreateUser)).Methods("POST")
+	v1.Handle("/users", reads(userHandler.ListUsers)).Methods("GET")
+	v1.Handle("/users/{email}", reads(userHandler.GetUser)).Methods("GET")
+	v1.Handle("/users/{email}", writes(userHandler.UpdateUser)).Methods("PUT")
+	v1.Handle("/users/{email}", writes(userHandler.DeleteUser)).Methods("DELETE")
+	v2 := r.PathPrefix("/v2").Subrouter()
+	v2.Use(cfg.versions.Pin(handler.V2))
+	v2.Handle("/users", writes(userHandler.CreateUser)).Methods("POST")
+	v2.Handle("/users", reads(userHandler.ListUsers)).Methods("GET")
+	v2.Handle("/users/{id}", reads(userHandler.GetUser)).Methods("GET")
+	v2.Handle("/users/{id}", writes(userHandler.UpdateUser)).Methods("PUT")
+	v2.Handle("/users/{id}", writes(userHandler.DeleteUser)).Methods("DELETE")
+
+	r.HandleFunc("/users/{email}/mfa/totp/request", userHandler.RequestMFAEnrollment).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/totp", userHandler.EnrollTOTP).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/totp/confirm", userHandler.ConfirmTOTP).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/verify", userHandler.VerifyMFA).Methods("POST")
+	r.HandleFunc("/users/{email}/verification", userHandler.RequestEmailVerification).Methods("POST")
+	r.HandleFunc("/email/verify", userHandler.VerifyEmail).Methods("POST")
+	r.HandleFunc("/password/forgot", userHandler.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", userHandler.ResetPassword).Methods("POST")
+
+	// Admin routes require ADMIN_TOKEN as a bearer token
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(handler.AdminAuth(cfg.adminToken), limiter.Authenticated)
+	admin.Handle("/users/{email}/undelete", negotiated(writes(userHandler.UndeleteUser))).Methods("POST")
+	admin.Handle("/users/{email}/activate", negotiated(writes(userHandler.ActivateUser))).Methods("POST")
+	admin.Handle("/users/{email}/suspend", negotiated(writes(userHandler.SuspendUser))).Methods("POST")
+	admin.Handle("/users/{email}/deactivate", negotiated(writes(userHandler.DeactivateUser))).Methods("POST")
+	adminV2 := admin.PathPrefix("/v2").Subrouter()
+	adminV2.Use(cfg.versions.Pin(handler.V2))
+	adminV2.Handle("/users/{id}/activate", writes(userHandler.ActivateUser)).Methods("POST")
+	adminV2.Handle("/users/{id}/suspend", writes(userHandler.SuspendUser)).Methods("POST")
+	adminV2.Handle("/users/{id}/deactivate", writes(userHandler.DeactivateUser)).Methods("POST")
+	admin.HandleFunc("/users/{email}/mfa", userHandler.ResetMFA).Methods("DELETE")
+	admin.HandleFunc("/users/{email}/lockout", userHandler.UnlockAccount).Methods("DELETE")
+	admin.HandleFunc("/users/{email}/export", userHandler.ExportUserData).Methods("GET")
+	admin.HandleFunc("/users/{email}/erasure", userHandler.EraseUser).Methods("POST")
+	admin.HandleFunc("/erasures/{email}", userHandler.GetErasure).Methods("GET")
+	admin.HandleFunc("/keys/rotate", userHandler.RotateEncryptionKeys).Methods("POST")
+	admin.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+	admin.Handle("/log/level", jsonContent(cfg.logLevel)).Methods("GET", "PUT")
+
+	graphqlHandler, err := gql.NewHandler(cfg.users, cfg.groups, cfg.logger,
+		gql.WithLimits(cfg.graphqlLimits), gql.WithRateLimiter(limiter))
+	if err != nil {
+		return nil, err
+	}
+	r.Handle("/graphql", graphqlHandler).Methods("GET", "POST")
+
+	// SCIM provisioning requires SCIM_TOKEN as a bearer token
+	scimRouter := r.PathPrefix(scim.Prefix).Subrouter()
+	scimRouter.Use(handler.SCIMAuth(cfg.scimToken), limiter.Authenticated)
+	scim.NewHandler(cfg.users, cfg.groups, cfg.logger).Register(scimRouter)
+
+	r.Handle("/healthz", cfg.health.LivenessHandler()).Methods("GET")
+	r.Handle("/readyz", cfg.health.ReadinessHandler()).Methods("GET")
+	r.Handle("/openapi.json", openapi.Handler(apiSpec(limiter))).Methods("GET")
+	return r, nil
+}
+
+// jsonContent labels the responses of next, which writes JSON without
+// saying so, as JSON.
+func jsonContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", openapi.JSON)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"user-service/internal/gql"
+	"user-service/internal/handler"
+	"user-service/internal/health"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/openapi"
+	"user-service/internal/repository"
+	"user-service/internal/scim"
+	"user-service/internal/search"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	testAdminToken = "admin-token"
+	testSCIMToken  = "scim-token"
+)
+
+// setupRouter returns the full router over fresh repositories, holding
+// one active user, alice@example.com, in the group with id "admins".
+func setupRouter(t *testing.T) *mux.Router {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	userRepo := repository.NewUserRepository(db)
+	index := search.NewIndex()
+	indexedRepo, err := search.NewIndexingUserRepository(context.Background(), userRepo, index)
+	if err != nil {
+		t.Fatalf("failed to index users: %v", err)
+	}
+	groupRepo := repository.NewGroupRepository(db)
+	logger := zaptest.NewLogger(t)
+	users := service.NewUserService(indexedRepo,
+		service.WithMFARepository(repository.NewMFARepository(db)),
+		service.WithAuditRepository(repository.NewAuditRepository(db)),
+		service.WithTokenRepository(repository.NewTokenRepository(db)),
+		service.WithTombstoneRepository(repository.NewTombstoneRepository(db)),
+		service.WithGroupRepository(groupRepo),
+		service.WithPseudonymKey([]byte("pseudonym-key")),
+		service.WithMailer(mailer.NewOutbox()),
+		service.WithLogger(logger),
+		service.WithKeyRotator(userRepo.(repository.KeyRotator)),
+		service.WithSearchIndex(index),
+	)
+	ctx := context.Background()
+	if err := users.CreateUser(ctx, &model.User{Email: "alice@example.com", Name: "Alice", Age: 30}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := users.TransitionUser(ctx, "alice@example.com", model.StateActive, ""); err != nil {
+		t.Fatalf("failed to activate user: %v", err)
+	}
+	group := &model.Group{ID: "admins", DisplayName: "Admins", Members: []string{"alice@example.com"}}
+	if err := groupRepo.Create(ctx, group); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+
+	r, err := newRouter(routerConfig{
+		users:         users,
+		groups:        service.NewGroupService(groupRepo, userRepo),
+		logger:        logger,
+		metrics:       prometheus.NewRegistry(),
+		limiter:       handler.NewRateLimiter(handler.RateLimiterConfig{Default: handler.RateLimit{Rate: 1000, Burst: 1000}}),
+		graphqlLimits: gql.DefaultLimits(),
+		health:        health.NewRegistry(0),
+		logLevel:      zap.NewAtomicLevel(),
+		adminToken:    testAdminToken,
+		scimToken:     testSCIMToken,
+	})
+	if err != nil {
+		t.Fatalf("failed to build router: %v", err)
+	}
+	return r
+}
+
+// fetchSpec returns the document the router serves.
+func fetchSpec(t *testing.T, r *mux.Router) *openapi.Document {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: expected status 200, got %d", w.Code)
+	}
+	doc := openapi.New("", "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), doc); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if doc.OpenAPI != openapi.Version {
+		t.Errorf("expected openapi %s, got %q", openapi.Version, doc.OpenAPI)
+	}
+	return doc
+}
+
+type operation struct {
+	method, path string
+	op           *openapi.Operation
+}
+
+// operations returns every operation in doc, sorted by path and method.
+func operations(doc *openapi.Document) []operation {
+	var ops []operation
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			ops = append(ops, operation{strings.ToUpper(method), path, op})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].path != ops[j].path {
+			return ops[i].path < ops[j].path
+		}
+		return ops[i].method < ops[j].method
+	})
+	return ops
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	r := setupRouter(t)
+	doc := fetchSpec(t, r)
+
+	registered := make(map[string]bool)
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Path prefixes of subrouters match no method themselves.
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+tmpl] = true
+			if doc.Operation(method, tmpl) == nil {
+				t.Errorf("%s %s is registered but not in the OpenAPI document", method, tmpl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+
+	ids := make(map[string]string)
+	for _, o := range operations(doc) {
+		key := o.method + " " + o.path
+		if !registered[key] {
+			t.Errorf("%s is in the OpenAPI document but not registered", key)
+		}
+		if other, ok := ids[o.op.OperationID]; ok || o.op.OperationID == "" {
+			t.Errorf("%s: operationId %q is empty or also used by %s", key, o.op.OperationID, other)
+		}
+		ids[o.op.OperationID] = key
+		if _, ok := o.op.Responses["429"]; !ok && !strings.HasPrefix(key, "GET /metrics") {
+			t.Errorf("%s: rate limited route does not document 429", key)
+		}
+	}
+}
+
+// examplePath returns a replacer filling in the path parameters of
+// requests to r.
+func examplePath(t *testing.T, r *mux.Router) *strings.Replacer {
+	req := httptest.NewRequest("GET", "/users/alice@example.com", nil)
+	req.Header.Set("Accept", handler.MediaType(handler.V2))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var alice struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &alice); err != nil || alice.Data.ID == "" {
+		t.Fatalf("failed to get the ID of alice: %v %s", err, w.Body.String())
+	}
+	return strings.NewReplacer(
+		"/Groups/{id}", "/Groups/admins",
+		"/ResourceTypes/{id}", "/ResourceTypes/User",
+		"/Schemas/{id}", "/Schemas/"+scim.UserSchema,
+		"/v2/users/{id}", "/v2/users/"+alice.Data.ID,
+		"{id}", "alice@example.com",
+		"{email}", "alice@example.com",
+	)
+}
+
+// TestOpenAPIMatchesHandlers sends every operation its documented example
+// request and checks the response against the document: the status must
+// be documented, with the documented media type, and JSON bodies must
+// match their schema.
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	doc := fetchSpec(t, setupRouter(t))
+	succeeded := 0
+	for _, o := range operations(doc) {
+		o := o
+		t.Run(o.method+" "+o.path, func(t *testing.T) {
+			r := setupRouter(t)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, exampleRequest(t, o, examplePath(t, r)))
+
+			resp, ok := o.op.Responses[strconv.Itoa(w.Code)]
+			if !ok {
+				t.Fatalf("undocumented status %d: %s", w.Code, w.Body.String())
+			}
+			if w.Code < 300 {
+				succeeded++
+			}
+			resp = doc.Resolve(resp)
+			if len(resp.Content) == 0 {
+				if w.Body.Len() > 0 {
+					t.Errorf("status %d is documented without a body, got %q", w.Code, w.Body.String())
+				}
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("status %d: invalid Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+			}
+			content, ok := resp.Content[mediaType]
+			if !ok {
+				t.Fatalf("status %d: undocumented Content-Type %s", w.Code, mediaType)
+			}
+			if !strings.HasSuffix(mediaType, "json") {
+				return
+			}
+			var body interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("status %d: invalid JSON: %v", w.Code, err)
+			}
+			if err := doc.Validate(content.Schema, body); err != nil {
+				t.Errorf("status %d: body does not match the schema: %v\n%s", w.Code, err, w.Body.String())
+			}
+		})
+	}
+	// Most examples should succeed, so success responses are checked too.
+	if ops := len(operations(doc)); succeeded < ops*3/4 {
+		t.Errorf("only %d of %d example requests succeeded", succeeded, ops)
+	}
+}
+
+// exampleRequest builds a request for o from the examples in the document
+// and paths, authenticated as o's security requirement asks.
+func exampleRequest(t *testing.T, o operation, paths *strings.Replacer) *http.Request {
+	path := paths.Replace(o.path)
+	query := make([]string, 0)
+	for _, p := range o.op.Parameters {
+		if p.In == "query" && p.Required {
+			query = append(query, p.Name+"="+url.QueryEscape(fmt.Sprint(p.Example)))
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + strings.Join(query, "&")
+	}
+
+	var body io.Reader
+	contentType := ""
+	if o.op.RequestBody != nil {
+		for mediaType, content := range o.op.RequestBody.Content {
+			// Examples are sent in JSON, the default of bodies in other
+			// media types too.
+			if !strings.HasSuffix(mediaType, "json") {
+				continue
+			}
+			b, err := json.Marshal(content.Example)
+			if err != nil {
+				t.Fatalf("invalid example: %v", err)
+			}
+			body, contentType = bytes.NewReader(b), mediaType
+		}
+	}
+	req := httptest.NewRequest(o.method, path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, requirement := range o.op.Security {
+		if _, ok := requirement["adminToken"]; ok {
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		}
+		if _, ok := requirement["scimToken"]; ok {
+			req.Header.Set("Authorization", "Bearer "+testSCIMToken)
+		}
+	}
+	return req
+}
+
+// TestLifecycleRoutesRequireAdmin checks that users can only be moved
+// between lifecycle states, or restored, with the admin token.
+func TestLifecycleRoutesRequireAdmin(t *testing.T) {
+	r := setupRouter(t)
+	byID := examplePath(t, r).Replace("/v2/users/{id}")
+	type request struct {
+		path, token string
+		want        int
+	}
+	check := func(requests []request) {
+		for _, tc := range requests {
+			req := httptest.NewRequest("POST", tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Errorf("POST %s with token %q: expected status %d, got %d", tc.path, tc.token, tc.want, w.Code)
+			}
+		}
+	}
+
+	check([]request{
+		{"/users/alice@example.com/suspend", testAdminToken, http.StatusNotFound},
+		{"/users/alice@example.com/reactivate", testAdminToken, http.StatusNotFound},
+		{"/admin/users/alice@example.com/suspend", "", http.StatusUnauthorized},
+		{"/admin/users/alice@example.com/deactivate", "wrong", http.StatusUnauthorized},
+		{"/admin/users/alice@example.com/suspend", testAdminToken, http.StatusOK},
+		{"/admin/users/alice@example.com/activate", testAdminToken, http.StatusOK},
+		{"/admin" + byID + "/suspend", "", http.StatusUnauthorized},
+		{"/admin" + byID + "/suspend", testAdminToken, http.StatusOK},
+		{"/admin" + byID + "/activate", testAdminToken, http.StatusOK},
+		{"/admin/v2/users/unknown-id/activate", testAdminToken, http.StatusNotFound},
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/users/alice@example.com", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected alice to be deleted, got %d", w.Code)
+	}
+	check([]request{
+		{"/users/alice@example.com/undelete", testAdminToken, http.StatusNotFound},
+		{"/admin/users/alice@example.com/undelete", "", http.StatusUnauthorized},
+		{"/admin/users/alice@example.com/undelete", testAdminToken, http.StatusOK},
+	})
+}
@@ -0,0 +1,87 @@
+package encryption
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T) (*LocalKeyring, *KeyFile) {
+	t.Helper()
+	kf, err := NewKeyFile("k1")
+	if err != nil {
+		t.Fatalf("NewKeyFile failed: %v", err)
+	}
+	k, err := NewLocalKeyring(*kf)
+	if err != nil {
+		t.Fatalf("NewLocalKeyring failed: %v", err)
+	}
+	return k, kf
+}
+
+func TestSealOpen(t *testing.T) {
+	k, _ := newTestKeyring(t)
+
+	env, err := Seal(k, []byte("secret"), []byte("aad"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if env.KeyID != "k1" {
+		t.Errorf("Expected key k1, got %s", env.KeyID)
+	}
+	got, err := Open(k, env, []byte("aad"))
+	if err != nil || string(got) != "secret" {
+		t.Errorf("Open returned %q, %v", got, err)
+	}
+	if _, err := Open(k, env, []byte("other")); err != ErrDecrypt {
+		t.Errorf("Expected ErrDecrypt for wrong aad, got %v", err)
+	}
+
+	other, _ := newTestKeyring(t)
+	if _, err := Open(other, env, []byte("aad")); err == nil {
+		t.Error("Expected Open with a different keyring to fail")
+	}
+}
+
+func TestKeyFileRotation(t *testing.T) {
+	_, kf := newTestKeyring(t)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data, _ := json.Marshal(kf)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	old, _ := Seal(k, []byte("old"), nil)
+	index := k.BlindIndex("a@example.com")
+
+	if err := kf.AddKey("k2"); err != nil {
+		t.Fatalf("AddKey failed: %v", err)
+	}
+	data, _ = json.Marshal(kf)
+	_ = os.WriteFile(path, data, 0o600)
+	if err := k.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if k.CurrentKeyID() != "k2" {
+		t.Errorf("Expected current key k2, got %s", k.CurrentKeyID())
+	}
+	if got, err := Open(k, old, nil); err != nil || string(got) != "old" {
+		t.Errorf("Expected data sealed with k1 to still open, got %q, %v", got, err)
+	}
+	if k.BlindIndex("a@example.com") != index {
+		t.Error("Expected blind index to survive key rotation")
+	}
+
+	delete(kf.Keys, "k1")
+	k2, _ := NewLocalKeyring(*kf)
+	if _, err := Open(k2, old, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey after removing k1, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+var ErrDecrypt = errors.New("encryption: message authentication failed")
+
+// Envelope is a value encrypted with its own data key.
+type Envelope struct {
+	KeyID      string // key encryption key that wrapped WrappedKey
+	WrappedKey []byte
+	Ciphertext []byte // nonce followed by the AES-GCM ciphertext
+}
+
+// Seal encrypts plaintext under a new data key wrapped by k. aad is
+// authenticated but not encrypted, and must be passed to Open unchanged.
+func Seal(k Keyring, plaintext, aad []byte) (*Envelope, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dek, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := k.Wrap(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: keyID, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts an envelope produced by Seal.
+func Open(k Keyring, env *Envelope, aad []byte) ([]byte, error) {
+	dek, err := k.Unwrap(env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(dek, env.Ciphertext, aad)
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, ciphertext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
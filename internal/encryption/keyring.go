@@ -0,0 +1,202 @@
+// Package encryption implements envelope encryption for data at rest.
+// Every value is encrypted with a fresh AES-256-GCM data key, and the data
+// key is wrapped by a key encryption key held by a Keyring.
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown key encryption key")
+)
+
+// Keyring wraps and unwraps data keys. It mirrors the operations offered by
+// a KMS so that a remote implementation can replace LocalKeyring.
+type Keyring interface {
+	// CurrentKeyID is the key that Wrap uses.
+	CurrentKeyID() string
+	// Wrap encrypts dek with the current key.
+	Wrap(dek []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped by keyID.
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+	// BlindIndex returns a keyed hash of value that can be indexed and
+	// compared for equality without revealing value.
+	BlindIndex(value string) string
+}
+
+// KeyFile is the JSON layout read by LoadKeyFile. Keys are base64 encoded
+// 32 byte values. Old keys must stay in the file until RotateKeys has
+// re-encrypted every record that uses them.
+type KeyFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// LocalKeyring is a Keyring backed by keys held in memory, usually loaded
+// from a key file.
+type LocalKeyring struct {
+	path string
+
+	mu       sync.RWMutex
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// NewLocalKeyring builds a keyring from kf.
+func NewLocalKeyring(kf KeyFile) (*LocalKeyring, error) {
+	k := &LocalKeyring{}
+	if err := k.load(kf); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKeyFile reads a KeyFile from path. Reload re-reads the same path.
+func LoadKeyFile(path string) (*LocalKeyring, error) {
+	k := &LocalKeyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload re-reads the key file, typically after a new current key was
+// added to it.
+func (k *LocalKeyring) Reload() error {
+	if k.path == "" {
+		return errors.New("encryption: keyring was not loaded from a file")
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return fmt.Errorf("encryption: parse key file: %w", err)
+	}
+	return k.load(kf)
+}
+
+func (k *LocalKeyring) load(kf KeyFile) error {
+	keys := make(map[string][]byte, len(kf.Keys))
+	for id, encoded := range kf.Keys {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return fmt.Errorf("encryption: key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	if _, ok := keys[kf.Current]; !ok {
+		return fmt.Errorf("encryption: current key %q: %w", kf.Current, ErrUnknownKey)
+	}
+	indexKey, err := decodeKey(kf.IndexKey)
+	if err != nil {
+		return fmt.Errorf("encryption: index key: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.current, k.keys, k.indexKey = kf.Current, keys, indexKey
+	return nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("expected 32 byte key, got %d", len(key))
+	}
+	return key, nil
+}
+
+func (k *LocalKeyring) CurrentKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+func (k *LocalKeyring) Wrap(dek []byte) (string, []byte, error) {
+	k.mu.RLock()
+	id, kek := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+
+	wrapped, err := seal(kek, dek, []byte(id))
+	if err != nil {
+		return "", nil, err
+	}
+	return id, wrapped, nil
+}
+
+func (k *LocalKeyring) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	kek, ok := k.keys[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("encryption: key %q: %w", keyID, ErrUnknownKey)
+	}
+	return open(kek, wrapped, []byte(keyID))
+}
+
+func (k *LocalKeyring) BlindIndex(value string) string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewKeyFile returns a key file with a freshly generated current key and
+// index key.
+func NewKeyFile(keyID string) (*KeyFile, error) {
+	indexKey, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	kf := &KeyFile{Keys: map[string]string{}, IndexKey: indexKey}
+	if err := kf.AddKey(keyID); err != nil {
+		return nil, err
+	}
+	return kf, nil
+}
+
+// AddKey generates a new key and makes it current. Existing keys are kept
+// so records sealed with them can still be read and rotated. The index key
+// is not changed, since that would invalidate every stored blind index.
+func (kf *KeyFile) AddKey(keyID string) error {
+	if _, exists := kf.Keys[keyID]; exists {
+		return fmt.Errorf("encryption: key %q already exists", keyID)
+	}
+	key, err := generateKey()
+	if err != nil {
+		return err
+	}
+	if kf.Keys == nil {
+		kf.Keys = map[string]string{}
+	}
+	kf.Keys[keyID] = key
+	kf.Current = keyID
+	return nil
+}
+
+func generateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
@@ -0,0 +1,145 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/model"
+)
+
+// Op is a comparison or logical operator.
+type Op string
+
+const (
+	Eq      Op = "eq"
+	Ne      Op = "ne"
+	Gt      Op = "gt"
+	Ge      Op = "ge"
+	Lt      Op = "lt"
+	Le      Op = "le"
+	Sw      Op = "sw"
+	Ew      Op = "ew"
+	Co      Op = "co"
+	Present Op = "pr"
+	And     Op = "and"
+	Or      Op = "or"
+	Not     Op = "not"
+)
+
+// comparisons are the operators comparing a field with a literal, in the
+// order error messages list them.
+var comparisons = []Op{Eq, Ne, Gt, Ge, Lt, Le, Sw, Ew, Co, Present}
+
+// Expr is a node of a parsed filter.
+type Expr interface {
+	// Match reports whether u satisfies the expression.
+	Match(u *model.User) bool
+	// String formats the expression as a filter, fully parenthesized.
+	String() string
+}
+
+// Logical is the conjunction (And) or disjunction (Or) of two expressions.
+type Logical struct {
+	Op          Op
+	Left, Right Expr
+}
+
+func (e *Logical) Match(u *model.User) bool {
+	if e.Op == And {
+		return e.Left.Match(u) && e.Right.Match(u)
+	}
+	return e.Left.Match(u) || e.Right.Match(u)
+}
+
+func (e *Logical) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.Left, e.Op, e.Right)
+}
+
+// Negation matches the users X does not.
+type Negation struct {
+	X Expr
+}
+
+func (e *Negation) Match(u *model.User) bool {
+	return !e.X.Match(u)
+}
+
+func (e *Negation) String() string {
+	return fmt.Sprintf("(not %s)", e.X)
+}
+
+// Comparison compares a field with Value, a string, int or time.Time as
+// the field's Type requires. Value is unused by Present. Unset times
+// only match ne.
+type Comparison struct {
+	Field string
+	Op    Op
+	Value interface{}
+}
+
+func (e *Comparison) Match(u *model.User) bool {
+	f, ok := fields[e.Field]
+	if !ok {
+		return false
+	}
+	v, set := f.value(u)
+	if e.Op == Present {
+		return set && v != ""
+	}
+	if !set {
+		return e.Op == Ne
+	}
+	var c int
+	switch v := v.(type) {
+	case string:
+		lit, _ := e.Value.(string)
+		switch e.Op {
+		case Sw:
+			return strings.HasPrefix(v, lit)
+		case Ew:
+			return strings.HasSuffix(v, lit)
+		case Co:
+			return strings.Contains(v, lit)
+		}
+		c = strings.Compare(v, lit)
+	case int:
+		lit, _ := e.Value.(int)
+		switch {
+		case v < lit:
+			c = -1
+		case v > lit:
+			c = 1
+		}
+	case time.Time:
+		lit, _ := e.Value.(time.Time)
+		c = v.Compare(lit)
+	}
+	switch e.Op {
+	case Eq:
+		return c == 0
+	case Ne:
+		return c != 0
+	case Gt:
+		return c > 0
+	case Ge:
+		return c >= 0
+	case Lt:
+		return c < 0
+	case Le:
+		return c <= 0
+	}
+	return false
+}
+
+func (e *Comparison) String() string {
+	switch v := e.Value.(type) {
+	case string:
+		return fmt.Sprintf("%s %s %s", e.Field, e.Op, strconv.Quote(v))
+	case time.Time:
+		return fmt.Sprintf("%s %s %s", e.Field, e.Op, strconv.Quote(v.Format(time.RFC3339Nano)))
+	case nil:
+		return fmt.Sprintf("%s %s", e.Field, e.Op)
+	}
+	return fmt.Sprintf("%s %s %v", e.Field, e.Op, e.Value)
+}
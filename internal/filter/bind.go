@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/model"
+)
+
+// users is the language of filters over users. It binds field names to
+// the fields of model.User and type checks literals against them.
+var users = Language[Expr]{Binder: userBinder{}}
+
+type userBinder struct{}
+
+func (userBinder) Compare(attr, opToken, value Token) (Expr, error) {
+	op := opToken.Op()
+	name := strings.ToLower(attr.Text)
+	f, ok := fields[name]
+	if !ok {
+		return nil, Errorf(attr, "unknown field; fields are %s", strings.Join(Fields(), ", "))
+	}
+	if op == Present {
+		return &Comparison{Field: name, Op: op}, nil
+	}
+	if (op == Sw || op == Ew || op == Co) && f.typ != String {
+		return nil, Errorf(opToken, "%s only applies to strings, %s is %s", op, name, f.typ)
+	}
+	lit, err := literal(value, name, f.typ)
+	if err != nil {
+		return nil, err
+	}
+	if name == "state" && (op == Eq || op == Ne) && !model.UserState(lit.(string)).Valid() {
+		return nil, Errorf(value, "unknown state; states are %s, %s, %s and %s",
+			model.StatePending, model.StateActive, model.StateSuspended, model.StateDeactivated)
+	}
+	return &Comparison{Field: name, Op: op, Value: lit}, nil
+}
+
+func (userBinder) ValuePath(attr Token, x Expr) (Expr, error) {
+	return nil, Errorf(attr, "fields of users are single-valued and cannot be filtered with [")
+}
+
+func (userBinder) Logical(op Op, left, right Expr) Expr {
+	return &Logical{Op: op, Left: left, Right: right}
+}
+
+func (userBinder) Negate(x Expr) Expr {
+	return &Negation{X: x}
+}
+
+// literal returns the value of t, which must be a literal of type typ to
+// compare with the field name.
+func literal(t Token, name string, typ Type) (interface{}, error) {
+	switch {
+	case t.Kind == TokenEOF:
+		return nil, Errorf(t, "expected %s to compare %s with", typ, name)
+	case typ == Int && t.Kind == TokenNumber && !strings.ContainsAny(t.Text, ".eE"):
+		n, err := strconv.Atoi(t.Text)
+		if err != nil {
+			return nil, Errorf(t, "integer out of range")
+		}
+		return n, nil
+	case typ == String && t.Kind == TokenString:
+		return t.Text, nil
+	case typ == Time && t.Kind == TokenString:
+		at, err := time.Parse(time.RFC3339Nano, t.Text)
+		if err != nil {
+			return nil, Errorf(t, "%s is a time, in RFC 3339 format", name)
+		}
+		return at, nil
+	}
+	return nil, Errorf(t, "%s is %s", name, typ)
+}
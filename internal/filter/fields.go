@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"user-service/internal/model"
+)
+
+// Type is the type of a field, and of the literals it is compared with.
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Time
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "a string"
+	case Int:
+		return "an integer"
+	case Time:
+		return "a time"
+	}
+	return "unknown"
+}
+
+// field is a field of model.User filters can refer to.
+type field struct {
+	typ   Type
+	index []int
+}
+
+// fields are the fields of model.User by their JSON names. Fields left
+// out of JSON are not filterable.
+var fields = userFields()
+
+var timeType = reflect.TypeOf(&time.Time{})
+
+func userFields() map[string]field {
+	t := reflect.TypeOf(model.User{})
+	fields := make(map[string]field)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		f := field{index: sf.Index}
+		switch {
+		case sf.Type == timeType:
+			f.typ = Time
+		case sf.Type.Kind() == reflect.String:
+			f.typ = String
+		case sf.Type.Kind() == reflect.Int:
+			f.typ = Int
+		default:
+			panic(fmt.Sprintf("filter: field %s has unsupported type %s", sf.Name, sf.Type))
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// Fields returns the names of the fields filters can refer to, sorted.
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// value returns the value of f in u as a string, int or time.Time, and
+// false if it is an unset time.
+func (f field) value(u *model.User) (interface{}, bool) {
+	v := reflect.ValueOf(u).Elem().FieldByIndex(f.index)
+	switch f.typ {
+	case Time:
+		if v.IsNil() {
+			return nil, false
+		}
+		return *v.Interface().(*time.Time), true
+	case Int:
+		return int(v.Int()), true
+	}
+	return v.String(), true
+}
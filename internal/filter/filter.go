@@ -0,0 +1,66 @@
+// Package filter parses and evaluates filter expressions over users, such
+// as
+//
+//	age ge 18 and name sw "Al"
+//
+// An expression compares fields of model.User, named as in JSON, with
+// literals: eq, ne, gt, ge, lt and le compare any field, sw, ew and co
+// test whether a string starts with, ends with or contains another, and
+// pr tests whether a field is set. Comparisons combine with and, or, not
+// and parentheses. Strings are double quoted, times are strings in RFC
+// 3339 format and integers are bare. Comparisons are case-sensitive;
+// keywords are not.
+//
+// Expressions are type checked as they are parsed, so a parsed Expr
+// never fails to evaluate.
+//
+// The syntax is shared with other filter languages, such as SCIM's,
+// which bind it to their own attributes with a Language.
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits keeping filters cheap to parse.
+const (
+	MaxLength = 2048
+	MaxDepth  = 32
+)
+
+// Error is a filter that does not parse or type check, pointing at the
+// offending token.
+type Error struct {
+	Filter string
+	// Pos is the byte offset of Token in Filter.
+	Pos int
+	// Token is the offending token, or empty if the filter ended too soon.
+	Token string
+	Msg   string
+}
+
+// Error describes the problem on its first line, then marks the token
+// under a copy of the filter.
+func (e *Error) Error() string {
+	if e.Filter == "" {
+		return "invalid filter: " + e.Msg
+	}
+	at := "at the end"
+	if e.Token != "" {
+		at = fmt.Sprintf("at %q (offset %d)", e.Token, e.Pos)
+	}
+	width := utf8.RuneCountInString(e.Token)
+	if width == 0 {
+		width = 1
+	}
+	return fmt.Sprintf("invalid filter %s: %s\n%s\n%s%s", at, e.Msg, e.Filter,
+		strings.Repeat(" ", utf8.RuneCountInString(e.Filter[:e.Pos])), strings.Repeat("^", width))
+}
+
+// Parse parses and type checks the filter s over users. Errors are
+// *Error.
+func Parse(s string) (Expr, error) {
+	return users.Parse(s)
+}
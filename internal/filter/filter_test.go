@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`age ge 18 and name sw "Al"`, `(age ge 18 and name sw "Al")`},
+		{`a eq 1`, ""},
+		{`age ge 18 or age lt 10 and name pr`, `(age ge 18 or (age lt 10 and name pr))`},
+		{`NOT (state EQ "active" or state eq "pending")`, `(not (state eq "active" or state eq "pending"))`},
+		{`email co "\"q\"" and age ne -1`, `(email co "\"q\"" and age ne -1)`},
+		{`created_at gt "2024-01-02T03:04:05Z"`, `created_at gt "2024-01-02T03:04:05Z"`},
+	}
+	for _, tt := range tests {
+		expr, err := Parse(tt.filter)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.filter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.filter, err)
+			continue
+		}
+		if got := expr.String(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.filter, tt.want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		filter string
+		pos    int
+		token  string
+		msg    string
+	}{
+		{`nme sw "Al"`, 0, "nme", "unknown field"},
+		{`age ge 18 and`, 13, "", `expected a field or "("`},
+		{`age sw "1"`, 4, "sw", "only applies to strings"},
+		{`age ge "18"`, 7, `"18"`, "age is an integer"},
+		{`name eq 18`, 8, "18", "name is a string"},
+		{`state eq "actve"`, 9, `"actve"`, "unknown state"},
+		{`created_at lt "yesterday"`, 14, `"yesterday"`, "RFC 3339"},
+		{`age is 18`, 4, "is", "expected an operator"},
+		{`(age gt 1`, 9, "", `expected ")" to close the "(" at offset 0`},
+		{`age gt 1 name pr`, 9, "name", `expected "and", "or"`},
+		{`name eq "Al`, 8, `"Al`, "unterminated string"},
+		{`name eq 'Al'`, 8, "'", "unexpected character"},
+		{`age gt 18x`, 7, "18x", "invalid number"},
+		{`age gt 1.5`, 7, "1.5", "age is an integer"},
+		{`name[age gt 1]`, 0, "name", "single-valued"},
+		{`age gt 1]`, 8, "]", `expected "and", "or"`},
+		{`age gt 99999999999999999999`, 7, "99999999999999999999", "out of range"},
+		{strings.Repeat("not ", MaxDepth+1) + "name pr", 4 * MaxDepth, "not", "nested"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.filter)
+		var fe *Error
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: expected an *Error, got %v", tt.filter, err)
+			continue
+		}
+		if fe.Pos != tt.pos || fe.Token != tt.token || !strings.Contains(fe.Msg, tt.msg) {
+			t.Errorf("%s: expected %q at %d with %q, got %q at %d with %q", tt.filter, tt.token, tt.pos, tt.msg, fe.Token, fe.Pos, fe.Msg)
+		}
+	}
+
+	_, err := Parse(`age ge 18 and nme sw "Al"`)
+	want := "invalid filter at \"nme\" (offset 14): unknown field; fields are " + strings.Join(Fields(), ", ") +
+		"\nage ge 18 and nme sw \"Al\"\n              ^^^"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected the token marked\n%s\ngot\n%v", want, err)
+	}
+	if _, err := Parse(strings.Repeat(" ", MaxLength+1)); err == nil {
+		t.Error("expected an overlong filter to be rejected")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	alice := &model.User{Email: "alice@example.com", Name: "Alice", Age: 30, State: model.StateActive, CreatedAt: &created}
+	bob := &model.User{Email: "bob@example.org", Name: "Bob", Age: 17, State: model.StatePending}
+
+	tests := []struct {
+		filter     string
+		alice, bob bool
+	}{
+		{`age ge 18 and name sw "Al"`, true, false},
+		{`age lt 18 or email ew ".com"`, true, true},
+		{`not state eq "active"`, false, true},
+		{`name co "o"`, false, true},
+		{`name sw "al"`, false, false},
+		{`created_at pr`, true, false},
+		{`state_reason pr`, false, false},
+		{`created_at ge "2024-01-02T00:00:00Z"`, true, false},
+		{`created_at ne "2024-01-01T00:00:00+01:00"`, true, true},
+		{`email gt "b"`, false, true},
+	}
+	for _, tt := range tests {
+		expr, err := Parse(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+		if got := expr.Match(alice); got != tt.alice {
+			t.Errorf("%s: expected %v for alice, got %v", tt.filter, tt.alice, got)
+		}
+		if got := expr.Match(bob); got != tt.bob {
+			t.Errorf("%s: expected %v for bob, got %v", tt.filter, tt.bob, got)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	got := strings.Join(Fields(), ",")
+	if !strings.Contains(got, "age,created_at") || strings.Contains(got, "password") || strings.Contains(got, "version") {
+		t.Errorf("expected the JSON fields of users, got %s", got)
+	}
+}
@@ -0,0 +1,135 @@
+package filter
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenKind is the kind of a Token.
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenWord
+	TokenString
+	TokenNumber
+	TokenLParen
+	TokenRParen
+	TokenLBracket
+	TokenRBracket
+)
+
+// Token is a lexeme of a filter and its byte offset. Words are field
+// names, attribute paths, operators and keywords. The Text of strings is
+// unquoted; Raw is as written.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Raw  string
+	Pos  int
+}
+
+// Op returns the operator or keyword t is, in lower case.
+func (t Token) Op() Op {
+	return Op(strings.ToLower(t.Text))
+}
+
+var brackets = map[rune]TokenKind{'(': TokenLParen, ')': TokenRParen, '[': TokenLBracket, ']': TokenRBracket}
+
+// lex splits s into tokens, ending with TokenEOF.
+func lex(s string) ([]Token, error) {
+	var tokens []Token
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch kind, ok := brackets[r]; {
+		case unicode.IsSpace(r):
+			i += size
+		case ok:
+			tokens = append(tokens, Token{Kind: kind, Text: s[i : i+1], Raw: s[i : i+1], Pos: i})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, &Error{Filter: s, Pos: i, Token: s[i:], Msg: "unterminated string"}
+			}
+			raw := s[i : end+1]
+			text, err := strconv.Unquote(raw)
+			if err != nil {
+				return nil, &Error{Filter: s, Pos: i, Token: raw, Msg: "invalid escape in string"}
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Text: text, Raw: raw, Pos: i})
+			i = end + 1
+		case r == '-' || isDigit(r):
+			end := number(s, i)
+			if end < len(s) && isWordRune(s[end:]) {
+				for end < len(s) && isWordRune(s[end:]) {
+					end++
+				}
+				return nil, &Error{Filter: s, Pos: i, Token: s[i:end], Msg: "invalid number"}
+			}
+			if end == i+1 && r == '-' {
+				return nil, &Error{Filter: s, Pos: i, Token: "-", Msg: "invalid number"}
+			}
+			tokens = append(tokens, Token{Kind: TokenNumber, Text: s[i:end], Raw: s[i:end], Pos: i})
+			i = end
+		case isWordRune(s[i:]):
+			end := i
+			for end < len(s) && isWordRune(s[end:]) {
+				_, n := utf8.DecodeRuneInString(s[end:])
+				end += n
+			}
+			tokens = append(tokens, Token{Kind: TokenWord, Text: s[i:end], Raw: s[i:end], Pos: i})
+			i = end
+		default:
+			return nil, &Error{Filter: s, Pos: i, Token: string(r), Msg: "unexpected character"}
+		}
+	}
+	return append(tokens, Token{Kind: TokenEOF, Pos: len(s)}), nil
+}
+
+// number returns the end of the number starting at s[i]: an optional
+// sign, digits, and an optional fraction and exponent.
+func number(s string, i int) int {
+	end := digits(s, i+1)
+	if end+1 < len(s) && s[end] == '.' && isDigit(rune(s[end+1])) {
+		end = digits(s, end+1)
+	}
+	if end+1 < len(s) && (s[end] == 'e' || s[end] == 'E') {
+		exp := end + 1
+		if s[exp] == '+' || s[exp] == '-' {
+			exp++
+		}
+		if exp < len(s) && isDigit(rune(s[exp])) {
+			end = digits(s, exp)
+		}
+	}
+	return end
+}
+
+// digits returns the end of the run of digits starting at s[i].
+func digits(s string, i int) int {
+	for i < len(s) && isDigit(rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// isWordRune reports whether s starts with a rune of a word. Besides
+// letters, digits and underscores, words may hold the dots, colons,
+// hyphens and dollar signs of URN-qualified attribute paths.
+func isWordRune(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:-$", r)
+}
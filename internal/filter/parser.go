@@ -0,0 +1,234 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Binder builds the expressions of a filter language, of type E, as its
+// filters are parsed. Compare and ValuePath bind attributes to what they
+// name and type check what they are compared with; they report problems
+// with Errorf.
+type Binder[E any] interface {
+	// Compare returns the comparison of the attribute attr with the
+	// literal value by the operator op, one of the comparisons. value is
+	// the zero Token for Present, and whatever token followed op
+	// otherwise.
+	Compare(attr, op, value Token) (E, error)
+	// ValuePath returns the expression matching users with an element of
+	// the multi-valued attribute attr that matches x, as in
+	// emails[type eq "work"].
+	ValuePath(attr Token, x E) (E, error)
+	// Logical returns the conjunction (And) or disjunction (Or) of left
+	// and right.
+	Logical(op Op, left, right E) E
+	// Negate returns the negation of x.
+	Negate(x E) E
+}
+
+// Language is a filter language: the syntax every filter shares, bound
+// to expressions by Binder. Languages vary only in what their attributes
+// name and how comparisons with them are typed.
+type Language[E any] struct {
+	Binder Binder[E]
+	// GroupedNot requires the operand of "not" to be parenthesized, as
+	// SCIM does.
+	GroupedNot bool
+}
+
+// Errorf returns an *Error pointing at t, for a Binder to report a
+// comparison that does not bind or type check.
+func Errorf(t Token, format string, args ...interface{}) error {
+	return &Error{Pos: t.Pos, Token: t.Raw, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses s and binds it. Errors are *Error.
+func (l Language[E]) Parse(s string) (E, error) {
+	var zero E
+	if len(s) > MaxLength {
+		return zero, &Error{Msg: fmt.Sprintf("longer than %d bytes", MaxLength)}
+	}
+	tokens, err := lex(s)
+	if err != nil {
+		return zero, err
+	}
+	p := &parser[E]{lang: l, src: s, tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return zero, p.locate(err)
+	}
+	if t := p.peek(); t.Kind != TokenEOF {
+		return zero, p.errorf(t, `expected "and", "or" or the end of the filter`)
+	}
+	return expr, nil
+}
+
+// parser is a recursive descent parser over the grammar
+//
+//	or         = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" or ")" | comparison
+//	comparison = attr "pr" | attr op literal | attr "[" or "]"
+//
+// except that languages with GroupedNot only allow "not" "(" or ")".
+type parser[E any] struct {
+	lang   Language[E]
+	src    string
+	tokens []Token
+	i      int
+	depth  int
+}
+
+func (p *parser[E]) peek() Token {
+	return p.tokens[p.i]
+}
+
+func (p *parser[E]) next() Token {
+	t := p.tokens[p.i]
+	if t.Kind != TokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// keyword reports whether t is the keyword k, in any case.
+func keyword(t Token, k Op) bool {
+	return t.Kind == TokenWord && strings.EqualFold(t.Text, string(k))
+}
+
+func (p *parser[E]) errorf(t Token, format string, args ...interface{}) *Error {
+	return &Error{Filter: p.src, Pos: t.Pos, Token: t.Raw, Msg: fmt.Sprintf(format, args...)}
+}
+
+// locate sets the filter of errors from the Binder.
+func (p *parser[E]) locate(err error) error {
+	var fe *Error
+	if errors.As(err, &fe) && fe.Filter == "" {
+		fe.Filter = p.src
+	}
+	return err
+}
+
+func (p *parser[E]) or() (E, error) {
+	return p.logical(Or, p.and)
+}
+
+func (p *parser[E]) and() (E, error) {
+	return p.logical(And, p.unary)
+}
+
+// logical parses operands joined by op, grouping them to the left.
+func (p *parser[E]) logical(op Op, operand func() (E, error)) (E, error) {
+	left, err := operand()
+	if err != nil {
+		return left, err
+	}
+	for keyword(p.peek(), op) {
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return right, err
+		}
+		left = p.lang.Binder.Logical(op, left, right)
+	}
+	return left, nil
+}
+
+// nest counts a level of nesting at t until the returned func is called.
+func (p *parser[E]) nest(t Token) (func(), error) {
+	if p.depth++; p.depth > MaxDepth {
+		return nil, p.errorf(t, "nested more than %d deep", MaxDepth)
+	}
+	return func() { p.depth-- }, nil
+}
+
+func (p *parser[E]) unary() (E, error) {
+	var zero E
+	t := p.peek()
+	switch {
+	case keyword(t, Not):
+		done, err := p.nest(t)
+		if err != nil {
+			return zero, err
+		}
+		defer done()
+		p.next()
+		if p.lang.GroupedNot && p.peek().Kind != TokenLParen {
+			return zero, p.errorf(p.peek(), `expected "(" after not`)
+		}
+		x, err := p.unary()
+		if err != nil {
+			return zero, err
+		}
+		return p.lang.Binder.Negate(x), nil
+	case t.Kind == TokenLParen:
+		done, err := p.nest(t)
+		if err != nil {
+			return zero, err
+		}
+		defer done()
+		p.next()
+		x, err := p.or()
+		if err != nil {
+			return zero, err
+		}
+		if closing := p.next(); closing.Kind != TokenRParen {
+			return zero, p.errorf(closing, `expected ")" to close the "(" at offset %d`, t.Pos)
+		}
+		return x, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser[E]) comparison() (E, error) {
+	var zero E
+	attr := p.next()
+	if attr.Kind != TokenWord || keyword(attr, And) || keyword(attr, Or) {
+		return zero, p.errorf(attr, `expected a field or "("`)
+	}
+
+	if open := p.peek(); open.Kind == TokenLBracket {
+		done, err := p.nest(open)
+		if err != nil {
+			return zero, err
+		}
+		defer done()
+		p.next()
+		x, err := p.or()
+		if err != nil {
+			return zero, err
+		}
+		if closing := p.next(); closing.Kind != TokenRBracket {
+			return zero, p.errorf(closing, `expected "]" to close the "[" at offset %d`, open.Pos)
+		}
+		return p.lang.Binder.ValuePath(attr, x)
+	}
+
+	op := p.next()
+	if op.Kind != TokenWord || !isComparison(op.Op()) {
+		return zero, p.errorf(op, "expected an operator after %s: %s", attr.Text, opList())
+	}
+	var value Token
+	if op.Op() != Present {
+		value = p.next()
+	}
+	return p.lang.Binder.Compare(attr, op, value)
+}
+
+func isComparison(op Op) bool {
+	for _, c := range comparisons {
+		if op == c {
+			return true
+		}
+	}
+	return false
+}
+
+func opList() string {
+	names := make([]string, len(comparisons))
+	for i, op := range comparisons {
+		names[i] = string(op)
+	}
+	return strings.Join(names, ", ")
+}
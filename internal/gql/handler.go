@@ -0,0 +1,224 @@
+package gql
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"user-service/internal/service"
+	"user-service/pkg/logger"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"go.uber.org/zap"
+)
+
+// Handler serves GraphQL queries over HTTP. Queries are accepted with GET
+// and POST, mutations only with POST.
+type Handler struct {
+	schema  graphql.Schema
+	groups  service.GroupService
+	limits  Limits
+	limiter RateLimiter
+	logger  *zap.Logger
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithLimits overrides DefaultLimits.
+func WithLimits(l Limits) Option {
+	return func(h *Handler) { h.limits = l }
+}
+
+// RateLimiter takes tokens from per-client buckets, as
+// handler.RateLimiter does.
+type RateLimiter interface {
+	AllowRequest(r *http.Request, route string, n int) (bool, time.Duration)
+}
+
+// MutationRoute is the route each mutation field takes a token for, on
+// top of the one every request to /graphql takes, so that clients cannot
+// create users faster through GraphQL than with POST /users, however many
+// aliased mutations they batch into one request.
+const MutationRoute = "POST /graphql mutation"
+
+// WithRateLimiter limits mutations with l, under MutationRoute.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(h *Handler) { h.limiter = l }
+}
+
+func NewHandler(users service.UserService, groups service.GroupService, logger *zap.Logger, opts ...Option) (*Handler, error) {
+	schema, err := NewSchema(users, groups)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{schema: schema, groups: groups, limits: DefaultLimits(), logger: logger}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// Request is a GraphQL request, sent as a JSON body or as GET query
+// parameters.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				h.write(w, r, http.StatusBadRequest, errorResult("Invalid variables"))
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.write(w, r, http.StatusBadRequest, errorResult("Invalid request payload"))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		h.write(w, r, http.StatusBadRequest, errorResult("query is required"))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		h.write(w, r, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if v := graphql.ValidateDocument(&h.schema, doc, nil); !v.IsValid {
+		h.write(w, r, http.StatusBadRequest, &graphql.Result{Errors: v.Errors})
+		return
+	}
+	operation := findOperation(doc, req.OperationName)
+	if operation == nil {
+		h.write(w, r, http.StatusBadRequest, errorResult("Unknown operation"))
+		return
+	}
+	if operation.Operation != ast.OperationTypeQuery && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		h.write(w, r, http.StatusMethodNotAllowed, errorResult("Mutations must be sent with POST"))
+		return
+	}
+	if err := h.limits.check(doc, operation, req.Variables); err != nil {
+		h.write(w, r, http.StatusBadRequest, errorResult(err))
+		return
+	}
+	if operation.Operation == ast.OperationTypeMutation && h.limiter != nil {
+		if ok, wait := h.limiter.AllowRequest(r, MutationRoute, rootFields(doc, operation)); !ok {
+			retry := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+			w.Header().Set("Retry-After", retry)
+			h.write(w, r, http.StatusTooManyRequests, errorResult(&Error{
+				Message: "Rate limit exceeded, retry in " + retry + " seconds",
+				Code:    CodeRateLimited,
+			}))
+			return
+		}
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoader(r.Context(), newGroupLoader(h.groups)),
+	})
+	for i, e := range result.Errors {
+		gqlErr := resolverError(e)
+		if gqlErr == nil {
+			continue
+		}
+		result.Errors[i].Extensions = gqlErr.Extensions()
+		if gqlErr.cause != nil {
+			h.log(r).Error("Failed to resolve GraphQL field", zap.Any("path", e.Path), zap.Error(gqlErr.cause))
+		}
+	}
+	h.write(w, r, http.StatusOK, result)
+}
+
+// findOperation returns the operation named name, or the only operation
+// when name is empty.
+func findOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+	return found
+}
+
+// resolverError returns the *Error a resolver failed with, which the
+// executor wraps differently depending on where it was returned.
+func resolverError(err error) *Error {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			return e
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// errorResult returns a result holding a single error, which is either a
+// message or an *Error.
+func errorResult(err interface{}) *graphql.Result {
+	var formatted gqlerrors.FormattedError
+	switch err := err.(type) {
+	case *Error:
+		formatted = gqlerrors.FormatError(err)
+		formatted.Extensions = err.Extensions()
+	case string:
+		formatted = gqlerrors.NewFormattedError(err)
+	}
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}}
+}
+
+// log returns the request's logger, falling back to the handler's.
+func (h *Handler) log(r *http.Request) *zap.Logger {
+	return logger.FromContext(r.Context(), h.logger)
+}
+
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+	}
+}
@@ -0,0 +1,365 @@
+package gql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+// countingGroupRepo counts batched membership lookups.
+type countingGroupRepo struct {
+	repository.GroupRepository
+	batches int
+}
+
+func (r *countingGroupRepo) ListByMembers(ctx context.Context, emails []string) (map[string][]*model.Group, error) {
+	r.batches++
+	return r.GroupRepository.ListByMembers(ctx, emails)
+}
+
+func setupGraphQL(t *testing.T, opts ...Option) (*Handler, *countingGroupRepo) {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	userRepo := repository.NewUserRepository(db)
+	groupRepo := &countingGroupRepo{GroupRepository: repository.NewGroupRepository(db)}
+	users := service.NewUserService(userRepo)
+	groups := service.NewGroupService(groupRepo, userRepo)
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		user := &model.User{Email: fmt.Sprintf("user%d@example.com", i), Name: fmt.Sprintf("User %d", i), Age: 20 + i}
+		if err := users.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	if _, err := users.TransitionUser(ctx, "user2@example.com", model.StateActive, ""); err != nil {
+		t.Fatalf("TransitionUser failed: %v", err)
+	}
+	for _, g := range []*model.Group{
+		{DisplayName: "Admins", Members: []string{"user1@example.com", "user2@example.com"}},
+		{DisplayName: "Ops", Members: []string{"user2@example.com"}},
+	} {
+		if err := groups.CreateGroup(ctx, g); err != nil {
+			t.Fatalf("CreateGroup failed: %v", err)
+		}
+	}
+	h, err := NewHandler(users, groups, zaptest.NewLogger(t), opts...)
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	return h, groupRepo
+}
+
+type response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func post(t *testing.T, h http.Handler, query string, vars map[string]interface{}) (int, response) {
+	t.Helper()
+	body, _ := json.Marshal(Request{Query: query, Variables: vars})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+	var res response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, res
+}
+
+func TestGraphQLUsersConnection(t *testing.T) {
+	h, _ := setupGraphQL(t)
+	query := `query($first: Int, $after: String, $last: Int, $before: String) {
+		users(first: $first, after: $after, last: $last, before: $before) {
+			totalCount
+			edges { cursor node { email } }
+			pageInfo { hasNextPage hasPreviousPage startCursor endCursor }
+		}
+	}`
+	page := func(vars map[string]interface{}) ([]string, map[string]interface{}) {
+		code, res := post(t, h, query, vars)
+		if code != http.StatusOK || len(res.Errors) > 0 {
+			t.Fatalf("unexpected response %d: %+v", code, res)
+		}
+		conn := res.Data["users"].(map[string]interface{})
+		var emails []string
+		for _, e := range conn["edges"].([]interface{}) {
+			emails = append(emails, e.(map[string]interface{})["node"].(map[string]interface{})["email"].(string))
+		}
+		return emails, conn["pageInfo"].(map[string]interface{})
+	}
+
+	emails, info := page(map[string]interface{}{"first": 2})
+	if fmt.Sprint(emails) != "[user1@example.com user2@example.com]" || info["hasNextPage"] != true || info["hasPreviousPage"] != false {
+		t.Fatalf("unexpected first page %v %v", emails, info)
+	}
+	emails, info = page(map[string]interface{}{"first": 2, "after": info["endCursor"]})
+	if fmt.Sprint(emails) != "[user3@example.com user4@example.com]" || info["hasNextPage"] != true || info["hasPreviousPage"] != true {
+		t.Fatalf("unexpected second page %v %v", emails, info)
+	}
+	emails, info = page(map[string]interface{}{"last": 2, "before": info["startCursor"]})
+	if fmt.Sprint(emails) != "[user1@example.com user2@example.com]" || info["hasPreviousPage"] != false {
+		t.Fatalf("unexpected page before the second %v %v", emails, info)
+	}
+
+	_, res := post(t, h, query, map[string]interface{}{"after": "bogus"})
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeBadUserInput {
+		t.Errorf("expected BAD_USER_INPUT for an invalid cursor, got %+v", res.Errors)
+	}
+	_, res = post(t, h, query, map[string]interface{}{"first": 500})
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeBadUserInput {
+		t.Errorf("expected BAD_USER_INPUT for first over the maximum, got %+v", res.Errors)
+	}
+}
+
+func TestGraphQLFilterAndBatchedGroups(t *testing.T) {
+	h, groups := setupGraphQL(t)
+
+	_, res := post(t, h, `{ users(filter: {minAge: 22, maxAge: 24}) { nodes { email state groups { displayName } } } }`, nil)
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors %+v", res.Errors)
+	}
+	nodes := res.Data["users"].(map[string]interface{})["nodes"].([]interface{})
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 users aged 22 to 24, got %v", nodes)
+	}
+	first := nodes[0].(map[string]interface{})
+	if first["email"] != "user2@example.com" || first["state"] != "ACTIVE" || len(first["groups"].([]interface{})) != 2 {
+		t.Errorf("unexpected user %v", first)
+	}
+	if groups.batches != 1 {
+		t.Errorf("expected groups of all users to load in 1 batch, got %d", groups.batches)
+	}
+
+	_, res = post(t, h, `{ users(filter: {state: ACTIVE, nameContains: "User"}) { totalCount } }`, nil)
+	if res.Data["users"].(map[string]interface{})["totalCount"] != 1.0 {
+		t.Errorf("expected 1 active user, got %+v", res)
+	}
+	_, res = post(t, h, `{ users(filter: {minAge: 22, expression: "not name ew \"3\""}) { totalCount } }`, nil)
+	if len(res.Errors) > 0 || res.Data["users"].(map[string]interface{})["totalCount"] != 3.0 {
+		t.Errorf("expected 3 users aged 22 or more not named User 3, got %+v", res)
+	}
+	_, res = post(t, h, `{ users(filter: {expression: "age sw \"2\""}) { totalCount } }`, nil)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeBadUserInput {
+		t.Errorf("expected BAD_USER_INPUT for an invalid expression, got %+v", res.Errors)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	h, _ := setupGraphQL(t)
+
+	_, res := post(t, h, `mutation { createUser(input: {email: "new@example.com", name: "New", age: 40}) { email name state } }`, nil)
+	if len(res.Errors) > 0 || res.Data["createUser"].(map[string]interface{})["state"] != "PENDING" {
+		t.Fatalf("unexpected createUser response %+v", res)
+	}
+	_, res = post(t, h, `mutation { createUser(input: {email: "new@example.com"}) { email } }`, nil)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeAlreadyExists {
+		t.Errorf("expected ALREADY_EXISTS, got %+v", res.Errors)
+	}
+
+	_, res = post(t, h, `mutation($email: String!) { updateUser(email: $email, input: {age: 41}) { name age } }`,
+		map[string]interface{}{"email": "new@example.com"})
+	updated := res.Data["updateUser"].(map[string]interface{})
+	if updated["name"] != "New" || updated["age"] != 41.0 {
+		t.Errorf("expected a partial update keeping the name, got %v", updated)
+	}
+
+	_, res = post(t, h, `mutation { deleteUser(email: "new@example.com") }`, nil)
+	if res.Data["deleteUser"] != true {
+		t.Errorf("unexpected deleteUser response %+v", res)
+	}
+	_, res = post(t, h, `{ user(email: "new@example.com") { email } }`, nil)
+	if res.Data["user"] != nil || len(res.Errors) > 0 {
+		t.Errorf("expected null for a deleted user, got %+v", res)
+	}
+	_, res = post(t, h, `mutation { updateUser(email: "new@example.com", input: {age: 1}) { email } }`, nil)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeNotFound {
+		t.Errorf("expected NOT_FOUND, got %+v", res.Errors)
+	}
+
+	q := url.Values{"query": {`mutation { deleteUser(email: "user1@example.com") }`}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/graphql?"+q.Encode(), nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405 Method Not Allowed for a mutation over GET, got %d", w.Code)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	h, _ := setupGraphQL(t, WithLimits(Limits{MaxDepth: 4, MaxComplexity: 100}))
+
+	code, res := post(t, h, `{ users(first: 10) { edges { node { email groups { id } } } } }`, nil)
+	if code != http.StatusBadRequest || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeLimitExceeded {
+		t.Errorf("expected depth 5 to be rejected, got %d %+v", code, res.Errors)
+	}
+	code, _ = post(t, h, `{ users(first: 10) { nodes { email groups { id } } } }`, nil)
+	if code != http.StatusOK {
+		t.Errorf("expected depth 4 with complexity 41 to be allowed, got %d", code)
+	}
+	// Fragments count towards depth and the page size multiplies cost.
+	code, res = post(t, h, `query($n: Int) { users(first: $n) { ...page } } fragment page on UserConnection { nodes { email name groups { id } } }`,
+		map[string]interface{}{"n": 50})
+	if code != http.StatusBadRequest || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeLimitExceeded {
+		t.Errorf("expected complexity over 100 to be rejected, got %d %+v", code, res.Errors)
+	}
+	// Introspection is deeper than queries over users, and has its own
+	// depth limit
+	code, _ = post(t, h, `{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`, nil)
+	if code != http.StatusOK {
+		t.Errorf("expected introspection within its depth limit to be allowed, got %d", code)
+	}
+	h, _ = setupGraphQL(t, WithLimits(Limits{MaxDepth: 4, MaxIntrospectionDepth: 6, MaxComplexity: 100}))
+	code, res = post(t, h, `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`, nil)
+	if code != http.StatusBadRequest || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeLimitExceeded {
+		t.Errorf("expected introspection depth 7 to be rejected, got %d %+v", code, res.Errors)
+	}
+	code, res = post(t, h, `{ __schema { types { name fields { name } } } __type(name: "User") { name } }`, nil)
+	if code != http.StatusOK {
+		t.Errorf("expected introspection depth 4 to be allowed, got %d %+v", code, res.Errors)
+	}
+	code, res = post(t, h, `{ a: users(first: 20) { totalCount } b: users(first: 20) { totalCount } __typename }`, nil)
+	if code != http.StatusOK {
+		t.Errorf("expected complexity 43 to be allowed, got %d %+v", code, res.Errors)
+	}
+	code, res = post(t, h, `{ __schema { types { name description kind fields { name description args { name description } } } } `+
+		strings.Repeat(`__typename `, 100)+`}`, nil)
+	if code != http.StatusBadRequest || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeLimitExceeded {
+		t.Errorf("expected introspection to count towards complexity, got %d %+v", code, res.Errors)
+	}
+
+	code, res = post(t, h, `{ users { bogus } }`, nil)
+	if code != http.StatusBadRequest || len(res.Errors) == 0 {
+		t.Errorf("expected status 400 Bad Request for an invalid query, got %d", code)
+	}
+}
+
+// fakeLimiter records the routes it is asked about and the tokens asked
+// for, and allows requests while allow is set.
+type fakeLimiter struct {
+	allow  bool
+	routes []string
+	tokens []int
+}
+
+func (l *fakeLimiter) AllowRequest(r *http.Request, route string, n int) (bool, time.Duration) {
+	l.routes = append(l.routes, route)
+	l.tokens = append(l.tokens, n)
+	return l.allow, 1500 * time.Millisecond
+}
+
+func TestGraphQLMutationRateLimit(t *testing.T) {
+	limiter := &fakeLimiter{}
+	h, _ := setupGraphQL(t, WithRateLimiter(limiter))
+
+	if code, _ := post(t, h, `{ user(email: "user1@example.com") { email } }`, nil); code != http.StatusOK || len(limiter.routes) != 0 {
+		t.Errorf("expected queries not to take mutation tokens, got %d %v", code, limiter.routes)
+	}
+
+	body, _ := json.Marshal(Request{Query: `mutation { createUser(input: {email: "new@example.com", name: "New", age: 40}) { email } }`})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", bytes.NewReader(body)))
+	var res response
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeRateLimited {
+		t.Errorf("expected 429 with RATE_LIMITED, got %d %q %+v", w.Code, w.Header().Get("Retry-After"), res.Errors)
+	}
+	if len(limiter.routes) != 1 || limiter.routes[0] != MutationRoute {
+		t.Errorf("expected a token taken for %s, got %v", MutationRoute, limiter.routes)
+	}
+	if _, res := post(t, h, `{ user(email: "new@example.com") { email } }`, nil); res.Data["user"] != nil {
+		t.Errorf("expected the limited mutation not to run, got %+v", res.Data)
+	}
+
+	limiter.allow = true
+	if _, res := post(t, h, `mutation { createUser(input: {email: "new@example.com", name: "New", age: 40}) { email } }`, nil); len(res.Errors) > 0 {
+		t.Errorf("expected the mutation to run once allowed, got %+v", res.Errors)
+	}
+}
+
+func TestGraphQLMutationBatchRateLimit(t *testing.T) {
+	limiter := &fakeLimiter{allow: true}
+	h, _ := setupGraphQL(t, WithRateLimiter(limiter), WithLimits(Limits{MaxMutations: 3}))
+
+	// Aliased mutations each take a token, those in fragments included
+	batch := `mutation {
+		a: createUser(input: {email: "a@example.com", name: "A", age: 20}) { email }
+		b: createUser(input: {email: "b@example.com", name: "B", age: 20}) { email }
+		... on Mutation { c: deleteUser(email: "a@example.com") }
+		__typename
+	}`
+	if code, res := post(t, h, batch, nil); code != http.StatusOK || len(res.Errors) > 0 {
+		t.Fatalf("expected the batch to run, got %d %+v", code, res.Errors)
+	}
+	if len(limiter.tokens) != 1 || limiter.tokens[0] != 3 {
+		t.Errorf("expected 3 tokens taken at once, got %v", limiter.tokens)
+	}
+
+	limiter.allow = false
+	if code, res := post(t, h, batch, nil); code != http.StatusTooManyRequests || res.Data["b"] != nil {
+		t.Errorf("expected the limited batch not to run, got %d %+v", code, res.Data)
+	}
+
+	var aliases strings.Builder
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(&aliases, "d%d: deleteUser(email: \"b@example.com\") ", i)
+	}
+	code, res := post(t, h, "mutation { "+aliases.String()+"}", nil)
+	if code != http.StatusBadRequest || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != CodeLimitExceeded {
+		t.Errorf("expected 400 LIMIT_EXCEEDED for 4 mutations, got %d %+v", code, res.Errors)
+	}
+	if len(limiter.tokens) != 2 {
+		t.Errorf("expected rejected batches not to take tokens, got %v", limiter.tokens)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		query              string
+		depth              int
+		introspectionDepth int
+		complexity         int
+	}{
+		{`{ user(email: "a") { email } }`, 2, 0, 2},
+		{`{ users { totalCount } }`, 2, 0, 1 + DefaultPageSize},
+		{`{ users(first: 3) { nodes { email groups { id } } } }`, 4, 0, 1 + 3*4},
+		{`{ a: user(email: "a") { email } b: user(email: "b") { ... on User { name } } }`, 2, 0, 4},
+		{`{ user(email: "a") { __typename } __type(name: "User") { fields { type { name } } } }`, 1, 4, 2 + 4},
+	}
+	for _, tt := range tests {
+		doc := mustParse(t, tt.query)
+		depth, introspectionDepth, complexity := measure(doc, findOperation(doc, ""), nil)
+		if depth != tt.depth || introspectionDepth != tt.introspectionDepth || complexity != tt.complexity {
+			t.Errorf("%s: got depths %d and %d and complexity %d, want %d and %d and %d", tt.query,
+				depth, introspectionDepth, complexity, tt.depth, tt.introspectionDepth, tt.complexity)
+		}
+	}
+}
+
+func mustParse(t *testing.T, query string) *ast.Document {
+	t.Helper()
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", query, err)
+	}
+	return doc
+}
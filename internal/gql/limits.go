@@ -0,0 +1,201 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound the cost of a query, checked before it runs. Zero disables
+// a limit.
+type Limits struct {
+	// MaxDepth is how deeply fields may be nested.
+	MaxDepth int
+	// MaxIntrospectionDepth replaces MaxDepth for fields within
+	// introspection fields, such as __schema, whose type references nest
+	// deeper than any query over users needs.
+	MaxIntrospectionDepth int
+	// MaxComplexity bounds the number of fields a query may resolve. Each
+	// field costs 1, introspection fields included, and the fields selected
+	// under a paged field count once per requested item.
+	MaxComplexity int
+	// MaxMutations bounds the mutation fields, aliases included, an
+	// operation may hold. Each takes its own MutationRoute token.
+	MaxMutations int
+}
+
+// DefaultLimits admits any reasonable query, including the introspection
+// query of GraphQL clients.
+func DefaultLimits() Limits {
+	return Limits{MaxDepth: 10, MaxIntrospectionDepth: 15, MaxComplexity: 5000, MaxMutations: 10}
+}
+
+// pagedFields are the fields whose selections are multiplied by the page
+// size, DefaultPageSize when first and last are left out.
+var pagedFields = map[string]bool{"users": true}
+
+// measure returns the depth of operation outside and within introspection
+// fields, and its complexity, resolving fragments and variables.
+func measure(doc *ast.Document, operation *ast.OperationDefinition, vars map[string]interface{}) (depth, introspectionDepth, complexity int) {
+	m := &measurer{fragments: make(map[string]*ast.FragmentDefinition), vars: vars, visiting: make(map[string]bool)}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			m.fragments[frag.Name.Value] = frag
+		}
+	}
+	complexity = m.selectionSet(operation.SelectionSet, 0, false)
+	return m.depth, m.introspectionDepth, complexity
+}
+
+// rootFields returns how many fields operation selects at its root,
+// through fragments and leaving out __typename: the mutations a mutation
+// operation runs.
+func rootFields(doc *ast.Document, operation *ast.OperationDefinition) int {
+	m := &measurer{fragments: make(map[string]*ast.FragmentDefinition), visiting: make(map[string]bool)}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			m.fragments[frag.Name.Value] = frag
+		}
+	}
+	return m.fields(operation.SelectionSet)
+}
+
+type measurer struct {
+	fragments map[string]*ast.FragmentDefinition
+	vars      map[string]interface{}
+	visiting  map[string]bool
+
+	// depth and introspectionDepth are those of the deepest fields found
+	// outside and within introspection fields.
+	depth, introspectionDepth int
+}
+
+// selectionSet returns the cost of set, nested depth fields deep and
+// within an introspection field if introspection is set.
+func (m *measurer) selectionSet(set *ast.SelectionSet, depth int, introspection bool) int {
+	if set == nil {
+		return 0
+	}
+	cost := 0
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			within := introspection || strings.HasPrefix(sel.Name.Value, "__")
+			m.reach(depth+1, within)
+			cost += 1 + m.multiplier(sel)*m.selectionSet(sel.SelectionSet, depth+1, within)
+		case *ast.InlineFragment:
+			cost += m.selectionSet(sel.SelectionSet, depth, introspection)
+		case *ast.FragmentSpread:
+			// Validation rejects fragment cycles, but guard anyway.
+			frag := m.fragments[sel.Name.Value]
+			if frag == nil || m.visiting[sel.Name.Value] {
+				continue
+			}
+			m.visiting[sel.Name.Value] = true
+			cost += m.selectionSet(frag.SelectionSet, depth, introspection)
+			delete(m.visiting, sel.Name.Value)
+		}
+	}
+	return cost
+}
+
+// fields returns the number of fields in set, not counting their own
+// selections.
+func (m *measurer) fields(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+	n := 0
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if sel.Name.Value != "__typename" {
+				n++
+			}
+		case *ast.InlineFragment:
+			n += m.fields(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			frag := m.fragments[sel.Name.Value]
+			if frag == nil || m.visiting[sel.Name.Value] {
+				continue
+			}
+			m.visiting[sel.Name.Value] = true
+			n += m.fields(frag.SelectionSet)
+			delete(m.visiting, sel.Name.Value)
+		}
+	}
+	return n
+}
+
+// reach records a field found depth fields deep.
+func (m *measurer) reach(depth int, introspection bool) {
+	if introspection && depth > m.introspectionDepth {
+		m.introspectionDepth = depth
+	}
+	if !introspection && depth > m.depth {
+		m.depth = depth
+	}
+}
+
+// multiplier returns how many times the selections of field are resolved.
+func (m *measurer) multiplier(field *ast.Field) int {
+	n, found := 0, false
+	for _, arg := range field.Arguments {
+		if name := arg.Name.Value; name == "first" || name == "last" {
+			if v, ok := m.intValue(arg.Value); ok {
+				if !found || v > n {
+					n = v
+				}
+				found = true
+			}
+		}
+	}
+	switch {
+	case found && n > MaxPageSize:
+		// Larger pages are rejected by the resolver.
+		return MaxPageSize
+	case found && n > 0:
+		return n
+	case !found && pagedFields[field.Name.Value]:
+		return DefaultPageSize
+	}
+	return 1
+}
+
+func (m *measurer) intValue(v ast.Value) (int, bool) {
+	switch v := v.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		switch n := m.vars[v.Name.Value].(type) {
+		case int:
+			return n, true
+		case float64:
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+// check returns an error if operation exceeds the limits.
+func (l Limits) check(doc *ast.Document, operation *ast.OperationDefinition, vars map[string]interface{}) error {
+	depth, introspectionDepth, complexity := measure(doc, operation, vars)
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &Error{Message: fmt.Sprintf("query depth %d exceeds the limit of %d", depth, l.MaxDepth), Code: CodeLimitExceeded}
+	}
+	if l.MaxIntrospectionDepth > 0 && introspectionDepth > l.MaxIntrospectionDepth {
+		return &Error{Message: fmt.Sprintf("introspection depth %d exceeds the limit of %d", introspectionDepth, l.MaxIntrospectionDepth), Code: CodeLimitExceeded}
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return &Error{Message: fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity), Code: CodeLimitExceeded}
+	}
+	if operation.Operation == ast.OperationTypeMutation && l.MaxMutations > 0 {
+		if n := rootFields(doc, operation); n > l.MaxMutations {
+			return &Error{Message: fmt.Sprintf("%d mutations exceed the limit of %d per operation", n, l.MaxMutations), Code: CodeLimitExceeded}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"user-service/internal/model"
+	"user-service/internal/service"
+)
+
+// groupLoader batches the group lookups of a request. Resolvers register
+// the emails they need with load and get a thunk back; the executor runs
+// the thunks only after resolving every sibling field, so the first thunk
+// fetches the groups of all registered emails in one call.
+type groupLoader struct {
+	groups service.GroupService
+
+	mu      sync.Mutex
+	pending []string
+	loaded  map[string][]*model.Group
+}
+
+func newGroupLoader(groups service.GroupService) *groupLoader {
+	return &groupLoader{groups: groups, loaded: make(map[string][]*model.Group)}
+}
+
+func (l *groupLoader) load(ctx context.Context, email string) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.loaded[email]; !ok {
+		l.pending = append(l.pending, email)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.loaded[email]; !ok {
+			if err := l.flush(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return l.loaded[email], nil
+	}
+}
+
+// flush fetches the groups of every pending email. l.mu must be held.
+func (l *groupLoader) flush(ctx context.Context) error {
+	batch := l.pending
+	l.pending = nil
+	groups, err := l.groups.ListGroupsByMembers(ctx, batch)
+	if err != nil {
+		l.pending = append(batch, l.pending...)
+		return err
+	}
+	for _, email := range batch {
+		l.loaded[email] = groups[email]
+	}
+	return nil
+}
+
+type loaderKey struct{}
+
+func withLoader(ctx context.Context, l *groupLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+// loaderFrom returns the request's loader. Resolvers run outside a request,
+// as in tests, get a loader of their own.
+func loaderFrom(ctx context.Context, groups service.GroupService) *groupLoader {
+	if l, ok := ctx.Value(loaderKey{}).(*groupLoader); ok {
+		return l
+	}
+	return newGroupLoader(groups)
+}
@@ -0,0 +1,45 @@
+package gql
+
+import (
+	"user-service/internal/openapi"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Describe adds the GraphQL endpoint served at path to doc. The schema
+// itself is discoverable through introspection.
+func Describe(doc *openapi.Document, path string) {
+	doc.Define("GraphQLError", gqlerrors.FormattedError{})
+	result := doc.Define("GraphQLResponse", graphql.Result{})
+	request := doc.Define("GraphQLRequest", Request{})
+	query := "{ users(first: 10) { edges { node { email name } } } }"
+
+	responses := func() map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			"200": openapi.RespondWith("The result, with field errors in errors", openapi.JSON, result),
+			"400": openapi.RespondWith("Invalid request, query or variables, or query limits exceeded", openapi.JSON, result),
+		}
+	}
+	get := responses()
+	get["405"] = openapi.RespondWith("Mutations must be sent with POST", openapi.JSON, result)
+	doc.Add("GET", path, &openapi.Operation{
+		OperationID: "graphqlQuery", Summary: "Run a GraphQL query", Tags: []string{"graphql"},
+		Parameters: []*openapi.Parameter{
+			{Name: "query", In: "query", Required: true, Schema: openapi.String(), Example: query},
+			{Name: "operationName", In: "query", Schema: openapi.String()},
+			{Name: "variables", In: "query", Description: "Variables as a JSON object.", Schema: openapi.String()},
+		},
+		Responses: get,
+	})
+	post := responses()
+	post["429"] = openapi.RespondWith("Rate limit exceeded. Mutations have a limit of their own, and get an error coded RATE_LIMITED", openapi.JSON, result)
+	post["429"].Headers = map[string]*openapi.Header{
+		"Retry-After": {Description: "Seconds until a request will be admitted.", Schema: openapi.Integer()},
+	}
+	doc.Add("POST", path, &openapi.Operation{
+		OperationID: "graphqlExecute", Summary: "Run a GraphQL query or mutation", Tags: []string{"graphql"},
+		RequestBody: openapi.Body(openapi.JSON, request, Request{Query: query}),
+		Responses:   post,
+	})
+}
@@ -0,0 +1,450 @@
+// Package gql serves users over GraphQL at /graphql.
+package gql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"user-service/internal/filter"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	// DefaultPageSize is the page size of connections when neither first
+	// nor last is given.
+	DefaultPageSize = 20
+	// MaxPageSize caps first and last.
+	MaxPageSize = 100
+)
+
+// Error codes reported in the "code" extension of errors.
+const (
+	CodeNotFound      = "NOT_FOUND"
+	CodeAlreadyExists = "ALREADY_EXISTS"
+	CodeBadUserInput  = "BAD_USER_INPUT"
+	CodeLimitExceeded = "QUERY_LIMIT_EXCEEDED"
+	CodeRateLimited   = "RATE_LIMITED"
+	CodeInternal      = "INTERNAL"
+)
+
+// Error is an error returned by a resolver, reported with its code.
+type Error struct {
+	Message string
+	Code    string
+	cause   error
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+// toError maps service errors to GraphQL errors. Unexpected errors are
+// reported as internal errors without their details, which are kept for
+// logging.
+func toError(err error) error {
+	var gqlErr *Error
+	switch {
+	case errors.As(err, &gqlErr):
+		return gqlErr
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, repository.ErrUserNotFound):
+		return &Error{Message: err.Error(), Code: CodeNotFound}
+	case errors.Is(err, repository.ErrUserAlreadyExists):
+		return &Error{Message: err.Error(), Code: CodeAlreadyExists}
+	case errors.Is(err, service.ErrInvalidState):
+		return &Error{Message: err.Error(), Code: CodeBadUserInput}
+	}
+	var invalid *filter.Error
+	if errors.As(err, &invalid) {
+		return &Error{Message: err.Error(), Code: CodeBadUserInput}
+	}
+	return &Error{Message: "internal error", Code: CodeInternal, cause: err}
+}
+
+func badInput(msg string) error {
+	return &Error{Message: msg, Code: CodeBadUserInput}
+}
+
+// Connection types follow the Relay cursor connections specification.
+type (
+	userConnection struct {
+		Edges      []*userEdge
+		Nodes      []*model.User
+		PageInfo   *pageInfo
+		TotalCount int
+	}
+	userEdge struct {
+		Cursor string
+		Node   *model.User
+	}
+	pageInfo struct {
+		HasNextPage     bool
+		HasPreviousPage bool
+		StartCursor     *string
+		EndCursor       *string
+	}
+)
+
+var userStateEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "UserState",
+	Values: graphql.EnumValueConfigMap{
+		"PENDING":     {Value: model.StatePending},
+		"ACTIVE":      {Value: model.StateActive},
+		"SUSPENDED":   {Value: model.StateSuspended},
+		"DEACTIVATED": {Value: model.StateDeactivated},
+	},
+})
+
+var groupType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Group",
+	Fields: graphql.Fields{
+		"id":          {Type: graphql.NewNonNull(graphql.ID)},
+		"displayName": {Type: graphql.NewNonNull(graphql.String)},
+		"createdAt":   {Type: graphql.NewNonNull(graphql.DateTime)},
+		"updatedAt":   {Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     {Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": {Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     {Type: graphql.String},
+		"endCursor":       {Type: graphql.String},
+	},
+})
+
+var userFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"state":         {Type: userStateEnum},
+		"emailContains": {Type: graphql.String},
+		"nameContains":  {Type: graphql.String},
+		"minAge":        {Type: graphql.Int},
+		"maxAge":        {Type: graphql.Int},
+		"verified":      {Type: graphql.Boolean},
+		"expression": {
+			Type:        graphql.String,
+			Description: "A filter expression users must match too, as in the filter parameter of GET /users.",
+		},
+	},
+})
+
+var createUserInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateUserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"email": {Type: graphql.NewNonNull(graphql.String)},
+		"name":  {Type: graphql.String},
+		"age":   {Type: graphql.Int},
+	},
+})
+
+var updateUserInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "UpdateUserInput",
+	Description: "Fields left out keep their current values.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": {Type: graphql.String},
+		"age":  {Type: graphql.Int},
+	},
+})
+
+// NewSchema returns the GraphQL schema, resolved by users and groups.
+func NewSchema(users service.UserService, groups service.GroupService) (graphql.Schema, error) {
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"email":          {Type: graphql.NewNonNull(graphql.String)},
+			"name":           {Type: graphql.NewNonNull(graphql.String)},
+			"age":            {Type: graphql.NewNonNull(graphql.Int)},
+			"state":          {Type: graphql.NewNonNull(userStateEnum)},
+			"stateChangedAt": {Type: graphql.DateTime},
+			"stateReason":    {Type: graphql.String},
+			"verifiedAt":     {Type: graphql.DateTime},
+			"groups": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(groupType))),
+				Description: "The groups the user belongs to, loaded in one batch for all users in a response.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user := p.Source.(*model.User)
+					load := loaderFrom(p.Context, groups).load(p.Context, user.Email)
+					return func() (interface{}, error) {
+						v, err := load()
+						if err != nil {
+							return nil, toError(err)
+						}
+						if v.([]*model.Group) == nil {
+							return []*model.Group{}, nil
+						}
+						return v, nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserEdge",
+		Fields: graphql.Fields{
+			"cursor": {Type: graphql.NewNonNull(graphql.String)},
+			"node":   {Type: graphql.NewNonNull(userType)},
+		},
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserConnection",
+		Fields: graphql.Fields{
+			"edges":      {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType)))},
+			"nodes":      {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType)))},
+			"pageInfo":   {Type: graphql.NewNonNull(pageInfoType)},
+			"totalCount": {Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": {
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"email": {Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user, err := users.GetUser(p.Context, p.Args["email"].(string))
+					if errors.Is(err, service.ErrUserNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, toError(err)
+					}
+					return user, nil
+				},
+			},
+			"users": {
+				Type:        graphql.NewNonNull(connectionType),
+				Description: "Users ordered by email, paged forwards with first and after or backwards with last and before.",
+				Args: graphql.FieldConfigArgument{
+					"first":  {Type: graphql.Int},
+					"after":  {Type: graphql.String},
+					"last":   {Type: graphql.Int},
+					"before": {Type: graphql.String},
+					"filter": {Type: userFilterType},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter, _ := p.Args["filter"].(map[string]interface{})
+					list, err := listUsers(p.Context, users, filter)
+					if err != nil {
+						return nil, err
+					}
+					return paginate(list, p.Args)
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": {
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"input": {Type: graphql.NewNonNull(createUserInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					input := p.Args["input"].(map[string]interface{})
+					user := &model.User{Email: input["email"].(string)}
+					user.Name, _ = input["name"].(string)
+					user.Age, _ = input["age"].(int)
+					if user.Email == "" {
+						return nil, badInput("email is required")
+					}
+					if err := users.CreateUser(p.Context, user); err != nil {
+						return nil, toError(err)
+					}
+					return user, nil
+				},
+			},
+			"updateUser": {
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"email": {Type: graphql.NewNonNull(graphql.String)},
+					"input": {Type: graphql.NewNonNull(updateUserInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					user, err := users.GetUser(p.Context, p.Args["email"].(string))
+					if err != nil {
+						return nil, toError(err)
+					}
+					input := p.Args["input"].(map[string]interface{})
+					if name, ok := input["name"].(string); ok {
+						user.Name = name
+					}
+					if age, ok := input["age"].(int); ok {
+						user.Age = age
+					}
+					if err := users.UpdateUser(p.Context, user); err != nil {
+						return nil, toError(err)
+					}
+					return user, nil
+				},
+			},
+			"deleteUser": {
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Soft-deletes a user, as DELETE /users/{email} does.",
+				Args: graphql.FieldConfigArgument{
+					"email": {Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := users.DeleteUser(p.Context, p.Args["email"].(string)); err != nil {
+						return nil, toError(err)
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// listUsers returns the users matching filter, ordered by email.
+func listUsers(ctx context.Context, users service.UserService, filter map[string]interface{}) ([]*model.User, error) {
+	state, _ := filter["state"].(model.UserState)
+	criteria := model.UserFilter{State: state}
+	expr, err := userFilter(filter)
+	if err != nil {
+		return nil, toError(err)
+	}
+	if expr != nil {
+		criteria.Expression = expr.String()
+	}
+	list, err := users.ListUsers(ctx, criteria)
+	if err != nil {
+		return nil, toError(err)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Email < list[j].Email })
+	return list, nil
+}
+
+// userFilter returns the conjunction of the expression and the
+// comparisons the fields of args other than state select, in the
+// language of package filter, or nil if there are none.
+func userFilter(args map[string]interface{}) (filter.Expr, error) {
+	var exprs []filter.Expr
+	compare := func(field string, op filter.Op, value interface{}) {
+		exprs = append(exprs, &filter.Comparison{Field: field, Op: op, Value: value})
+	}
+	if s, _ := args["emailContains"].(string); s != "" {
+		compare("email", filter.Co, s)
+	}
+	if s, _ := args["nameContains"].(string); s != "" {
+		compare("name", filter.Co, s)
+	}
+	if n, ok := args["minAge"].(int); ok {
+		compare("age", filter.Ge, n)
+	}
+	if n, ok := args["maxAge"].(int); ok {
+		compare("age", filter.Le, n)
+	}
+	if verified, ok := args["verified"].(bool); ok {
+		compare("verified_at", filter.Present, nil)
+		if !verified {
+			exprs[len(exprs)-1] = &filter.Negation{X: exprs[len(exprs)-1]}
+		}
+	}
+	if s, _ := args["expression"].(string); s != "" {
+		expr, err := filter.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	expr := exprs[0]
+	for _, e := range exprs[1:] {
+		expr = &filter.Logical{Op: filter.And, Left: expr, Right: e}
+	}
+	return expr, nil
+}
+
+// paginate returns the page of users selected by the first, after, last
+// and before arguments.
+func paginate(users []*model.User, args map[string]interface{}) (*userConnection, error) {
+	start, end := 0, len(users)
+	if after, ok := args["after"].(string); ok {
+		email, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(users), func(i int) bool { return users[i].Email > email })
+	}
+	if before, ok := args["before"].(string); ok {
+		email, err := decodeCursor(before)
+		if err != nil {
+			return nil, err
+		}
+		end = sort.Search(len(users), func(i int) bool { return users[i].Email >= email })
+	}
+	if end < start {
+		end = start
+	}
+
+	first, hasFirst := args["first"].(int)
+	last, hasLast := args["last"].(int)
+	if !hasFirst && !hasLast {
+		first, hasFirst = DefaultPageSize, true
+	}
+	if hasFirst {
+		if first < 0 || first > MaxPageSize {
+			return nil, badInput("first must be between 0 and 100")
+		}
+		if end-start > first {
+			end = start + first
+		}
+	}
+	if hasLast {
+		if last < 0 || last > MaxPageSize {
+			return nil, badInput("last must be between 0 and 100")
+		}
+		if end-start > last {
+			start = end - last
+		}
+	}
+
+	conn := &userConnection{
+		Edges:      []*userEdge{},
+		Nodes:      users[start:end],
+		PageInfo:   &pageInfo{HasPreviousPage: start > 0, HasNextPage: end < len(users)},
+		TotalCount: len(users),
+	}
+	for _, u := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &userEdge{Cursor: encodeCursor(u.Email), Node: u})
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+	return conn, nil
+}
+
+const cursorPrefix = "user:"
+
+func encodeCursor(email string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + email))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return "", badInput("invalid cursor")
+	}
+	return strings.TrimPrefix(string(b), cursorPrefix), nil
+}
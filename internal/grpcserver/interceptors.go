@@ -0,0 +1,50 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+	"user-service/pkg/logger"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryLogger stores a child of base in each call's context and writes
+// one access log line per call, like the HTTP request logger.
+func UnaryLogger(base *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		l := base.With(zap.String("grpc_method", info.FullMethod))
+		resp, err := handler(logger.NewContext(ctx, l), req)
+		logCall(l, start, err)
+		return resp, err
+	}
+}
+
+// StreamLogger is UnaryLogger for streaming calls.
+func StreamLogger(base *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		l := base.With(zap.String("grpc_method", info.FullMethod))
+		err := handler(srv, &loggedStream{ServerStream: ss, ctx: logger.NewContext(ss.Context(), l)})
+		logCall(l, start, err)
+		return err
+	}
+}
+
+func logCall(l *zap.Logger, start time.Time, err error) {
+	l.Info("grpc call",
+		zap.String("grpc_code", status.Code(err).String()),
+		zap.Duration("latency", time.Since(start)))
+}
+
+// loggedStream overrides the context of a server stream.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,47 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+	userv1 "user-service/api/user/v1"
+	"user-service/internal/handler"
+	"user-service/pkg/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestInterceptors(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	// Logged through the redacting core, as in production.
+	l := zap.New(logger.NewRedactingCore(core, logger.DefaultRedaction()))
+	limiter := handler.NewRateLimiter(handler.RateLimiterConfig{
+		Routes: map[string]handler.RateLimit{"POST /users": {Rate: 0.001, Burst: 1}},
+	})
+	client := userv1.NewUserServiceClient(serveTest(t, newTestService(t),
+		grpc.ChainUnaryInterceptor(UnaryLogger(l), UnaryRateLimit(limiter)),
+		grpc.ChainStreamInterceptor(StreamLogger(l), StreamRateLimit(limiter))))
+	ctx := context.Background()
+
+	if _, err := client.CreateUser(ctx, &userv1.CreateUserRequest{User: &userv1.User{Email: "a@example.com"}}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	_, err := client.CreateUser(ctx, &userv1.CreateUserRequest{User: &userv1.User{Email: "b@example.com"}})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted once the POST /users bucket is empty, got %v", err)
+	}
+	if _, err := client.GetUser(ctx, &userv1.GetUserRequest{Email: "a@example.com"}); err != nil {
+		t.Errorf("expected other methods to have their own bucket, got %v", err)
+	}
+
+	logged := make(map[interface{}]bool)
+	for _, e := range logs.FilterMessage("grpc call").All() {
+		logged[e.ContextMap()["grpc_code"]] = true
+	}
+	if !logged["OK"] || !logged["ResourceExhausted"] {
+		t.Errorf("expected the status codes logged unredacted, got %v", logged)
+	}
+}
@@ -0,0 +1,72 @@
+package grpcserver
+
+import (
+	"context"
+	"math"
+	"net"
+	"time"
+	userv1 "user-service/api/user/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Limiter takes tokens from per-client buckets, as handler.RateLimiter
+// does.
+type Limiter interface {
+	Allow(route, ip string) (bool, time.Duration)
+}
+
+// methodRoutes maps methods to the HTTP routes doing the same, whose
+// buckets they share, so a client cannot get past the HTTP limits by
+// switching protocols. Other methods share the default bucket.
+var methodRoutes = map[string]string{
+	userv1.UserService_CreateUser_FullMethodName: "POST /users",
+	userv1.UserService_GetUser_FullMethodName:    "GET /users/{email}",
+	userv1.UserService_UpdateUser_FullMethodName: "PUT /users/{email}",
+	userv1.UserService_DeleteUser_FullMethodName: "DELETE /users/{email}",
+	userv1.UserService_ListUsers_FullMethodName:  "GET /users",
+}
+
+// UnaryRateLimit rejects calls with ResourceExhausted once the caller's
+// bucket is empty.
+func UnaryRateLimit(l Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, l, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimit is UnaryRateLimit for streaming calls.
+func StreamRateLimit(l Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), l, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func allow(ctx context.Context, l Limiter, method string) error {
+	ok, wait := l.Allow(methodRoutes[method], peerIP(ctx))
+	if ok {
+		return nil
+	}
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %d seconds", int(math.Ceil(wait.Seconds())))
+}
+
+// peerIP returns the address of the caller, without its port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
@@ -0,0 +1,136 @@
+// Package grpcserver serves the user API over gRPC, backed by the same
+// service layer as the REST handlers.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	userv1 "user-service/api/user/v1"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+	"user-service/pkg/logger"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Server implements userv1.UserServiceServer.
+type Server struct {
+	userv1.UnimplementedUserServiceServer
+
+	userService service.UserService
+	logger      *zap.Logger
+}
+
+func NewServer(userService service.UserService, logger *zap.Logger) *Server {
+	return &Server{userService: userService, logger: logger}
+}
+
+// NewGRPCServer returns a gRPC server serving s, with reflection enabled
+// so tools like grpcurl can discover the API.
+func NewGRPCServer(s *Server, opts ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(opts...)
+	userv1.RegisterUserServiceServer(srv, s)
+	reflection.Register(srv)
+	return srv
+}
+
+func (s *Server) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.User, error) {
+	if req.GetUser().GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user.email is required")
+	}
+	user := &model.User{Email: req.User.Email, Name: req.User.Name, Age: int(req.User.Age)}
+	if err := s.userService.CreateUser(ctx, user); err != nil {
+		return nil, s.toStatus(ctx, "Failed to create user", err)
+	}
+	return userv1.FromModel(user), nil
+}
+
+func (s *Server) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.User, error) {
+	user, err := s.userService.GetUser(ctx, req.GetEmail())
+	if err != nil {
+		return nil, s.toStatus(ctx, "Failed to get user", err)
+	}
+	return userv1.FromModel(user), nil
+}
+
+func (s *Server) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.User, error) {
+	if req.GetUser().GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user.email is required")
+	}
+	user := &model.User{Email: req.User.Email, Name: req.User.Name, Age: int(req.User.Age)}
+	if err := s.userService.UpdateUser(ctx, user); err != nil {
+		return nil, s.toStatus(ctx, "Failed to update user", err)
+	}
+	return userv1.FromModel(user), nil
+}
+
+func (s *Server) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := s.userService.DeleteUser(ctx, req.GetEmail()); err != nil {
+		return nil, s.toStatus(ctx, "Failed to delete user", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ListUsers(req *userv1.ListUsersRequest, stream userv1.UserService_ListUsersServer) error {
+	ctx := stream.Context()
+	state, ok := fromProtoState(req.GetState())
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown state %v", req.GetState())
+	}
+	users, err := s.userService.ListUsers(ctx, model.UserFilter{State: state})
+	if err != nil {
+		return s.toStatus(ctx, "Failed to list users", err)
+	}
+	for _, user := range users {
+		if err := stream.Send(userv1.FromModel(user)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toStatus maps domain errors to gRPC status codes. Unexpected errors are
+// logged and reported as Internal without their message.
+func (s *Server) toStatus(ctx context.Context, msg string, err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, repository.ErrUserNotFound):
+		code = codes.NotFound
+	case errors.Is(err, repository.ErrUserAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, service.ErrInvalidState):
+		code = codes.InvalidArgument
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrAccountInactive),
+		errors.Is(err, service.ErrRetentionExpired):
+		code = codes.FailedPrecondition
+	case errors.Is(err, service.ErrAccountLocked):
+		code = codes.ResourceExhausted
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	default:
+		logger.FromContext(ctx, s.logger).Error(msg, zap.Error(err))
+		return status.Error(codes.Internal, msg)
+	}
+	return status.Error(code, err.Error())
+}
+
+// fromProtoState converts a filter state; unspecified means no filter.
+func fromProtoState(s userv1.UserState) (model.UserState, bool) {
+	if s == userv1.UserState_USER_STATE_UNSPECIFIED {
+		return "", true
+	}
+	for state, ps := range userv1.States {
+		if ps == s {
+			return state, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,185 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	userv1 "user-service/api/user/v1"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves svc over an in-process bufconn listener.
+func newTestClient(t *testing.T, svc service.UserService) *grpc.ClientConn {
+	t.Helper()
+	logger := zaptest.NewLogger(t)
+	return serveTest(t, svc,
+		grpc.ChainUnaryInterceptor(UnaryLogger(logger)),
+		grpc.ChainStreamInterceptor(StreamLogger(logger)))
+}
+
+// serveTest serves svc with opts over an in-process bufconn listener.
+func serveTest(t *testing.T, svc service.UserService, opts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewGRPCServer(NewServer(svc, zaptest.NewLogger(t)), opts...)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func newTestService(t *testing.T) service.UserService {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	return service.NewUserService(repository.NewUserRepository(db))
+}
+
+func TestUserServiceCRUD(t *testing.T) {
+	client := userv1.NewUserServiceClient(newTestClient(t, newTestService(t)))
+	ctx := context.Background()
+
+	created, err := client.CreateUser(ctx, &userv1.CreateUserRequest{User: &userv1.User{Email: "a@example.com", Name: "A", Age: 30}})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if created.State != userv1.UserState_USER_STATE_PENDING || created.StateChangedAt == nil {
+		t.Errorf("expected a pending user, got %v", created)
+	}
+
+	_, err = client.CreateUser(ctx, &userv1.CreateUserRequest{User: &userv1.User{Email: "a@example.com"}})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected AlreadyExists for a duplicate, got %v", err)
+	}
+	_, err = client.CreateUser(ctx, &userv1.CreateUserRequest{User: &userv1.User{}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without an email, got %v", err)
+	}
+
+	updated, err := client.UpdateUser(ctx, &userv1.UpdateUserRequest{User: &userv1.User{Email: "a@example.com", Name: "B", Age: 31}})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if updated.Name != "B" || updated.State != userv1.UserState_USER_STATE_PENDING {
+		t.Errorf("unexpected updated user: %v", updated)
+	}
+
+	got, err := client.GetUser(ctx, &userv1.GetUserRequest{Email: "a@example.com"})
+	if err != nil || got.Name != "B" || got.Age != 31 {
+		t.Fatalf("GetUser returned %v, %v", got, err)
+	}
+
+	if _, err := client.DeleteUser(ctx, &userv1.DeleteUserRequest{Email: "a@example.com"}); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	for name, call := range map[string]func() error{
+		"GetUser": func() error {
+			_, err := client.GetUser(ctx, &userv1.GetUserRequest{Email: "a@example.com"})
+			return err
+		},
+		"UpdateUser": func() error {
+			_, err := client.UpdateUser(ctx, &userv1.UpdateUserRequest{User: &userv1.User{Email: "a@example.com"}})
+			return err
+		},
+		"DeleteUser": func() error {
+			_, err := client.DeleteUser(ctx, &userv1.DeleteUserRequest{Email: "a@example.com"})
+			return err
+		},
+	} {
+		if err := call(); status.Code(err) != codes.NotFound {
+			t.Errorf("%s: expected NotFound after deletion, got %v", name, err)
+		}
+	}
+}
+
+func TestUserServiceListUsers(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := svc.CreateUser(ctx, &model.User{Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.TransitionUser(ctx, "b@example.com", model.StateActive, ""); err != nil {
+		t.Fatal(err)
+	}
+	client := userv1.NewUserServiceClient(newTestClient(t, svc))
+
+	list := func(state userv1.UserState) ([]string, error) {
+		stream, err := client.ListUsers(ctx, &userv1.ListUsersRequest{State: state})
+		if err != nil {
+			return nil, err
+		}
+		var emails []string
+		for {
+			u, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return emails, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			emails = append(emails, u.Email)
+		}
+	}
+
+	all, err := list(userv1.UserState_USER_STATE_UNSPECIFIED)
+	if err != nil || len(all) != 3 {
+		t.Errorf("expected 3 users, got %v, %v", all, err)
+	}
+	active, err := list(userv1.UserState_USER_STATE_ACTIVE)
+	if err != nil || len(active) != 1 || active[0] != "b@example.com" {
+		t.Errorf("expected only the active user, got %v, %v", active, err)
+	}
+	if _, err := list(userv1.UserState(42)); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for an unknown state, got %v", err)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	client := reflectionpb.NewServerReflectionClient(newTestClient(t, newTestService(t)))
+	stream, err := client.ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		if s.Name == "user.v1.UserService" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("user.v1.UserService not listed by reflection: %v", resp)
+	}
+}
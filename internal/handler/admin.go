@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth returns middleware that only admits requests carrying
+// "Authorization: Bearer <token>". An empty token disables the routes it
+// protects entirely.
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return bearerAuth(token, "admin", "Admin API disabled")
+}
+
+// SCIMAuth is like AdminAuth, for the SCIM provisioning API. Requests it
+// admits are attributed to the "scim" principal.
+func SCIMAuth(token string) func(http.Handler) http.Handler {
+	return bearerAuth(token, "scim", "SCIM API disabled")
+}
+
+// bearerAuth admits requests carrying token and records realm as their
+// principal.
+func bearerAuth(token, realm, disabled string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.Error(w, disabled, http.StatusForbidden)
+				return
+			}
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			setPrincipal(r, realm)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
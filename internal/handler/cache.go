@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/model"
+)
+
+// Cache-Control policies of user routes.
+const (
+	// CacheRevalidate lets clients keep a response but has them revalidate
+	// it on every use, which costs a 304 while it is current.
+	CacheRevalidate = "private, no-cache"
+	// CacheNoStore keeps responses out of every cache.
+	CacheNoStore = "no-store"
+)
+
+// CacheControl returns middleware answering with policy in the
+// Cache-Control header.
+func CacheControl(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", policy)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validators identify the state a response represents, so conditional
+// requests can tell whether a client's copy is current.
+type validators struct {
+	etag string
+	// lastModified is zero when it is not known.
+	lastModified time.Time
+}
+
+// userValidators are the validators of responses with u: its version, and
+// when it was last updated. Users created before updates were recorded
+// only have the version.
+func userValidators(u *model.User) validators {
+	v := validators{etag: etag(u.Version)}
+	if u.UpdatedAt != nil {
+		v.lastModified = *u.UpdatedAt
+	}
+	return v
+}
+
+// etag returns the entity tag of version. It is weak because responses in
+// every version and format share it; Vary: Accept tells them apart.
+func etag(version uint64) string {
+	return `W/"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// notModified sets the validators v on w, and answers 304 when the
+// preconditions of r show the client's copy is current, reporting whether
+// it did.
+func notModified(w http.ResponseWriter, r *http.Request, v validators) bool {
+	w.Header().Set("ETag", v.etag)
+	if !v.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if !current(r, v) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// current evaluates the preconditions of a GET as RFC 9110 does:
+// If-Modified-Since is ignored when If-None-Match is present.
+func current(r *http.Request, v validators) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, v.etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || v.lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	// Last-Modified has a resolution of a second.
+	return !v.lastModified.Truncate(time.Second).After(t)
+}
+
+// matchETag reports whether the If-None-Match list names etag, comparing
+// weakly.
+func matchETag(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"user-service/internal/model"
+)
+
+func TestConditionalGet(t *testing.T) {
+	r, svc := setupVersionedRouter(t)
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("user", func(t *testing.T) {
+		w := get("/users/a@example.com", nil)
+		tag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+		if w.Code != http.StatusOK || tag == "" || modified == "" {
+			t.Fatalf("expected a 200 with validators, got %d %v", w.Code, w.Header())
+		}
+
+		for _, h := range []http.Header{
+			{"If-None-Match": {tag}},
+			{"If-None-Match": {`"0", ` + tag[2:]}},
+			{"If-Modified-Since": {modified}},
+		} {
+			w := get("/users/a@example.com", h)
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != tag {
+				t.Errorf("%v: expected a 304 without a body, got %d %q", h, w.Code, w.Body.String())
+			}
+		}
+		for _, h := range []http.Header{
+			{"If-None-Match": {`W/"0"`}},
+			{"If-None-Match": {`W/"0"`}, "If-Modified-Since": {modified}},
+			{"If-Modified-Since": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}},
+		} {
+			if w := get("/users/a@example.com", h); w.Code != http.StatusOK {
+				t.Errorf("%v: expected a 200, got %d", h, w.Code)
+			}
+		}
+
+		if w := get("/users/a@example.com?expand=audit", http.Header{"If-None-Match": {tag}}); w.Header().Get("ETag") != "" || w.Code == http.StatusNotModified {
+			t.Errorf("expected expanded users not to be revalidated, got %d %v", w.Code, w.Header())
+		}
+
+		a, _ := svc.GetUser(context.Background(), "a@example.com")
+		a.Name = "Alice"
+		if err := svc.UpdateUser(context.Background(), a); err != nil {
+			t.Fatalf("failed to update user: %v", err)
+		}
+		w = get("/users/a@example.com", http.Header{"If-None-Match": {tag}})
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == tag {
+			t.Errorf("expected the updated user with a new ETag, got %d %v", w.Code, w.Header())
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := get("/v2/users", nil)
+		tag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || tag == "" {
+			t.Fatalf("expected a 200 with an ETag, got %d %v", w.Code, w.Header())
+		}
+		if w := get("/v2/users", http.Header{"If-None-Match": {tag}}); w.Code != http.StatusNotModified {
+			t.Errorf("expected a 304 while no user changes, got %d", w.Code)
+		}
+
+		if err := svc.CreateUser(context.Background(), &model.User{Email: "b@example.com", Name: "B", Age: 30}); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		w = get("/v2/users", http.Header{"If-None-Match": {tag}})
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == tag {
+			t.Errorf("expected the new list with a new ETag, got %d %v", w.Code, w.Header())
+		}
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	w := httptest.NewRecorder()
+	CacheControl(CacheNoStore)(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get("Cache-Control"); got != CacheNoStore {
+		t.Errorf("expected Cache-Control %q, got %q", CacheNoStore, got)
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type tokenRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password,omitempty"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (h *UserHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	if err := h.userService.RequestEmailVerification(r.Context(), email); err != nil {
+		h.log(r).Error("Failed to send verification email", zap.Error(err))
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.userService.VerifyEmail(r.Context(), req.Token); err != nil {
+		h.log(r).Info("Email verification failed", zap.Error(err))
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.userService.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		h.log(r).Error("Failed to send password reset email", zap.Error(err))
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.userService.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		h.log(r).Info("Password reset failed", zap.Error(err))
+		http.Error(w, err.Error(), emailErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func emailErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrWeakPassword):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrAccountInactive):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrEmailUnavailable):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"user-service/internal/service"
+
+	"go.uber.org/zap"
+)
+
+type rotateKeysResponse struct {
+	Rotated int `json:"rotated"`
+}
+
+func (h *UserHandler) RotateEncryptionKeys(w http.ResponseWriter, r *http.Request) {
+	n, err := h.userService.RotateEncryptionKeys(r.Context())
+	if err != nil {
+		h.log(r).Error("Failed to rotate encryption keys", zap.Int("rotated", n), zap.Error(err))
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrEncryptionUnavailable) {
+			status = http.StatusNotImplemented
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rotateKeysResponse{Rotated: n}); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
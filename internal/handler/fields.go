@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"user-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// Related resources users embed with expand=. Audit events are not
+// among them: they are only exported to admins.
+const expandGroups = "groups"
+
+var expansions = []string{expandGroups}
+
+var errGroupsUnavailable = errors.New("groups are not configured")
+
+// groupRef is a group embedded in a user.
+type groupRef struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+// projection is what the fields and expand query parameters select: the
+// fields of each user, all of them when fields is nil, and the related
+// resources to embed.
+type projection struct {
+	fields map[string]bool
+	expand map[string]bool
+}
+
+// cacheable reports whether responses projected by p can be revalidated
+// with the validators of the users in them. Embedded resources change
+// without the users they are embedded in.
+func (p projection) cacheable() bool {
+	return p.expand == nil
+}
+
+var errProjectionUnsupported = errors.New("fields and expand are not supported in " + protobufFormat.mediaType)
+
+// parseProjection reads the comma separated fields and expand parameters
+// of query, rejecting names that are not fields of users in rep or known
+// expansions. Protobuf messages cannot be projected.
+func parseProjection(query url.Values, rep representation) (projection, error) {
+	var p projection
+	if _, ok := rep.(protobufRepresentation); ok {
+		if query.Has("fields") || query.Has("expand") {
+			return p, errProjectionUnsupported
+		}
+		return p, nil
+	}
+	var err error
+	if p.fields, err = parseNames("field", query["fields"], fieldNames(rep.user(&model.User{}))); err != nil {
+		return p, err
+	}
+	p.expand, err = parseNames("expansion", query["expand"], expansions)
+	return p, err
+}
+
+// parseNames splits values into names, which must all be valid. It returns
+// nil when values is empty.
+func parseNames(kind string, values, valid []string) (map[string]bool, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	names := make(map[string]bool)
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if i := sort.SearchStrings(valid, name); i == len(valid) || valid[i] != name {
+				return nil, fmt.Errorf("unknown %s %q, expected one of %s", kind, name, strings.Join(valid, ", "))
+			}
+			names[name] = true
+		}
+	}
+	return names, nil
+}
+
+// fieldValues returns the fields of the struct v by JSON name, leaving out
+// empty ones tagged omitempty as encoding/json does. Unlike a round trip
+// through JSON it keeps their types, which MessagePack encodes.
+func fieldValues(v interface{}) map[string]interface{} {
+	rv := reflect.ValueOf(v)
+	t := rv.Type()
+	m := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		f := rv.Field(i)
+		if strings.Contains(opts, "omitempty") && f.IsZero() {
+			continue
+		}
+		m[name] = f.Interface()
+	}
+	return m
+}
+
+// fieldNames returns the sorted JSON names of the fields of the struct v.
+func fieldNames(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// project returns users in rep, reduced to the fields p selects and with
+// the resources it expands embedded. Users are encoded as rep has them
+// when p selects neither.
+func (h *UserHandler) project(r *http.Request, rep representation, p projection, users []*model.User) ([]interface{}, error) {
+	projected := make([]interface{}, len(users))
+	if p.fields == nil && p.expand == nil {
+		for i, u := range users {
+			projected[i] = rep.user(u)
+		}
+		return projected, nil
+	}
+
+	var groups map[string][]*model.Group
+	if p.expand[expandGroups] {
+		if h.groups == nil {
+			return nil, errGroupsUnavailable
+		}
+		emails := make([]string, len(users))
+		for i, u := range users {
+			emails[i] = u.Email
+		}
+		var err error
+		if groups, err = h.groups.ListGroupsByMembers(r.Context(), emails); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, u := range users {
+		m := fieldValues(rep.user(u))
+		if p.fields != nil {
+			for name := range m {
+				if !p.fields[name] {
+					delete(m, name)
+				}
+			}
+		}
+		if p.expand[expandGroups] {
+			refs := make([]groupRef, 0, len(groups[u.Email]))
+			for _, g := range groups[u.Email] {
+				refs = append(refs, groupRef{ID: g.ID, DisplayName: g.DisplayName})
+			}
+			m[expandGroups] = refs
+		}
+		projected[i] = m
+	}
+	return projected, nil
+}
+
+// failProjection writes the error of a failed project.
+func (h *UserHandler) failProjection(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errGroupsUnavailable) {
+		h.fail(w, r, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	h.log(r).Error("Failed to expand users", zap.Error(err))
+	h.fail(w, r, "Failed to expand users", http.StatusInternalServerError)
+}
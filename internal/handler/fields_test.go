@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupProjectionRouter(t *testing.T, opts ...Option) *mux.Router {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	userRepo := repository.NewUserRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	svc := service.NewUserService(userRepo, service.WithAuditRepository(repository.NewAuditRepository(db)))
+	groups := service.NewGroupService(groupRepo, userRepo)
+	handler := NewUserHandler(svc, zaptest.NewLogger(t), append([]Option{WithGroups(groups)}, opts...)...)
+
+	ctx := context.Background()
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := svc.CreateUser(ctx, &model.User{Email: email, Name: "A", Age: 20}); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	if _, err := svc.TransitionUser(ctx, "a@example.com", model.StateActive, "verified"); err != nil {
+		t.Fatalf("failed to activate user: %v", err)
+	}
+	if err := groups.CreateGroup(ctx, &model.Group{DisplayName: "Admins", Members: []string{"a@example.com"}}); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+
+	versions := Versioning{}
+	r := mux.NewRouter()
+	r.Handle("/users", versions.Negotiate(http.HandlerFunc(handler.ListUsers))).Methods("GET")
+	r.Handle("/users/{email}", versions.Negotiate(http.HandlerFunc(handler.GetUser))).Methods("GET")
+	return r
+}
+
+func TestProjection(t *testing.T) {
+	r := setupProjectionRouter(t)
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("fields", func(t *testing.T) {
+		w := get("/users/a@example.com?fields=email,state", "")
+		var got map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 OK, got %d %s", w.Code, w.Body.String())
+		}
+		if len(got) != 2 || got["email"] != "a@example.com" || got["state"] != "active" {
+			t.Errorf("expected only email and state, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("expand", func(t *testing.T) {
+		w := get("/users?fields=id&expand=groups", MediaType(V2))
+		var got listEnvelope[struct {
+			ID     string     `json:"id"`
+			Email  string     `json:"email"`
+			Groups []groupRef `json:"groups"`
+		}]
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 OK, got %d %s", w.Code, w.Body.String())
+		}
+		if got.Meta.Count != 2 {
+			t.Fatalf("expected 2 users, got %s", w.Body.String())
+		}
+		for _, u := range got.Data {
+			if u.ID == "" || u.Email != "" || u.Groups == nil {
+				t.Errorf("expected the id and expansions only, got %+v", u)
+			}
+		}
+		a := got.Data[0]
+		if len(a.Groups) == 0 {
+			a = got.Data[1]
+		}
+		if len(a.Groups) != 1 || a.Groups[0].DisplayName != "Admins" {
+			t.Errorf("expected the user's group embedded, got %+v", a.Groups)
+		}
+	})
+
+	t.Run("unknown names", func(t *testing.T) {
+		for _, tc := range []struct{ path, accept, want string }{
+			{"/users/a@example.com?fields=id", "", `unknown field "id"`},
+			{"/users/a@example.com?fields=password_hash", MediaType(V2), `unknown field \"password_hash\"`},
+			{"/users?expand=roles", "", `unknown expansion "roles", expected one of groups`},
+			{"/users?expand=audit", "", `unknown expansion "audit"`},
+		} {
+			w := get(tc.path, tc.accept)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("%s: expected 400 %s, got %d %s", tc.path, tc.want, w.Code, w.Body.String())
+			}
+		}
+	})
+}
+
+func TestProjectionUnavailable(t *testing.T) {
+	r := setupProjectionRouter(t, WithGroups(nil))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/a@example.com?expand=groups", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without groups, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// format is an encoding user routes read and write bodies in. JSON is the
+// default; MessagePack and Protobuf spare high-volume clients its cost.
+type format struct {
+	// mediaType labels bodies that do not name an API version.
+	mediaType string
+	// suffix is the structured syntax suffix of the vendor media types
+	// naming a version in the format, or "" when they cannot: Protobuf
+	// messages evolve by field number rather than by version.
+	suffix string
+	encode func(w io.Writer, v interface{}) error
+	decode func(r io.Reader, v interface{}) error
+}
+
+var (
+	jsonFormat = &format{
+		mediaType: "application/json",
+		suffix:    "json",
+		encode:    func(w io.Writer, v interface{}) error { return json.NewEncoder(w).Encode(v) },
+		decode:    func(r io.Reader, v interface{}) error { return json.NewDecoder(r).Decode(v) },
+	}
+	// msgpackFormat encodes the same shapes as JSON, named by their JSON
+	// tags, with times as MessagePack timestamps.
+	msgpackFormat = &format{
+		mediaType: "application/msgpack",
+		suffix:    "msgpack",
+		encode: func(w io.Writer, v interface{}) error {
+			enc := msgpack.NewEncoder(w)
+			enc.SetCustomStructTag("json")
+			return enc.Encode(v)
+		},
+		decode: func(r io.Reader, v interface{}) error {
+			dec := msgpack.NewDecoder(r)
+			dec.SetCustomStructTag("json")
+			return dec.Decode(v)
+		},
+	}
+	// protobufFormat encodes the messages of api/user/v1, which only the
+	// protobuf representation produces.
+	protobufFormat = &format{
+		mediaType: "application/x-protobuf",
+		encode: func(w io.Writer, v interface{}) error {
+			m, ok := v.(proto.Message)
+			if !ok {
+				return fmt.Errorf("%T is not a protobuf message", v)
+			}
+			b, err := proto.Marshal(m)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		},
+		decode: func(r io.Reader, v interface{}) error {
+			m, ok := v.(proto.Message)
+			if !ok {
+				return fmt.Errorf("%T is not a protobuf message", v)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			return proto.Unmarshal(b, m)
+		},
+	}
+)
+
+var formats = []*format{jsonFormat, msgpackFormat, protobufFormat}
+
+// versioned returns the vendor media type naming version v in f.
+func (f *format) versioned(v int) string {
+	return fmt.Sprintf("application/vnd.user-service.v%d+%s", v, f.suffix)
+}
+
+var (
+	errUnknownVersion = errors.New("unsupported API version")
+	errNotAcceptable  = fmt.Errorf("no acceptable media type, expected one of %s", strings.Join(mediaTypes(), ", "))
+)
+
+// mediaTypes returns the media types of formats.
+func mediaTypes() []string {
+	types := make([]string, len(formats))
+	for i, f := range formats {
+		types[i] = f.mediaType
+	}
+	return types
+}
+
+// parseMediaType returns the format mediaType names, and the version it
+// names if it is a vendor media type. The format is nil when there is none.
+func parseMediaType(mediaType string) (version int, f *format) {
+	for _, f := range formats {
+		if mediaType == f.mediaType {
+			return 0, f
+		}
+	}
+	m := versionMediaType.FindStringSubmatch(mediaType)
+	if m == nil {
+		return 0, nil
+	}
+	for _, f := range formats {
+		if f.suffix != "" && m[2] == f.suffix {
+			version, _ = strconv.Atoi(m[1])
+			return version, f
+		}
+	}
+	return 0, nil
+}
+
+// negotiate returns the version and format accept names with the highest
+// quality. The version is 0 when the media type names none, and the format
+// JSON when accept is empty or a wildcard is preferred. It fails with
+// errUnknownVersion when accept names versions but none that are known,
+// and nothing else acceptable, and with errNotAcceptable when it names no
+// format at all.
+func negotiate(accept string, known func(int) bool) (version int, f *format, err error) {
+	if strings.TrimSpace(accept) == "" {
+		return 0, jsonFormat, nil
+	}
+	bestQ, unknown := 0.0, false
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		candidate, cf := 0, jsonFormat
+		switch mediaType {
+		case "application/*", "*/*":
+		default:
+			if candidate, cf = parseMediaType(mediaType); cf == nil {
+				continue
+			}
+			if candidate != 0 && !known(candidate) {
+				unknown = true
+				continue
+			}
+		}
+		if q > bestQ {
+			version, f, bestQ = candidate, cf, q
+		}
+	}
+	switch {
+	case bestQ > 0:
+		return version, f, nil
+	case unknown:
+		return 0, nil, errUnknownVersion
+	default:
+		return 0, nil, errNotAcceptable
+	}
+}
+
+// contentFormat returns the format of a request body labelled contentType,
+// JSON when it is unlabelled, or nil when the format is unsupported.
+func contentFormat(contentType string) *format {
+	if contentType == "" {
+		return jsonFormat
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	_, f := parseMediaType(mediaType)
+	return f
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	userv1 "user-service/api/user/v1"
+	"user-service/internal/model"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFormats(t *testing.T) {
+	r, svc := setupVersionedRouter(t)
+	a, _ := svc.GetUser(context.Background(), "a@example.com")
+	serve := func(method, path, accept, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Accept", accept)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("msgpack", func(t *testing.T) {
+		w := serve("GET", "/v2/users", "application/msgpack", "", nil)
+		var list listEnvelope[userV2]
+		if err := msgpackFormat.decode(w.Body, &list); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected a 200 MessagePack response, got %d %v", w.Code, err)
+		}
+		if w.Header().Get("Content-Type") != "application/msgpack" || list.Meta.Count != 1 || list.Data[0].ID != a.ID || list.Data[0].CreatedAt == nil {
+			t.Errorf("expected the v2 users, got %s %+v", w.Header().Get("Content-Type"), list)
+		}
+
+		w = serve("GET", "/users/a@example.com", "application/vnd.user-service.v2+msgpack", "", nil)
+		var one envelope[userV2]
+		if err := msgpackFormat.decode(w.Body, &one); err != nil || one.Data.Email != a.Email {
+			t.Errorf("expected the v2 user, got %d %v %+v", w.Code, err, one)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/vnd.user-service.v2+msgpack" {
+			t.Errorf("expected the versioned media type, got %q", got)
+		}
+
+		w = serve("GET", "/v2/users?fields=created_at", "application/msgpack", "", nil)
+		var projected listEnvelope[map[string]interface{}]
+		if err := msgpackFormat.decode(w.Body, &projected); err != nil || len(projected.Data) != 1 {
+			t.Fatalf("expected the projected users, got %d %v", w.Code, err)
+		}
+		if created, ok := projected.Data[0]["created_at"].(time.Time); !ok || !created.Equal(*a.CreatedAt) || len(projected.Data[0]) != 1 {
+			t.Errorf("expected created_at only, as a timestamp, got %#v", projected.Data[0])
+		}
+
+		w = serve("GET", "/v2/users/missing", "application/msgpack", "", nil)
+		var failed errorEnvelope
+		if err := msgpackFormat.decode(w.Body, &failed); err != nil || w.Code != http.StatusNotFound || failed.Error.Status != http.StatusNotFound {
+			t.Errorf("expected a 404 error envelope, got %d %v", w.Code, err)
+		}
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		w := serve("GET", "/v2/users", "application/x-protobuf", "", nil)
+		var list userv1.UserList
+		if err := proto.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected a 200 Protobuf response, got %d %v", w.Code, err)
+		}
+		if w.Header().Get("Content-Type") != "application/x-protobuf" || len(list.Users) != 1 || list.Users[0].Id != a.ID || list.Users[0].CreatedAt == nil {
+			t.Errorf("expected the users, got %s %v", w.Header().Get("Content-Type"), &list)
+		}
+
+		if w := serve("GET", "/v2/users?fields=email", "application/x-protobuf", "", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("expected fields to be rejected, got %d", w.Code)
+		}
+	})
+
+	t.Run("requests", func(t *testing.T) {
+		body, _ := proto.Marshal(&userv1.User{Email: "b@example.com", Name: "B", Age: 30})
+		w := serve("POST", "/v2/users", "application/x-protobuf", "application/x-protobuf", body)
+		var created userv1.User
+		if err := proto.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("expected status 201 Created, got %d %v", w.Code, err)
+		}
+		if created.Id == "" || created.Email != "b@example.com" || w.Header().Get("Location") != "/v2/users/"+created.Id {
+			t.Errorf("expected the created user, got %v", &created)
+		}
+
+		var buf bytes.Buffer
+		if err := msgpackFormat.encode(&buf, userInputV2{Name: "Bee", Age: 31}); err != nil {
+			t.Fatal(err)
+		}
+		w = serve("PUT", "/v2/users/"+created.Id, "", "application/msgpack", buf.Bytes())
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 OK, got %d %s", w.Code, w.Body.String())
+		}
+		if got, _ := svc.GetUserByID(context.Background(), created.Id); got == nil || got.Name != "Bee" || got.Age != 31 {
+			t.Errorf("user not updated, got %+v", got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if w := serve("POST", "/v2/users", "", "text/plain", []byte("b@example.com")); w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected 415 for a text body, got %d", w.Code)
+		}
+		if w := serve("GET", "/v2/users", "text/html", "", nil); w.Code != http.StatusNotAcceptable {
+			t.Errorf("expected 406 for HTML only, got %d", w.Code)
+		}
+	})
+}
+
+// benchmarkUsers returns n users with every field set.
+func benchmarkUsers(n int) []*model.User {
+	now := time.Now()
+	users := make([]*model.User, n)
+	for i := range users {
+		users[i] = &model.User{
+			ID:             fmt.Sprintf("%032x", i),
+			Email:          fmt.Sprintf("user%d@example.com", i),
+			Name:           fmt.Sprintf("User %d", i),
+			Age:            20 + i%50,
+			State:          model.StateActive,
+			StateChangedAt: &now,
+			StateReason:    "verified",
+			VerifiedAt:     &now,
+			CreatedAt:      &now,
+			UpdatedAt:      &now,
+		}
+	}
+	return users
+}
+
+// benchmarkFormats are the formats GET /v2/users answers in, with the
+// representation each is encoded from and a list to decode into.
+var benchmarkFormats = []struct {
+	name   string
+	format *format
+	rep    representation
+	list   func() interface{}
+}{
+	{"json", jsonFormat, v2Representation{}, func() interface{} { return &listEnvelope[userV2]{} }},
+	{"msgpack", msgpackFormat, v2Representation{}, func() interface{} { return &listEnvelope[userV2]{} }},
+	{"protobuf", protobufFormat, protobufRepresentation{v2Representation{}}, func() interface{} { return &userv1.UserList{} }},
+}
+
+// encodeUsers writes users as a list response in f.
+func encodeUsers(w io.Writer, f *format, rep representation, users []*model.User) error {
+	shaped := make([]interface{}, len(users))
+	for i, u := range users {
+		shaped[i] = rep.user(u)
+	}
+	return f.encode(w, rep.many(shaped))
+}
+
+func BenchmarkEncodeUsers(b *testing.B) {
+	users := benchmarkUsers(10000)
+	for _, bf := range benchmarkFormats {
+		bf := bf
+		b.Run(bf.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := encodeUsers(&buf, bf.format, bf.rep, users); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(int64(buf.Len()))
+		})
+	}
+}
+
+func BenchmarkDecodeUsers(b *testing.B) {
+	users := benchmarkUsers(10000)
+	for _, bf := range benchmarkFormats {
+		bf := bf
+		b.Run(bf.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			if err := encodeUsers(&buf, bf.format, bf.rep, users); err != nil {
+				b.Fatal(err)
+			}
+			encoded := buf.Bytes()
+			b.SetBytes(int64(len(encoded)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := bf.format.decode(bytes.NewReader(encoded), bf.list()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"user-service/internal/model"
+	"user-service/internal/service"
+
+	"go.uber.org/zap"
+)
+
+type transitionRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *UserHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	h.transitionUser(w, r, model.StateActive)
+}
+
+func (h *UserHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	h.transitionUser(w, r, model.StateSuspended)
+}
+
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.transitionUser(w, r, model.StateDeactivated)
+}
+
+// transitionUser moves the user in the path, addressed by email or ID, to
+// state with the reason from the optional body and responds with the
+// updated user.
+func (h *UserHandler) transitionUser(w http.ResponseWriter, r *http.Request, state model.UserState) {
+	email, err := h.pathEmail(r)
+	if err != nil {
+		h.fail(w, r, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var req transitionRequest
+	if err := versionOf(r).content.decode(r.Body, &req); err != nil && err != io.EOF {
+		h.fail(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	user, err := h.userService.TransitionUser(r.Context(), email, state, req.Reason)
+	if err != nil {
+		h.log(r).Error("Failed to change user state", zap.Error(err))
+		h.fail(w, r, err.Error(), lifecycleErrorStatus(err))
+		return
+	}
+	h.representUser(w, r, http.StatusOK, user)
+}
+
+func lifecycleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrConcurrentUpdate):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidState):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
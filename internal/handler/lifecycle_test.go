@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestLifecycleHandlers(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := service.NewUserService(repository.NewUserRepository(db))
+	handler := NewUserHandler(svc, zaptest.NewLogger(t))
+	r := mux.NewRouter()
+	r.HandleFunc("/users", handler.ListUsers).Methods("GET")
+	r.HandleFunc("/users/{email}/activate", handler.ActivateUser).Methods("POST")
+	r.HandleFunc("/users/{email}/suspend", handler.SuspendUser).Methods("POST")
+
+	_ = svc.CreateUser(context.Background(), &model.User{Email: "a@example.com", Name: "A"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/a@example.com/suspend", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 Conflict suspending a pending user, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/a@example.com/activate", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d", w.Code)
+	}
+
+	body, _ := json.Marshal(transitionRequest{Reason: "abuse"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/a@example.com/suspend", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d", w.Code)
+	}
+	var got model.User
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got.State != model.StateSuspended || got.StateReason != "abuse" {
+		t.Errorf("expected suspended with reason, got %+v", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users?state=suspended", nil))
+	var users []model.User
+	if err := json.NewDecoder(w.Body).Decode(&users); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("expected 1 suspended user, got %d", len(users))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users?state=bogus", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 Bad Request for unknown state, got %d", w.Code)
+	}
+}
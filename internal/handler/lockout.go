@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func (h *UserHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	if err := h.userService.UnlockAccount(r.Context(), email); err != nil {
+		h.log(r).Error("Failed to unlock account", zap.Error(err))
+		http.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientIP returns the IP address of the connecting client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter formats the delay until t in whole seconds for Retry-After.
+func retryAfter(t time.Time) string {
+	secs := math.Ceil(time.Until(t).Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.Itoa(int(secs))
+}
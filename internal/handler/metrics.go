@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RequestMetrics returns router middleware recording, per route template,
+// request counts by status code and request latency in reg. Use it with
+// mux.Router.Use so only matched routes are recorded, which keeps label
+// cardinality bounded.
+func RequestMetrics(reg prometheus.Registerer) mux.MiddlewareFunc {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route and status code.",
+	}, []string{"method", "route", "code"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+	reg.MustRegister(requests, duration, inFlight)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			route := "unmatched"
+			if cur := mux.CurrentRoute(r); cur != nil {
+				if tmpl, err := cur.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			requests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+			duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r := mux.NewRouter()
+	r.Use(RequestMetrics(reg))
+	r.HandleFunc("/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "User not found", http.StatusNotFound)
+	}).Methods("GET")
+
+	for _, path := range []string{"/users/a@example.com", "/users/b@example.com"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	want := `
+# HELP http_requests_total HTTP requests by route and status code.
+# TYPE http_requests_total counter
+http_requests_total{code="404",method="GET",route="/users/{email}"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(reg, "http_request_duration_seconds"); n != 1 {
+		t.Errorf("expected one latency histogram, got %d", n)
+	}
+}
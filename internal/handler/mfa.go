@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// RequestMFAEnrollment emails the user a link to enroll in MFA. It
+// answers 202 whether or not the user exists.
+func (h *UserHandler) RequestMFAEnrollment(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	if err := h.userService.RequestMFAEnrollment(r.Context(), email); err != nil {
+		h.log(r).Error("Failed to send MFA enrollment email", zap.Error(err))
+		http.Error(w, err.Error(), mfaErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// EnrollTOTP starts enrollment for the holder of a token from
+// RequestMFAEnrollment.
+func (h *UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	setup, err := h.userService.EnrollTOTP(r.Context(), email, req.Token)
+	if err != nil {
+		h.log(r).Error("Failed to enroll TOTP", zap.Error(err))
+		http.Error(w, err.Error(), mfaErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(setup); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+func (h *UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	ctx := service.ContextWithClientIP(r.Context(), forwardedClientIP(r, h.trustedProxies))
+	codes, err := h.userService.ConfirmTOTP(ctx, email, req.Code)
+	if err != nil {
+		h.log(r).Error("Failed to confirm TOTP", zap.Error(err))
+		var locked *service.LockedError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", retryAfter(locked.Until))
+		}
+		http.Error(w, err.Error(), mfaErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// VerifyMFA accepts either a TOTP code or a recovery code.
+func (h *UserHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	ctx := service.ContextWithClientIP(r.Context(), forwardedClientIP(r, h.trustedProxies))
+	var err error
+	if req.RecoveryCode != "" {
+		err = h.userService.VerifyRecoveryCode(ctx, email, req.RecoveryCode)
+	} else {
+		err = h.userService.VerifyTOTP(ctx, email, req.Code)
+	}
+	if err != nil {
+		h.log(r).Info("MFA verification failed", zap.Error(err))
+		var locked *service.LockedError
+		if errors.As(err, &locked) {
+			w.Header().Set("Retry-After", retryAfter(locked.Until))
+		}
+		http.Error(w, err.Error(), mfaErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	if err := h.userService.ResetMFA(r.Context(), email); err != nil {
+		h.log(r).Error("Failed to reset MFA", zap.Error(err))
+		http.Error(w, err.Error(), mfaErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrMFANotEnrolled):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrMFAAlreadyEnrolled):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidToken):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrAccountLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrAccountInactive):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrMFAUnavailable), errors.Is(err, service.ErrEmailUnavailable):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupMFARouter(t *testing.T, opts ...Option) (*mux.Router, service.UserService, *mailer.Outbox) {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	outbox := mailer.NewOutbox()
+	svc := service.NewUserService(
+		repository.NewUserRepository(db),
+		service.WithMFARepository(repository.NewMFARepository(db)),
+		service.WithTokenRepository(repository.NewTokenRepository(db)),
+		service.WithMailer(outbox),
+		service.WithLinkBaseURL("https://app.example.com"),
+	)
+	handler := NewUserHandler(svc, zaptest.NewLogger(t), opts...)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/users", handler.CreateUser).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/totp/request", handler.RequestMFAEnrollment).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/totp", handler.EnrollTOTP).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/totp/confirm", handler.ConfirmTOTP).Methods("POST")
+	r.HandleFunc("/users/{email}/mfa/verify", handler.VerifyMFA).Methods("POST")
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminAuth("secret-token"))
+	admin.HandleFunc("/users/{email}/mfa", handler.ResetMFA).Methods("DELETE")
+	admin.HandleFunc("/users/{email}/lockout", handler.UnlockAccount).Methods("DELETE")
+	return r, svc, outbox
+}
+
+// enroll posts to the TOTP enrollment route for email with token.
+func enroll(r http.Handler, email, token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(tokenRequest{Token: token})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/"+email+"/mfa/totp", bytes.NewReader(body)))
+	return w
+}
+
+func TestMFAHandlers(t *testing.T) {
+	r, svc, outbox := setupMFARouter(t)
+
+	body, _ := json.Marshal(model.User{Email: "mfa@example.com", Name: "MFA", Age: 30})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 Created, got %d", w.Code)
+	}
+
+	// Enrollment requires the token from the emailed link
+	if w = enroll(r, "mfa@example.com", "forged"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 Bad Request without a valid token, got %d", w.Code)
+	}
+	for _, email := range []string{"mfa@example.com", "missing@example.com"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/users/"+email+"/mfa/totp/request", nil))
+		if w.Code != http.StatusAccepted {
+			t.Errorf("expected status 202 Accepted requesting enrollment for %s, got %d", email, w.Code)
+		}
+	}
+	_ = svc.(service.Drainer).Drain(context.Background())
+	msgs := outbox.Messages()
+	if len(msgs) != 1 || msgs[0].To != "mfa@example.com" {
+		t.Fatalf("expected one enrollment email to the user, got %+v", msgs)
+	}
+	link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(msgs[0].Body))
+	if err != nil {
+		t.Fatalf("no link in enrollment email: %v", err)
+	}
+
+	if w = enroll(r, "mfa@example.com", link.Query().Get("token")); w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 Created, got %d", w.Code)
+	}
+	var setup model.TOTPSetup
+	if err := json.NewDecoder(w.Body).Decode(&setup); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if setup.Secret == "" || setup.URI == "" {
+		t.Errorf("expected secret and URI, got %+v", setup)
+	}
+
+	w = httptest.NewRecorder()
+	body, _ = json.Marshal(mfaCodeRequest{Code: "000000"})
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/users/mfa@example.com/mfa/totp/confirm", bytes.NewReader(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 Unauthorized for wrong code, got %d", w.Code)
+	}
+
+}
+
+func TestAdminAuth(t *testing.T) {
+	r, _, _ := setupMFARouter(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/admin/users/mfa@example.com/mfa", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 Unauthorized without token, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("DELETE", "/admin/users/mfa@example.com/mfa", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 Not Found for user without enrollment, got %d", w.Code)
+	}
+}
+
+func TestVerifyMFALockout(t *testing.T) {
+	r, _, _ := setupMFARouter(t)
+	body, _ := json.Marshal(mfaCodeRequest{Code: "000000"})
+
+	verify := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/users/ghost@example.com/mfa/verify", bytes.NewReader(body)))
+		return w
+	}
+
+	// Unknown emails fail exactly like wrong codes until locked
+	for i := 0; i < service.DefaultLockoutPolicy().AccountThreshold; i++ {
+		if w := verify(); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401 Unauthorized, got %d", i, w.Code)
+		}
+	}
+	w := verify()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 Too Many Requests, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	req := httptest.NewRequest("DELETE", "/admin/users/ghost@example.com/lockout", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204 No Content, got %d", w.Code)
+	}
+	if w := verify(); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 Unauthorized after unlock, got %d", w.Code)
+	}
+}
+
+func TestMFALockoutBehindProxy(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, _ := setupMFARouter(t, WithTrustedProxies(trusted))
+	body, _ := json.Marshal(mfaCodeRequest{Code: "000000"})
+
+	verify := func(email, client string) int {
+		req := httptest.NewRequest("POST", "/users/"+email+"/mfa/verify", bytes.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", client)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// One client guessing across accounts locks out its own address only
+	policy := service.DefaultLockoutPolicy()
+	for i := 0; i < policy.IPThreshold; i++ {
+		email := fmt.Sprintf("ghost%d@example.com", i/policy.AccountThreshold)
+		if code := verify(email, "1.1.1.1"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status 401 Unauthorized, got %d", i, code)
+		}
+	}
+	if code := verify("other@example.com", "1.1.1.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the guessing client to be locked out, got %d", code)
+	}
+	if code := verify("other@example.com", "2.2.2.2"); code != http.StatusUnauthorized {
+		t.Errorf("expected another client behind the proxy not to be locked out, got %d", code)
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+	"user-service/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits which incoming request IDs are propagated, so
+// clients cannot inject arbitrary text into logs and responses.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,128}$`)
+
+// requestInfo is shared by the middleware and handlers further down the
+// chain, which see a different *http.Request.
+type requestInfo struct {
+	id        string
+	principal string
+}
+
+type requestInfoKey struct{}
+
+func getRequestInfo(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// RequestID returns the ID assigned to the request by RequestLogger.
+func RequestID(ctx context.Context) string {
+	if info := getRequestInfo(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// setPrincipal records who made the request, for the access log.
+func setPrincipal(r *http.Request, principal string) {
+	if info := getRequestInfo(r.Context()); info != nil {
+		info.principal = principal
+	}
+}
+
+// principal returns who made the request, or "anonymous".
+func principal(r *http.Request) string {
+	if info := getRequestInfo(r.Context()); info != nil && info.principal != "" {
+		return info.principal
+	}
+	return "anonymous"
+}
+
+// RequestLogger wraps router so every request gets an X-Request-ID, a
+// child logger carrying it in its context (see logger.FromContext), and
+// one access log line once it completes.
+func RequestLogger(base *zap.Logger, router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &requestInfo{id: id}
+		reqLogger := base.With(zap.String("request_id", id))
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		ctx = logger.NewContext(ctx, reqLogger)
+		r = r.WithContext(ctx)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		router.ServeHTTP(rec, r)
+
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("route", routeTemplate(router, r)),
+			zap.Int("status", rec.status),
+			zap.Int64("bytes", rec.bytes),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("principal", principal(r)),
+		}
+		accessLogger := logger.FromContext(r.Context(), reqLogger)
+		if rec.status >= http.StatusInternalServerError {
+			accessLogger.Error("request", fields...)
+		} else {
+			accessLogger.Info("request", fields...)
+		}
+	})
+}
+
+// routeTemplate returns the template of the route matching r, such as
+// /users/{email}, so access logs do not contain path parameters.
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.Route == nil {
+		return "unmatched"
+	}
+	tmpl, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+	return tmpl
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// responseRecorder captures the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestLogger(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	core, logs := observer.New(zapcore.DebugLevel)
+	base := zap.New(core)
+
+	svc := service.NewUserService(repository.NewUserRepository(db),
+		service.WithAuditRepository(repository.NewAuditRepository(db)))
+	handler := NewUserHandler(svc, zap.NewNop())
+	r := mux.NewRouter()
+	r.HandleFunc("/users/{email}", handler.GetUser).Methods("GET")
+	r.HandleFunc("/users/{email}", handler.DeleteUser).Methods("DELETE")
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminAuth("secret"))
+	admin.HandleFunc("/users/{email}/lockout", handler.UnlockAccount).Methods("DELETE")
+	srv := RequestLogger(base, r)
+
+	_ = svc.CreateUser(context.Background(), &model.User{Email: "a@example.com", Name: "A"})
+
+	// Incoming request IDs are propagated to the response and every log
+	// line written for the request, including the handler's and service's.
+	req := httptest.NewRequest("DELETE", "/users/a@example.com", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if got := w.Header().Get(RequestIDHeader); got != "req-123" {
+		t.Errorf("expected request ID req-123, got %q", got)
+	}
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/users/a@example.com", nil)
+	req.Header.Set(RequestIDHeader, "req-456")
+	srv.ServeHTTP(w, req)
+
+	if n := logs.FilterField(zap.String("request_id", "req-123")).FilterMessage("Audit event").Len(); n != 1 {
+		t.Errorf("expected service audit log with request ID, got %d", n)
+	}
+	if n := logs.FilterField(zap.String("request_id", "req-456")).FilterMessage("User not found").Len(); n != 1 {
+		t.Errorf("expected handler log with request ID, got %d", n)
+	}
+
+	access := logs.FilterMessage("request").FilterField(zap.String("request_id", "req-456")).All()
+	if len(access) != 1 {
+		t.Fatalf("expected one access log line, got %d", len(access))
+	}
+	fields := access[0].ContextMap()
+	if fields["method"] != "GET" || fields["route"] != "/users/{email}" || fields["status"] != int64(http.StatusNotFound) || fields["principal"] != "anonymous" {
+		t.Errorf("unexpected access log fields: %v", fields)
+	}
+	if fields["bytes"].(int64) == 0 {
+		t.Errorf("expected response bytes to be logged: %v", fields)
+	}
+	if _, ok := fields["latency"]; !ok {
+		t.Errorf("expected latency to be logged: %v", fields)
+	}
+
+	// Invalid IDs are replaced, and authenticated principals are logged.
+	req = httptest.NewRequest("DELETE", "/admin/users/a@example.com/lockout", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" || id == "bad id\n" {
+		t.Errorf("expected a generated request ID, got %q", id)
+	}
+	access = logs.FilterMessage("request").FilterField(zap.String("request_id", id)).All()
+	if len(access) != 1 || access[0].ContextMap()["principal"] != "admin" {
+		t.Errorf("expected admin principal in access log, got %v", access)
+	}
+}
@@ -0,0 +1,497 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"user-service/internal/filter"
+	"user-service/internal/model"
+	"user-service/internal/openapi"
+)
+
+// Describe adds the user and admin routes to doc.
+func Describe(doc *openapi.Document) {
+	doc.Enum(model.StatePending, model.StateActive, model.StateSuspended, model.StateDeactivated)
+
+	mfaErrors := map[string]*openapi.Response{
+		"404": textError("User not found or not enrolled"),
+		"409": textError("Already enrolled"),
+		"401": textError("Invalid code"),
+		"429": lockedOut(),
+		"403": textError("Account inactive"),
+		"501": textError("MFA is not configured"),
+		"500": textError("Internal error"),
+	}
+	emailErrors := map[string]*openapi.Response{
+		"400": textError("Invalid request payload, token or password"),
+		"404": textError("User not found"),
+		"403": textError("Account inactive"),
+		"501": textError("Email is not configured"),
+		"500": textError("Internal error"),
+	}
+	privacyErrors := map[string]*openapi.Response{
+		"404": textError("User or erasure not found"),
+		"501": textError("Privacy operations are not configured"),
+		"500": textError("Internal error"),
+	}
+
+	describeUsers(doc)
+
+	enrollErrors := with(with(mfaErrors, "400", textError("Invalid request payload or token")),
+		"501", textError("MFA or email is not configured"))
+	doc.Add("POST", "/users/{email}/mfa/totp/request", &openapi.Operation{
+		OperationID: "requestMFAEnrollment", Summary: "Email the user a link to enroll in MFA", Tags: []string{"mfa"},
+		Description: "Answered 202 whether or not the user exists; the link is sent in the background.",
+		Responses: map[string]*openapi.Response{
+			"202": openapi.Respond("Enrollment email sent if the user exists"),
+			"501": enrollErrors["501"],
+		},
+	})
+	doc.Add("POST", "/users/{email}/mfa/totp", &openapi.Operation{
+		OperationID: "enrollTOTP", Summary: "Start TOTP enrollment", Tags: []string{"mfa"},
+		Description: "Requires the token from the link emailed by POST /users/{email}/mfa/totp/request, proving the caller owns the account.",
+		RequestBody: openapi.Body(openapi.JSON, doc.Schema(tokenRequest{}), map[string]string{"token": "..."}),
+		Responses:   with(enrollErrors, "201", openapi.RespondWith("The TOTP secret", openapi.JSON, doc.Schema(model.TOTPSetup{}))),
+	})
+	doc.Add("POST", "/users/{email}/mfa/totp/confirm", &openapi.Operation{
+		OperationID: "confirmTOTP", Summary: "Confirm TOTP enrollment", Tags: []string{"mfa"},
+		RequestBody: openapi.Body(openapi.JSON, doc.Schema(mfaCodeRequest{}), map[string]string{"code": "123456"}),
+		Responses: with(with(mfaErrors, "400", textError("Invalid request payload")),
+			"200", openapi.RespondWith("Single use recovery codes", openapi.JSON, doc.Schema(recoveryCodesResponse{}))),
+	})
+	doc.Add("POST", "/users/{email}/mfa/verify", &openapi.Operation{
+		OperationID: "verifyMFA", Summary: "Verify a TOTP or recovery code", Tags: []string{"mfa"},
+		RequestBody: openapi.Body(openapi.JSON, doc.Schema(mfaCodeRequest{}), map[string]string{"code": "123456"}),
+		Responses: with(with(mfaErrors, "400", textError("Invalid request payload")),
+			"204", openapi.Respond("Code accepted")),
+	})
+
+	doc.Add("POST", "/users/{email}/verification", &openapi.Operation{
+		OperationID: "requestEmailVerification", Summary: "Email the user a verification link", Tags: []string{"email"},
+		Description: "Answered 202 whether or not the user exists; the link is sent in the background.",
+		Responses: map[string]*openapi.Response{
+			"202": openapi.Respond("Verification email sent if the user exists"),
+			"501": emailErrors["501"],
+		},
+	})
+	doc.Add("POST", "/email/verify", &openapi.Operation{
+		OperationID: "verifyEmail", Summary: "Confirm an email address", Tags: []string{"email"},
+		RequestBody: openapi.Body(openapi.JSON, doc.Schema(tokenRequest{}), map[string]string{"token": "..."}),
+		Responses:   with(emailErrors, "204", openapi.Respond("Email verified")),
+	})
+	doc.Add("POST", "/password/forgot", &openapi.Operation{
+		OperationID: "forgotPassword", Summary: "Email a password reset link", Tags: []string{"email"},
+		RequestBody: openapi.Body(openapi.JSON, doc.Schema(forgotPasswordRequest{}), forgotPasswordRequest{Email: "alice@example.com"}),
+		Responses:   with(emailErrors, "202", openapi.Respond("Reset email sent")),
+	})
+	doc.Add("POST", "/password/reset", &openapi.Operation{
+		OperationID: "resetPassword", Summary: "Set a new password", Tags: []string{"email"},
+		RequestBody: openapi.Body(openapi.JSON, doc.Schema(tokenRequest{}), map[string]string{"token": "...", "password": "correct horse battery"}),
+		Responses:   with(emailErrors, "204", openapi.Respond("Password changed")),
+	})
+
+	admin := func(method, path string, op *openapi.Operation) {
+		op.Tags = []string{"admin"}
+		op.Security = AdminSecurity(doc)
+		op.Responses = with(with(op.Responses, "401", textError("Missing or invalid token")),
+			"403", textError("Admin API disabled"))
+		doc.Add(method, "/admin"+path, op)
+	}
+	admin("DELETE", "/users/{email}/mfa", &openapi.Operation{
+		OperationID: "resetMFA", Summary: "Reset a user's MFA enrollment",
+		Responses: with(mfaErrors, "204", openapi.Respond("Enrollment removed")),
+	})
+	admin("DELETE", "/users/{email}/lockout", &openapi.Operation{
+		OperationID: "unlockAccount", Summary: "Clear failed attempts and unlock an account",
+		Responses: map[string]*openapi.Response{
+			"204": openapi.Respond("Account unlocked"),
+			"500": textError("Internal error"),
+		},
+	})
+	admin("GET", "/users/{email}/export", &openapi.Operation{
+		OperationID: "exportUserData", Summary: "Download everything stored about a user",
+		Description: "A zip archive of profile.json, mfa.json, tokens.json, audit_events.json and manifest.json.",
+		Responses: with(privacyErrors, "200", openapi.RespondWith("Export archive", "application/zip",
+			&openapi.Schema{Type: openapi.Types{"string"}, Format: "binary"})),
+	})
+	tombstone := doc.Schema(model.Tombstone{})
+	admin("POST", "/users/{email}/erasure", &openapi.Operation{
+		OperationID: "eraseUser", Summary: "Erase a user everywhere",
+		Responses: with(privacyErrors, "200", openapi.RespondWith("The erasure tombstone", openapi.JSON, tombstone)),
+	})
+	admin("GET", "/erasures/{email}", &openapi.Operation{
+		OperationID: "getErasure", Summary: "Look up the tombstone proving an email was erased",
+		Responses: with(privacyErrors, "200", openapi.RespondWith("The erasure tombstone", openapi.JSON, tombstone)),
+	})
+	admin("POST", "/keys/rotate", &openapi.Operation{
+		OperationID: "rotateEncryptionKeys", Summary: "Re-encrypt stored users with the current key",
+		Responses: map[string]*openapi.Response{
+			"200": openapi.RespondWith("Number of users re-encrypted", openapi.JSON, doc.Schema(rotateKeysResponse{})),
+			"501": textError("Encryption at rest is not configured"),
+			"500": textError("Internal error"),
+		},
+	})
+}
+
+// describeUsers adds the user routes of every API version to doc: v1 under
+// /v1, v2 under /v2, and the unversioned routes, which serve either.
+func describeUsers(doc *openapi.Document) {
+	user := doc.Define("User", userV1{})
+	doc.Define("UserV2", userV2{})
+	doc.Define("ListMeta", listMeta{})
+	doc.Define("APIError", apiError{})
+	oneV2 := doc.Define("UserV2Envelope", envelope[userV2]{})
+	manyV2 := doc.Define("UserV2ListEnvelope", listEnvelope[userV2]{})
+	errorV2 := doc.Define("ErrorEnvelope", errorEnvelope{})
+	inputV2 := doc.Define("UserV2Input", userInputV2{})
+	// Users embed the related resources expand= asks for.
+	groups := openapi.ArrayOf(doc.Schema(groupRef{}))
+	for _, name := range []string{"User", "UserV2"} {
+		s := doc.Components.Schemas[name]
+		s.Properties[expandGroups] = groups
+	}
+	example := userV1{Email: "bob@example.com", Name: "Bob", Age: 30}
+	exampleV2 := userInputV2{Email: "bob@example.com", Name: "Bob", Age: 30}
+
+	deprecation := map[string]*openapi.Header{
+		"Deprecation": {Description: "When v1 was deprecated, as @ and a Unix time.", Schema: openapi.String()},
+		"Sunset":      {Description: "When v1 will be removed, once decided.", Schema: openapi.String()},
+		"Link":        {Description: "The successor-version of v1.", Schema: openapi.String()},
+	}
+	// Bodies in version v are the same in JSON and MessagePack, and users
+	// are also served as Protobuf messages, in every version.
+	content := func(v int, s *openapi.Schema) map[string]*openapi.MediaType {
+		return map[string]*openapi.MediaType{
+			openapi.JSON: {Schema: s}, MediaType(v): {Schema: s},
+			msgpackFormat.mediaType: {Schema: s}, msgpackFormat.versioned(v): {Schema: s},
+		}
+	}
+	message := &openapi.MediaType{Schema: &openapi.Schema{Type: openapi.Types{"string"}, Format: "binary"}}
+	body := func(s *openapi.Schema, example interface{}) *openapi.RequestBody {
+		b := openapi.Body(openapi.JSON, s, example)
+		b.Content[msgpackFormat.mediaType] = &openapi.MediaType{Schema: s}
+		b.Content[protobufFormat.mediaType] = message
+		return b
+	}
+	// v1 answers with the deprecation headers, and errors in plain text.
+	v1 := func(description string, s *openapi.Schema) *openapi.Response {
+		r := openapi.Respond(description)
+		if s != nil {
+			r.Content = content(V1, s)
+			r.Content[protobufFormat.mediaType] = message
+		}
+		r.Headers = deprecation
+		return r
+	}
+	// v2 answers in envelopes, errors included, but for Protobuf messages.
+	v2 := func(description string, s *openapi.Schema) *openapi.Response {
+		r := openapi.Respond(description)
+		if s != nil {
+			r.Content = content(V2, s)
+			r.Content[protobufFormat.mediaType] = message
+		}
+		return r
+	}
+	v2Error := func(description string) *openapi.Response {
+		r := openapi.Respond(description)
+		r.Content = content(V2, errorV2)
+		r.Content[openapi.Text] = &openapi.MediaType{Schema: openapi.String()}
+		return r
+	}
+	// Unversioned routes answer in the version the Accept header asks for.
+	negotiated := func(description string, s, sV2 *openapi.Schema) *openapi.Response {
+		r := v1(description, s)
+		r.Content[MediaType(V2)] = &openapi.MediaType{Schema: sV2}
+		r.Content[msgpackFormat.versioned(V2)] = &openapi.MediaType{Schema: sV2}
+		return r
+	}
+	negotiatedError := func(description string) *openapi.Response {
+		r := textError(description)
+		r.Content[MediaType(V2)] = &openapi.MediaType{Schema: errorV2}
+		r.Content[msgpackFormat.versioned(V2)] = &openapi.MediaType{Schema: errorV2}
+		return r
+	}
+	notAcceptable := textError("Only unsupported API versions or media types are acceptable")
+	unsupported := textError("The request body is in an unsupported media type")
+	state := &openapi.Parameter{Name: "state", In: "query", Description: "Only list users in this lifecycle state.", Schema: doc.Schema(model.StateActive)}
+	where := &openapi.Parameter{
+		Name: "filter", In: "query", Schema: openapi.String(), Example: `age ge 18 and name sw "Al"`,
+		Description: "Only list users matching this expression, which compares fields of " + strings.Join(filter.Fields(), ", ") +
+			" with eq, ne, gt, ge, lt and le, strings with sw, ew and co, tests them with pr, and combines comparisons with and, or, not and parentheses.",
+	}
+	expand := &openapi.Parameter{
+		Name: "expand", In: "query", Schema: openapi.String(), Example: expandGroups,
+		Description: fmt.Sprintf("Comma separated related resources to embed in users: %s, the groups each belongs to.", expandGroups),
+	}
+	// fields selects among the fields of user, leaving out even required ones.
+	projection := func(user interface{}) []*openapi.Parameter {
+		return []*openapi.Parameter{{
+			Name: "fields", In: "query", Schema: openapi.String(), Example: "email,name",
+			Description: "Comma separated fields to include in users, of " + strings.Join(fieldNames(user), ", ") +
+				". The others are left out, even if they are otherwise required.",
+		}, expand}
+	}
+	v1Params, v2Params := projection(userV1{}), projection(userV2{})
+	// Reads are answered 304 while the client's copy is current, unless
+	// they expand related resources.
+	conditional := []*openapi.Parameter{
+		{Name: "If-None-Match", In: "header", Schema: openapi.String(), Description: "ETags of copies the client holds."},
+		{Name: "If-Modified-Since", In: "header", Schema: openapi.String(), Description: "When the client's copy was last modified. Ignored with If-None-Match."},
+	}
+	validated := map[string]*openapi.Header{
+		"ETag":          {Description: "Changes whenever the user, or for lists any user, is written.", Schema: openapi.String()},
+		"Last-Modified": {Description: "When the user was last updated, if it is known.", Schema: openapi.String()},
+		"Cache-Control": {Description: CacheRevalidate + ": revalidate before every use.", Schema: openapi.String()},
+	}
+	unmodified := &openapi.Response{Description: "The client's copy is current", Headers: validated}
+	notImplemented := "An expansion is not configured"
+	v1Only := "Requests for v2 in the Accept header are answered as by the /v2 route."
+
+	type route struct {
+		method, path, id, summary, description string
+		body                                   *openapi.RequestBody
+		params                                 []*openapi.Parameter
+		responses                              map[string]*openapi.Response
+	}
+	for prefix, routes := range map[string][]route{
+		"": {
+			{"POST", "/users", "createUser", "Create a user", v1Only,
+				body(user, example), nil, map[string]*openapi.Response{
+					"201": v1("User created", nil),
+					"400": negotiatedError("Invalid request payload or user"),
+				}},
+			{"GET", "/users", "listUsers", "List users", "", nil, append([]*openapi.Parameter{state, where}, v1Params...), map[string]*openapi.Response{
+				"200": negotiated("Users", openapi.ArrayOf(user), manyV2),
+				"400": negotiatedError("Invalid state, filter, field or expansion"),
+				"501": negotiatedError(notImplemented),
+				"500": negotiatedError("Internal error"),
+			}},
+			{"GET", "/users/{email}", "getUser", "Get a user", "", nil, v1Params, map[string]*openapi.Response{
+				"200": negotiated("The user", user, oneV2),
+				"400": negotiatedError("Unknown field or expansion"),
+				"501": negotiatedError(notImplemented),
+				"404": negotiatedError("User not found"),
+			}},
+			{"PUT", "/users/{email}", "updateUser", "Replace a user",
+				"The email in the path takes precedence over the one in the body. " + v1Only,
+				body(user, example), nil, map[string]*openapi.Response{
+					"200": v1("User updated", nil),
+					"400": negotiatedError("Invalid request payload or user"),
+				}},
+			{"DELETE", "/users/{email}", "deleteUser", "Soft-delete a user", "", nil, nil, map[string]*openapi.Response{
+				"204": v1("User deleted", nil),
+				"400": negotiatedError("User not found or already deleted"),
+			}},
+		},
+		"/v1": {
+			{"POST", "/users", "createUserV1", "Create a user", "", body(user, example), nil, map[string]*openapi.Response{
+				"201": v1("User created", nil),
+				"400": textError("Invalid request payload or user"),
+			}},
+			{"GET", "/users", "listUsersV1", "List users", "", nil, append([]*openapi.Parameter{state, where}, v1Params...), map[string]*openapi.Response{
+				"200": v1("Users", openapi.ArrayOf(user)),
+				"400": textError("Invalid state, filter, field or expansion"),
+				"501": textError(notImplemented),
+				"500": textError("Internal error"),
+			}},
+			{"GET", "/users/{email}", "getUserV1", "Get a user", "", nil, v1Params, map[string]*openapi.Response{
+				"200": v1("The user", user),
+				"400": textError("Unknown field or expansion"),
+				"501": textError(notImplemented),
+				"404": textError("User not found"),
+			}},
+			{"PUT", "/users/{email}", "updateUserV1", "Replace a user", "The email in the path takes precedence over the one in the body.",
+				body(user, example), nil, map[string]*openapi.Response{
+					"200": v1("User updated", nil),
+					"400": textError("Invalid request payload or user"),
+				}},
+			{"DELETE", "/users/{email}", "deleteUserV1", "Soft-delete a user", "", nil, nil, map[string]*openapi.Response{
+				"204": v1("User deleted", nil),
+				"400": textError("User not found or already deleted"),
+			}},
+		},
+		"/v2": {
+			{"POST", "/users", "createUserV2", "Create a user", "", body(inputV2, exampleV2), nil, map[string]*openapi.Response{
+				"201": v2("The created user, also at its Location", oneV2),
+				"400": v2Error("Invalid request payload or user"),
+			}},
+			{"GET", "/users", "listUsersV2", "List users", "", nil, append([]*openapi.Parameter{state, where}, v2Params...), map[string]*openapi.Response{
+				"200": v2("Users", manyV2),
+				"400": v2Error("Invalid state, filter, field or expansion"),
+				"501": v2Error(notImplemented),
+				"500": v2Error("Internal error"),
+			}},
+			{"GET", "/users/{id}", "getUserV2", "Get a user by ID", "", nil, v2Params, map[string]*openapi.Response{
+				"200": v2("The user", oneV2),
+				"400": v2Error("Unknown field or expansion"),
+				"501": v2Error(notImplemented),
+				"404": v2Error("User not found"),
+			}},
+			{"PUT", "/users/{id}", "updateUserV2", "Replace a user", "The email of a user cannot be changed; the one in the body is ignored.",
+				body(inputV2, exampleV2), nil, map[string]*openapi.Response{
+					"200": v2("The updated user", oneV2),
+					"400": v2Error("Invalid request payload or user"),
+					"404": v2Error("User not found"),
+				}},
+			{"DELETE", "/users/{id}", "deleteUserV2", "Soft-delete a user", "", nil, nil, map[string]*openapi.Response{
+				"204": v2("User deleted", nil),
+				"400": v2Error("User already deleted"),
+				"404": v2Error("User not found"),
+			}},
+		},
+	} {
+		for _, rt := range routes {
+			rt.responses["406"] = notAcceptable
+			if rt.method == "GET" {
+				rt.params = append(rt.params, conditional...)
+				ok := *rt.responses["200"]
+				ok.Headers = make(map[string]*openapi.Header, len(ok.Headers)+len(validated))
+				for _, headers := range []map[string]*openapi.Header{rt.responses["200"].Headers, validated} {
+					for name, h := range headers {
+						ok.Headers[name] = h
+					}
+				}
+				rt.responses["200"] = &ok
+				rt.responses["304"] = unmodified
+			}
+			if rt.body != nil {
+				rt.responses["415"] = unsupported
+			}
+			doc.Add(rt.method, prefix+rt.path, &openapi.Operation{
+				OperationID: rt.id, Summary: rt.summary, Description: rt.description, Tags: []string{"users"},
+				RequestBody: rt.body, Parameters: rt.params, Responses: rt.responses,
+				Deprecated: prefix == "/v1",
+			})
+		}
+	}
+
+	doc.Add("GET", "/users/search", &openapi.Operation{
+		OperationID: "searchUsers", Summary: "Find users by partial or misspelled names and emails", Tags: []string{"users"},
+		Description: "Users match when every word of q is a word of their name or email, starts one, or is spelled like one. " +
+			"The best matches come first, with the parts of their fields that matched marked with <em> in highlights.",
+		Parameters: []*openapi.Parameter{
+			{Name: "q", In: "query", Required: true, Schema: openapi.String(), Example: "ali", Description: "Words to search for."},
+			{Name: "limit", In: "query", Schema: openapi.Integer(), Description: fmt.Sprintf("Results per page, at most %d. Defaults to %d.", maxSearchLimit, defaultSearchLimit)},
+			{Name: "offset", In: "query", Schema: openapi.Integer(), Description: "Results to skip."},
+		},
+		Responses: map[string]*openapi.Response{
+			"200": openapi.RespondWith("A page of matching users, best first", openapi.JSON, doc.Schema(searchPage{})),
+			"400": textError("Missing query, or invalid limit or offset"),
+			"501": textError("Search is not configured"),
+			"500": textError("Internal error"),
+		},
+	})
+
+	doc.Add("POST", "/admin/users/{email}/undelete", &openapi.Operation{
+		OperationID: "undeleteUser", Summary: "Restore a deleted user within the retention window", Tags: []string{"users"},
+		Security: AdminSecurity(doc),
+		Responses: map[string]*openapi.Response{
+			"200": negotiated("The restored user", user, oneV2),
+			"401": textError("Missing or invalid token"),
+			"403": textError("Admin API disabled"),
+			"404": negotiatedError("User not found"),
+			"406": notAcceptable,
+			"410": negotiatedError("Retention window expired"),
+			"500": negotiatedError("Internal error"),
+		},
+	})
+
+	transition := doc.Schema(transitionRequest{})
+	for _, t := range []struct{ path, id, summary string }{
+		{"activate", "activateUser", "Activate a pending, suspended or deactivated user"},
+		{"suspend", "suspendUser", "Suspend an active user"},
+		{"deactivate", "deactivateUser", "Deactivate a user"},
+	} {
+		body := openapi.Body(openapi.JSON, transition, transitionRequest{Reason: "Requested by support"})
+		body.Content[msgpackFormat.mediaType] = &openapi.MediaType{Schema: transition}
+		body.Required = false
+		doc.Add("POST", "/admin/users/{email}/"+t.path, &openapi.Operation{
+			OperationID: t.id, Summary: t.summary, Tags: []string{"lifecycle"},
+			Security:    AdminSecurity(doc),
+			RequestBody: body,
+			Responses: map[string]*openapi.Response{
+				"200": negotiated("The user in its new state", user, oneV2),
+				"400": negotiatedError("Invalid request payload"),
+				"401": textError("Missing or invalid token"),
+				"403": textError("Admin API disabled"),
+				"404": negotiatedError("User not found"),
+				"406": notAcceptable,
+				"409": negotiatedError("The transition is not allowed from the current state, or the user kept changing"),
+				"415": unsupported,
+				"500": negotiatedError("Internal error"),
+			},
+		})
+		doc.Add("POST", "/admin/v2/users/{id}/"+t.path, &openapi.Operation{
+			OperationID: t.id + "V2", Summary: t.summary + " by ID", Tags: []string{"lifecycle"},
+			Security:    AdminSecurity(doc),
+			RequestBody: body,
+			Responses: map[string]*openapi.Response{
+				"200": v2("The user in its new state", oneV2),
+				"400": v2Error("Invalid request payload"),
+				"401": textError("Missing or invalid token"),
+				"403": textError("Admin API disabled"),
+				"404": v2Error("User not found"),
+				"406": notAcceptable,
+				"409": v2Error("The transition is not allowed from the current state, or the user kept changing"),
+				"415": unsupported,
+				"500": v2Error("Internal error"),
+			},
+		})
+	}
+}
+
+// AdminSecurity returns the security requirement of routes behind
+// AdminAuth.
+func AdminSecurity(doc *openapi.Document) []map[string][]string {
+	return doc.BearerAuth("adminToken", "The ADMIN_TOKEN. Admin routes answer 403 when it is unset.")
+}
+
+// Describe adds the 429 response to every operation in doc that l limits.
+// Call it once every route is described.
+func (l *RateLimiter) Describe(doc *openapi.Document) {
+	limited := doc.DefineResponse("TooManyRequests", &openapi.Response{
+		Description: "Rate limit exceeded",
+		Headers: map[string]*openapi.Header{
+			"Retry-After": {Description: "Seconds until a request will be admitted.", Schema: openapi.Integer()},
+		},
+		Content: map[string]*openapi.MediaType{openapi.Problem: {Schema: doc.Schema(problem{})}},
+	})
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			if _, ok := op.Responses["429"]; ok {
+				continue
+			}
+			limit := l.cfg.Default
+			if route, ok := l.cfg.Routes[strings.ToUpper(method)+" "+path]; ok {
+				limit = route
+			}
+			if limit.Rate > 0 {
+				op.Responses["429"] = limited
+			}
+		}
+	}
+}
+
+// textError is an error answered by http.Error.
+func textError(description string) *openapi.Response {
+	return openapi.RespondWith(description, openapi.Text, openapi.String())
+}
+
+// lockedOut is the response to MFA attempts while the account or client
+// is locked out.
+func lockedOut() *openapi.Response {
+	r := textError("Locked out after repeated failures")
+	r.Headers = map[string]*openapi.Header{
+		"Retry-After": {Description: "Seconds until the lockout ends.", Schema: openapi.Integer()},
+	}
+	return r
+}
+
+// with returns a copy of responses with r added for status.
+func with(responses map[string]*openapi.Response, status string, r *openapi.Response) map[string]*openapi.Response {
+	out := make(map[string]*openapi.Response, len(responses)+1)
+	for k, v := range responses {
+		out[k] = v
+	}
+	out[status] = r
+	return out
+}
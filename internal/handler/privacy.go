@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"user-service/internal/model"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// exportManifest describes the files in an export archive.
+type exportManifest struct {
+	Subject     string   `json:"subject"`
+	GeneratedAt string   `json:"generated_at"`
+	Files       []string `json:"files"`
+}
+
+// ExportUserData responds with a zip archive of everything stored about the
+// user, one JSON file per kind of data.
+func (h *UserHandler) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	export, err := h.userService.ExportUserData(r.Context(), email)
+	if err != nil {
+		h.log(r).Error("Failed to export user data", zap.Error(err))
+		http.Error(w, err.Error(), privacyErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-export-%s.zip"`,
+		export.GeneratedAt.UTC().Format("20060102T150405Z")))
+	if err := writeExportArchive(w, export); err != nil {
+		// Headers are already sent, so the client sees a truncated archive.
+		h.log(r).Error("Failed to write export archive", zap.Error(err))
+	}
+}
+
+func writeExportArchive(w http.ResponseWriter, export *model.DataExport) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", struct {
+			*model.User
+			PasswordSet bool `json:"password_set"`
+		}{export.User, export.PasswordSet}},
+		{"mfa.json", export.MFA},
+		{"tokens.json", export.Tokens},
+		{"audit_events.json", export.AuditEvents},
+	}
+
+	zw := zip.NewWriter(w)
+	manifest := exportManifest{
+		Subject:     export.User.Email,
+		GeneratedAt: export.GeneratedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for _, f := range files {
+		if err := writeZipJSON(zw, f.name, f.data); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, f.name)
+	}
+	if err := writeZipJSON(zw, "manifest.json", manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (h *UserHandler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	tombstone, err := h.userService.EraseUser(r.Context(), email)
+	if err != nil {
+		h.log(r).Error("Failed to erase user", zap.Error(err))
+		http.Error(w, err.Error(), privacyErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tombstone); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *UserHandler) GetErasure(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	tombstone, err := h.userService.GetErasure(r.Context(), email)
+	if err != nil {
+		http.Error(w, err.Error(), privacyErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tombstone); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func privacyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrNotErased):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrPrivacyUnavailable):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
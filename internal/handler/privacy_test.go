@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExportUserDataArchive(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := service.NewUserService(repository.NewUserRepository(db))
+	handler := NewUserHandler(svc, zaptest.NewLogger(t))
+	r := mux.NewRouter()
+	r.HandleFunc("/users/{email}/export", handler.ExportUserData).Methods("GET")
+
+	_ = svc.CreateUser(context.Background(), &model.User{Email: "a@example.com", Name: "A"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/a@example.com/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("expected attachment disposition, got %q", w.Header().Get("Content-Disposition"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("response is not a zip archive: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	expected := "audit_events.json,manifest.json,mfa.json,profile.json,tokens.json"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("expected files %s, got %v", expected, names)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/missing@example.com/export", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 Not Found, got %d", w.Code)
+	}
+}
@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RateLimit is a token bucket refilled at Rate tokens per second and
+// holding at most Burst tokens. A zero Rate means unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseRateLimit parses "rate/burst", such as "10/20", or "off".
+func ParseRateLimit(s string) (RateLimit, error) {
+	if s == "off" {
+		return RateLimit{}, nil
+	}
+	r, b, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q is not rate/burst", s)
+	}
+	rate, err := strconv.ParseFloat(r, 64)
+	if err != nil || rate < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate in %q", s)
+	}
+	burst, err := strconv.Atoi(b)
+	if err != nil || burst < 1 {
+		return RateLimit{}, fmt.Errorf("invalid burst in %q", s)
+	}
+	return RateLimit{Rate: rate, Burst: burst}, nil
+}
+
+// ParseRouteRateLimits parses comma separated "METHOD /template=rate/burst"
+// overrides, such as "POST /users=1/5,GET /users=5/10".
+func ParseRouteRateLimits(s string) (map[string]RateLimit, error) {
+	routes := make(map[string]RateLimit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("route rate limit %q is not route=rate/burst", entry)
+		}
+		l, err := ParseRateLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		routes[strings.TrimSpace(route)] = l
+	}
+	return routes, nil
+}
+
+// ParseTrustedProxies parses comma separated IPs and CIDRs.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// RateLimiterConfig configures NewRateLimiter.
+type RateLimiterConfig struct {
+	// Default applies to every route without an override. Each client has
+	// one bucket shared by all of those routes.
+	Default RateLimit
+	// Routes overrides the limit for "METHOD /template" routes, each with
+	// its own bucket per client.
+	Routes map[string]RateLimit
+	// APIKeyHeader, if set, names a header identifying the client. Only set
+	// it when keys are validated before requests reach the service, as
+	// clients could otherwise get a fresh bucket per made-up key.
+	APIKeyHeader string
+	// TrustedProxies are allowed to report the client address in
+	// X-Forwarded-For.
+	TrustedProxies []*net.IPNet
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits requests per client with token buckets. Clients are
+// identified by API key, then by IP address, before authentication; see
+// Authenticated for requests that turn out to come from a principal.
+type RateLimiter struct {
+	cfg RateLimiterConfig
+	now func() time.Time
+
+	// idle is the longest any bucket takes to refill.
+	idle time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a limiter for cfg.
+func NewRateLimiter(cfg RateLimiterConfig) *RateLimiter {
+	l := &RateLimiter{cfg: cfg, now: time.Now, buckets: make(map[string]*bucket)}
+	limits := []RateLimit{cfg.Default}
+	for _, limit := range cfg.Routes {
+		limits = append(limits, limit)
+	}
+	for _, limit := range limits {
+		if limit.Rate > 0 {
+			if d := time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)); d > l.idle {
+				l.idle = d
+			}
+		}
+	}
+	return l
+}
+
+// Middleware limits requests to the routes of the router it is used on,
+// answering 429 with a problem document once a client's bucket is empty.
+// Every limited response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, limit := l.limitFor(r)
+		if limit.Rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := scope + "|" + l.clientKey(r)
+		if !l.limit(w, key, limit) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chargeKey{}, &charge{key: key, limit: limit})))
+	})
+}
+
+// charge is the token Middleware took for a request.
+type charge struct {
+	key   string
+	limit RateLimit
+}
+
+type chargeKey struct{}
+
+// Authenticated moves requests admitted by AdminAuth or SCIMAuth, which it
+// must follow, from the bucket of their address to that of their
+// principal: the token Middleware took is given back and one is taken for
+// the principal instead. Requests failing authentication stay charged to
+// their address, so guessing tokens is limited too.
+func (l *RateLimiter) Authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := r.Context().Value(chargeKey{}).(*charge)
+		p := principal(r)
+		if !ok || p == "anonymous" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l.refund(c.key, c.limit)
+		scope, _, _ := strings.Cut(c.key, "|")
+		if !l.limit(w, scope+"|principal:"+p, c.limit) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limit takes a token from the bucket for key and sets the RateLimit
+// headers, answering 429 and returning false if there was none.
+func (l *RateLimiter) limit(w http.ResponseWriter, key string, limit RateLimit) bool {
+	ok, remaining, wait, reset := l.take(key, limit, 1)
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", seconds(reset))
+	if !ok {
+		w.Header().Set("Retry-After", seconds(wait))
+		writeProblem(w, http.StatusTooManyRequests, "Rate limit exceeded, retry in "+seconds(wait)+" seconds")
+	}
+	return ok
+}
+
+// Allow takes a token from the bucket of the client at ip for route, a
+// "METHOD /template" as in RateLimiterConfig.Routes, so that servers other
+// than HTTP, such as gRPC, share the HTTP buckets. It returns whether a
+// token was available and, if not, how long until the next one.
+func (l *RateLimiter) Allow(route, ip string) (bool, time.Duration) {
+	scope, limit := l.limitForRoute(route)
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+	ok, _, wait, _ := l.take(scope+"|ip:"+ip, limit, 1)
+	return ok, wait
+}
+
+// AllowRequest takes n tokens at once from the bucket of r's client for
+// route, a "METHOD /template" as in RateLimiterConfig.Routes, for handlers
+// limiting operations finer than the routes they serve, such as each
+// mutation of a GraphQL request. It returns whether the tokens were
+// available and, if not, how long until they are; more tokens than the
+// burst are never available.
+func (l *RateLimiter) AllowRequest(r *http.Request, route string, n int) (bool, time.Duration) {
+	scope, limit := l.limitForRoute(route)
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+	ok, _, wait, _ := l.take(scope+"|"+l.clientKey(r), limit, n)
+	return ok, wait
+}
+
+// limitFor returns the bucket scope and limit for r's route.
+func (l *RateLimiter) limitFor(r *http.Request) (string, RateLimit) {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return l.limitForRoute(r.Method + " " + tmpl)
+		}
+	}
+	return "default", l.cfg.Default
+}
+
+// limitForRoute returns the bucket scope and limit for a "METHOD
+// /template" route.
+func (l *RateLimiter) limitForRoute(route string) (string, RateLimit) {
+	if limit, ok := l.cfg.Routes[route]; ok {
+		return route, limit
+	}
+	return "default", l.cfg.Default
+}
+
+// clientKey identifies who is making the request: its principal once it
+// is authenticated, otherwise its API key or address.
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if p := principal(r); p != "anonymous" {
+		return "principal:" + p
+	}
+	if l.cfg.APIKeyHeader != "" {
+		if key := r.Header.Get(l.cfg.APIKeyHeader); key != "" {
+			// Keys are hashed so the limiter does not hold credentials.
+			sum := sha256.Sum256([]byte(key))
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + forwardedClientIP(r, l.cfg.TrustedProxies)
+}
+
+// take removes n tokens from the bucket for key, or none if fewer are
+// left. It returns whether they were available, the whole tokens left,
+// how long until n tokens are and how long until the bucket is full
+// again.
+func (l *RateLimiter) take(key string, limit RateLimit, n int) (bool, int, time.Duration, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	burst := float64(limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	want := float64(n)
+	allowed := b.tokens >= want
+	if allowed {
+		b.tokens -= want
+	}
+	wait := time.Duration(0)
+	if b.tokens < want {
+		wait = time.Duration((want - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	reset := time.Duration((burst - b.tokens) / limit.Rate * float64(time.Second))
+	return allowed, int(b.tokens), wait, reset
+}
+
+// refund gives back a token taken from the bucket for key.
+func (l *RateLimiter) refund(key string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+1)
+	}
+}
+
+// sweep drops buckets idle long enough to have refilled, at most once a
+// minute, so memory does not grow with every client ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > l.idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// forwardedClientIP returns the client address, taken from
+// X-Forwarded-For when the request comes through a trusted proxy. The
+// header is read right to left, skipping trusted proxies, since entries
+// further left can be forged by the client.
+func forwardedClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := clientIP(r)
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// problem is an RFC 7807 problem details document.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeProblem answers with an application/problem+json document.
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail})
+}
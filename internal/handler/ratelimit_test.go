@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func newRateLimitedRouter(cfg RateLimiterConfig, now *time.Time) *mux.Router {
+	limiter := NewRateLimiter(cfg)
+	limiter.now = func() time.Time { return *now }
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	r.HandleFunc("/users", ok).Methods("POST")
+	r.HandleFunc("/users", ok).Methods("GET")
+	r.HandleFunc("/users/{email}", ok).Methods("GET")
+	return r
+}
+
+func send(r http.Handler, method, path string, set func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if set != nil {
+		set(req)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	r := newRateLimitedRouter(RateLimiterConfig{
+		Default: RateLimit{Rate: 1, Burst: 2},
+		Routes:  map[string]RateLimit{"POST /users": {Rate: 0.1, Burst: 1}, "GET /users": {}},
+	}, &now)
+
+	for i := 0; i < 2; i++ {
+		if w := send(r, "GET", "/users/a@example.com", nil); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	w := send(r, "GET", "/users/b@example.com", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the burst is used, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" || w.Header().Get("RateLimit-Limit") != "2" ||
+		w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Reset") != "2" {
+		t.Errorf("unexpected rate limit headers: %v", w.Header())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("expected problem+json, got %s", ct)
+	}
+	var p problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Status != http.StatusTooManyRequests || p.Title != "Too Many Requests" {
+		t.Errorf("unexpected problem document: %+v, %v", p, err)
+	}
+
+	// Overridden routes have their own bucket and limit.
+	if w := send(r, "POST", "/users", nil); w.Code != http.StatusOK {
+		t.Errorf("expected POST /users to have its own bucket, got %d", w.Code)
+	}
+	if w := send(r, "POST", "/users", nil); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "10" {
+		t.Errorf("expected POST /users to be limited for 10s, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	for i := 0; i < 5; i++ {
+		if w := send(r, "GET", "/users", nil); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("expected GET /users to be unlimited, got %d", w.Code)
+		}
+	}
+
+	// Tokens are refilled over time.
+	now = now.Add(time.Second)
+	if w := send(r, "GET", "/users/a@example.com", nil); w.Code != http.StatusOK {
+		t.Errorf("expected a token after one second, got %d", w.Code)
+	}
+}
+
+func TestRateLimitClientKeys(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRateLimitedRouter(RateLimiterConfig{
+		Default:        RateLimit{Rate: 1, Burst: 1},
+		APIKeyHeader:   "X-API-Key",
+		TrustedProxies: trusted,
+	}, &now)
+
+	from := func(remote, forwarded string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.RemoteAddr = remote + ":1234"
+			if forwarded != "" {
+				req.Header.Set("X-Forwarded-For", forwarded)
+			}
+		}
+	}
+
+	// Clients behind a trusted proxy are told apart by X-Forwarded-For,
+	// ignoring anything they prepend themselves.
+	if w := send(r, "GET", "/users/x", from("10.0.0.1", "6.6.6.6, 1.1.1.1")); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w := send(r, "GET", "/users/x", from("10.0.0.2", "7.7.7.7, 1.1.1.1, 10.0.0.3")); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the same client through another proxy to be limited, got %d", w.Code)
+	}
+	if w := send(r, "GET", "/users/x", from("10.0.0.1", "2.2.2.2")); w.Code != http.StatusOK {
+		t.Errorf("expected another client behind the proxy to have its own bucket, got %d", w.Code)
+	}
+
+	// Untrusted peers cannot pick their address.
+	if w := send(r, "GET", "/users/x", from("3.3.3.3", "")); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w := send(r, "GET", "/users/x", from("3.3.3.3", "4.4.4.4")); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected X-Forwarded-For from an untrusted peer to be ignored, got %d", w.Code)
+	}
+
+	// API keys take precedence over the address.
+	withKey := func(key string) func(*http.Request) {
+		return func(req *http.Request) {
+			from("3.3.3.3", "")(req)
+			req.Header.Set("X-API-Key", key)
+		}
+	}
+	if w := send(r, "GET", "/users/x", withKey("k1")); w.Code != http.StatusOK {
+		t.Errorf("expected API key to have its own bucket, got %d", w.Code)
+	}
+	if w := send(r, "GET", "/users/x", withKey("k1")); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected API key bucket to be used up, got %d", w.Code)
+	}
+}
+
+func TestRateLimitPrincipals(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(RateLimiterConfig{Default: RateLimit{Rate: 1, Burst: 1}})
+	limiter.now = func() time.Time { return now }
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	r.HandleFunc("/public", ok).Methods("GET")
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(AdminAuth("admin-token"), limiter.Authenticated)
+	admin.HandleFunc("/x", ok).Methods("GET")
+	scim := r.PathPrefix("/scim").Subrouter()
+	scim.Use(SCIMAuth("scim-token"), limiter.Authenticated)
+	scim.HandleFunc("/x", ok).Methods("GET")
+	h := RequestLogger(zap.NewNop(), r)
+
+	bearer := func(token string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	// Both principals and anonymous clients share one address, but not a
+	// bucket.
+	for _, tc := range []struct {
+		path, token string
+		want        int
+	}{
+		{"/admin/x", "admin-token", http.StatusOK},
+		{"/scim/x", "scim-token", http.StatusOK},
+		{"/public", "", http.StatusOK},
+		{"/admin/x", "admin-token", http.StatusTooManyRequests},
+		{"/scim/x", "scim-token", http.StatusTooManyRequests},
+		// Failed authentication is charged to the address
+		{"/admin/x", "guess", http.StatusTooManyRequests},
+	} {
+		if w := send(h, "GET", tc.path, bearer(tc.token)); w.Code != tc.want {
+			t.Errorf("GET %s with %q: expected %d, got %d", tc.path, tc.token, tc.want, w.Code)
+		}
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	routes, err := ParseRouteRateLimits("POST /users=1/5, GET /users=off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes["POST /users"] != (RateLimit{Rate: 1, Burst: 5}) || routes["GET /users"] != (RateLimit{}) {
+		t.Errorf("unexpected routes: %v", routes)
+	}
+	for _, bad := range []string{"10", "x/5", "1/0", "-1/5"} {
+		if _, err := ParseRateLimit(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, err := ParseTrustedProxies("10.0.0.1, ::1, 192.168.0.0/16"); err != nil {
+		t.Errorf("expected proxies to parse: %v", err)
+	}
+}
+
+func TestRateLimitAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(RateLimiterConfig{
+		Default: RateLimit{Rate: 1, Burst: 5},
+		Routes:  map[string]RateLimit{"POST /users": {Rate: 0.1, Burst: 1}},
+	})
+	limiter.now = func() time.Time { return now }
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	r.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+
+	// httptest requests come from 192.0.2.1.
+	if w := send(r, "POST", "/users", nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ok, wait := limiter.Allow("POST /users", "192.0.2.1"); ok || wait != 10*time.Second {
+		t.Errorf("expected the HTTP bucket to be shared, got %v %v", ok, wait)
+	}
+	if ok, _ := limiter.Allow("POST /users", "192.0.2.2"); !ok {
+		t.Error("expected other clients to have their own bucket")
+	}
+	if ok, _ := limiter.Allow("GET /unknown", "192.0.2.1"); !ok {
+		t.Error("expected routes without an override to use the default bucket")
+	}
+
+	// Several tokens are taken together or not at all
+	req := httptest.NewRequest("POST", "/graphql", nil)
+	req.RemoteAddr = "192.0.2.3:1234"
+	if ok, _ := limiter.AllowRequest(req, "POST /graphql mutation", 3); !ok {
+		t.Error("expected 3 of 5 tokens to be available")
+	}
+	if ok, wait := limiter.AllowRequest(req, "POST /graphql mutation", 3); ok || wait != time.Second {
+		t.Errorf("expected 3 more tokens to be refused until one refills, got %v %v", ok, wait)
+	}
+	if ok, _ := limiter.AllowRequest(req, "POST /graphql mutation", 2); !ok {
+		t.Error("expected a refused request not to take tokens")
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+	userv1 "user-service/api/user/v1"
+	"user-service/internal/model"
+
+	"go.uber.org/zap"
+)
+
+// representation adapts users to the shape of one API version, so every
+// version is served by the same handlers over the same service. Shapes are
+// encoded in JSON or MessagePack; Protobuf has its own representation.
+type representation interface {
+	// decode reads the user in a create or update request body in f.
+	decode(body io.Reader, f *format) (*model.User, error)
+	// user is u in the version's shape, which fields and expand project.
+	user(u *model.User) interface{}
+	// one and many are the bodies of responses with one and several
+	// users, as returned by user and possibly projected.
+	one(user interface{}) interface{}
+	many(users []interface{}) interface{}
+	// error is the body of an error response, or nil for plain text.
+	error(message string, status int) interface{}
+	// location is the URL of a created user, or "" if the version does not
+	// answer creates and updates with the user.
+	location(u *model.User) string
+}
+
+var representations = map[int]representation{
+	V1: v1Representation{},
+	V2: v2Representation{},
+}
+
+// userV1 is the user of v1, frozen as it was before users had IDs and
+// timestamps.
+type userV1 struct {
+	Email          string          `json:"email"`
+	Name           string          `json:"name"`
+	Age            int             `json:"age"`
+	State          model.UserState `json:"state,omitempty"`
+	StateChangedAt *time.Time      `json:"state_changed_at,omitempty"`
+	StateReason    string          `json:"state_reason,omitempty"`
+	VerifiedAt     *time.Time      `json:"verified_at,omitempty"`
+	DeletedAt      *time.Time      `json:"deleted_at,omitempty"`
+}
+
+type v1Representation struct{}
+
+func (v1Representation) decode(body io.Reader, f *format) (*model.User, error) {
+	var u userV1
+	if err := f.decode(body, &u); err != nil {
+		return nil, err
+	}
+	return &model.User{Email: u.Email, Name: u.Name, Age: u.Age}, nil
+}
+
+func (v1Representation) user(u *model.User) interface{} {
+	return userV1{
+		Email:          u.Email,
+		Name:           u.Name,
+		Age:            u.Age,
+		State:          u.State,
+		StateChangedAt: u.StateChangedAt,
+		StateReason:    u.StateReason,
+		VerifiedAt:     u.VerifiedAt,
+		DeletedAt:      u.DeletedAt,
+	}
+}
+
+func (v1Representation) one(user interface{}) interface{} { return user }
+
+// many is null rather than empty when there are no users, as it always was.
+func (v1Representation) many(users []interface{}) interface{} {
+	if len(users) == 0 {
+		return nil
+	}
+	return users
+}
+
+func (v1Representation) error(string, int) interface{} { return nil }
+
+func (v1Representation) location(*model.User) string { return "" }
+
+// userV2 is the user of v2, addressed by ID. Timestamps are null for users
+// created before they were recorded.
+type userV2 struct {
+	ID             string          `json:"id"`
+	Email          string          `json:"email"`
+	Name           string          `json:"name"`
+	Age            int             `json:"age"`
+	State          model.UserState `json:"state"`
+	StateReason    string          `json:"state_reason,omitempty"`
+	StateChangedAt *time.Time      `json:"state_changed_at"`
+	VerifiedAt     *time.Time      `json:"verified_at"`
+	CreatedAt      *time.Time      `json:"created_at"`
+	UpdatedAt      *time.Time      `json:"updated_at"`
+}
+
+// userInputV2 is the part of a v2 user clients can set. The email cannot
+// be changed once the user is created.
+type userInputV2 struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Age   int    `json:"age"`
+}
+
+// v2 wraps every body in an envelope.
+type (
+	envelope[T any] struct {
+		Data T `json:"data"`
+	}
+	listEnvelope[T any] struct {
+		Data []T      `json:"data"`
+		Meta listMeta `json:"meta"`
+	}
+	listMeta struct {
+		Count int `json:"count"`
+	}
+	errorEnvelope struct {
+		Error apiError `json:"error"`
+	}
+	apiError struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	}
+)
+
+type v2Representation struct{}
+
+func (v2Representation) decode(body io.Reader, f *format) (*model.User, error) {
+	var u userInputV2
+	if err := f.decode(body, &u); err != nil {
+		return nil, err
+	}
+	return &model.User{Email: u.Email, Name: u.Name, Age: u.Age}, nil
+}
+
+func (v2Representation) user(u *model.User) interface{} {
+	return userV2{
+		ID:             u.ID,
+		Email:          u.Email,
+		Name:           u.Name,
+		Age:            u.Age,
+		State:          u.State,
+		StateReason:    u.StateReason,
+		StateChangedAt: u.StateChangedAt,
+		VerifiedAt:     u.VerifiedAt,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+	}
+}
+
+func (v2Representation) one(user interface{}) interface{} {
+	return envelope[interface{}]{Data: user}
+}
+
+func (v2Representation) many(users []interface{}) interface{} {
+	if users == nil {
+		users = []interface{}{}
+	}
+	return listEnvelope[interface{}]{Data: users, Meta: listMeta{Count: len(users)}}
+}
+
+func (v2Representation) error(message string, status int) interface{} {
+	return errorEnvelope{Error: apiError{Status: status, Message: message}}
+}
+
+func (v2Representation) location(u *model.User) string {
+	return "/v2/users/" + u.ID
+}
+
+// protobufRepresentation serves users as the messages of api/user/v1,
+// which are the same in every version. Creates and updates are answered
+// as in the version r is served with, and errors in plain text.
+type protobufRepresentation struct {
+	representation
+}
+
+func (protobufRepresentation) decode(body io.Reader, f *format) (*model.User, error) {
+	var u userv1.User
+	if err := f.decode(body, &u); err != nil {
+		return nil, err
+	}
+	return &model.User{Email: u.Email, Name: u.Name, Age: int(u.Age)}, nil
+}
+
+func (protobufRepresentation) user(u *model.User) interface{} { return userv1.FromModel(u) }
+
+func (protobufRepresentation) one(user interface{}) interface{} { return user }
+
+func (protobufRepresentation) many(users []interface{}) interface{} {
+	list := &userv1.UserList{Users: make([]*userv1.User, len(users))}
+	for i, u := range users {
+		list.Users[i] = u.(*userv1.User)
+	}
+	return list
+}
+
+func (protobufRepresentation) error(string, int) interface{} { return nil }
+
+// represent writes v in the version and format r is served with.
+func (h *UserHandler) represent(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	version := versionOf(r)
+	w.Header().Set("Content-Type", version.mediaType)
+	w.WriteHeader(status)
+	if err := version.format.encode(w, v); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// representUser writes u, whole, in the version r is served with.
+func (h *UserHandler) representUser(w http.ResponseWriter, r *http.Request, status int, u *model.User) {
+	rep := representationOf(r)
+	h.represent(w, r, status, rep.one(rep.user(u)))
+}
+
+// fail writes an error in the version r is served with: plain text in v1,
+// and an error envelope from v2 on.
+func (h *UserHandler) fail(w http.ResponseWriter, r *http.Request, message string, status int) {
+	body := representationOf(r).error(message, status)
+	if body == nil {
+		http.Error(w, message, status)
+		return
+	}
+	h.represent(w, r, status, body)
+}
+
+// representationOf returns the representation of the version and format r
+// is served with.
+func representationOf(r *http.Request) representation {
+	v := versionOf(r)
+	if v.format == protobufFormat {
+		return protobufRepresentation{representations[v.version]}
+	}
+	return representations[v.version]
+}
+
+// decodeUser reads the user in the body of r, a create or update in the
+// version r is served with.
+func decodeUser(r *http.Request) (*model.User, error) {
+	v := versionOf(r)
+	rep := representations[v.version]
+	if v.content == protobufFormat {
+		rep = protobufRepresentation{rep}
+	}
+	return rep.decode(r.Body, v.content)
+}
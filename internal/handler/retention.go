@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func (h *UserHandler) UndeleteUser(w http.ResponseWriter, r *http.Request) {
+	email := mux.Vars(r)["email"]
+
+	user, err := h.userService.UndeleteUser(r.Context(), email)
+	if err != nil {
+		h.log(r).Error("Failed to undelete user", zap.Error(err))
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, service.ErrRetentionExpired):
+			status = http.StatusGone
+		}
+		h.fail(w, r, err.Error(), status)
+		return
+	}
+	h.representUser(w, r, http.StatusOK, user)
+}
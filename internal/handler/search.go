@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"user-service/internal/service"
+
+	"go.uber.org/zap"
+)
+
+// Paging of search results.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchHit is a user matching a search, in the v2 shape, with the values
+// of its fields that matched, marked up in highlights.
+type searchHit struct {
+	User       userV2            `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type searchMeta struct {
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type searchPage struct {
+	Data []searchHit `json:"data"`
+	Meta searchMeta  `json:"meta"`
+}
+
+// SearchUsers finds users by partial or misspelled names and emails.
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(query.Get("limit"), defaultSearchLimit, 1, maxSearchLimit)
+	if err != nil {
+		http.Error(w, "Invalid limit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0, 0, -1)
+	if err != nil {
+		http.Error(w, "Invalid offset: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.userService.SearchUsers(r.Context(), q, limit, offset)
+	if err != nil {
+		h.log(r).Error("Failed to search users", zap.Error(err))
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrSearchUnavailable) {
+			status = http.StatusNotImplemented
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	page := searchPage{
+		Data: make([]searchHit, len(found.Hits)),
+		Meta: searchMeta{Total: found.Total, Limit: limit, Offset: offset},
+	}
+	for i, hit := range found.Hits {
+		page.Data[i] = searchHit{
+			User:       v2Representation{}.user(hit.User).(userV2),
+			Score:      hit.Score,
+			Highlights: hit.Highlights,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// queryInt parses the query parameter value s, which must be at least min
+// and, unless max is negative, at most max. It returns def when s is
+// empty.
+func queryInt(s string, def, min, max int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if n < min || (max >= 0 && n > max) {
+		if max < 0 {
+			return 0, fmt.Errorf("%d is less than %d", n, min)
+		}
+		return 0, fmt.Errorf("%d is not between %d and %d", n, min, max)
+	}
+	return n, nil
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/search"
+	"user-service/internal/service"
+
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSearchUsers(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	idx := search.NewIndex()
+	base := repository.NewUserRepository(db)
+	repo, err := search.NewIndexingUserRepository(context.Background(), base, idx)
+	if err != nil {
+		t.Fatalf("failed to index users: %v", err)
+	}
+	svc := service.NewUserService(repo, service.WithSearchIndex(idx))
+	for _, u := range []*model.User{
+		{Email: "alice@example.com", Name: "Alice Smith", Age: 30},
+		{Email: "alicia@example.com", Name: "Alicia Jones", Age: 40},
+		{Email: "bob@example.com", Name: "Bob Smyth", Age: 50},
+	} {
+		if err := svc.CreateUser(context.Background(), u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	handler := NewUserHandler(svc, zaptest.NewLogger(t))
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.SearchUsers(w, httptest.NewRequest("GET", "/users/search?"+query, nil))
+		return w
+	}
+
+	w := get("q=ali&limit=1&offset=1")
+	var page searchPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d %s", w.Code, w.Body.String())
+	}
+	if page.Meta != (searchMeta{Total: 2, Limit: 1, Offset: 1}) || len(page.Data) != 1 {
+		t.Fatalf("expected the second of 2 hits, got %s", w.Body.String())
+	}
+	if hit := page.Data[0]; hit.User.Email != "alicia@example.com" || hit.User.ID == "" || hit.Highlights["name"] != "<em>Ali</em>cia Jones" {
+		t.Errorf("expected alicia highlighted, got %+v", hit)
+	}
+
+	w = get("q=smith")
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || len(page.Data) != 2 || page.Data[0].User.Email != "alice@example.com" {
+		t.Errorf("expected the exact match before the fuzzy one, got %s", w.Body.String())
+	}
+
+	for _, tc := range []struct{ query, want string }{
+		{"q=+", "Missing query"},
+		{"q=ali&limit=0", "Invalid limit"},
+		{"q=ali&limit=101", "Invalid limit"},
+		{"q=ali&offset=-1", "Invalid offset"},
+	} {
+		if w := get(tc.query); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s: expected 400 %s, got %d %s", tc.query, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	// Users deleted without the index knowing are neither counted nor leave
+	// the page short
+	if err := base.Delete(context.Background(), "alice@example.com"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	w = get("q=ali&limit=1")
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || page.Meta.Total != 1 || len(page.Data) != 1 || page.Data[0].User.Email != "alicia@example.com" {
+		t.Errorf("expected only alicia left, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	NewUserHandler(service.NewUserService(repo), zaptest.NewLogger(t)).SearchUsers(w, httptest.NewRequest("GET", "/users/search?q=ali", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 without an index, got %d", w.Code)
+	}
+}
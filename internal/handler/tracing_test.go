@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+	"user-service/internal/tracing"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTracing(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	var spans bytes.Buffer
+	tp, err := tracing.NewProvider(context.Background(), tracing.Config{Exporter: tracing.ExporterStdout, Writer: &spans})
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	repo := repository.NewTracingUserRepository(repository.NewUserRepository(db), tp)
+	svc := service.NewTracingUserService(service.NewUserService(repo), tp)
+	_ = svc.CreateUser(context.Background(), &model.User{Email: "a@example.com", Name: "A"})
+	handler := NewUserHandler(svc, zap.NewNop())
+	r := mux.NewRouter()
+	r.HandleFunc("/users/{email}", handler.GetUser).Methods("GET")
+	srv := Tracing(tp, r)(RequestLogger(zap.New(core), r))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/users/a@example.com", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The request, service and repository spans all continue the incoming
+	// trace.
+	names := map[string]bool{}
+	dec := json.NewDecoder(&spans)
+	for dec.More() {
+		var span struct {
+			Name        string
+			SpanContext struct{ TraceID string }
+		}
+		if err := dec.Decode(&span); err != nil {
+			t.Fatalf("failed to decode span: %v", err)
+		}
+		if span.SpanContext.TraceID == traceID {
+			names[span.Name] = true
+		}
+	}
+	for _, name := range []string{"GET /users/{email}", "UserService.GetUser", "UserRepository.GetByEmail"} {
+		if !names[name] {
+			t.Errorf("expected span %q in trace, got %v", name, names)
+		}
+	}
+
+	if n := logs.FilterMessage("request").FilterField(zap.String("trace_id", traceID)).Len(); n != 1 {
+		t.Errorf("expected access log with trace ID, got %d", n)
+	}
+}
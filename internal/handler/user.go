@@ -1,10 +1,13 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"user-service/internal/filter"
 	"user-service/internal/model"
 	"user-service/internal/service"
+	"user-service/pkg/logger"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -12,84 +15,187 @@ import (
 
 type UserHandler struct {
 	userService service.UserService
+	groups      service.GroupService
 	logger      *zap.Logger
+	// trustedProxies may report the client address for MFA lockouts.
+	trustedProxies []*net.IPNet
 }
 
-func NewUserHandler(userService service.UserService, logger *zap.Logger) *UserHandler {
-	return &UserHandler{userService: userService, logger: logger}
+// Option configures a UserHandler.
+type Option func(*UserHandler)
+
+// WithGroups lets users embed their groups with expand=groups.
+func WithGroups(groups service.GroupService) Option {
+	return func(h *UserHandler) { h.groups = groups }
+}
+
+// WithTrustedProxies resolves the client address behind these proxies
+// from X-Forwarded-For, as the rate limiter does, so clients behind a load
+// balancer are locked out one by one rather than all together.
+func WithTrustedProxies(proxies []*net.IPNet) Option {
+	return func(h *UserHandler) { h.trustedProxies = proxies }
+}
+
+func NewUserHandler(userService service.UserService, logger *zap.Logger, opts ...Option) *UserHandler {
+	h := &UserHandler{userService: userService, logger: logger}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// log returns the request's logger, falling back to the handler's.
+func (h *UserHandler) log(r *http.Request) *zap.Logger {
+	return logger.FromContext(r.Context(), h.logger)
+}
+
+// lookup returns the user in the request path, addressed by ID from v2 on
+// and by email before.
+func (h *UserHandler) lookup(r *http.Request) (*model.User, error) {
+	vars := mux.Vars(r)
+	if id, ok := vars["id"]; ok {
+		return h.userService.GetUserByID(r.Context(), id)
+	}
+	return h.userService.GetUser(r.Context(), vars["email"])
+}
+
+// pathEmail returns the email of the user in the request path, looking it
+// up when the user is addressed by ID.
+func (h *UserHandler) pathEmail(r *http.Request) (string, error) {
+	vars := mux.Vars(r)
+	if _, ok := vars["id"]; !ok {
+		return vars["email"], nil
+	}
+	user, err := h.lookup(r)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
 }
 
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user model.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	user, err := decodeUser(r)
+	if err != nil {
+		h.fail(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.userService.CreateUser(r.Context(), user); err != nil {
+		h.log(r).Error("Failed to create user", zap.Error(err))
+		h.fail(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := h.userService.CreateUser(r.Context(), &user); err != nil {
-		h.logger.Error("Failed to create user", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	location := representationOf(r).location(user)
+	if location == "" {
+		w.WriteHeader(http.StatusCreated)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Location", location)
+	h.representUser(w, r, http.StatusCreated, user)
 }
 
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	email := vars["email"]
-	user, err := h.userService.GetUser(r.Context(), email)
+	rep := representationOf(r)
+	p, err := parseProjection(r.URL.Query(), rep)
 	if err != nil {
-		h.logger.Error("User not found", zap.Error(err))
-		http.Error(w, "User not found", http.StatusNotFound)
+		h.fail(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		h.logger.Error("Failed to encode response", zap.Error(err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	user, err := h.lookup(r)
+	if err != nil {
+		h.log(r).Error("User not found", zap.Error(err))
+		h.fail(w, r, "User not found", http.StatusNotFound)
 		return
 	}
+	if p.cacheable() && notModified(w, r, userValidators(user)) {
+		return
+	}
+	projected, err := h.project(r, rep, p, []*model.User{user})
+	if err != nil {
+		h.failProjection(w, r, err)
+		return
+	}
+	h.represent(w, r, http.StatusOK, rep.one(projected[0]))
 }
 
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	email := vars["email"]
+	email, err := h.pathEmail(r)
+	if err != nil {
+		h.fail(w, r, "User not found", http.StatusNotFound)
+		return
+	}
 
-	var user model.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	user, err := decodeUser(r)
+	if err != nil {
+		h.fail(w, r, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 	user.Email = email
 
-	if err := h.userService.UpdateUser(r.Context(), &user); err != nil {
-		h.logger.Error("Failed to update user", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := h.userService.UpdateUser(r.Context(), user); err != nil {
+		h.log(r).Error("Failed to update user", zap.Error(err))
+		h.fail(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	if representationOf(r).location(user) == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	h.representUser(w, r, http.StatusOK, user)
 }
 
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	email := vars["email"]
+	email, err := h.pathEmail(r)
+	if err != nil {
+		h.fail(w, r, "User not found", http.StatusNotFound)
+		return
+	}
 
 	if err := h.userService.DeleteUser(r.Context(), email); err != nil {
-		h.logger.Error("Failed to delete user", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.log(r).Error("Failed to delete user", zap.Error(err))
+		h.fail(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userService.ListUsers(r.Context())
+	rep := representationOf(r)
+	p, err := parseProjection(r.URL.Query(), rep)
 	if err != nil {
-		h.logger.Error("Failed to list users", zap.Error(err))
-		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		h.fail(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if err := json.NewEncoder(w).Encode(users); err != nil {
-		h.logger.Error("Failed to encode response", zap.Error(err))
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	if p.cacheable() {
+		// Read before listing, so the list is at least as new as its ETag.
+		version, err := h.userService.UsersVersion(r.Context())
+		if err != nil {
+			h.log(r).Error("Failed to read the users version", zap.Error(err))
+			h.fail(w, r, "Failed to list users", http.StatusInternalServerError)
+			return
+		}
+		if notModified(w, r, validators{etag: etag(version)}) {
+			return
+		}
+	}
+	criteria := model.UserFilter{
+		State:      model.UserState(r.URL.Query().Get("state")),
+		Expression: r.URL.Query().Get("filter"),
+	}
+	users, err := h.userService.ListUsers(r.Context(), criteria)
+	var invalid *filter.Error
+	if errors.Is(err, service.ErrInvalidState) || errors.As(err, &invalid) {
+		h.fail(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.log(r).Error("Failed to list users", zap.Error(err))
+		h.fail(w, r, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+	projected, err := h.project(r, rep, p, users)
+	if err != nil {
+		h.failProjection(w, r, err)
 		return
 	}
+	h.represent(w, r, http.StatusOK, rep.many(projected))
 }
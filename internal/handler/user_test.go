@@ -7,6 +7,8 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"user-service/internal/model"
 	"user-service/internal/service"
@@ -15,8 +17,10 @@ import (
 	"go.uber.org/zap/zaptest"
 )
 
-// mockUserService implements service.UserService for testing
+// mockUserService implements service.UserService for testing. Methods not
+// defined below panic through the nil embedded interface.
 type mockUserService struct {
+	service.UserService
 	users map[string]*model.User
 }
 
@@ -52,7 +56,7 @@ func (m *mockUserService) DeleteUser(_ context.Context, email string) error {
 	return nil
 }
 
-func (m *mockUserService) ListUsers(_ context.Context) ([]*model.User, error) {
+func (m *mockUserService) ListUsers(_ context.Context, _ model.UserFilter) ([]*model.User, error) {
 	var list []*model.User
 	for _, u := range m.users {
 		list = append(list, u)
@@ -60,6 +64,10 @@ func (m *mockUserService) ListUsers(_ context.Context) ([]*model.User, error) {
 	return list, nil
 }
 
+func (m *mockUserService) UsersVersion(context.Context) (uint64, error) {
+	return uint64(len(m.users)), nil
+}
+
 func setupHandler() (*UserHandler, *mockUserService) {
 	svc := &mockUserService{users: make(map[string]*model.User)}
 	logger := zaptest.NewLogger(nil)
@@ -180,3 +188,39 @@ func TestListUsersHandler(t *testing.T) {
 		t.Errorf("expected 2 users, got %d", len(users))
 	}
 }
+
+func TestListUsersFilter(t *testing.T) {
+	r, svc := setupVersionedRouter(t)
+	if err := svc.CreateUser(context.Background(), &model.User{Email: "al@example.com", Name: "Al", Age: 17}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	list := func(filter string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v2/users?filter="+url.QueryEscape(filter), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := list(`age ge 18 or name sw "Al"`)
+	var users listEnvelope[userV2]
+	if err := json.NewDecoder(w.Body).Decode(&users); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d %v", w.Code, err)
+	}
+	if users.Meta.Count != 2 {
+		t.Errorf("expected both users, got %+v", users.Data)
+	}
+	w = list(`age ge 18 and name sw "A"`)
+	users = listEnvelope[userV2]{}
+	if err := json.NewDecoder(w.Body).Decode(&users); err != nil || users.Meta.Count != 1 || users.Data[0].Email != "a@example.com" {
+		t.Errorf("expected a@example.com only, got %d %+v", w.Code, users.Data)
+	}
+
+	w = list(`age ge 18 and nme sw "Al"`)
+	var failed errorEnvelope
+	if err := json.NewDecoder(w.Body).Decode(&failed); err != nil || w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 Bad Request, got %d %v", w.Code, err)
+	}
+	if !strings.Contains(failed.Error.Message, `at "nme" (offset 14)`) {
+		t.Errorf("expected the error to point at nme, got %q", failed.Error.Message)
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API versions. Routes under /v1 and /v2 serve their version; unversioned
+// user routes serve the version the Accept header asks for, or V1.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+// versionMediaType matches the vendor media types naming a version and a
+// format, such as those of MediaType.
+var versionMediaType = regexp.MustCompile(`^application/vnd\.user-service\.v([0-9]+)\+([a-z]+)$`)
+
+// MediaType returns the media type that selects version v in JSON in an
+// Accept header, and labels JSON responses in that version.
+func MediaType(v int) string {
+	return jsonFormat.versioned(v)
+}
+
+// Deprecation announces that an API version will be removed.
+type Deprecation struct {
+	// Since is when the version was deprecated.
+	Since time.Time
+	// Sunset is when the version stops being served, if it is decided.
+	Sunset time.Time
+	// Successor is the URL of the resources replacing the version's.
+	Successor string
+}
+
+// Versioning selects the API version each request is served with.
+type Versioning struct {
+	// Deprecations of old versions are announced in the Deprecation,
+	// Sunset and Link headers of every response in those versions.
+	Deprecations map[int]Deprecation
+}
+
+// apiVersion is the version a request is served with, the formats of its
+// body and of its responses, and the media type they are labelled with.
+type apiVersion struct {
+	version   int
+	format    *format
+	content   *format
+	mediaType string
+}
+
+type apiVersionKey struct{}
+
+// versionOf returns the version r is served with, V1 unless a Versioning
+// middleware chose another.
+func versionOf(r *http.Request) apiVersion {
+	if v, ok := r.Context().Value(apiVersionKey{}).(apiVersion); ok {
+		return v
+	}
+	return apiVersion{version: V1, format: jsonFormat, content: jsonFormat, mediaType: jsonFormat.mediaType}
+}
+
+// Pin returns middleware serving version v on routes under its path
+// prefix. Requests whose Accept header only names other versions or
+// unsupported formats are answered 406, and those with bodies in
+// unsupported formats 415.
+func (vs Versioning) Pin(v int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vs.serve(w, r, next, func(version int) bool { return version == v }, v)
+		})
+	}
+}
+
+// Negotiate serves the version the Accept header names, with the highest
+// quality, or V1 when it names none. Requests for unknown versions or
+// unsupported formats only are answered 406, and those with bodies in
+// unsupported formats 415.
+func (vs Versioning) Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vs.serve(w, r, next, func(version int) bool { return version == V1 || version == V2 }, V1)
+	})
+}
+
+func (vs Versioning) serve(w http.ResponseWriter, r *http.Request, next http.Handler, known func(int) bool, def int) {
+	w.Header().Add("Vary", "Accept")
+	version, f, err := negotiate(r.Header.Get("Accept"), known)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+	content := contentFormat(r.Header.Get("Content-Type"))
+	if content == nil {
+		http.Error(w, "unsupported media type, expected one of "+strings.Join(mediaTypes(), ", "), http.StatusUnsupportedMediaType)
+		return
+	}
+	v := apiVersion{version: def, format: f, content: content, mediaType: f.mediaType}
+	if version != 0 {
+		v.version, v.mediaType = version, f.versioned(version)
+	}
+	if d, ok := vs.Deprecations[v.version]; ok {
+		d.announce(w.Header())
+	}
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, v)))
+}
+
+// announce sets the headers of RFC 9745 and RFC 8594 on h.
+func (d Deprecation) announce(h http.Header) {
+	h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Successor != "" {
+		h.Add("Link", "<"+d.Successor+`>; rel="successor-version"`)
+	}
+}
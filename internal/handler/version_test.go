@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestNegotiate(t *testing.T) {
+	known := func(v int) bool { return v == V1 || v == V2 }
+	for _, tc := range []struct {
+		accept  string
+		version int
+		format  *format
+		err     error
+	}{
+		{"", 0, jsonFormat, nil},
+		{"application/json", 0, jsonFormat, nil},
+		{"text/html", 0, nil, errNotAcceptable},
+		{"text/html, */*;q=0.8", 0, jsonFormat, nil},
+		{MediaType(V2), V2, jsonFormat, nil},
+		{MediaType(V1) + ", " + MediaType(V2) + ";q=0.5", V1, jsonFormat, nil},
+		{"application/json;q=0.5, " + MediaType(V2), V2, jsonFormat, nil},
+		{MediaType(V2) + ";q=0.1, */*;q=0.9", 0, jsonFormat, nil},
+		{MediaType(3), 0, nil, errUnknownVersion},
+		{MediaType(3) + ", application/json;q=0.1", 0, jsonFormat, nil},
+		{"application/msgpack", 0, msgpackFormat, nil},
+		{"application/vnd.user-service.v2+msgpack, application/json;q=0.5", V2, msgpackFormat, nil},
+		{"application/x-protobuf, application/json;q=0.5", 0, protobufFormat, nil},
+		{"application/vnd.user-service.v2+protobuf", 0, nil, errNotAcceptable},
+	} {
+		version, f, err := negotiate(tc.accept, known)
+		if version != tc.version || f != tc.format || err != tc.err {
+			t.Errorf("Accept %q: expected %d %v %v, got %d %v %v", tc.accept, tc.version, tc.format, tc.err, version, f, err)
+		}
+	}
+}
+
+func setupVersionedRouter(t *testing.T) (*mux.Router, service.UserService) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := service.NewUserService(repository.NewUserRepository(db))
+	handler := NewUserHandler(svc, zaptest.NewLogger(t))
+	versions := Versioning{Deprecations: map[int]Deprecation{V1: {
+		Since:     time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+		Successor: "/v2/users",
+	}}}
+
+	r := mux.NewRouter()
+	r.Handle("/users/{email}", versions.Negotiate(http.HandlerFunc(handler.GetUser))).Methods("GET")
+	v1 := r.PathPrefix("/v1").Subrouter()
+	v1.Use(versions.Pin(V1))
+	v1.HandleFunc("/users/{email}", handler.GetUser).Methods("GET")
+	v2 := r.PathPrefix("/v2").Subrouter()
+	v2.Use(versions.Pin(V2))
+	v2.HandleFunc("/users", handler.CreateUser).Methods("POST")
+	v2.HandleFunc("/users", handler.ListUsers).Methods("GET")
+	v2.HandleFunc("/users/{id}", handler.GetUser).Methods("GET")
+	v2.HandleFunc("/users/{id}", handler.UpdateUser).Methods("PUT")
+
+	if err := svc.CreateUser(context.Background(), &model.User{Email: "a@example.com", Name: "A", Age: 20}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return r, svc
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	r, svc := setupVersionedRouter(t)
+	a, _ := svc.GetUser(context.Background(), "a@example.com")
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("v1", func(t *testing.T) {
+		for _, path := range []string{"/users/a@example.com", "/v1/users/a@example.com"} {
+			w := get(path, "")
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("%s: expected a 200 JSON response, got %d %s", path, w.Code, w.Header().Get("Content-Type"))
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if _, ok := got["id"]; ok || got["email"] != "a@example.com" {
+				t.Errorf("%s: expected the v1 user without an id, got %s", path, w.Body.String())
+			}
+			if got := w.Header().Get("Deprecation"); got != "@1792368000" {
+				t.Errorf("%s: expected a Deprecation header, got %q", path, got)
+			}
+			if got := w.Header().Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+				t.Errorf("%s: expected a Sunset header, got %q", path, got)
+			}
+			if got := w.Header().Get("Link"); got != `</v2/users>; rel="successor-version"` {
+				t.Errorf("%s: expected a successor-version link, got %q", path, got)
+			}
+		}
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		for _, tc := range []struct{ path, accept, contentType string }{
+			{"/v2/users/" + a.ID, "", "application/json"},
+			{"/v2/users/" + a.ID, MediaType(V2), MediaType(V2)},
+			{"/users/a@example.com", MediaType(V2), MediaType(V2)},
+		} {
+			w := get(tc.path, tc.accept)
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != tc.contentType {
+				t.Fatalf("%s: expected a 200 %s response, got %d %s", tc.path, tc.contentType, w.Code, w.Header().Get("Content-Type"))
+			}
+			var got envelope[userV2]
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if got.Data.ID != a.ID || got.Data.CreatedAt == nil || got.Data.UpdatedAt == nil {
+				t.Errorf("%s: expected the v2 user with its id and timestamps, got %s", tc.path, w.Body.String())
+			}
+			if w.Header().Get("Deprecation") != "" || w.Header().Get("Vary") != "Accept" {
+				t.Errorf("%s: unexpected headers %v", tc.path, w.Header())
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		w := get("/v2/users/missing", "")
+		var got errorEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusNotFound || got.Error.Status != http.StatusNotFound {
+			t.Errorf("expected a 404 error envelope, got %d %s", w.Code, w.Body.String())
+		}
+		if w := get("/users/missing@example.com", ""); w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+			t.Errorf("expected a plain text 404 in v1, got %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		if w := get("/users/a@example.com", MediaType(3)); w.Code != http.StatusNotAcceptable {
+			t.Errorf("expected 406 for an unknown version, got %d", w.Code)
+		}
+		if w := get("/v2/users/"+a.ID, MediaType(V1)); w.Code != http.StatusNotAcceptable {
+			t.Errorf("expected 406 for v1 under /v2, got %d", w.Code)
+		}
+	})
+}
+
+func TestV2Writes(t *testing.T) {
+	r, svc := setupVersionedRouter(t)
+
+	body, _ := json.Marshal(userInputV2{Email: "b@example.com", Name: "B", Age: 30})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/v2/users", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+	var created envelope[userV2]
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.Data.ID == "" || w.Header().Get("Location") != "/v2/users/"+created.Data.ID {
+		t.Errorf("expected the created user and its Location, got %s %s", w.Header().Get("Location"), w.Body.String())
+	}
+
+	body, _ = json.Marshal(userInputV2{Email: "ignored@example.com", Name: "Bee", Age: 31})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/v2/users/"+created.Data.ID, bytes.NewReader(body)))
+	var updated envelope[userV2]
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK with the user, got %d %s", w.Code, w.Body.String())
+	}
+	if updated.Data.Email != "b@example.com" || updated.Data.Name != "Bee" || !updated.Data.CreatedAt.Equal(*created.Data.CreatedAt) {
+		t.Errorf("expected the name changed and the email and creation time kept, got %+v", updated.Data)
+	}
+	if got, _ := svc.GetUserByID(context.Background(), created.Data.ID); got == nil || got.Age != 31 {
+		t.Errorf("user not updated, got %+v", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v2/users", nil))
+	var list listEnvelope[userV2]
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || list.Meta.Count != 2 || len(list.Data) != 2 {
+		t.Errorf("expected an envelope of 2 users, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,194 @@
+// Package health runs dependency checks for the liveness and readiness
+// endpoints.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses reported for checks and overall health.
+const (
+	StatusOK = "ok"
+	// StatusDegraded means a non-critical check failed. The service keeps
+	// reporting ready.
+	StatusDegraded = "degraded"
+	// StatusUnavailable means a critical check failed or the service is
+	// shutting down.
+	StatusUnavailable = "unavailable"
+)
+
+// DefaultTimeout bounds each check when the registry has no timeout.
+const DefaultTimeout = 2 * time.Second
+
+// CheckFunc reports whether a dependency is usable. It should return
+// promptly once ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	critical bool
+}
+
+// Registry holds the checks subsystems register and tracks whether the
+// service is shutting down.
+type Registry struct {
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewRegistry returns a registry running each check with timeout, or
+// DefaultTimeout if timeout is zero.
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a check that must pass for the service to be ready.
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.add(check{name: name, fn: fn, critical: true})
+}
+
+// RegisterNonCritical adds a check whose failure is reported but does not
+// make the service unready, for dependencies the service can run without.
+func (r *Registry) RegisterNonCritical(name string, fn CheckFunc) {
+	r.add(check{name: name, fn: fn})
+}
+
+func (r *Registry) add(c check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, c)
+}
+
+// SetShuttingDown makes readiness fail from now on, so load balancers stop
+// sending new requests while in-flight ones finish.
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+// ShuttingDown reports whether SetShuttingDown has been called.
+func (r *Registry) ShuttingDown() bool {
+	return r.shuttingDown.Load()
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Critical bool    `json:"critical"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// Report is the outcome of every check.
+type Report struct {
+	Status       string                 `json:"status"`
+	ShuttingDown bool                   `json:"shutting_down,omitempty"`
+	Checks       map[string]CheckResult `json:"checks"`
+}
+
+// Check runs every registered check concurrently.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		res := results[i]
+		report.Checks[c.name] = res
+		switch {
+		case res.Status == StatusOK:
+		case c.critical:
+			report.Status = StatusUnavailable
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	if r.ShuttingDown() {
+		report.Status = StatusUnavailable
+		report.ShuttingDown = true
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{Status: StatusOK, Critical: c.critical, Duration: time.Since(start).Seconds()}
+	if err != nil {
+		res.Status = StatusUnavailable
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// LivenessHandler serves /healthz. It only shows that the process can
+// serve requests; dependencies are not checked, so a failing dependency
+// does not get the process restarted.
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		write(w, req, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler serves /readyz, answering 503 while a critical check
+// fails or the service is shutting down.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Check(req.Context())
+		status := http.StatusOK
+		if report.Status == StatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		write(w, req, status, report)
+	})
+}
+
+// write answers with the plain status, or the full report as JSON when
+// the request has ?verbose.
+func write(w http.ResponseWriter, req *http.Request, status int, report Report) {
+	w.Header().Set("Cache-Control", "no-store")
+	if _, verbose := req.URL.Query()["verbose"]; !verbose {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(report.Status + "\n"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	reg := NewRegistry(50 * time.Millisecond)
+	var dbErr error
+	reg.Register("repository", func(ctx context.Context) error { return dbErr })
+	reg.RegisterNonCritical("mailer", func(ctx context.Context) error { return errors.New("connection refused") })
+	h := reg.ReadinessHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "degraded\n" {
+		t.Errorf("expected 200 degraded with a failing non-critical check, got %d %q", w.Code, w.Body.String())
+	}
+
+	dbErr = errors.New("table missing")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/readyz?verbose", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with a failing critical check, got %d", w.Code)
+	}
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if report.Status != StatusUnavailable || report.Checks["repository"].Error != "table missing" || !report.Checks["repository"].Critical {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Checks["mailer"].Status != StatusUnavailable || report.Checks["mailer"].Critical {
+		t.Errorf("unexpected mailer result: %+v", report.Checks["mailer"])
+	}
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	reg := NewRegistry(10 * time.Millisecond)
+	reg.Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := reg.Check(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("check was not bounded by the timeout")
+	}
+	if report.Status != StatusUnavailable || report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected slow check to time out, got %+v", report)
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	reg := NewRegistry(0)
+	reg.Register("repository", func(ctx context.Context) error { return nil })
+	reg.SetShuttingDown()
+
+	w := httptest.NewRecorder()
+	reg.ReadinessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail while shutting down, got %d", w.Code)
+	}
+
+	// Liveness is unaffected, so the process is not restarted mid-drain.
+	w = httptest.NewRecorder()
+	reg.LivenessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("expected liveness to pass, got %d %q", w.Code, w.Body.String())
+	}
+}
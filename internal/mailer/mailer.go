@@ -0,0 +1,91 @@
+// Package mailer sends transactional email such as verification and
+// password reset messages.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Checker is implemented by mailers that can check whether they are able
+// to deliver mail, for health checks.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// SMTPConfig configures an SMTP mailer. Username may be empty for relays
+// that do not require authentication.
+type SMTPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) Mailer {
+	return &smtpMailer{cfg: cfg}
+}
+
+// Send delivers msg through the configured server. net/smtp does not
+// support cancellation, so ctx is only checked before connecting.
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		host := m.cfg.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)
+	}
+	return smtp.SendMail(m.cfg.Addr, auth, m.cfg.From, []string{msg.To}, formatMessage(m.cfg.From, msg, time.Now()))
+}
+
+// Check connects to the SMTP server without sending anything.
+func (m *smtpMailer) Check(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func formatMessage(from string, msg Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so values cannot inject extra headers.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
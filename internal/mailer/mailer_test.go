@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	for _, name := range []string{TemplateVerifyEmail, TemplatePasswordReset} {
+		msg, err := Render(name, "a@example.com", TemplateData{Name: "Alice", Link: "https://x/?token=abc", Expires: "1h0m0s"})
+		if err != nil {
+			t.Fatalf("Render(%s) failed: %v", name, err)
+		}
+		if msg.To != "a@example.com" || msg.Subject == "" {
+			t.Errorf("Render(%s) returned incomplete message: %+v", name, msg)
+		}
+		if !strings.Contains(msg.Body, "Hi Alice") || !strings.Contains(msg.Body, "https://x/?token=abc") {
+			t.Errorf("Render(%s) body missing data: %q", name, msg.Body)
+		}
+	}
+	if _, err := Render("missing", "a@example.com", TemplateData{}); err == nil {
+		t.Error("Expected error for unknown template")
+	}
+}
+
+func TestFileOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatalf("NewFileOutbox failed: %v", err)
+	}
+	msg := Message{To: "a@example.com\r\nBcc: evil@example.com", Subject: "Hello", Body: "line one\nline two"}
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if len(outbox.Messages()) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(outbox.Messages()))
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 file in outbox dir, got %d", len(entries))
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	if strings.Contains(string(data), "\r\nBcc:") {
+		t.Errorf("Header injection was not prevented:\n%s", data)
+	}
+	if !strings.Contains(string(data), "line one\r\nline two") {
+		t.Errorf("Expected CRLF line endings in body:\n%s", data)
+	}
+}
+
+func TestOutboxCheck(t *testing.T) {
+	dir := t.TempDir() + "/outbox"
+	outbox, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatalf("NewFileOutbox failed: %v", err)
+	}
+	if err := outbox.Check(context.Background()); err != nil {
+		t.Errorf("Expected check to pass, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Check left %d files behind", len(entries))
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Check(context.Background()); err == nil {
+		t.Error("Expected check to fail once the directory is gone")
+	}
+}
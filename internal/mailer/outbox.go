@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox is a Mailer that keeps sent messages in memory instead of
+// delivering them, optionally also writing each one to a directory as an
+// .eml file. It is used in tests and local development.
+type Outbox struct {
+	dir      string
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewOutbox returns an in-memory outbox.
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+// NewFileOutbox returns an outbox that also writes messages to dir.
+func NewFileOutbox(dir string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.dir != "" {
+		now := time.Now()
+		name := fmt.Sprintf("%d-%04d.eml", now.UnixNano(), len(o.messages))
+		if err := os.WriteFile(filepath.Join(o.dir, name), formatMessage("outbox@localhost", msg, now), 0o600); err != nil {
+			return err
+		}
+	}
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
+
+// Check verifies that the outbox directory, if any, is still a writable
+// directory.
+func (o *Outbox) Check(ctx context.Context) error {
+	if o.dir == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(o.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// Template names
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+	TemplateEnrollMFA     = "enroll_mfa"
+)
+
+// TemplateData is passed to every template.
+type TemplateData struct {
+	Name    string
+	Link    string
+	Expires string
+}
+
+// Each message is defined as a pair of "<name>.subject" and "<name>.body"
+// templates.
+var templates = template.Must(template.New("mail").Parse(`
+{{define "verify_email.subject"}}Verify your email address{{end}}
+{{define "verify_email.body"}}Hi {{.Name}},
+
+Please confirm your email address by opening the link below:
+
+{{.Link}}
+
+This link expires in {{.Expires}}. If you did not create an account you can
+ignore this message.
+{{end}}
+
+{{define "password_reset.subject"}}Reset your password{{end}}
+{{define "password_reset.body"}}Hi {{.Name}},
+
+We received a request to reset your password. Open the link below to choose
+a new one:
+
+{{.Link}}
+
+This link expires in {{.Expires}} and can only be used once. If you did not
+request a reset you can ignore this message.
+{{end}}
+
+{{define "enroll_mfa.subject"}}Set up two-factor authentication{{end}}
+{{define "enroll_mfa.body"}}Hi {{.Name}},
+
+Open the link below to set up an authenticator app for your account:
+
+{{.Link}}
+
+This link expires in {{.Expires}} and can only be used once. If you did not
+ask to set up two-factor authentication you can ignore this message.
+{{end}}
+`))
+
+// Render builds the message for template name addressed to to.
+func Render(name, to string, data TemplateData) (Message, error) {
+	var subject, body bytes.Buffer
+	if err := templates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := templates.ExecuteTemplate(&body, name+".body", data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
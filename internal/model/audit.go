@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// Audit actions
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditIPLocked        = "ip_locked"
+	AuditAccountUnlocked = "account_unlocked"
+	AuditStateChanged    = "state_changed"
+	AuditUserDeleted     = "user_deleted"
+	AuditUserRestored    = "user_restored"
+	AuditUserPurged      = "user_purged"
+	AuditUserExported    = "user_exported"
+	AuditUserErased      = "user_erased"
+	AuditKeysRotated     = "keys_rotated"
+)
+
+// AuditEvent is an append-only record of a security relevant action.
+type AuditEvent struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Email  string    `json:"email,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
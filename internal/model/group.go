@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Group is a named set of users, referenced by email.
+type Group struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	Members     []string  `json:"members"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
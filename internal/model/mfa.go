@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// MFA holds a user's TOTP enrollment. Secret and recovery codes are never
+// returned to clients after enrollment.
+type MFA struct {
+	Email         string    `json:"email"`
+	Secret        []byte    `json:"-"`
+	Confirmed     bool      `json:"confirmed"`
+	LastUsedStep  int64     `json:"-"`
+	RecoveryCodes []string  `json:"-"` // SHA-256 hashes, removed once used
+	CreatedAt     time.Time `json:"created_at"`
+	ConfirmedAt   time.Time `json:"confirmed_at,omitempty"`
+}
+
+// TOTPSetup is returned when a user starts TOTP enrollment.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// DataExport is everything stored about a user, assembled for a data
+// subject access request. Secrets such as password hashes, TOTP secrets
+// and token hashes are never included.
+type DataExport struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	User        *User         `json:"user"`
+	PasswordSet bool          `json:"password_set"`
+	MFA         *MFA          `json:"mfa,omitempty"`
+	Tokens      []*Token      `json:"tokens"`
+	AuditEvents []*AuditEvent `json:"audit_events"`
+}
+
+// Tombstone proves that a user's data was erased without retaining their
+// email. SubjectHash is a keyed hash of the email, so a later request about
+// the same email can be matched to it.
+type Tombstone struct {
+	SubjectHash     string    `json:"subject_hash"`
+	Pseudonym       string    `json:"pseudonym"`
+	ErasedAt        time.Time `json:"erased_at"`
+	AuditEventCount int       `json:"audit_events_pseudonymized"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// UserSearchResult is a page of the users matching a search, best match
+// first.
+type UserSearchResult struct {
+	// Total is how many users match, across every page.
+	Total int
+	Hits  []UserHit
+}
+
+// UserHit is a user matching a search, with how well it matches and the
+// fields that matched highlighted.
+type UserHit struct {
+	User       *User
+	Score      float64
+	Highlights map[string]string
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Token purposes
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+	TokenMFAEnrollment     = "mfa_enrollment"
+)
+
+// Token is a single-use token sent to a user by email. Only the SHA-256
+// hash of the token is stored.
+type Token struct {
+	Hash      string    `json:"-"`
+	Email     string    `json:"email"`
+	Purpose   string    `json:"purpose"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -1,7 +1,52 @@
 package model
 
+import "time"
+
+// UserState is a user's lifecycle state.
+type UserState string
+
+const (
+	StatePending     UserState = "pending"
+	StateActive      UserState = "active"
+	StateSuspended   UserState = "suspended"
+	StateDeactivated UserState = "deactivated"
+)
+
+// Valid reports whether s is a known state.
+func (s UserState) Valid() bool {
+	switch s {
+	case StatePending, StateActive, StateSuspended, StateDeactivated:
+		return true
+	}
+	return false
+}
+
+// User fields tagged `pii` are masked or hashed when a user is logged.
+// Users are addressed by email in v1 of the API and by ID from v2 on;
+// users created before IDs were introduced have no ID or CreatedAt.
+// Version changes every time the user is written, and is set by the
+// repository on the users it returns; users passed to writes are left
+// untouched.
 type User struct {
-	Email string `json:"email"` // unique id
-	Name  string `json:"name"`
-	Age   int    `json:"age"`
+	ID             string     `json:"id,omitempty"`
+	Email          string     `json:"email" pii:"hash"` // unique id
+	Name           string     `json:"name" pii:"mask"`
+	Age            int        `json:"age"`
+	State          UserState  `json:"state,omitempty"`
+	StateChangedAt *time.Time `json:"state_changed_at,omitempty"`
+	StateReason    string     `json:"state_reason,omitempty"`
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+	Version        uint64     `json:"-"`
+	PasswordHash   string     `json:"-"`
+}
+
+// UserFilter narrows ListUsers results. Zero values match every user.
+type UserFilter struct {
+	State UserState
+	// Expression is a filter expression, in the language of package
+	// filter, users must match too.
+	Expression string
 }
@@ -0,0 +1,202 @@
+// Package openapi builds OpenAPI 3.1 documents describing the HTTP API.
+// Each package that serves routes describes them on a shared Document,
+// with schemas derived from the Go types it encodes and decodes.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Version is the OpenAPI version documents are written in.
+const Version = "3.1.0"
+
+// Media types used across the API.
+const (
+	JSON    = "application/json"
+	Text    = "text/plain"
+	Problem = "application/problem+json"
+)
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	// names maps the Go types reflected into Components.Schemas to their
+	// names there.
+	names *registry
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// PathItem holds the operations of a path, keyed by lowercase method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Schema      *Schema     `json:"schema,omitempty"`
+	Example     interface{} `json:"example,omitempty"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema  *Schema     `json:"schema,omitempty"`
+	Example interface{} `json:"example,omitempty"`
+}
+
+// Response is a response, or a reference to one in Components.Responses.
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// New returns an empty document.
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			Responses:       make(map[string]*Response),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+		names: newRegistry(),
+	}
+}
+
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// Add describes the operation serving method on path, a mux route template.
+// Path parameters the operation does not declare are added as required
+// strings, and mux patterns such as {id:[0-9]+} are removed from path.
+func (d *Document) Add(method, path string, op *Operation) {
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		if d.param(op, m[1]) == nil {
+			op.Parameters = append(op.Parameters, &Parameter{Name: m[1], In: "path", Required: true, Schema: String()})
+		}
+	}
+	path = pathParam.ReplaceAllString(path, "{$1}")
+	item := d.Paths[path]
+	if item == nil {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+func (d *Document) param(op *Operation, name string) *Parameter {
+	for _, p := range op.Parameters {
+		if p.Name == name && p.In == "path" {
+			return p
+		}
+	}
+	return nil
+}
+
+// Operation returns the operation serving method on path, or nil.
+func (d *Document) Operation(method, path string) *Operation {
+	item := d.Paths[pathParam.ReplaceAllString(path, "{$1}")]
+	if item == nil {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// Resolve follows a reference to a component response.
+func (d *Document) Resolve(r *Response) *Response {
+	if name := strings.TrimPrefix(r.Ref, "#/components/responses/"); r.Ref != "" {
+		if resolved := d.Components.Responses[name]; resolved != nil {
+			return resolved
+		}
+	}
+	return r
+}
+
+// DefineResponse adds a reusable response and returns a reference to it.
+func (d *Document) DefineResponse(name string, r *Response) *Response {
+	d.Components.Responses[name] = r
+	return &Response{Ref: "#/components/responses/" + name}
+}
+
+// BearerAuth adds a bearer token security scheme and returns the
+// requirement operations list in Security.
+func (d *Document) BearerAuth(name, description string) []map[string][]string {
+	d.Components.SecuritySchemes[name] = &SecurityScheme{Type: "http", Scheme: "bearer", Description: description}
+	return []map[string][]string{{name: {}}}
+}
+
+// Body returns a required request body of mediaType.
+func Body(mediaType string, s *Schema, example interface{}) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]*MediaType{mediaType: {Schema: s, Example: example}}}
+}
+
+// Respond returns a response without a body.
+func Respond(description string) *Response {
+	return &Response{Description: description}
+}
+
+// RespondWith returns a response with a body of mediaType.
+func RespondWith(description, mediaType string, s *Schema) *Response {
+	return &Response{Description: description, Content: map[string]*MediaType{mediaType: {Schema: s}}}
+}
+
+// Handler serves doc as JSON.
+func Handler(doc *Document) http.Handler {
+	body, err := json.MarshalIndent(doc, "", "  ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "Failed to encode document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", JSON)
+		_, _ = w.Write(body)
+	})
+}
@@ -0,0 +1,276 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema (draft 2020-12), as used by OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+}
+
+// Types is the type keyword, written as a string when it holds one type.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *Types) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+func String() *Schema  { return &Schema{Type: Types{"string"}} }
+func Integer() *Schema { return &Schema{Type: Types{"integer"}} }
+func Boolean() *Schema { return &Schema{Type: Types{"boolean"}} }
+
+// Any returns a schema every value matches.
+func Any() *Schema { return &Schema{} }
+
+// ArrayOf returns a schema for arrays of items.
+func ArrayOf(items *Schema) *Schema { return &Schema{Type: Types{"array"}, Items: items} }
+
+// MapOf returns a schema for objects whose values match values.
+func MapOf(values *Schema) *Schema {
+	return &Schema{Type: Types{"object"}, AdditionalProperties: values}
+}
+
+// Object returns a schema for objects with the given properties, all of
+// them required.
+func Object(properties map[string]*Schema) *Schema {
+	s := &Schema{Type: Types{"object"}, Properties: properties}
+	for name := range properties {
+		s.Required = append(s.Required, name)
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// nullable returns s admitting null as well.
+func nullable(s *Schema) *Schema {
+	switch {
+	case s.Ref != "":
+		return &Schema{AnyOf: []*Schema{s, {Type: Types{"null"}}}}
+	case len(s.Type) == 0:
+		return s
+	}
+	n := *s
+	n.Type = append(append(Types(nil), s.Type...), "null")
+	return &n
+}
+
+type registry struct {
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+	enums map[reflect.Type][]interface{}
+}
+
+func newRegistry() *registry {
+	return &registry{
+		names: make(map[reflect.Type]string),
+		types: make(map[string]reflect.Type),
+		enums: make(map[reflect.Type][]interface{}),
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Enum declares the values of their type, which is described as an enum
+// wherever it is used. It must be called before the type is reflected.
+func (d *Document) Enum(values ...interface{}) {
+	if len(values) > 0 {
+		t := reflect.TypeOf(values[0])
+		d.names.enums[t] = append(d.names.enums[t], values...)
+	}
+}
+
+// Define adds the schema of v, a struct, to the components under name and
+// returns a reference to it. Types reflected later refer to that name.
+func (d *Document) Define(name string, v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return d.named(name, t)
+}
+
+// DefineSchema adds s to the components under name and returns a reference
+// to it, for types whose encoding cannot be reflected.
+func (d *Document) DefineSchema(name string, s *Schema) *Schema {
+	if _, ok := d.Components.Schemas[name]; ok {
+		panic(fmt.Sprintf("openapi: schema %s defined twice", name))
+	}
+	d.Components.Schemas[name] = s
+	return ref(name)
+}
+
+// Schema returns the schema of v as encoding/json encodes it. Named struct
+// types and enums are added to the components and referenced.
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.reflect(reflect.TypeOf(v))
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (d *Document) reflect(t reflect.Type) *Schema {
+	if t == nil {
+		return Any()
+	}
+	if t.Kind() == reflect.Pointer {
+		return d.reflect(t.Elem())
+	}
+	if t == timeType {
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	}
+	if name, ok := d.names.names[t]; ok {
+		return ref(name)
+	}
+	if _, ok := d.names.enums[t]; ok {
+		return d.named(exportedName(t.Name()), t)
+	}
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		// The encoding is custom, so nothing can be said about it.
+		return Any()
+	}
+	if t.Kind() == reflect.Struct && t.Name() != "" {
+		return d.named(exportedName(t.Name()), t)
+	}
+	return d.build(t)
+}
+
+// named registers t under name and returns a reference to it.
+func (d *Document) named(name string, t reflect.Type) *Schema {
+	if other, ok := d.names.types[name]; ok && other != t {
+		panic(fmt.Sprintf("openapi: schema %s would describe both %v and %v", name, other, t))
+	}
+	if other, ok := d.names.names[t]; ok && other != name {
+		panic(fmt.Sprintf("openapi: %v is already described as %s", t, other))
+	}
+	if _, ok := d.names.names[t]; !ok {
+		d.names.names[t] = name
+		d.names.types[name] = t
+		// Register before building, so recursive types terminate.
+		d.Components.Schemas[name] = nil
+		d.Components.Schemas[name] = d.build(t)
+	}
+	return ref(name)
+}
+
+func (d *Document) build(t reflect.Type) *Schema {
+	s := d.kind(t)
+	if values, ok := d.names.enums[t]; ok {
+		s.Enum = values
+	}
+	return s
+}
+
+func (d *Document) kind(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Integer()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: Types{"integer"}, Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return String()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		return ArrayOf(d.reflect(t.Elem()))
+	case reflect.Map:
+		return MapOf(d.reflect(t.Elem()))
+	case reflect.Struct:
+		s := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema)}
+		d.fields(s, t)
+		sort.Strings(s.Required)
+		return s
+	case reflect.Pointer:
+		return d.reflect(t.Elem())
+	}
+	return Any()
+}
+
+// fields adds the properties encoding/json writes for the fields of t.
+// Fields without omitempty are required, and null when they are nil.
+func (d *Document) fields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				d.fields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := d.reflect(ft)
+		if strings.Contains(","+opts+",", ",omitempty,") {
+			s.Properties[name] = prop
+			continue
+		}
+		switch ft.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			if !(ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8) {
+				prop = nullable(prop)
+			}
+		}
+		s.Properties[name] = prop
+		s.Required = append(s.Required, name)
+	}
+}
+
+// exportedName capitalizes name, so unexported types get names like the
+// exported ones.
+func exportedName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[n:]
+}
@@ -0,0 +1,112 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type color string
+
+type inner struct {
+	Value string `json:"value"`
+}
+
+type embedded struct {
+	Flat bool `json:"flat"`
+}
+
+type sample struct {
+	embedded
+	Name     string     `json:"name"`
+	Nick     string     `json:"nick,omitempty"`
+	Color    color      `json:"color"`
+	At       time.Time  `json:"at"`
+	Optional *time.Time `json:"optional,omitempty"`
+	Nullable *inner     `json:"nullable"`
+	Tags     []string   `json:"tags"`
+	Secret   string     `json:"-"`
+	hidden   string
+}
+
+func TestSchemaReflection(t *testing.T) {
+	doc := New("test", "1", "")
+	doc.Enum(color("red"), color("green"))
+	ref := doc.Schema(sample{})
+	if ref.Ref != "#/components/schemas/Sample" {
+		t.Fatalf("expected a reference to Sample, got %+v", ref)
+	}
+	s := doc.Components.Schemas["Sample"]
+
+	var props []string
+	for name := range s.Properties {
+		props = append(props, name)
+	}
+	for _, want := range []string{"flat", "name", "nick", "color", "at", "optional", "nullable", "tags"} {
+		if s.Properties[want] == nil {
+			t.Errorf("missing property %s in %v", want, props)
+		}
+	}
+	if len(s.Properties) != 8 {
+		t.Errorf("expected 8 properties, got %v", props)
+	}
+	if got := strings.Join(s.Required, ","); got != "at,color,flat,name,nullable,tags" {
+		t.Errorf("unexpected required properties %s", got)
+	}
+	if at := s.Properties["at"]; at.Format != "date-time" {
+		t.Errorf("expected time.Time to be a date-time, got %+v", at)
+	}
+	if tags, _ := json.Marshal(s.Properties["tags"].Type); string(tags) != `["array","null"]` {
+		t.Errorf("expected a nullable array, got %s", tags)
+	}
+	if enum := doc.Components.Schemas["Color"]; enum == nil || len(enum.Enum) != 2 {
+		t.Errorf("expected an enum schema for color, got %+v", enum)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	doc := New("test", "1", "")
+	doc.Enum(color("red"), color("green"))
+	s := doc.Schema(sample{})
+
+	valid := `{"flat":true,"name":"a","color":"red","at":"2024-01-02T03:04:05Z","nullable":null,"tags":["x"]}`
+	for _, tc := range []struct {
+		name, body, err string
+	}{
+		{"valid", valid, ""},
+		{"nested", strings.Replace(valid, `"nullable":null`, `"nullable":{"value":"v"}`, 1), ""},
+		{"missing", `{"name":"a"}`, `missing property "at"`},
+		{"undocumented", strings.Replace(valid, `"name":"a"`, `"name":"a","extra":1`, 1), `undocumented property "extra"`},
+		{"enum", strings.Replace(valid, "red", "blue", 1), "is not one of"},
+		{"type", strings.Replace(valid, `"tags":["x"]`, `"tags":[1]`, 1), "$.tags[0]: expected string"},
+		{"date-time", strings.Replace(valid, "2024-01-02T03:04:05Z", "yesterday", 1), "not a date-time"},
+		{"nested type", strings.Replace(valid, `"nullable":null`, `"nullable":{"value":1}`, 1), "matches no alternative"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(tc.body), &v); err != nil {
+				t.Fatal(err)
+			}
+			err := doc.Validate(s, v)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("expected %s to be valid, got %v", tc.body, err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestAddPathParameters(t *testing.T) {
+	doc := New("test", "1", "")
+	doc.Add("GET", "/items/{id:[0-9]+}", &Operation{OperationID: "getItem"})
+	op := doc.Operation("GET", "/items/{id}")
+	if op == nil {
+		t.Fatal("operation not found under the cleaned path")
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || !op.Parameters[0].Required {
+		t.Errorf("expected a required id path parameter, got %+v", op.Parameters)
+	}
+}
@@ -0,0 +1,137 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Validate checks v, a value decoded by encoding/json into interface{},
+// against s. It is stricter than JSON Schema in one way: objects may only
+// hold the properties their schema declares, unless it also allows
+// additional properties, so undocumented fields are caught.
+func (d *Document) Validate(s *Schema, v interface{}) error {
+	return d.validate(s, v, "$")
+}
+
+func (d *Document) validate(s *Schema, v interface{}, path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		resolved := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if resolved == nil {
+			return fmt.Errorf("%s: unresolved reference %s", path, s.Ref)
+		}
+		return d.validate(resolved, v, path)
+	}
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, alt := range s.AnyOf {
+			err := d.validate(alt, v, path)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s: matches no alternative: %s", path, strings.Join(errs, "; "))
+	}
+	if len(s.Type) > 0 && !s.hasType(typeOf(v)) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), typeOf(v))
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return fmt.Errorf("%s: %v is not one of %v", path, v, s.Enum)
+	}
+	if s.Format == "date-time" {
+		if str, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", path, str)
+			}
+		}
+	}
+	if n, ok := v.(float64); ok && s.Minimum != nil && n < *s.Minimum {
+		return fmt.Errorf("%s: %v is less than %v", path, n, *s.Minimum)
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		for i, item := range v {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing property %q", path, name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			switch {
+			case ok:
+			case s.AdditionalProperties != nil:
+				prop = s.AdditionalProperties
+			case s.Properties != nil:
+				return fmt.Errorf("%s: undocumented property %q", path, k)
+			default:
+				continue
+			}
+			if err := d.validate(prop, v[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) hasType(t string) bool {
+	for _, want := range s.Type {
+		if want == t || want == "number" && t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of v.
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		// Enum values are Go values, such as named string types.
+		if rv := reflect.ValueOf(e); rv.Kind() == reflect.String {
+			e = rv.String()
+		}
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"user-service/internal/encryption"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+type AuditRepository interface {
+	// Append stores event, assigning it the next sequential ID.
+	Append(ctx context.Context, event *model.AuditEvent) error
+	ListByEmail(ctx context.Context, email string) ([]*model.AuditEvent, error)
+	// Pseudonymize replaces email with pseudonym in every event about
+	// email and drops the client IP, returning how many events changed.
+	Pseudonymize(ctx context.Context, email, pseudonym string) (int, error)
+}
+
+type memAuditRepo struct {
+	db  *memdb.MemDB
+	enc *FieldEncryptor
+}
+
+// auditRecord is how events are stored, indexed by EmailKey. The email is
+// held in SealedEmail instead when encryption is enabled.
+type auditRecord struct {
+	model.AuditEvent
+	EmailKey    string
+	SealedEmail *encryption.Envelope
+}
+
+func NewAuditRepository(db *memdb.MemDB, opts ...RepositoryOption) AuditRepository {
+	return &memAuditRepo{db: db, enc: applyRepositoryOptions(opts).enc}
+}
+
+// toRecord returns event as stored, about email.
+func (r *memAuditRepo) toRecord(event model.AuditEvent, email string) (*auditRecord, error) {
+	rec := &auditRecord{AuditEvent: event}
+	var err error
+	if rec.Email, rec.EmailKey, rec.SealedEmail, err = r.enc.sealEmail(email); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (r *memAuditRepo) Append(ctx context.Context, event *model.AuditEvent) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	// Write transactions are serialized, so the last ID cannot change
+	// before we commit.
+	last, err := txn.Last("audit", "id")
+	if err != nil {
+		return err
+	}
+	event.ID = 1
+	if last != nil {
+		event.ID = last.(*auditRecord).ID + 1
+	}
+
+	rec, err := r.toRecord(*event, event.Email)
+	if err != nil {
+		return err
+	}
+	if err := txn.Insert("audit", rec); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memAuditRepo) ListByEmail(ctx context.Context, email string) ([]*model.AuditEvent, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	it, err := txn.Get("audit", "email", r.enc.indexKey(email))
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*model.AuditEvent
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		rec := obj.(*auditRecord)
+		event := rec.AuditEvent
+		if event.Email, err = r.enc.openEmail(rec.Email, rec.EmailKey, rec.SealedEmail); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+func (r *memAuditRepo) Pseudonymize(ctx context.Context, email, pseudonym string) (int, error) {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	it, err := txn.Get("audit", "email", r.enc.indexKey(email))
+	if err != nil {
+		return 0, err
+	}
+	var events []*auditRecord
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		events = append(events, obj.(*auditRecord))
+	}
+
+	for _, event := range events {
+		updated, err := r.toRecord(event.AuditEvent, pseudonym)
+		if err != nil {
+			return 0, err
+		}
+		updated.IP = ""
+		if err := txn.Insert("audit", updated); err != nil {
+			return 0, err
+		}
+	}
+	txn.Commit()
+	return len(events), nil
+}
+
+func (r *memAuditRepo) RotateKeys(ctx context.Context) (int, error) {
+	return rotator{
+		db:    r.db,
+		table: "audit",
+		id:    func(obj interface{}) interface{} { return obj.(*auditRecord).ID },
+		stale: func(obj interface{}) bool {
+			rec := obj.(*auditRecord)
+			return r.enc.staleEmail(rec.Email, rec.SealedEmail)
+		},
+		reseal: func(obj interface{}) (interface{}, error) {
+			updated := *obj.(*auditRecord)
+			var err error
+			updated.Email, updated.EmailKey, updated.SealedEmail, err = r.enc.resealEmail(updated.Email, updated.EmailKey, updated.SealedEmail)
+			return &updated, err
+		},
+	}.rotate(ctx)
+}
@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"user-service/internal/encryption"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+// DefaultPIIFields are the model.User fields encrypted by default.
+var DefaultPIIFields = []string{"Email", "Name"}
+
+// FieldEncryptor encrypts the configured PII fields of users before they
+// are stored. Emails are replaced in indexes by a blind index, so lookups
+// by email and the uniqueness check keep working on encrypted records.
+type FieldEncryptor struct {
+	keys   encryption.Keyring
+	fields []string
+}
+
+// NewFieldEncryptor returns an encryptor for the named string fields of
+// model.User.
+func NewFieldEncryptor(keys encryption.Keyring, fields ...string) (*FieldEncryptor, error) {
+	t := reflect.TypeOf(model.User{})
+	for _, name := range fields {
+		f, ok := t.FieldByName(name)
+		if !ok || f.Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("repository: %q is not a string field of model.User", name)
+		}
+	}
+	return &FieldEncryptor{keys: keys, fields: fields}, nil
+}
+
+// indexKey returns the value stored in the email indexes for email.
+func (f *FieldEncryptor) indexKey(email string) string {
+	if f == nil {
+		return email
+	}
+	return f.keys.BlindIndex(email)
+}
+
+// userRecord is how users are stored in memdb. When encryption is enabled
+// the configured fields of the embedded User are blank and held in Sealed
+// instead.
+type userRecord struct {
+	model.User
+	EmailKey string
+	Sealed   *encryption.Envelope
+}
+
+func (f *FieldEncryptor) toRecord(user *model.User) (*userRecord, error) {
+	rec := &userRecord{User: *user, EmailKey: f.indexKey(user.Email)}
+	if f == nil {
+		return rec, nil
+	}
+
+	v := reflect.ValueOf(&rec.User).Elem()
+	values := make(map[string]string, len(f.fields))
+	for _, name := range f.fields {
+		field := v.FieldByName(name)
+		values[name] = field.String()
+		field.SetString("")
+	}
+	plaintext, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	// Binding the ciphertext to its index key stops it being swapped into
+	// another record.
+	env, err := encryption.Seal(f.keys, plaintext, []byte(rec.EmailKey))
+	if err != nil {
+		return nil, err
+	}
+	rec.Sealed = env
+	return rec, nil
+}
+
+func (f *FieldEncryptor) fromRecord(rec *userRecord) (*model.User, error) {
+	user := rec.User
+	if rec.Sealed == nil {
+		return &user, nil
+	}
+	if f == nil {
+		return nil, fmt.Errorf("repository: record for %s is encrypted but no keyring is configured", rec.EmailKey)
+	}
+
+	plaintext, err := encryption.Open(f.keys, rec.Sealed, []byte(rec.EmailKey))
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(&user).Elem()
+	for name, value := range values {
+		if field := v.FieldByName(name); field.IsValid() && field.Kind() == reflect.String {
+			field.SetString(value)
+		}
+	}
+	return &user, nil
+}
+
+// stale reports whether rec was sealed with a key other than the current
+// one, or should be sealed but is not.
+func (f *FieldEncryptor) stale(rec *userRecord) bool {
+	if f == nil {
+		return false
+	}
+	return rec.Sealed == nil || rec.Sealed.KeyID != f.keys.CurrentKeyID()
+}
+
+// RepositoryOption configures the MFA, token, audit and group
+// repositories.
+type RepositoryOption func(*repositoryOptions)
+
+type repositoryOptions struct {
+	enc *FieldEncryptor
+}
+
+// WithEmailEncryptor seals the emails stored by the MFA, token, audit and
+// group repositories and keys their records by the blind index of the
+// email, as the user repository does with WithFieldEncryptor.
+func WithEmailEncryptor(enc *FieldEncryptor) RepositoryOption {
+	return func(o *repositoryOptions) { o.enc = enc }
+}
+
+func applyRepositoryOptions(opts []RepositoryOption) repositoryOptions {
+	var o repositoryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// sealEmail returns what a record outside the user table stores for
+// email: the email itself unless it is sealed, the key to index it by, and
+// the email sealed and bound to that key when encryption is enabled.
+func (f *FieldEncryptor) sealEmail(email string) (string, string, *encryption.Envelope, error) {
+	if f == nil || email == "" {
+		return email, f.indexKey(email), nil, nil
+	}
+	key := f.indexKey(email)
+	env, err := encryption.Seal(f.keys, []byte(email), []byte(key))
+	if err != nil {
+		return "", "", nil, err
+	}
+	return "", key, env, nil
+}
+
+// openEmail reverses sealEmail.
+func (f *FieldEncryptor) openEmail(stored, key string, sealed *encryption.Envelope) (string, error) {
+	if sealed == nil {
+		return stored, nil
+	}
+	if f == nil {
+		return "", fmt.Errorf("repository: email for %s is encrypted but no keyring is configured", key)
+	}
+	plaintext, err := encryption.Open(f.keys, sealed, []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// staleEmail reports whether an email stored by sealEmail was sealed with
+// a key other than the current one, or should be sealed but is not.
+func (f *FieldEncryptor) staleEmail(stored string, sealed *encryption.Envelope) bool {
+	if f == nil {
+		return false
+	}
+	if sealed == nil {
+		return stored != ""
+	}
+	return sealed.KeyID != f.keys.CurrentKeyID()
+}
+
+// resealEmail opens an email stored by sealEmail and seals it again with
+// the current key.
+func (f *FieldEncryptor) resealEmail(stored, key string, sealed *encryption.Envelope) (string, string, *encryption.Envelope, error) {
+	email, err := f.openEmail(stored, key, sealed)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return f.sealEmail(email)
+}
+
+// rotator rewrites the stale records of a table, as memUserRepo.RotateKeys
+// does for users.
+type rotator struct {
+	db    *memdb.MemDB
+	table string
+	// id returns the value of a record's "id" index.
+	id     func(obj interface{}) interface{}
+	stale  func(obj interface{}) bool
+	reseal func(obj interface{}) (interface{}, error)
+}
+
+// rotate finds stale records in a snapshot and rewrites them one
+// transaction each.
+func (r rotator) rotate(ctx context.Context) (int, error) {
+	txn := r.db.Txn(false)
+	it, err := txn.Get(r.table, "id")
+	if err != nil {
+		txn.Abort()
+		return 0, err
+	}
+	var stale []interface{}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if r.stale(obj) {
+			stale = append(stale, r.id(obj))
+		}
+	}
+	txn.Abort()
+
+	rotated := 0
+	for _, key := range stale {
+		if err := ctx.Err(); err != nil {
+			return rotated, err
+		}
+		ok, err := r.rotateRecord(key)
+		if err != nil {
+			return rotated, err
+		}
+		if ok {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+// rotateRecord rewrites the record with the id key if it is still stale.
+// The old record is deleted first, as sealing an email that was stored in
+// plaintext changes the key it is indexed by.
+func (r rotator) rotateRecord(key interface{}) (bool, error) {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	raw, err := txn.First(r.table, "id", key)
+	if err != nil || raw == nil || !r.stale(raw) {
+		return false, err
+	}
+	updated, err := r.reseal(raw)
+	if err != nil {
+		return false, err
+	}
+	if err := txn.Delete(r.table, raw); err != nil {
+		return false, err
+	}
+	if err := txn.Insert(r.table, updated); err != nil {
+		return false, err
+	}
+	txn.Commit()
+	return true, nil
+}
+
+type keyRotators []KeyRotator
+
+// KeyRotators returns a KeyRotator rotating the keys of each of rotators
+// in turn, and the total number of records rewritten.
+func KeyRotators(rotators ...KeyRotator) KeyRotator {
+	return keyRotators(rotators)
+}
+
+func (k keyRotators) RotateKeys(ctx context.Context) (int, error) {
+	total := 0
+	for _, r := range k {
+		n, err := r.RotateKeys(ctx)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"user-service/internal/encryption"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func TestEncryptedUserRepository(t *testing.T) {
+	kf, err := encryption.NewKeyFile("k1")
+	if err != nil {
+		t.Fatalf("NewKeyFile failed: %v", err)
+	}
+	keys, _ := encryption.NewLocalKeyring(*kf)
+	enc, err := NewFieldEncryptor(keys, DefaultPIIFields...)
+	if err != nil {
+		t.Fatalf("NewFieldEncryptor failed: %v", err)
+	}
+	if _, err := NewFieldEncryptor(keys, "Age"); err == nil {
+		t.Error("Expected non-string field to be rejected")
+	}
+
+	db, err := memdb.NewMemDB(Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := NewUserRepository(db, WithFieldEncryptor(enc))
+	ctx := context.Background()
+
+	user := &model.User{ID: "u1", Email: "secret@example.com", Name: "Secret Name", Age: 42}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := repo.Create(ctx, &model.User{Email: "secret@example.com"}); err == nil {
+		t.Error("Expected duplicate email to be rejected on ciphertext")
+	}
+
+	// Nothing stored in memdb contains the plaintext
+	txn := db.Txn(false)
+	raw, _ := txn.First("user", "id", keys.BlindIndex("secret@example.com"))
+	txn.Abort()
+	rec := raw.(*userRecord)
+	if rec.Email != "" || rec.Name != "" || strings.Contains(string(rec.Sealed.Ciphertext), "Secret") {
+		t.Errorf("Expected PII to be encrypted, got %+v", rec)
+	}
+	if rec.Age != 42 {
+		t.Errorf("Expected unconfigured fields to stay readable, got age %d", rec.Age)
+	}
+
+	got, err := repo.GetByEmail(ctx, "secret@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail failed: %v", err)
+	}
+	if got.Email != user.Email || got.Name != user.Name {
+		t.Errorf("Expected decrypted user, got %+v", got)
+	}
+	if got, err := repo.GetByID(ctx, "u1"); err != nil || got.Email != user.Email {
+		t.Errorf("Expected decrypted user by ID, got %+v, %v", got, err)
+	}
+
+	// Rotation re-encrypts only records sealed with an old key
+	_ = kf.AddKey("k2")
+	rotatedKeys, _ := encryption.NewLocalKeyring(*kf)
+	rotatedEnc, _ := NewFieldEncryptor(rotatedKeys, DefaultPIIFields...)
+	rotatedRepo := NewUserRepository(db, WithFieldEncryptor(rotatedEnc))
+	n, err := rotatedRepo.(KeyRotator).RotateKeys(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 record rotated, got %d, %v", n, err)
+	}
+	if n, _ := rotatedRepo.(KeyRotator).RotateKeys(ctx); n != 0 {
+		t.Errorf("Expected nothing left to rotate, got %d", n)
+	}
+	got, err = rotatedRepo.GetByEmail(ctx, "secret@example.com")
+	if err != nil || got.Name != "Secret Name" {
+		t.Errorf("Expected rotated record to decrypt, got %+v, %v", got, err)
+	}
+}
+
+func TestEncryptedEmailTables(t *testing.T) {
+	kf, err := encryption.NewKeyFile("k1")
+	if err != nil {
+		t.Fatalf("NewKeyFile failed: %v", err)
+	}
+	keys, _ := encryption.NewLocalKeyring(*kf)
+	enc, err := NewFieldEncryptor(keys, DefaultPIIFields...)
+	if err != nil {
+		t.Fatalf("NewFieldEncryptor failed: %v", err)
+	}
+	db, err := memdb.NewMemDB(Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	ctx := context.Background()
+	const email = "secret@example.com"
+
+	mfa := NewMFARepository(db, WithEmailEncryptor(enc))
+	if err := mfa.Save(ctx, &model.MFA{Email: email, RecoveryCodes: []string{"h1"}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := mfa.UseRecoveryCode(ctx, email, "h1"); err != nil {
+		t.Fatalf("UseRecoveryCode failed: %v", err)
+	}
+	if got, err := mfa.Get(ctx, email); err != nil || got.Email != email || len(got.RecoveryCodes) != 0 {
+		t.Errorf("Expected the decrypted enrollment, got %+v, %v", got, err)
+	}
+
+	tokens := NewTokenRepository(db, WithEmailEncryptor(enc))
+	if err := tokens.Create(ctx, &model.Token{Hash: "t1", Email: email, Purpose: "verify"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if got, err := tokens.ListByEmail(ctx, email); err != nil || len(got) != 1 || got[0].Email != email {
+		t.Errorf("Expected the decrypted token, got %+v, %v", got, err)
+	}
+
+	audit := NewAuditRepository(db, WithEmailEncryptor(enc))
+	if err := audit.Append(ctx, &model.AuditEvent{Action: "user.created", Email: email}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got, err := audit.ListByEmail(ctx, email); err != nil || len(got) != 1 || got[0].Email != email {
+		t.Errorf("Expected the decrypted event, got %+v, %v", got, err)
+	}
+
+	groups := NewGroupRepository(db, WithEmailEncryptor(enc))
+	if err := groups.Create(ctx, &model.Group{ID: "g1", DisplayName: "G", Members: []string{email, "other@example.com"}}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if got, err := groups.ListByMember(ctx, email); err != nil || len(got) != 1 || len(got[0].Members) != 2 {
+		t.Errorf("Expected the group by member, got %+v, %v", got, err)
+	}
+
+	// Nothing stored in memdb contains the plaintext
+	txn := db.Txn(false)
+	defer txn.Abort()
+	for _, table := range []string{"mfa", "token", "audit", "group"} {
+		it, err := txn.Get(table, "id")
+		if err != nil {
+			t.Fatalf("Get %s failed: %v", table, err)
+		}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			if s := fmt.Sprintf("%+v", obj); strings.Contains(s, "@example.com") {
+				t.Errorf("Expected %s emails to be encrypted, got %s", table, s)
+			}
+		}
+	}
+
+	if n, err := groups.RemoveMember(ctx, email); err != nil || n != 1 {
+		t.Fatalf("RemoveMember failed: %d, %v", n, err)
+	}
+	if got, _ := groups.Get(ctx, "g1"); len(got.Members) != 1 || got.Members[0] != "other@example.com" {
+		t.Errorf("Expected the member removed, got %+v", got)
+	}
+	if n, err := audit.Pseudonymize(ctx, email, "deleted-1"); err != nil || n != 1 {
+		t.Errorf("Pseudonymize failed: %d, %v", n, err)
+	}
+	if got, _ := audit.ListByEmail(ctx, "deleted-1"); len(got) != 1 {
+		t.Errorf("Expected the event under the pseudonym, got %+v", got)
+	}
+
+	// Rotation reseals every table with the current key, including records
+	// written before encryption was enabled
+	if err := NewTokenRepository(db).Create(ctx, &model.Token{Hash: "t2", Email: email, Purpose: "reset"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	_ = kf.AddKey("k2")
+	rotatedKeys, _ := encryption.NewLocalKeyring(*kf)
+	rotatedEnc, _ := NewFieldEncryptor(rotatedKeys, DefaultPIIFields...)
+	rotator := KeyRotators(
+		NewMFARepository(db, WithEmailEncryptor(rotatedEnc)).(KeyRotator),
+		NewTokenRepository(db, WithEmailEncryptor(rotatedEnc)).(KeyRotator),
+		NewAuditRepository(db, WithEmailEncryptor(rotatedEnc)).(KeyRotator),
+		NewGroupRepository(db, WithEmailEncryptor(rotatedEnc)).(KeyRotator),
+	)
+	if n, err := rotator.RotateKeys(ctx); err != nil || n != 5 {
+		t.Errorf("Expected 5 records rotated, got %d, %v", n, err)
+	}
+	if n, _ := rotator.RotateKeys(ctx); n != 0 {
+		t.Errorf("Expected nothing left to rotate, got %d", n)
+	}
+	got, err := NewTokenRepository(db, WithEmailEncryptor(rotatedEnc)).ListByEmail(ctx, email)
+	if err != nil || len(got) != 2 {
+		t.Errorf("Expected both tokens after rotation, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"user-service/internal/encryption"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("group already exists")
+)
+
+// GroupRepository stores groups. Display names are unique, ignoring case.
+type GroupRepository interface {
+	Create(ctx context.Context, group *model.Group) error
+	Get(ctx context.Context, id string) (*model.Group, error)
+	Update(ctx context.Context, group *model.Group) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]*model.Group, error)
+	// ListByMember returns the groups email belongs to.
+	ListByMember(ctx context.Context, email string) ([]*model.Group, error)
+	// ListByMembers returns the groups of each email in one transaction.
+	ListByMembers(ctx context.Context, emails []string) (map[string][]*model.Group, error)
+	// RemoveMember removes email from every group and returns how many
+	// groups changed.
+	RemoveMember(ctx context.Context, email string) (int, error)
+}
+
+type memGroupRepo struct {
+	db  *memdb.MemDB
+	enc *FieldEncryptor
+}
+
+// groupRecord is how groups are stored, indexed by the MemberKeys of their
+// members. The members are held in SealedMembers instead when encryption
+// is enabled.
+type groupRecord struct {
+	model.Group
+	MemberKeys    []string
+	SealedMembers *encryption.Envelope
+}
+
+func NewGroupRepository(db *memdb.MemDB, opts ...RepositoryOption) GroupRepository {
+	return &memGroupRepo{db: db, enc: applyRepositoryOptions(opts).enc}
+}
+
+func (r *memGroupRepo) toRecord(group *model.Group) (*groupRecord, error) {
+	rec := &groupRecord{Group: *group, MemberKeys: make([]string, len(group.Members))}
+	for i, m := range group.Members {
+		rec.MemberKeys[i] = r.enc.indexKey(m)
+	}
+	rec.Members = append([]string(nil), group.Members...)
+	if r.enc == nil {
+		return rec, nil
+	}
+	plaintext, err := json.Marshal(group.Members)
+	if err != nil {
+		return nil, err
+	}
+	// Bound to the group, so members cannot be swapped between groups.
+	if rec.SealedMembers, err = encryption.Seal(r.enc.keys, plaintext, []byte(group.ID)); err != nil {
+		return nil, err
+	}
+	rec.Members = nil
+	return rec, nil
+}
+
+// fromRecord returns a copy of the group in rec, which must not be
+// modified as it is stored in memdb.
+func (r *memGroupRepo) fromRecord(rec *groupRecord) (*model.Group, error) {
+	g := rec.Group
+	g.Members = append([]string(nil), rec.Members...)
+	if rec.SealedMembers == nil {
+		return &g, nil
+	}
+	if r.enc == nil {
+		return nil, fmt.Errorf("repository: members of group %s are encrypted but no keyring is configured", g.ID)
+	}
+	plaintext, err := encryption.Open(r.enc.keys, rec.SealedMembers, []byte(g.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(plaintext, &g.Members); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *memGroupRepo) Create(ctx context.Context, group *model.Group) error {
+	rec, err := r.toRecord(group)
+	if err != nil {
+		return err
+	}
+
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	if existing, _ := txn.First("group", "id", group.ID); existing != nil {
+		return ErrGroupAlreadyExists
+	}
+	if existing, _ := txn.First("group", "display_name", group.DisplayName); existing != nil {
+		return ErrGroupAlreadyExists
+	}
+	if err := txn.Insert("group", rec); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memGroupRepo) Get(ctx context.Context, id string) (*model.Group, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	raw, err := txn.First("group", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrGroupNotFound
+	}
+	return r.fromRecord(raw.(*groupRecord))
+}
+
+func (r *memGroupRepo) Update(ctx context.Context, group *model.Group) error {
+	rec, err := r.toRecord(group)
+	if err != nil {
+		return err
+	}
+
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("group", "id", group.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrGroupNotFound
+	}
+	if other, _ := txn.First("group", "display_name", group.DisplayName); other != nil && other.(*groupRecord).ID != group.ID {
+		return ErrGroupAlreadyExists
+	}
+	if err := txn.Insert("group", rec); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memGroupRepo) Delete(ctx context.Context, id string) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("group", "id", id)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrGroupNotFound
+	}
+	if err := txn.Delete("group", existing); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memGroupRepo) List(ctx context.Context) ([]*model.Group, error) {
+	return r.list("id")
+}
+
+func (r *memGroupRepo) ListByMember(ctx context.Context, email string) ([]*model.Group, error) {
+	return r.list("member", r.enc.indexKey(email))
+}
+
+func (r *memGroupRepo) ListByMembers(ctx context.Context, emails []string) (map[string][]*model.Group, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	groups := make(map[string][]*model.Group, len(emails))
+	for _, email := range emails {
+		it, err := txn.Get("group", "member", r.enc.indexKey(email))
+		if err != nil {
+			return nil, err
+		}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			g, err := r.fromRecord(obj.(*groupRecord))
+			if err != nil {
+				return nil, err
+			}
+			groups[email] = append(groups[email], g)
+		}
+	}
+	return groups, nil
+}
+
+func (r *memGroupRepo) list(index string, args ...interface{}) ([]*model.Group, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	it, err := txn.Get("group", index, args...)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*model.Group
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		g, err := r.fromRecord(obj.(*groupRecord))
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (r *memGroupRepo) RemoveMember(ctx context.Context, email string) (int, error) {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	it, err := txn.Get("group", "member", r.enc.indexKey(email))
+	if err != nil {
+		return 0, err
+	}
+	var groups []*model.Group
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		g, err := r.fromRecord(obj.(*groupRecord))
+		if err != nil {
+			return 0, err
+		}
+		groups = append(groups, g)
+	}
+	for _, g := range groups {
+		members := g.Members[:0]
+		for _, m := range g.Members {
+			if m != email {
+				members = append(members, m)
+			}
+		}
+		g.Members = members
+		rec, err := r.toRecord(g)
+		if err != nil {
+			return 0, err
+		}
+		if err := txn.Insert("group", rec); err != nil {
+			return 0, err
+		}
+	}
+	txn.Commit()
+	return len(groups), nil
+}
+
+func (r *memGroupRepo) RotateKeys(ctx context.Context) (int, error) {
+	return rotator{
+		db:    r.db,
+		table: "group",
+		id:    func(obj interface{}) interface{} { return obj.(*groupRecord).ID },
+		stale: func(obj interface{}) bool {
+			rec := obj.(*groupRecord)
+			if r.enc == nil {
+				return false
+			}
+			if rec.SealedMembers == nil {
+				return len(rec.Members) > 0
+			}
+			return rec.SealedMembers.KeyID != r.enc.keys.CurrentKeyID()
+		},
+		reseal: func(obj interface{}) (interface{}, error) {
+			group, err := r.fromRecord(obj.(*groupRecord))
+			if err != nil {
+				return nil, err
+			}
+			return r.toRecord(group)
+		},
+	}.rotate(ctx)
+}
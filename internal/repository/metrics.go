@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"user-service/internal/filter"
+	"user-service/internal/model"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type instrumentedUserRepo struct {
+	next     UserRepository
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewInstrumentedUserRepository wraps next, recording how long each
+// operation takes and how often it fails in reg. ErrUserNotFound is an
+// expected result and is not counted as a failure.
+func NewInstrumentedUserRepository(next UserRepository, reg prometheus.Registerer) UserRepository {
+	r := &instrumentedUserRepo{
+		next: next,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "user_repository_operation_duration_seconds",
+			Help:    "Time taken by user repository operations.",
+			Buckets: []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1},
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "user_repository_errors_total",
+			Help: "User repository operations that failed.",
+		}, []string{"operation"}),
+	}
+	reg.MustRegister(r.duration, r.errors)
+	return r
+}
+
+// observe records an operation that started at start and returned err.
+func (r *instrumentedUserRepo) observe(op string, start time.Time, err error) {
+	r.duration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.errors.WithLabelValues(op).Inc()
+	}
+}
+
+func (r *instrumentedUserRepo) Create(ctx context.Context, user *model.User) error {
+	start := time.Now()
+	err := r.next.Create(ctx, user)
+	r.observe("create", start, err)
+	return err
+}
+
+func (r *instrumentedUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	start := time.Now()
+	v, err := r.next.GetByEmail(ctx, email)
+	r.observe("get_by_email", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
+	start := time.Now()
+	v, err := r.next.GetByID(ctx, id)
+	r.observe("get_by_id", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) Update(ctx context.Context, user *model.User) error {
+	start := time.Now()
+	err := r.next.Update(ctx, user)
+	r.observe("update", start, err)
+	return err
+}
+
+func (r *instrumentedUserRepo) UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error {
+	start := time.Now()
+	err := r.next.UpdateIfVersion(ctx, user, version)
+	r.observe("update_if_version", start, err)
+	return err
+}
+
+func (r *instrumentedUserRepo) Delete(ctx context.Context, email string) error {
+	start := time.Now()
+	err := r.next.Delete(ctx, email)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r *instrumentedUserRepo) List(ctx context.Context) ([]*model.User, error) {
+	start := time.Now()
+	v, err := r.next.List(ctx)
+	r.observe("list", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) ListByState(ctx context.Context, state model.UserState) ([]*model.User, error) {
+	start := time.Now()
+	v, err := r.next.ListByState(ctx, state)
+	r.observe("list_by_state", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) Query(ctx context.Context, expr filter.Expr) ([]*model.User, error) {
+	start := time.Now()
+	v, err := r.next.Query(ctx, expr)
+	r.observe("query", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) SoftDelete(ctx context.Context, email string, at time.Time) error {
+	start := time.Now()
+	err := r.next.SoftDelete(ctx, email, at)
+	r.observe("soft_delete", start, err)
+	return err
+}
+
+func (r *instrumentedUserRepo) GetDeleted(ctx context.Context, email string) (*model.User, error) {
+	start := time.Now()
+	v, err := r.next.GetDeleted(ctx, email)
+	r.observe("get_deleted", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) Restore(ctx context.Context, email string) (*model.User, error) {
+	start := time.Now()
+	v, err := r.next.Restore(ctx, email)
+	r.observe("restore", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) ListDeletedBefore(ctx context.Context, t time.Time) ([]*model.User, error) {
+	start := time.Now()
+	v, err := r.next.ListDeletedBefore(ctx, t)
+	r.observe("list_deleted_before", start, err)
+	return v, err
+}
+
+func (r *instrumentedUserRepo) Purge(ctx context.Context, email string, deletedBy time.Time) error {
+	start := time.Now()
+	err := r.next.Purge(ctx, email, deletedBy)
+	r.observe("purge", start, err)
+	return err
+}
+
+func (r *instrumentedUserRepo) Index(ctx context.Context) (uint64, error) {
+	start := time.Now()
+	v, err := r.next.Index(ctx)
+	r.observe("index", start, err)
+	return v, err
+}
+
+// userStates are reported by the user count collector, along with
+// "deleted" for soft-deleted users.
+var userStates = []model.UserState{model.StatePending, model.StateActive, model.StateSuspended, model.StateDeactivated}
+
+type userCountCollector struct {
+	repo UserRepository
+	desc *prometheus.Desc
+}
+
+// NewUserCountCollector returns a collector reporting the number of users
+// in each lifecycle state, counted from repo when metrics are scraped.
+func NewUserCountCollector(repo UserRepository) prometheus.Collector {
+	return &userCountCollector{
+		repo: repo,
+		desc: prometheus.NewDesc("users", "Number of users by lifecycle state.", []string{"state"}, nil),
+	}
+}
+
+func (c *userCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *userCountCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	for _, state := range userStates {
+		users, err := c.repo.ListByState(ctx, state)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(c.desc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(len(users)), string(state))
+	}
+	// Every soft-deleted user was deleted before the far future.
+	deleted, err := c.repo.ListDeletedBefore(ctx, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(len(deleted)), "deleted")
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentedUserRepository(t *testing.T) {
+	db, err := memdb.NewMemDB(Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	reg := prometheus.NewRegistry()
+	base := NewUserRepository(db)
+	repo := NewInstrumentedUserRepository(base, reg)
+	ctx := context.Background()
+
+	user := &model.User{Email: "a@example.com", Name: "A", State: model.StateActive}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := repo.Create(ctx, user); err == nil {
+		t.Fatal("expected duplicate create to fail")
+	}
+	if _, err := repo.GetByEmail(ctx, "missing@example.com"); err != ErrUserNotFound {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+
+	if n := testutil.CollectAndCount(reg, "user_repository_operation_duration_seconds"); n != 2 {
+		t.Errorf("expected histograms for 2 operations, got %d", n)
+	}
+	want := `
+# HELP user_repository_errors_total User repository operations that failed.
+# TYPE user_repository_errors_total counter
+user_repository_errors_total{operation="create"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "user_repository_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserCountCollector(t *testing.T) {
+	db, err := memdb.NewMemDB(Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	_ = repo.Create(ctx, &model.User{Email: "a@example.com", State: model.StateActive})
+	_ = repo.Create(ctx, &model.User{Email: "b@example.com", State: model.StateActive})
+	_ = repo.Create(ctx, &model.User{Email: "c@example.com", State: model.StatePending})
+	_ = repo.SoftDelete(ctx, "c@example.com", time.Now())
+
+	want := `
+# HELP users Number of users by lifecycle state.
+# TYPE users gauge
+users{state="active"} 2
+users{state="deactivated"} 0
+users{state="deleted"} 1
+users{state="pending"} 0
+users{state="suspended"} 0
+`
+	if err := testutil.CollectAndCompare(NewUserCountCollector(repo), strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
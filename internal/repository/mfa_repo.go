@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/encryption"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+var (
+	ErrMFANotFound          = errors.New("mfa enrollment not found")
+	ErrMFAStepUsed          = errors.New("mfa code already used")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+type MFARepository interface {
+	Get(ctx context.Context, email string) (*model.MFA, error)
+	Save(ctx context.Context, mfa *model.MFA) error
+	Delete(ctx context.Context, email string) error
+	// UseStep atomically records step as used, failing with ErrMFAStepUsed
+	// if it is not newer than the last used step.
+	UseStep(ctx context.Context, email string, step int64) error
+	// UseRecoveryCode atomically removes the recovery code with the given
+	// hash, failing with ErrRecoveryCodeNotFound if it is not present.
+	UseRecoveryCode(ctx context.Context, email, hash string) error
+}
+
+type memMFARepo struct {
+	db  *memdb.MemDB
+	enc *FieldEncryptor
+}
+
+// mfaRecord is how enrollments are stored, keyed by EmailKey. The email
+// is held in SealedEmail instead when encryption is enabled.
+type mfaRecord struct {
+	model.MFA
+	EmailKey    string
+	SealedEmail *encryption.Envelope
+}
+
+func NewMFARepository(db *memdb.MemDB, opts ...RepositoryOption) MFARepository {
+	return &memMFARepo{db: db, enc: applyRepositoryOptions(opts).enc}
+}
+
+func (r *memMFARepo) Get(ctx context.Context, email string) (*model.MFA, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	raw, err := txn.First("mfa", "id", r.enc.indexKey(email))
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrMFANotFound
+	}
+	rec := raw.(*mfaRecord)
+	mfa := rec.MFA
+	if mfa.Email, err = r.enc.openEmail(rec.Email, rec.EmailKey, rec.SealedEmail); err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+func (r *memMFARepo) Save(ctx context.Context, mfa *model.MFA) error {
+	rec := &mfaRecord{MFA: *mfa}
+	var err error
+	if rec.Email, rec.EmailKey, rec.SealedEmail, err = r.enc.sealEmail(mfa.Email); err != nil {
+		return err
+	}
+
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	if err := txn.Insert("mfa", rec); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memMFARepo) Delete(ctx context.Context, email string) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := txn.First("mfa", "id", r.enc.indexKey(email))
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrMFANotFound
+	}
+
+	if err := txn.Delete("mfa", existing); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memMFARepo) UseStep(ctx context.Context, email string, step int64) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	raw, err := txn.First("mfa", "id", r.enc.indexKey(email))
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return ErrMFANotFound
+	}
+	existing := raw.(*mfaRecord)
+	if step <= existing.LastUsedStep {
+		return ErrMFAStepUsed
+	}
+
+	// Objects stored in memdb must not be modified in place.
+	updated := *existing
+	updated.LastUsedStep = step
+	if err := txn.Insert("mfa", &updated); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memMFARepo) UseRecoveryCode(ctx context.Context, email, hash string) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	raw, err := txn.First("mfa", "id", r.enc.indexKey(email))
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return ErrMFANotFound
+	}
+	existing := raw.(*mfaRecord)
+
+	remaining := make([]string, 0, len(existing.RecoveryCodes))
+	for _, code := range existing.RecoveryCodes {
+		if code != hash {
+			remaining = append(remaining, code)
+		}
+	}
+	if len(remaining) == len(existing.RecoveryCodes) {
+		return ErrRecoveryCodeNotFound
+	}
+
+	updated := *existing
+	updated.RecoveryCodes = remaining
+	if err := txn.Insert("mfa", &updated); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memMFARepo) RotateKeys(ctx context.Context) (int, error) {
+	return rotator{
+		db:    r.db,
+		table: "mfa",
+		id:    func(obj interface{}) interface{} { return obj.(*mfaRecord).EmailKey },
+		stale: func(obj interface{}) bool {
+			rec := obj.(*mfaRecord)
+			return r.enc.staleEmail(rec.Email, rec.SealedEmail)
+		},
+		reseal: func(obj interface{}) (interface{}, error) {
+			updated := *obj.(*mfaRecord)
+			var err error
+			updated.Email, updated.EmailKey, updated.SealedEmail, err = r.enc.resealEmail(updated.Email, updated.EmailKey, updated.SealedEmail)
+			return &updated, err
+		},
+	}.rotate(ctx)
+}
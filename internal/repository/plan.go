@@ -0,0 +1,65 @@
+package repository
+
+import "user-service/internal/filter"
+
+// plan is how Query reads the users a filter may match: from index, with
+// args. Every user read is then matched against the whole filter, so a
+// plan may read more users than match but never fewer.
+type plan struct {
+	index string
+	args  []interface{}
+	// cost ranks plans; cheaper ones read fewer users.
+	cost int
+}
+
+const (
+	costUnique = iota
+	costPrefix
+	costEqual
+	costScan
+)
+
+// scan reads every user, in the order List returns them.
+var scan = plan{index: "email", cost: costScan}
+
+// plan returns the cheapest plan for expr. Comparisons on indexed fields
+// read that index, and a conjunction reads the cheaper plan of its sides,
+// as users it matches match both. Anything else scans.
+func (r *memUserRepo) plan(expr filter.Expr) plan {
+	switch e := expr.(type) {
+	case *filter.Comparison:
+		return r.planComparison(e)
+	case *filter.Logical:
+		if e.Op != filter.And {
+			return scan
+		}
+		left, right := r.plan(e.Left), r.plan(e.Right)
+		if right.cost < left.cost {
+			return right
+		}
+		return left
+	}
+	return scan
+}
+
+func (r *memUserRepo) planComparison(c *filter.Comparison) plan {
+	value, ok := c.Value.(string)
+	// Users with no ID or state are missing from those indexes.
+	if !ok || (value == "" && c.Field != "email") {
+		return scan
+	}
+	switch {
+	case c.Field == "id" && c.Op == filter.Eq:
+		return plan{index: "user_id", args: []interface{}{value}, cost: costUnique}
+	case c.Field == "email" && c.Op == filter.Eq:
+		return plan{index: "email", args: []interface{}{r.enc.indexKey(value)}, cost: costUnique}
+	case c.Field == "id" && c.Op == filter.Sw:
+		return plan{index: "user_id_prefix", args: []interface{}{value}, cost: costPrefix}
+	// Blind indexes of encrypted emails only answer equality.
+	case c.Field == "email" && c.Op == filter.Sw && r.enc == nil:
+		return plan{index: "email_prefix", args: []interface{}{value}, cost: costPrefix}
+	case c.Field == "state" && c.Op == filter.Eq:
+		return plan{index: "state", args: []interface{}{value}, cost: costEqual}
+	}
+	return scan
+}
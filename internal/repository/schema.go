@@ -0,0 +1,166 @@
+package repository
+
+import "github.com/hashicorp/go-memdb"
+
+// Schema returns the memdb schema for every table used by the repositories.
+func Schema() *memdb.DBSchema {
+	return &memdb.DBSchema{
+		Tables: map[string]*memdb.TableSchema{
+			// The modification index of each table that keeps one, as
+			// indexEntries.
+			"index": {
+				Name: "index",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "Table"},
+					},
+				},
+			},
+			// Users are stored as userRecords, indexed by EmailKey so that
+			// lookups work whether or not emails are encrypted.
+			"user": {
+				Name: "user",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "EmailKey"},
+					},
+					"email": {
+						Name:    "email",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "EmailKey"},
+					},
+					"state": {
+						Name:         "state",
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "State"},
+					},
+					// Users created before IDs were introduced have none.
+					"user_id": {
+						Name:         "user_id",
+						Unique:       true,
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "ID"},
+					},
+				},
+			},
+			// Enrollments, tokens, audit events and groups are stored as
+			// records keyed by the index key of their emails, as users are.
+			"mfa": {
+				Name: "mfa",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "EmailKey"},
+					},
+				},
+			},
+			"token": {
+				Name: "token",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "Hash"},
+					},
+					"email": {
+						Name:    "email",
+						Indexer: &memdb.StringFieldIndex{Field: "EmailKey"},
+					},
+				},
+			},
+			"tombstone": {
+				Name: "tombstone",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "SubjectHash"},
+					},
+				},
+			},
+			"group": {
+				Name: "group",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "ID"},
+					},
+					"display_name": {
+						Name:    "display_name",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "DisplayName", Lowercase: true},
+					},
+					"member": {
+						Name:         "member",
+						AllowMissing: true,
+						Indexer:      &memdb.StringSliceFieldIndex{Field: "MemberKeys"},
+					},
+				},
+			},
+			"audit": {
+				Name: "audit",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.UintFieldIndex{Field: "ID"},
+					},
+					"email": {
+						Name:         "email",
+						AllowMissing: true,
+						Indexer:      &memdb.StringFieldIndex{Field: "EmailKey"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// indexEntry is the modification index of a table: how many transactions
+// have written to it. It only grows, so it identifies the table's state.
+type indexEntry struct {
+	Table string
+	Value uint64
+}
+
+// bumpIndex increments the modification index of table in txn, which must
+// write to it, and returns the new index.
+func bumpIndex(txn *memdb.Txn, table string) (uint64, error) {
+	index, err := tableIndex(txn, table)
+	if err != nil {
+		return 0, err
+	}
+	index++
+	if err := txn.Insert("index", &indexEntry{Table: table, Value: index}); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// tableIndex returns the modification index of table, 0 if it was never
+// written.
+func tableIndex(txn *memdb.Txn, table string) (uint64, error) {
+	raw, err := txn.First("index", "id", table)
+	if err != nil || raw == nil {
+		return 0, err
+	}
+	return raw.(*indexEntry).Value, nil
+}
+
+// Ping checks that db can serve reads from every table in the schema.
+func Ping(db *memdb.MemDB) error {
+	txn := db.Txn(false)
+	defer txn.Abort()
+	for name := range Schema().Tables {
+		if _, err := txn.First(name, "id"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/encryption"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *model.Token) error
+	// Consume atomically removes and returns the token with the given
+	// purpose and hash, so each token can only be used once.
+	Consume(ctx context.Context, purpose, hash string) (*model.Token, error)
+	// DeleteByEmail removes every token for email with the given purpose,
+	// or with any purpose if purpose is empty.
+	DeleteByEmail(ctx context.Context, email, purpose string) error
+	ListByEmail(ctx context.Context, email string) ([]*model.Token, error)
+}
+
+type memTokenRepo struct {
+	db  *memdb.MemDB
+	enc *FieldEncryptor
+}
+
+// tokenRecord is how tokens are stored, indexed by EmailKey. The email is
+// held in SealedEmail instead when encryption is enabled.
+type tokenRecord struct {
+	model.Token
+	EmailKey    string
+	SealedEmail *encryption.Envelope
+}
+
+func NewTokenRepository(db *memdb.MemDB, opts ...RepositoryOption) TokenRepository {
+	return &memTokenRepo{db: db, enc: applyRepositoryOptions(opts).enc}
+}
+
+func (r *memTokenRepo) fromRecord(rec *tokenRecord) (*model.Token, error) {
+	token := rec.Token
+	var err error
+	if token.Email, err = r.enc.openEmail(rec.Email, rec.EmailKey, rec.SealedEmail); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *memTokenRepo) Create(ctx context.Context, token *model.Token) error {
+	rec := &tokenRecord{Token: *token}
+	var err error
+	if rec.Email, rec.EmailKey, rec.SealedEmail, err = r.enc.sealEmail(token.Email); err != nil {
+		return err
+	}
+
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	if err := txn.Insert("token", rec); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memTokenRepo) Consume(ctx context.Context, purpose, hash string) (*model.Token, error) {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	raw, err := txn.First("token", "id", hash)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil || raw.(*tokenRecord).Purpose != purpose {
+		return nil, ErrTokenNotFound
+	}
+
+	if err := txn.Delete("token", raw); err != nil {
+		return nil, err
+	}
+	txn.Commit()
+	return r.fromRecord(raw.(*tokenRecord))
+}
+
+func (r *memTokenRepo) DeleteByEmail(ctx context.Context, email, purpose string) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	it, err := txn.Get("token", "email", r.enc.indexKey(email))
+	if err != nil {
+		return err
+	}
+	var matched []interface{}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if purpose == "" || obj.(*tokenRecord).Purpose == purpose {
+			matched = append(matched, obj)
+		}
+	}
+	for _, obj := range matched {
+		if err := txn.Delete("token", obj); err != nil {
+			return err
+		}
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memTokenRepo) ListByEmail(ctx context.Context, email string) ([]*model.Token, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	it, err := txn.Get("token", "email", r.enc.indexKey(email))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []*model.Token
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		token, err := r.fromRecord(obj.(*tokenRecord))
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func (r *memTokenRepo) RotateKeys(ctx context.Context) (int, error) {
+	return rotator{
+		db:    r.db,
+		table: "token",
+		id:    func(obj interface{}) interface{} { return obj.(*tokenRecord).Hash },
+		stale: func(obj interface{}) bool {
+			rec := obj.(*tokenRecord)
+			return r.enc.staleEmail(rec.Email, rec.SealedEmail)
+		},
+		reseal: func(obj interface{}) (interface{}, error) {
+			updated := *obj.(*tokenRecord)
+			var err error
+			updated.Email, updated.EmailKey, updated.SealedEmail, err = r.enc.resealEmail(updated.Email, updated.EmailKey, updated.SealedEmail)
+			return &updated, err
+		},
+	}.rotate(ctx)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/model"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+var (
+	ErrTombstoneNotFound = errors.New("tombstone not found")
+)
+
+type TombstoneRepository interface {
+	Create(ctx context.Context, tombstone *model.Tombstone) error
+	Get(ctx context.Context, subjectHash string) (*model.Tombstone, error)
+}
+
+type memTombstoneRepo struct {
+	db *memdb.MemDB
+}
+
+func NewTombstoneRepository(db *memdb.MemDB) TombstoneRepository {
+	return &memTombstoneRepo{db: db}
+}
+
+func (r *memTombstoneRepo) Create(ctx context.Context, tombstone *model.Tombstone) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	if err := txn.Insert("tombstone", tombstone); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memTombstoneRepo) Get(ctx context.Context, subjectHash string) (*model.Tombstone, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	raw, err := txn.First("tombstone", "id", subjectHash)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, ErrTombstoneNotFound
+	}
+	return raw.(*model.Tombstone), nil
+}
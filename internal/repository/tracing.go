@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"user-service/internal/filter"
+	"user-service/internal/model"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingUserRepo struct {
+	next   UserRepository
+	tracer trace.Tracer
+}
+
+// NewTracingUserRepository wraps next so every operation is recorded as a
+// span, a child of the span in the operation's context.
+func NewTracingUserRepository(next UserRepository, tp trace.TracerProvider) UserRepository {
+	return &tracingUserRepo{next: next, tracer: tp.Tracer("user-service/internal/repository")}
+}
+
+func (r *tracingUserRepo) start(ctx context.Context, op string) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, "UserRepository."+op,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("db.system", "memdb"), attribute.String("db.operation", op)))
+}
+
+// endSpan records err, if any, on span and ends it. ErrUserNotFound is an
+// expected result and does not mark the span as failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r *tracingUserRepo) Create(ctx context.Context, user *model.User) error {
+	ctx, span := r.start(ctx, "Create")
+	err := r.next.Create(ctx, user)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracingUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := r.start(ctx, "GetByEmail")
+	v, err := r.next.GetByEmail(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
+	ctx, span := r.start(ctx, "GetByID")
+	v, err := r.next.GetByID(ctx, id)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) Update(ctx context.Context, user *model.User) error {
+	ctx, span := r.start(ctx, "Update")
+	err := r.next.Update(ctx, user)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracingUserRepo) UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error {
+	ctx, span := r.start(ctx, "UpdateIfVersion")
+	err := r.next.UpdateIfVersion(ctx, user, version)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracingUserRepo) Delete(ctx context.Context, email string) error {
+	ctx, span := r.start(ctx, "Delete")
+	err := r.next.Delete(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracingUserRepo) List(ctx context.Context) ([]*model.User, error) {
+	ctx, span := r.start(ctx, "List")
+	v, err := r.next.List(ctx)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) ListByState(ctx context.Context, state model.UserState) ([]*model.User, error) {
+	ctx, span := r.start(ctx, "ListByState")
+	v, err := r.next.ListByState(ctx, state)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) Query(ctx context.Context, expr filter.Expr) ([]*model.User, error) {
+	ctx, span := r.start(ctx, "Query")
+	v, err := r.next.Query(ctx, expr)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) SoftDelete(ctx context.Context, email string, at time.Time) error {
+	ctx, span := r.start(ctx, "SoftDelete")
+	err := r.next.SoftDelete(ctx, email, at)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracingUserRepo) GetDeleted(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := r.start(ctx, "GetDeleted")
+	v, err := r.next.GetDeleted(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) Restore(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := r.start(ctx, "Restore")
+	v, err := r.next.Restore(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) ListDeletedBefore(ctx context.Context, t time.Time) ([]*model.User, error) {
+	ctx, span := r.start(ctx, "ListDeletedBefore")
+	v, err := r.next.ListDeletedBefore(ctx, t)
+	endSpan(span, err)
+	return v, err
+}
+
+func (r *tracingUserRepo) Purge(ctx context.Context, email string, deletedBy time.Time) error {
+	ctx, span := r.start(ctx, "Purge")
+	err := r.next.Purge(ctx, email, deletedBy)
+	endSpan(span, err)
+	return err
+}
+
+func (r *tracingUserRepo) Index(ctx context.Context) (uint64, error) {
+	ctx, span := r.start(ctx, "Index")
+	v, err := r.next.Index(ctx)
+	endSpan(span, err)
+	return v, err
+}
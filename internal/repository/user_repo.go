@@ -3,42 +3,107 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
+	"user-service/internal/filter"
 	"user-service/internal/model"
 
 	"github.com/hashicorp/go-memdb"
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrVersionConflict   = errors.New("user changed since it was read")
 )
 
+// UserRepository stores users. Soft-deleted users are hidden from every
+// method except those that explicitly deal with deleted users, but still
+// hold on to their email until they are hard deleted.
 type UserRepository interface {
 	Create(ctx context.Context, user *model.User) error
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// GetByID returns a live user by the ID assigned when it was created.
+	GetByID(ctx context.Context, id string) (*model.User, error)
 	Update(ctx context.Context, user *model.User) error
+	// UpdateIfVersion updates a user only if it is still at version, the
+	// Version it was read at, and returns ErrVersionConflict if it has been
+	// written since.
+	UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error
+	// Delete removes a user, deleted or not, permanently.
 	Delete(ctx context.Context, email string) error
 	List(ctx context.Context) ([]*model.User, error)
+	ListByState(ctx context.Context, state model.UserState) ([]*model.User, error)
+	// Query returns the live users expr matches, reading them through an
+	// index when expr allows it.
+	Query(ctx context.Context, expr filter.Expr) ([]*model.User, error)
+
+	// SoftDelete marks a user as deleted at the given time.
+	SoftDelete(ctx context.Context, email string, at time.Time) error
+	// GetDeleted returns a soft-deleted user.
+	GetDeleted(ctx context.Context, email string) (*model.User, error)
+	// Restore clears the deletion marker of a soft-deleted user.
+	Restore(ctx context.Context, email string) (*model.User, error)
+	// ListDeletedBefore returns users soft-deleted before t.
+	ListDeletedBefore(ctx context.Context, t time.Time) ([]*model.User, error)
+	// Purge removes a user permanently if it was soft-deleted at or before
+	// deletedBy, and returns ErrUserNotFound otherwise, so a user restored
+	// meanwhile is kept.
+	Purge(ctx context.Context, email string, deletedBy time.Time) error
+
+	// Index returns the modification index of the users: the Version of
+	// the user written last. It changes whenever any user is written,
+	// deleted ones included.
+	Index(ctx context.Context) (uint64, error)
+}
+
+// KeyRotator is implemented by repositories that encrypt data at rest.
+type KeyRotator interface {
+	// RotateKeys re-encrypts every record not sealed with the current key
+	// and returns how many were rewritten. Each record is rewritten in its
+	// own transaction so other operations are not blocked.
+	RotateKeys(ctx context.Context) (int, error)
 }
 
 type memUserRepo struct {
-	db *memdb.MemDB
+	db  *memdb.MemDB
+	enc *FieldEncryptor
 }
 
-func NewUserRepository(db *memdb.MemDB) UserRepository {
-	return &memUserRepo{db: db}
+// UserRepositoryOption configures NewUserRepository.
+type UserRepositoryOption func(*memUserRepo)
+
+// WithFieldEncryptor encrypts PII fields before they are stored.
+func WithFieldEncryptor(enc *FieldEncryptor) UserRepositoryOption {
+	return func(r *memUserRepo) { r.enc = enc }
+}
+
+func NewUserRepository(db *memdb.MemDB, opts ...UserRepositoryOption) UserRepository {
+	r := &memUserRepo{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func (r *memUserRepo) Create(ctx context.Context, user *model.User) error {
+	rec, err := r.enc.toRecord(user)
+	if err != nil {
+		return err
+	}
+
 	txn := r.db.Txn(true)
 	defer txn.Abort()
 
 	// Check if user already exists
-	existing, _ := txn.First("user", "email", user.Email)
+	existing, _ := txn.First("user", "email", rec.EmailKey)
 	if existing != nil {
-		return errors.New("user already exists")
+		return ErrUserAlreadyExists
 	}
 
-	if err := txn.Insert("user", user); err != nil {
+	if rec.Version, err = bumpIndex(txn, "user"); err != nil {
+		return err
+	}
+	if err := txn.Insert("user", rec); err != nil {
 		return err
 	}
 	txn.Commit()
@@ -49,29 +114,63 @@ func (r *memUserRepo) GetByEmail(ctx context.Context, email string) (*model.User
 	txn := r.db.Txn(false)
 	defer txn.Abort()
 
-	raw, err := txn.First("user", "email", email)
+	rec, err := r.getLive(txn, email)
+	if err != nil {
+		return nil, err
+	}
+	return r.enc.fromRecord(rec)
+}
+
+func (r *memUserRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	raw, err := txn.First("user", "user_id", id)
 	if err != nil {
 		return nil, err
 	}
-	if raw == nil {
+	if raw == nil || !isLive(raw.(*userRecord)) {
 		return nil, ErrUserNotFound
 	}
-	return raw.(*model.User), nil
+	return r.enc.fromRecord(raw.(*userRecord))
 }
 
 func (r *memUserRepo) Update(ctx context.Context, user *model.User) error {
+	return r.update(user, func(*userRecord) error { return nil })
+}
+
+func (r *memUserRepo) UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error {
+	return r.update(user, func(existing *userRecord) error {
+		if existing.Version != version {
+			return ErrVersionConflict
+		}
+		return nil
+	})
+}
+
+// update replaces the live user with user if check accepts the stored
+// record, in the same transaction.
+func (r *memUserRepo) update(user *model.User, check func(*userRecord) error) error {
+	rec, err := r.enc.toRecord(user)
+	if err != nil {
+		return err
+	}
+
 	txn := r.db.Txn(true)
 	defer txn.Abort()
 
-	existing, err := txn.First("user", "email", user.Email)
+	existing, err := r.getLive(txn, user.Email)
 	if err != nil {
 		return err
 	}
-	if existing == nil {
-		return ErrUserNotFound
+	if err := check(existing); err != nil {
+		return err
 	}
 
-	if err := txn.Insert("user", user); err != nil {
+	if rec.Version, err = bumpIndex(txn, "user"); err != nil {
+		return err
+	}
+	if err := txn.Insert("user", rec); err != nil {
 		return err
 	}
 	txn.Commit()
@@ -82,7 +181,7 @@ func (r *memUserRepo) Delete(ctx context.Context, email string) error {
 	txn := r.db.Txn(true)
 	defer txn.Abort()
 
-	existing, err := txn.First("user", "email", email)
+	existing, err := txn.First("user", "email", r.enc.indexKey(email))
 	if err != nil {
 		return err
 	}
@@ -90,6 +189,9 @@ func (r *memUserRepo) Delete(ctx context.Context, email string) error {
 		return ErrUserNotFound
 	}
 
+	if _, err := bumpIndex(txn, "user"); err != nil {
+		return err
+	}
 	if err := txn.Delete("user", existing); err != nil {
 		return err
 	}
@@ -105,10 +207,252 @@ func (r *memUserRepo) List(ctx context.Context) ([]*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
+	return r.collect(it, isLive)
+}
+
+func (r *memUserRepo) ListByState(ctx context.Context, state model.UserState) ([]*model.User, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	it, err := txn.Get("user", "state", string(state))
+	if err != nil {
+		return nil, err
+	}
+	return r.collect(it, isLive)
+}
+
+func (r *memUserRepo) Query(ctx context.Context, expr filter.Expr) ([]*model.User, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	p := r.plan(expr)
+	it, err := txn.Get("user", p.index, p.args...)
+	if err != nil {
+		return nil, err
+	}
+	// Plans only narrow down the users to read; each still has to match,
+	// decrypted.
+	users, err := r.collect(it, isLive)
+	if err != nil {
+		return nil, err
+	}
+	matched := users[:0]
+	for _, u := range users {
+		if expr.Match(u) {
+			matched = append(matched, u)
+		}
+	}
+	return matched, nil
+}
+
+func (r *memUserRepo) SoftDelete(ctx context.Context, email string, at time.Time) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := r.getLive(txn, email)
+	if err != nil {
+		return err
+	}
 
+	// DeletedAt is never encrypted, so the sealed fields can be kept.
+	deleted := *existing
+	deleted.DeletedAt = &at
+	if deleted.Version, err = bumpIndex(txn, "user"); err != nil {
+		return err
+	}
+	if err := txn.Insert("user", &deleted); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memUserRepo) GetDeleted(ctx context.Context, email string) (*model.User, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	rec, err := r.getDeleted(txn, email)
+	if err != nil {
+		return nil, err
+	}
+	return r.enc.fromRecord(rec)
+}
+
+func (r *memUserRepo) Restore(ctx context.Context, email string) (*model.User, error) {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := r.getDeleted(txn, email)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := *existing
+	restored.DeletedAt = nil
+	if restored.Version, err = bumpIndex(txn, "user"); err != nil {
+		return nil, err
+	}
+	user, err := r.enc.fromRecord(&restored)
+	if err != nil {
+		return nil, err
+	}
+	if err := txn.Insert("user", &restored); err != nil {
+		return nil, err
+	}
+	txn.Commit()
+	return user, nil
+}
+
+func (r *memUserRepo) ListDeletedBefore(ctx context.Context, t time.Time) ([]*model.User, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	it, err := txn.Get("user", "email")
+	if err != nil {
+		return nil, err
+	}
+	return r.collect(it, func(rec *userRecord) bool {
+		return rec.DeletedAt != nil && rec.DeletedAt.Before(t)
+	})
+}
+
+func (r *memUserRepo) Purge(ctx context.Context, email string, deletedBy time.Time) error {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	existing, err := r.getDeleted(txn, email)
+	if err != nil {
+		return err
+	}
+	if existing.DeletedAt.After(deletedBy) {
+		return ErrUserNotFound
+	}
+
+	if _, err := bumpIndex(txn, "user"); err != nil {
+		return err
+	}
+	if err := txn.Delete("user", existing); err != nil {
+		return err
+	}
+	txn.Commit()
+	return nil
+}
+
+func (r *memUserRepo) Index(ctx context.Context) (uint64, error) {
+	txn := r.db.Txn(false)
+	defer txn.Abort()
+
+	return tableIndex(txn, "user")
+}
+
+func (r *memUserRepo) RotateKeys(ctx context.Context) (int, error) {
+	if r.enc == nil {
+		return 0, nil
+	}
+
+	// Find stale records in a snapshot, then rewrite them one at a time.
+	txn := r.db.Txn(false)
+	it, err := txn.Get("user", "id")
+	if err != nil {
+		txn.Abort()
+		return 0, err
+	}
+	var stale []string
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if rec := obj.(*userRecord); r.enc.stale(rec) {
+			stale = append(stale, rec.EmailKey)
+		}
+	}
+	txn.Abort()
+
+	rotated := 0
+	for _, key := range stale {
+		if err := ctx.Err(); err != nil {
+			return rotated, err
+		}
+		ok, err := r.rotate(key)
+		if err != nil {
+			return rotated, err
+		}
+		if ok {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+// rotate re-encrypts the record stored under key if it is still stale.
+func (r *memUserRepo) rotate(key string) (bool, error) {
+	txn := r.db.Txn(true)
+	defer txn.Abort()
+
+	raw, err := txn.First("user", "id", key)
+	if err != nil || raw == nil {
+		return false, err
+	}
+	rec := raw.(*userRecord)
+	if !r.enc.stale(rec) {
+		return false, nil
+	}
+	user, err := r.enc.fromRecord(rec)
+	if err != nil {
+		return false, err
+	}
+	updated, err := r.enc.toRecord(user)
+	if err != nil {
+		return false, err
+	}
+	if updated.Version, err = bumpIndex(txn, "user"); err != nil {
+		return false, err
+	}
+	if err := txn.Insert("user", updated); err != nil {
+		return false, err
+	}
+	txn.Commit()
+	return true, nil
+}
+
+// getLive returns the record for email unless it is missing or
+// soft-deleted.
+func (r *memUserRepo) getLive(txn *memdb.Txn, email string) (*userRecord, error) {
+	raw, err := txn.First("user", "email", r.enc.indexKey(email))
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil || !isLive(raw.(*userRecord)) {
+		return nil, ErrUserNotFound
+	}
+	return raw.(*userRecord), nil
+}
+
+func (r *memUserRepo) getDeleted(txn *memdb.Txn, email string) (*userRecord, error) {
+	raw, err := txn.First("user", "email", r.enc.indexKey(email))
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil || isLive(raw.(*userRecord)) {
+		return nil, ErrUserNotFound
+	}
+	return raw.(*userRecord), nil
+}
+
+// collect decrypts the records from it that match keep.
+func (r *memUserRepo) collect(it memdb.ResultIterator, keep func(*userRecord) bool) ([]*model.User, error) {
 	var users []*model.User
 	for obj := it.Next(); obj != nil; obj = it.Next() {
-		users = append(users, obj.(*model.User))
+		rec := obj.(*userRecord)
+		if !keep(rec) {
+			continue
+		}
+		user, err := r.enc.fromRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
 	}
 	return users, nil
 }
+
+func isLive(rec *userRecord) bool {
+	return rec.DeletedAt == nil
+}
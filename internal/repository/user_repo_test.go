@@ -3,8 +3,14 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+	"user-service/internal/encryption"
+	"user-service/internal/filter"
 	"user-service/internal/model"
 
 	"github.com/hashicorp/go-memdb"
@@ -29,6 +35,16 @@ func TestConcurrentUserCreation(t *testing.T) {
 					},
 				},
 			},
+			"index": {
+				Name: "index",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "Table"},
+					},
+				},
+			},
 		},
 	}
 
@@ -91,3 +107,180 @@ func TestConcurrentUserCreation(t *testing.T) {
 		t.Error("User was not created")
 	}
 }
+
+func TestUserVersions(t *testing.T) {
+	db, err := memdb.NewMemDB(Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	if index, err := repo.Index(ctx); err != nil || index != 0 {
+		t.Fatalf("expected index 0 before any write, got %d %v", index, err)
+	}
+	a := &model.User{Email: "a@example.com", Name: "A"}
+	b := &model.User{Email: "b@example.com", Name: "B"}
+	for _, u := range []*model.User{a, b} {
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	storedA, _ := repo.GetByEmail(ctx, a.Email)
+	storedB, _ := repo.GetByEmail(ctx, b.Email)
+	if storedA == nil || storedB == nil || storedA.Version != 1 || storedB.Version != 2 {
+		t.Errorf("expected versions 1 and 2, got %+v and %+v", storedA, storedB)
+	}
+	if a.Version != 0 {
+		t.Errorf("expected the caller's user to be left alone, got version %d", a.Version)
+	}
+
+	a.Name = "Alice"
+	if err := repo.Update(ctx, a); err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	stored, _ := repo.GetByEmail(ctx, a.Email)
+	if stored == nil || stored.Version != 3 {
+		t.Errorf("expected version 3 after the update, got %+v", stored)
+	}
+
+	if err := repo.Delete(ctx, b.Email); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if index, _ := repo.Index(ctx); index != 4 {
+		t.Errorf("expected the delete to change the index to 4, got %d", index)
+	}
+	if stored, _ := repo.GetByEmail(ctx, a.Email); stored == nil || stored.Version != 3 {
+		t.Errorf("expected other users to keep their version, got %+v", stored)
+	}
+
+	// Conditional updates only apply to the version they were read at
+	stale := *stored
+	stale.Name = "Stale"
+	if err := repo.UpdateIfVersion(ctx, &stale, 2); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict updating a stale read, got %v", err)
+	}
+	if err := repo.UpdateIfVersion(ctx, &stale, 3); err != nil {
+		t.Fatalf("failed to update user at its version: %v", err)
+	}
+	if stored, _ := repo.GetByEmail(ctx, a.Email); stored == nil || stored.Name != "Stale" || stored.Version != 5 {
+		t.Errorf("expected the conditional update at version 5, got %+v", stored)
+	}
+	if err := repo.UpdateIfVersion(ctx, &model.User{Email: b.Email}, 2); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound for a deleted user, got %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	db, err := memdb.NewMemDB(Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	deletedAt := time.Unix(1700000000, 0)
+
+	_ = repo.Create(ctx, &model.User{Email: "live@example.com"})
+	_ = repo.Create(ctx, &model.User{Email: "gone@example.com"})
+	_ = repo.SoftDelete(ctx, "gone@example.com", deletedAt)
+
+	if err := repo.Purge(ctx, "live@example.com", deletedAt); err != ErrUserNotFound {
+		t.Errorf("expected a live user to be kept, got %v", err)
+	}
+	if err := repo.Purge(ctx, "gone@example.com", deletedAt.Add(-time.Second)); err != ErrUserNotFound {
+		t.Errorf("expected a user deleted after the cutoff to be kept, got %v", err)
+	}
+	if _, err := repo.GetDeleted(ctx, "gone@example.com"); err != nil {
+		t.Fatalf("expected the deleted user to be kept, got %v", err)
+	}
+	if err := repo.Purge(ctx, "gone@example.com", deletedAt); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if _, err := repo.GetDeleted(ctx, "gone@example.com"); err != ErrUserNotFound {
+		t.Errorf("expected the purged user to be gone, got %v", err)
+	}
+	if _, err := repo.GetByEmail(ctx, "live@example.com"); err != nil {
+		t.Errorf("expected the live user to be kept, got %v", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	kf, err := encryption.NewKeyFile("k1")
+	if err != nil {
+		t.Fatalf("NewKeyFile failed: %v", err)
+	}
+	keys, _ := encryption.NewLocalKeyring(*kf)
+	enc, err := NewFieldEncryptor(keys, DefaultPIIFields...)
+	if err != nil {
+		t.Fatalf("NewFieldEncryptor failed: %v", err)
+	}
+
+	tests := []struct {
+		filter string
+		index  string
+		want   string
+	}{
+		{`age ge 18 and name sw "Al"`, "email", "alice@example.com"},
+		{`email eq "bob@example.com"`, "email", "bob@example.com"},
+		{`state eq "active" and age lt 30`, "state", "bob@example.com"},
+		{`age gt 0 and id eq "u3"`, "user_id", "carol@example.org"},
+		{`id sw "u" and state eq "pending"`, "user_id_prefix", "carol@example.org"},
+		{`email sw "a" and state eq "active"`, "email_prefix", "alice@example.com"},
+		{`state eq "active" or name co "ar"`, "email", "alice@example.com,bob@example.com,carol@example.org"},
+		{`not state eq "active"`, "email", "carol@example.org"},
+		{`email ew ".org" and name pr`, "email", "carol@example.org"},
+	}
+	for _, encrypted := range []bool{false, true} {
+		db, err := memdb.NewMemDB(Schema())
+		if err != nil {
+			t.Fatalf("failed to create memdb: %v", err)
+		}
+		var opts []UserRepositoryOption
+		if encrypted {
+			opts = append(opts, WithFieldEncryptor(enc))
+		}
+		repo := NewUserRepository(db, opts...)
+		ctx := context.Background()
+		for _, u := range []*model.User{
+			{ID: "u1", Email: "alice@example.com", Name: "Alice", Age: 30, State: model.StateActive},
+			{ID: "u2", Email: "bob@example.com", Name: "Bob", Age: 20, State: model.StateActive},
+			{ID: "u3", Email: "carol@example.org", Name: "Carol", Age: 40, State: model.StatePending},
+			{ID: "u4", Email: "dave@example.org", Name: "Dave", Age: 50, State: model.StateActive},
+		} {
+			if err := repo.Create(ctx, u); err != nil {
+				t.Fatalf("failed to create user: %v", err)
+			}
+		}
+		if err := repo.SoftDelete(ctx, "dave@example.org", time.Now()); err != nil {
+			t.Fatalf("failed to delete user: %v", err)
+		}
+
+		for _, tt := range tests {
+			expr, err := filter.Parse(tt.filter)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.filter, err)
+			}
+			// Blind indexes have no prefixes, so the next cheapest plan is
+			// read instead.
+			index := tt.index
+			if encrypted && index == "email_prefix" {
+				index = "state"
+			}
+			if p := repo.(*memUserRepo).plan(expr); p.index != index {
+				t.Errorf("%s (encrypted %v): expected to read %s, got %s", tt.filter, encrypted, index, p.index)
+			}
+			users, err := repo.Query(ctx, expr)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.filter, err)
+			}
+			var emails []string
+			for _, u := range users {
+				emails = append(emails, u.Email)
+			}
+			sort.Strings(emails)
+			if got := strings.Join(emails, ","); got != tt.want {
+				t.Errorf("%s (encrypted %v): expected %s, got %s", tt.filter, encrypted, tt.want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package scim
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Attribute describes an attribute in a schema definition (RFC 7643
+// section 7).
+type Attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Description   string      `json:"description,omitempty"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []Attribute `json:"subAttributes,omitempty"`
+}
+
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+type ResourceType struct {
+	Schemas          []string          `json:"schemas"`
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	Endpoint         string            `json:"endpoint"`
+	Description      string            `json:"description"`
+	Schema           string            `json:"schema"`
+	SchemaExtensions []SchemaExtension `json:"schemaExtensions,omitempty"`
+	Meta             *Meta             `json:"meta,omitempty"`
+}
+
+type SchemaExtension struct {
+	Schema   string `json:"schema"`
+	Required bool   `json:"required"`
+}
+
+// attr returns a single-valued, optional, case-insensitive read-write
+// attribute, the most common kind.
+func attr(name, typ, description string) Attribute {
+	return Attribute{Name: name, Type: typ, Description: description, Mutability: "readWrite", Returned: "default", Uniqueness: "none"}
+}
+
+func readOnly(a Attribute) Attribute {
+	a.Mutability = "readOnly"
+	return a
+}
+
+func multiValued(a Attribute, subs ...Attribute) Attribute {
+	a.MultiValued = true
+	a.SubAttributes = subs
+	return a
+}
+
+var (
+	userNameAttr = Attribute{
+		Name: "userName", Type: "string", Description: "The user's email address, unique among users.",
+		Required: true, Mutability: "immutable", Returned: "always", Uniqueness: "server",
+	}
+
+	schemas = []Schema{
+		{
+			ID: UserSchema, Name: "User", Description: "User Account",
+			Attributes: []Attribute{
+				userNameAttr,
+				{
+					Name: "name", Type: "complex", Description: "The user's name.", Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+					SubAttributes: []Attribute{
+						attr("formatted", "string", "The full name."),
+						attr("givenName", "string", "The given name."),
+						attr("familyName", "string", "The family name."),
+					},
+				},
+				attr("displayName", "string", "The name displayed for the user."),
+				readOnly(multiValued(attr("emails", "complex", "The user's email address, the same as userName."),
+					attr("value", "string", "Email address."),
+					attr("type", "string", "Always work."),
+					attr("primary", "boolean", "Always true."),
+				)),
+				attr("active", "boolean", "Whether the user is active. Clearing it deactivates the user."),
+				readOnly(multiValued(attr("groups", "complex", "The groups the user belongs to."),
+					attr("value", "string", "The group's id."),
+					attr("display", "string", "The group's display name."),
+					attr("$ref", "reference", "The URI of the group."),
+				)),
+			},
+		},
+		{
+			ID: GroupSchema, Name: "Group", Description: "Group",
+			Attributes: []Attribute{
+				{
+					Name: "displayName", Type: "string", Description: "The group's name.",
+					Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server",
+				},
+				multiValued(attr("members", "complex", "The users in the group."),
+					attr("value", "string", "The member's id."),
+					readOnly(attr("display", "string", "The member's display name.")),
+					readOnly(attr("type", "string", "Always User.")),
+					readOnly(attr("$ref", "reference", "The URI of the member.")),
+				),
+			},
+		},
+		{
+			ID: UserExtensionSchema, Name: "UserServiceUser", Description: "User attributes specific to this service",
+			Attributes: []Attribute{
+				attr("age", "integer", "The user's age."),
+				readOnly(attr("state", "string", "The lifecycle state: pending, active, suspended or deactivated.")),
+			},
+		},
+	}
+
+	resourceTypes = []ResourceType{
+		{
+			ID: "User", Name: "User", Endpoint: "/Users", Description: "User Account", Schema: UserSchema,
+			SchemaExtensions: []SchemaExtension{{Schema: UserExtensionSchema}},
+		},
+		{ID: "Group", Name: "Group", Endpoint: "/Groups", Description: "Group", Schema: GroupSchema},
+	}
+)
+
+func (h *Handler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	type supported struct {
+		Supported bool `json:"supported"`
+	}
+	h.write(w, r, http.StatusOK, map[string]interface{}{
+		"schemas": []string{ServiceProviderConfigSchema},
+		"patch":   supported{true},
+		"bulk": map[string]interface{}{
+			"supported": false, "maxOperations": 0, "maxPayloadSize": 0,
+		},
+		"filter": map[string]interface{}{
+			"supported": true, "maxResults": MaxResults,
+		},
+		"changePassword": supported{false},
+		"sort":           supported{false},
+		"etag":           supported{false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Authentication with the SCIM_TOKEN bearer token.",
+			"primary":     true,
+		}},
+		"meta": &Meta{ResourceType: "ServiceProviderConfig", Location: baseURL(r) + "/ServiceProviderConfig"},
+	})
+}
+
+func (h *Handler) ListResourceTypes(w http.ResponseWriter, r *http.Request) {
+	var resources []interface{}
+	for _, rt := range resourceTypes {
+		resources = append(resources, resourceType(r, rt))
+	}
+	h.write(w, r, http.StatusOK, newListResponse(len(resources), 1, resources))
+}
+
+func (h *Handler) GetResourceType(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	for _, rt := range resourceTypes {
+		if rt.ID == id {
+			h.write(w, r, http.StatusOK, resourceType(r, rt))
+			return
+		}
+	}
+	h.writeError(w, r, "", &Error{Status: http.StatusNotFound, Detail: "resource type not found"})
+}
+
+func (h *Handler) ListSchemas(w http.ResponseWriter, r *http.Request) {
+	var resources []interface{}
+	for _, s := range schemas {
+		resources = append(resources, schema(r, s))
+	}
+	h.write(w, r, http.StatusOK, newListResponse(len(resources), 1, resources))
+}
+
+func (h *Handler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	for _, s := range schemas {
+		if s.ID == id {
+			h.write(w, r, http.StatusOK, schema(r, s))
+			return
+		}
+	}
+	h.writeError(w, r, "", &Error{Status: http.StatusNotFound, Detail: "schema not found"})
+}
+
+func resourceType(r *http.Request, rt ResourceType) *ResourceType {
+	rt.Schemas = []string{ResourceTypeSchema}
+	rt.Meta = &Meta{ResourceType: "ResourceType", Location: baseURL(r) + "/ResourceTypes/" + rt.ID}
+	return &rt
+}
+
+func schema(r *http.Request, s Schema) *Schema {
+	s.Schemas = []string{SchemaSchema}
+	s.Meta = &Meta{ResourceType: "Schema", Location: baseURL(r) + "/Schemas/" + s.ID}
+	return &s
+}
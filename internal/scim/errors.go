@@ -0,0 +1,67 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+)
+
+// SCIM error types (RFC 7644 section 3.12).
+const (
+	ScimTypeInvalidFilter = "invalidFilter"
+	ScimTypeInvalidSyntax = "invalidSyntax"
+	ScimTypeInvalidPath   = "invalidPath"
+	ScimTypeInvalidValue  = "invalidValue"
+	ScimTypeNoTarget      = "noTarget"
+	ScimTypeUniqueness    = "uniqueness"
+	ScimTypeMutability    = "mutability"
+)
+
+// Error is a SCIM error response.
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string { return e.Detail }
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{[]string{ErrorSchema}, strconv.Itoa(e.Status), e.ScimType, e.Detail})
+}
+
+// toError maps service errors to SCIM errors. It returns nil for
+// unexpected errors.
+func toError(err error) *Error {
+	var scimErr *Error
+	switch {
+	case errors.As(err, &scimErr):
+		return scimErr
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, repository.ErrUserNotFound),
+		errors.Is(err, service.ErrGroupNotFound):
+		return &Error{Status: http.StatusNotFound, Detail: err.Error()}
+	case errors.Is(err, repository.ErrUserAlreadyExists), errors.Is(err, service.ErrGroupAlreadyExists):
+		return &Error{Status: http.StatusConflict, ScimType: ScimTypeUniqueness, Detail: err.Error()}
+	case errors.Is(err, service.ErrInvalidGroup), errors.Is(err, service.ErrUnknownMember):
+		return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: err.Error()}
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrAccountInactive):
+		return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeMutability, Detail: err.Error()}
+	case errors.Is(err, service.ErrInvalidState):
+		return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: err.Error()}
+	case errors.Is(err, service.ErrConcurrentUpdate):
+		// The user changed while being written; the request can be retried
+		return &Error{Status: http.StatusConflict, Detail: err.Error()}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return &Error{Status: http.StatusServiceUnavailable, Detail: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"user-service/internal/filter"
+)
+
+// Filter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2),
+// in the syntax of package filter. Filters are evaluated against
+// resources decoded into generic JSON values. Attribute names and string
+// comparisons ignore case.
+type Filter interface {
+	Match(resource map[string]interface{}) bool
+}
+
+type (
+	logicalFilter struct {
+		op          string // "and" or "or"
+		left, right Filter
+	}
+	notFilter struct {
+		filter Filter
+	}
+	// compareFilter compares an attribute with a value; op "pr" tests that
+	// the attribute is present and value is unused.
+	compareFilter struct {
+		path  attrPath
+		op    string
+		value interface{}
+	}
+	// valuePathFilter matches resources with an element of a multi-valued
+	// attribute that matches filter, as in emails[type eq "work"].
+	valuePathFilter struct {
+		path   attrPath
+		filter Filter
+	}
+)
+
+// attrPath names an attribute, optionally qualified by a schema URN and
+// followed by a sub-attribute, as in name.formatted.
+type attrPath struct {
+	schema string
+	attr   string
+	sub    string
+}
+
+func (p attrPath) String() string {
+	s := p.attr
+	if p.schema != "" {
+		s = p.schema + ":" + s
+	}
+	if p.sub != "" {
+		s += "." + p.sub
+	}
+	return s
+}
+
+// filters is the SCIM filter language: the shared filter syntax, with
+// attribute paths bound to the attributes of resources decoded into
+// generic JSON values.
+var filters = filter.Language[Filter]{Binder: binder{}, GroupedNot: true}
+
+// ParseFilter parses a SCIM filter expression. Errors are *filter.Error.
+func ParseFilter(s string) (Filter, error) {
+	return filters.Parse(s)
+}
+
+type binder struct{}
+
+func (binder) Compare(attr, op, value filter.Token) (Filter, error) {
+	path, err := bindAttrPath(attr)
+	if err != nil {
+		return nil, err
+	}
+	if op.Op() == filter.Present {
+		return &compareFilter{path: path, op: string(filter.Present)}, nil
+	}
+	v, err := parseValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return &compareFilter{path: path, op: string(op.Op()), value: v}, nil
+}
+
+func (binder) ValuePath(attr filter.Token, x Filter) (Filter, error) {
+	path, err := bindAttrPath(attr)
+	if err != nil {
+		return nil, err
+	}
+	return &valuePathFilter{path: path, filter: x}, nil
+}
+
+func (binder) Logical(op filter.Op, left, right Filter) Filter {
+	return &logicalFilter{op: string(op), left: left, right: right}
+}
+
+func (binder) Negate(x Filter) Filter {
+	return &notFilter{filter: x}
+}
+
+// parseValue returns the value of the literal t: a string, a number as a
+// float64, a boolean or nil.
+func parseValue(t filter.Token) (interface{}, error) {
+	switch t.Kind {
+	case filter.TokenString:
+		return t.Text, nil
+	case filter.TokenNumber:
+		n, err := strconv.ParseFloat(t.Text, 64)
+		if err != nil {
+			return nil, filter.Errorf(t, "invalid number")
+		}
+		return n, nil
+	case filter.TokenWord:
+		switch strings.ToLower(t.Text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, filter.Errorf(t, "expected a string, number, true, false or null")
+}
+
+// bindAttrPath parses the attribute path of the filter token t.
+func bindAttrPath(t filter.Token) (attrPath, error) {
+	path, err := parseAttrPath(t.Text)
+	if err != nil {
+		return attrPath{}, filter.Errorf(t, "invalid attribute path")
+	}
+	return path, nil
+}
+
+// parseAttrPath splits an attribute path into its schema, attribute and
+// sub-attribute. Paths qualified by a core schema are reduced to the bare
+// attribute, as core attributes are stored at the top level.
+func parseAttrPath(s string) (attrPath, error) {
+	var path attrPath
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		i := strings.LastIndexByte(s, ':')
+		path.schema, s = s[:i], s[i+1:]
+		if strings.EqualFold(path.schema, UserSchema) || strings.EqualFold(path.schema, GroupSchema) {
+			path.schema = ""
+		}
+	}
+	path.attr = s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		path.attr, path.sub = s[:i], s[i+1:]
+	}
+	if path.attr == "" || strings.ContainsAny(path.sub, ".:") {
+		return attrPath{}, fmt.Errorf("invalid attribute path %q", s)
+	}
+	return path, nil
+}
+
+func (f *logicalFilter) Match(res map[string]interface{}) bool {
+	if f.op == "and" {
+		return f.left.Match(res) && f.right.Match(res)
+	}
+	return f.left.Match(res) || f.right.Match(res)
+}
+
+func (f *notFilter) Match(res map[string]interface{}) bool {
+	return !f.filter.Match(res)
+}
+
+func (f *valuePathFilter) Match(res map[string]interface{}) bool {
+	for _, v := range asSlice(lookup(res, f.path)) {
+		if elem, ok := v.(map[string]interface{}); ok && f.filter.Match(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *compareFilter) Match(res map[string]interface{}) bool {
+	if f.op == "pr" && f.path.sub == "" {
+		return present(lookup(res, f.path))
+	}
+	values := values(res, f.path)
+	if f.op == "ne" {
+		// ne matches when no value equals, including when there is none.
+		for _, v := range values {
+			if compare(v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if (f.op == "pr" && present(v)) || compare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the values at path. Elements of multi-valued attributes
+// are compared by their "value" sub-attribute unless path names another.
+func values(res map[string]interface{}, path attrPath) []interface{} {
+	var out []interface{}
+	for _, v := range asSlice(lookup(res, path)) {
+		if elem, ok := v.(map[string]interface{}); ok {
+			sub := path.sub
+			if sub == "" {
+				sub = "value"
+			}
+			_, v = get(elem, sub)
+		} else if path.sub != "" {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// lookup returns the value of the attribute at path, ignoring any
+// sub-attribute, or nil.
+func lookup(res map[string]interface{}, path attrPath) interface{} {
+	obj := container(res, path, false)
+	if obj == nil {
+		return nil
+	}
+	_, v := get(obj, path.attr)
+	return v
+}
+
+// get returns the key and value of the attribute named name, ignoring case.
+func get(obj map[string]interface{}, name string) (string, interface{}) {
+	if v, ok := obj[name]; ok {
+		return name, v
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return k, v
+		}
+	}
+	return "", nil
+}
+
+func asSlice(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+	return []interface{}{v}
+}
+
+func present(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func compare(attr interface{}, op string, value interface{}) bool {
+	switch a := attr.(type) {
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return false
+		}
+		a, v = strings.ToLower(a), strings.ToLower(v)
+		switch op {
+		case "eq":
+			return a == v
+		case "co":
+			return strings.Contains(a, v)
+		case "sw":
+			return strings.HasPrefix(a, v)
+		case "ew":
+			return strings.HasSuffix(a, v)
+		case "gt":
+			return a > v
+		case "ge":
+			return a >= v
+		case "lt":
+			return a < v
+		case "le":
+			return a <= v
+		}
+	case float64:
+		v, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == v
+		case "gt":
+			return a > v
+		case "ge":
+			return a >= v
+		case "lt":
+			return a < v
+		case "le":
+			return a <= v
+		}
+	case bool:
+		v, ok := value.(bool)
+		return ok && op == "eq" && a == v
+	case nil:
+		return op == "eq" && value == nil
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	var user map[string]interface{}
+	_ = json.Unmarshal([]byte(`{
+		"userName": "Alice@Example.com",
+		"name": {"formatted": "Alice Smith"},
+		"active": true,
+		"emails": [{"value": "alice@example.com", "type": "work", "primary": true}],
+		"meta": {"lastModified": "2024-01-02T00:00:00Z"},
+		"urn:user-service:params:scim:schemas:extension:2.0:User": {"age": 30}
+	}`), &user)
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "alice@example.com"`, true},
+		{`USERNAME Eq "alice@example.com"`, true},
+		{`userName eq "bob@example.com"`, false},
+		{`userName ne "bob@example.com"`, true},
+		{`title ne "x"`, true},
+		{`name.formatted co "smith"`, true},
+		{`name.formatted sw "Alice"`, true},
+		{`userName ew "@example.com"`, true},
+		{`title pr`, false},
+		{`name pr`, true},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`emails eq "alice@example.com"`, true},
+		{`emails.type eq "home"`, false},
+		{`emails[type eq "work" and primary eq true]`, true},
+		{`emails[type eq "home"]`, false},
+		{`meta.lastModified gt "2024-01-01T00:00:00Z"`, true},
+		{`urn:user-service:params:scim:schemas:extension:2.0:User:age ge 30`, true},
+		{`urn:user-service:params:scim:schemas:extension:2.0:User:age lt 30`, false},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "alice"`, true},
+		{`userName eq "bob@example.com" or active eq true`, true},
+		{`userName eq "bob@example.com" or active eq true and title pr`, false},
+		{`(userName eq "bob@example.com" or active eq true) and name pr`, true},
+		{`not (userName eq "bob@example.com")`, true},
+		{`not (active eq true)`, false},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) failed: %v", tt.filter, err)
+			continue
+		}
+		if got := f.Match(user); got != tt.want {
+			t.Errorf("%q matched %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName xx "a"`,
+		`userName eq "a`,
+		`userName eq "a" and`,
+		`(userName eq "a"`,
+		`emails[type eq "work"`,
+		`not userName eq "a"`,
+		`userName eq "a" extra`,
+		`userName eq bogus`,
+	} {
+		if _, err := ParseFilter(filter); err == nil {
+			t.Errorf("ParseFilter(%q) succeeded, want error", filter)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"user-service/internal/model"
+	"user-service/internal/service"
+	"user-service/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// Prefix is the path the SCIM API is served under.
+	Prefix = "/scim/v2"
+	// ContentType is the media type of SCIM requests and responses.
+	ContentType = "application/scim+json"
+	// MaxResults caps the page size of list responses.
+	MaxResults = 200
+)
+
+// Handler serves the SCIM Users, Groups and discovery endpoints.
+type Handler struct {
+	users  service.UserService
+	groups service.GroupService
+	logger *zap.Logger
+}
+
+func NewHandler(users service.UserService, groups service.GroupService, logger *zap.Logger) *Handler {
+	return &Handler{users: users, groups: groups, logger: logger}
+}
+
+// Register adds the SCIM routes to r, which should serve Prefix.
+func (h *Handler) Register(r *mux.Router) {
+	r.HandleFunc("/Users", h.ListUsers).Methods("GET")
+	r.HandleFunc("/Users", h.CreateUser).Methods("POST")
+	r.HandleFunc("/Users/{id}", h.GetUser).Methods("GET")
+	r.HandleFunc("/Users/{id}", h.ReplaceUser).Methods("PUT")
+	r.HandleFunc("/Users/{id}", h.PatchUser).Methods("PATCH")
+	r.HandleFunc("/Users/{id}", h.DeleteUser).Methods("DELETE")
+	r.HandleFunc("/Groups", h.ListGroups).Methods("GET")
+	r.HandleFunc("/Groups", h.CreateGroup).Methods("POST")
+	r.HandleFunc("/Groups/{id}", h.GetGroup).Methods("GET")
+	r.HandleFunc("/Groups/{id}", h.ReplaceGroup).Methods("PUT")
+	r.HandleFunc("/Groups/{id}", h.PatchGroup).Methods("PATCH")
+	r.HandleFunc("/Groups/{id}", h.DeleteGroup).Methods("DELETE")
+	r.HandleFunc("/ServiceProviderConfig", h.ServiceProviderConfig).Methods("GET")
+	r.HandleFunc("/ResourceTypes", h.ListResourceTypes).Methods("GET")
+	r.HandleFunc("/ResourceTypes/{id}", h.GetResourceType).Methods("GET")
+	r.HandleFunc("/Schemas", h.ListSchemas).Methods("GET")
+	r.HandleFunc("/Schemas/{id}", h.GetSchema).Methods("GET")
+}
+
+// log returns the request's logger, falling back to the handler's.
+func (h *Handler) log(r *http.Request) *zap.Logger {
+	return logger.FromContext(r.Context(), h.logger)
+}
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, startIndex, count, err := listParams(r)
+	if err != nil {
+		h.writeError(w, r, "", err)
+		return
+	}
+	users, err := h.users.ListUsers(r.Context(), model.UserFilter{})
+	if err != nil {
+		h.writeError(w, r, "Failed to list users", err)
+		return
+	}
+	var matched []interface{}
+	for _, u := range users {
+		res, err := h.userResource(r, u)
+		if err != nil {
+			h.writeError(w, r, "Failed to list users", err)
+			return
+		}
+		if filter == nil || filter.Match(toMap(res)) {
+			matched = append(matched, res)
+		}
+	}
+	h.write(w, r, http.StatusOK, page(matched, startIndex, count))
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var res User
+	if !h.decode(w, r, &res) {
+		return
+	}
+	if res.UserName == "" {
+		h.writeError(w, r, "", &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: "userName is required"})
+		return
+	}
+	user := res.toUser("")
+	if err := h.users.CreateUser(r.Context(), user); err != nil {
+		h.writeError(w, r, "Failed to create user", err)
+		return
+	}
+	if res.Active != nil && *res.Active {
+		if _, err := h.users.TransitionUser(r.Context(), user.Email, model.StateActive, stateReason); err != nil {
+			h.writeError(w, r, "Failed to activate user", err)
+			return
+		}
+	}
+	h.respondUser(w, r, http.StatusCreated, user.Email)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.users.GetUserByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, r, "Failed to get user", err)
+		return
+	}
+	h.respondUser(w, r, http.StatusOK, user.Email)
+}
+
+func (h *Handler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	current, err := h.users.GetUserByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, r, "Failed to get user", err)
+		return
+	}
+	var res User
+	if !h.decode(w, r, &res) {
+		return
+	}
+	h.replaceUser(w, r, current, &res)
+}
+
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	current, err := h.users.GetUserByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, r, "Failed to get user", err)
+		return
+	}
+	var req PatchRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	res, err := h.userResource(r, current)
+	if err != nil {
+		h.writeError(w, r, "Failed to get user", err)
+		return
+	}
+	patched := toMap(res)
+	if err := applyPatch(patched, req.Operations); err != nil {
+		h.writeError(w, r, "", err)
+		return
+	}
+	var updated User
+	if err := fromMap(patched, &updated); err != nil {
+		h.writeError(w, r, "", &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: err.Error()})
+		return
+	}
+	h.replaceUser(w, r, current, &updated)
+}
+
+// stateReason is recorded for lifecycle transitions made through SCIM.
+const stateReason = "SCIM provisioning"
+
+// replaceUser updates current to match res. Setting active activates the
+// user, and clearing it deactivates an active user.
+func (h *Handler) replaceUser(w http.ResponseWriter, r *http.Request, current *model.User, res *User) {
+	if res.UserName != "" && !strings.EqualFold(res.UserName, current.Email) {
+		h.writeError(w, r, "", &Error{Status: http.StatusBadRequest, ScimType: ScimTypeMutability, Detail: "userName cannot be changed"})
+		return
+	}
+	user := res.toUser(current.Name)
+	user.Email = current.Email
+	if err := h.users.UpdateUser(r.Context(), user); err != nil {
+		h.writeError(w, r, "Failed to update user", err)
+		return
+	}
+	if res.Active != nil {
+		var to model.UserState
+		switch {
+		case *res.Active && current.State != model.StateActive:
+			to = model.StateActive
+		case !*res.Active && current.State == model.StateActive:
+			to = model.StateDeactivated
+		}
+		if to != "" {
+			if _, err := h.users.TransitionUser(r.Context(), user.Email, to, stateReason); err != nil {
+				h.writeError(w, r, "Failed to change user state", err)
+				return
+			}
+		}
+	}
+	h.respondUser(w, r, http.StatusOK, user.Email)
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.users.GetUserByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, r, "Failed to delete user", err)
+		return
+	}
+	if err := h.users.DeleteUser(r.Context(), user.Email); err != nil {
+		h.writeError(w, r, "Failed to delete user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) respondUser(w http.ResponseWriter, r *http.Request, status int, email string) {
+	user, err := h.users.GetUser(r.Context(), email)
+	if err != nil {
+		h.writeError(w, r, "Failed to get user", err)
+		return
+	}
+	res, err := h.userResource(r, user)
+	if err != nil {
+		h.writeError(w, r, "Failed to get user", err)
+		return
+	}
+	w.Header().Set("Location", res.Meta.Location)
+	h.write(w, r, status, res)
+}
+
+func (h *Handler) userResource(r *http.Request, user *model.User) (*User, error) {
+	groups, err := h.groups.ListUserGroups(r.Context(), user.Email)
+	if err != nil {
+		return nil, err
+	}
+	return fromUser(user, groups, baseURL(r)), nil
+}
+
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	filter, startIndex, count, err := listParams(r)
+	if err != nil {
+		h.writeError(w, r, "", err)
+		return
+	}
+	groups, err := h.groups.ListGroups(r.Context())
+	if err != nil {
+		h.writeError(w, r, "Failed to list groups", err)
+		return
+	}
+	var matched []interface{}
+	for _, g := range groups {
+		res := h.groupResource(r, g)
+		if filter == nil || filter.Match(toMap(res)) {
+			matched = append(matched, res)
+		}
+	}
+	h.write(w, r, http.StatusOK, page(matched, startIndex, count))
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var res Group
+	if !h.decode(w, r, &res) {
+		return
+	}
+	group := res.toGroup(h.emailOf(r))
+	if err := h.groups.CreateGroup(r.Context(), group); err != nil {
+		h.writeError(w, r, "Failed to create group", err)
+		return
+	}
+	h.respondGroup(w, r, http.StatusCreated, group)
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.groups.GetGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, r, "Failed to get group", err)
+		return
+	}
+	h.respondGroup(w, r, http.StatusOK, group)
+}
+
+func (h *Handler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var res Group
+	if !h.decode(w, r, &res) {
+		return
+	}
+	group := res.toGroup(h.emailOf(r))
+	group.ID = mux.Vars(r)["id"]
+	if err := h.groups.UpdateGroup(r.Context(), group); err != nil {
+		h.writeError(w, r, "Failed to update group", err)
+		return
+	}
+	h.respondGroup(w, r, http.StatusOK, group)
+}
+
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	current, err := h.groups.GetGroup(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, r, "Failed to get group", err)
+		return
+	}
+	var req PatchRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	patched := toMap(h.groupResource(r, current))
+	if err := applyPatch(patched, req.Operations); err != nil {
+		h.writeError(w, r, "", err)
+		return
+	}
+	var res Group
+	if err := fromMap(patched, &res); err != nil {
+		h.writeError(w, r, "", &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: err.Error()})
+		return
+	}
+	group := res.toGroup(h.emailOf(r))
+	group.ID = current.ID
+	if err := h.groups.UpdateGroup(r.Context(), group); err != nil {
+		h.writeError(w, r, "Failed to update group", err)
+		return
+	}
+	h.respondGroup(w, r, http.StatusOK, group)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.groups.DeleteGroup(r.Context(), mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, r, "Failed to delete group", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) respondGroup(w http.ResponseWriter, r *http.Request, status int, group *model.Group) {
+	res := h.groupResource(r, group)
+	w.Header().Set("Location", res.Meta.Location)
+	h.write(w, r, status, res)
+}
+
+// groupResource maps group onto a SCIM Group, referencing members that
+// can still be looked up by id.
+func (h *Handler) groupResource(r *http.Request, group *model.Group) *Group {
+	members := make(map[string]*model.User, len(group.Members))
+	for _, email := range group.Members {
+		if user, err := h.users.GetUser(r.Context(), email); err == nil {
+			members[email] = user
+		}
+	}
+	return fromGroup(group, members, baseURL(r))
+}
+
+// emailOf returns a func looking up the emails of group members by id.
+func (h *Handler) emailOf(r *http.Request) func(id string) (string, bool) {
+	return func(id string) (string, bool) {
+		user, err := h.users.GetUserByID(r.Context(), id)
+		if err != nil {
+			return "", false
+		}
+		return user.Email, true
+	}
+}
+
+// listParams parses the filter, startIndex and count query parameters.
+func listParams(r *http.Request) (filter Filter, startIndex, count int, err error) {
+	q := r.URL.Query()
+	if s := q.Get("filter"); s != "" {
+		if filter, err = ParseFilter(s); err != nil {
+			return nil, 0, 0, &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidFilter, Detail: err.Error()}
+		}
+	}
+	startIndex, count = 1, MaxResults
+	if s := q.Get("startIndex"); s != "" {
+		if startIndex, err = strconv.Atoi(s); err != nil {
+			return nil, 0, 0, &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: "startIndex must be an integer"}
+		}
+	}
+	if s := q.Get("count"); s != "" {
+		if count, err = strconv.Atoi(s); err != nil {
+			return nil, 0, 0, &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: "count must be an integer"}
+		}
+	}
+	// Out of range values are clamped rather than rejected (RFC 7644
+	// section 3.4.2.4).
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > MaxResults {
+		count = MaxResults
+	}
+	return filter, startIndex, count, nil
+}
+
+// page returns the count resources starting at the 1-based startIndex.
+func page(resources []interface{}, startIndex, count int) *ListResponse {
+	total := len(resources)
+	start := startIndex - 1
+	if start > total {
+		start = total
+	}
+	end := start + count
+	if end > total {
+		end = total
+	}
+	return newListResponse(total, startIndex, resources[start:end])
+}
+
+// baseURL returns the absolute URL of the SCIM API, for resource
+// locations.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + Prefix
+}
+
+// decode reads a JSON request body into v, writing an error response if it
+// is malformed.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		h.writeError(w, r, "", &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidSyntax, Detail: "Invalid request payload"})
+		return false
+	}
+	return true
+}
+
+func (h *Handler) write(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log(r).Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// writeError writes err as a SCIM error. Unexpected errors are logged with
+// msg and answered with 500 Internal Server Error.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	scimErr := toError(err)
+	if scimErr == nil {
+		h.log(r).Error(msg, zap.Error(err))
+		scimErr = &Error{Status: http.StatusInternalServerError, Detail: "Internal server error"}
+	}
+	h.write(w, r, scimErr.Status, scimErr)
+}
+
+// toMap returns v decoded into generic JSON values, for filtering and
+// patching.
+func toMap(v interface{}) map[string]interface{} {
+	b, _ := json.Marshal(v)
+	var m map[string]interface{}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+func fromMap(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
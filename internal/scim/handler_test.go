@@ -0,0 +1,278 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func setupSCIMRouter(t *testing.T) http.Handler {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	userRepo := repository.NewUserRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	users := service.NewUserService(userRepo, service.WithGroupRepository(groupRepo))
+	groups := service.NewGroupService(groupRepo, userRepo)
+	r := mux.NewRouter()
+	NewHandler(users, groups, zaptest.NewLogger(t)).Register(r.PathPrefix(Prefix).Subrouter())
+	return r
+}
+
+// do sends a request and decodes the JSON response into a generic map.
+func do(t *testing.T, h http.Handler, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, Prefix+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", ContentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var res map[string]interface{}
+	if w.Body.Len() > 0 {
+		if ct := w.Header().Get("Content-Type"); ct != ContentType {
+			t.Errorf("%s %s: expected Content-Type %s, got %q", method, path, ContentType, ct)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s %s: invalid JSON response: %v", method, path, err)
+		}
+	}
+	return w.Code, res
+}
+
+func TestSCIMUsers(t *testing.T) {
+	h := setupSCIMRouter(t)
+
+	code, res := do(t, h, "POST", "/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "alice@example.com",
+		"name": {"givenName": "Alice", "familyName": "Smith"},
+		"active": true
+	}`)
+	if code != http.StatusCreated {
+		t.Fatalf("expected status 201 Created, got %d: %v", code, res)
+	}
+	alice, _ := res["id"].(string)
+	if alice == "" || res["userName"] != "alice@example.com" || res["displayName"] != "Alice Smith" || res["active"] != true {
+		t.Errorf("unexpected created user %v", res)
+	}
+	if loc := res["meta"].(map[string]interface{})["location"]; loc != "http://example.com/scim/v2/Users/"+alice {
+		t.Errorf("unexpected location %v", loc)
+	}
+	if code, _ = do(t, h, "GET", "/Users/alice@example.com", ""); code != http.StatusNotFound {
+		t.Errorf("expected users not to be found by email, got %d", code)
+	}
+
+	code, res = do(t, h, "POST", "/Users", `{"userName": "alice@example.com"}`)
+	if code != http.StatusConflict || res["scimType"] != ScimTypeUniqueness || res["status"] != "409" {
+		t.Errorf("expected 409 uniqueness error for duplicate userName, got %d: %v", code, res)
+	}
+	if code, _ = do(t, h, "POST", "/Users", `{"name": {"formatted": "X"}}`); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 Bad Request without userName, got %d", code)
+	}
+	_, res = do(t, h, "POST", "/Users", `{"userName": "bob@example.com", "displayName": "Bob"}`)
+	bob, _ := res["id"].(string)
+	meta := res["meta"].(map[string]interface{})
+	created := meta["created"]
+	if created == nil || meta["lastModified"] != created {
+		t.Errorf("expected a new user to be last modified when created, got %v", meta)
+	}
+
+	code, res = do(t, h, "PATCH", "/Users/"+alice, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "replace", "path": "active", "value": false},
+			{"op": "replace", "path": "displayName", "value": "Alice Jones"},
+			{"op": "add", "path": "urn:user-service:params:scim:schemas:extension:2.0:User:age", "value": 41}
+		]
+	}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d: %v", code, res)
+	}
+	ext := res[UserExtensionSchema].(map[string]interface{})
+	if res["active"] != false || res["displayName"] != "Alice Jones" || ext["age"] != 41.0 || ext["state"] != "deactivated" {
+		t.Errorf("unexpected patched user %v", res)
+	}
+
+	code, res = do(t, h, "PUT", "/Users/"+bob, `{"userName": "carol@example.com"}`)
+	if code != http.StatusBadRequest || res["scimType"] != ScimTypeMutability {
+		t.Errorf("expected 400 mutability error renaming a user, got %d: %v", code, res)
+	}
+	code, res = do(t, h, "PUT", "/Users/"+bob, `{"userName": "bob@example.com", "name": {"formatted": "Robert"}, "active": true}`)
+	if code != http.StatusOK || res["displayName"] != "Robert" || res["active"] != true {
+		t.Errorf("unexpected replaced user %d: %v", code, res)
+	}
+	if meta := res["meta"].(map[string]interface{}); meta["created"] != created || meta["lastModified"] == created {
+		t.Errorf("expected replacing a user to change only lastModified, got %v", meta)
+	}
+
+	code, res = do(t, h, "GET", `/Users?filter=`+url.QueryEscape(`userName eq "BOB@example.com" or displayName sw "alice"`), "")
+	if code != http.StatusOK || res["totalResults"] != 2.0 {
+		t.Errorf("expected 2 users matching the filter, got %d: %v", code, res)
+	}
+	code, res = do(t, h, "GET", `/Users?filter=`+url.QueryEscape(`active eq true`)+"&startIndex=1&count=5", "")
+	if code != http.StatusOK || res["totalResults"] != 1.0 || res["Resources"].([]interface{})[0].(map[string]interface{})["id"] != bob {
+		t.Errorf("expected only bob to be active, got %d: %v", code, res)
+	}
+	code, res = do(t, h, "GET", "/Users?filter="+url.QueryEscape(`userName xx "a"`), "")
+	if code != http.StatusBadRequest || res["scimType"] != ScimTypeInvalidFilter {
+		t.Errorf("expected 400 invalidFilter, got %d: %v", code, res)
+	}
+
+	if code, _ = do(t, h, "DELETE", "/Users/"+bob, ""); code != http.StatusNoContent {
+		t.Errorf("expected status 204 No Content, got %d", code)
+	}
+	if code, res = do(t, h, "GET", "/Users/"+bob, ""); code != http.StatusNotFound || res["status"] != "404" {
+		t.Errorf("expected 404 for deleted user, got %d: %v", code, res)
+	}
+}
+
+func TestSCIMPaging(t *testing.T) {
+	h := setupSCIMRouter(t)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		do(t, h, "POST", "/Users", `{"userName": "`+name+`@example.com"}`)
+	}
+
+	tests := []struct {
+		query      string
+		startIndex float64
+		names      []string
+	}{
+		{"", 1, []string{"a", "b", "c", "d", "e"}},
+		{"?startIndex=2&count=2", 2, []string{"b", "c"}},
+		{"?startIndex=4&count=10", 4, []string{"d", "e"}},
+		{"?startIndex=9", 9, nil},
+		{"?startIndex=0&count=1", 1, []string{"a"}},
+		{"?count=0", 1, nil},
+	}
+	for _, tt := range tests {
+		_, res := do(t, h, "GET", "/Users"+tt.query, "")
+		resources := res["Resources"].([]interface{})
+		var names []string
+		for _, r := range resources {
+			names = append(names, strings.TrimSuffix(r.(map[string]interface{})["userName"].(string), "@example.com"))
+		}
+		if res["totalResults"] != 5.0 || res["startIndex"] != tt.startIndex || res["itemsPerPage"] != float64(len(names)) || strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("%q: got %v", tt.query, res)
+		}
+	}
+	if code, _ := do(t, h, "GET", "/Users?count=many", ""); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 Bad Request for a non-numeric count, got %d", code)
+	}
+}
+
+func TestSCIMGroups(t *testing.T) {
+	h := setupSCIMRouter(t)
+	_, res := do(t, h, "POST", "/Users", `{"userName": "a@example.com", "displayName": "A"}`)
+	a, _ := res["id"].(string)
+	_, res = do(t, h, "POST", "/Users", `{"userName": "b@example.com", "displayName": "B"}`)
+	b, _ := res["id"].(string)
+
+	code, res := do(t, h, "POST", "/Groups", `{"displayName": "Admins", "members": [{"value": "`+a+`"}]}`)
+	if code != http.StatusCreated {
+		t.Fatalf("expected status 201 Created, got %d: %v", code, res)
+	}
+	id := res["id"].(string)
+	members := res["members"].([]interface{})
+	if len(members) != 1 || members[0].(map[string]interface{})["display"] != "A" || members[0].(map[string]interface{})["$ref"] != "http://example.com/scim/v2/Users/"+a {
+		t.Errorf("unexpected members %v", members)
+	}
+	if code, res = do(t, h, "POST", "/Groups", `{"displayName": "Ops", "members": [{"value": "nobody@example.com"}]}`); code != http.StatusBadRequest || res["scimType"] != ScimTypeInvalidValue {
+		t.Errorf("expected 400 invalidValue for an unknown member, got %d: %v", code, res)
+	}
+	if code, _ = do(t, h, "POST", "/Groups", `{"displayName": "admins"}`); code != http.StatusConflict {
+		t.Errorf("expected status 409 Conflict for a duplicate display name, got %d", code)
+	}
+
+	code, res = do(t, h, "PATCH", "/Groups/"+id, `{"Operations": [
+		{"op": "add", "path": "members", "value": [{"value": "`+b+`"}]},
+		{"op": "remove", "path": "members[value eq \"`+a+`\"]"}
+	]}`)
+	members, _ = res["members"].([]interface{})
+	if code != http.StatusOK || len(members) != 1 || members[0].(map[string]interface{})["value"] != b {
+		t.Errorf("expected only b after patch, got %d: %v", code, res)
+	}
+
+	_, res = do(t, h, "GET", "/Users/"+b, "")
+	groups, _ := res["groups"].([]interface{})
+	if len(groups) != 1 || groups[0].(map[string]interface{})["display"] != "Admins" {
+		t.Errorf("expected b to list its group, got %v", res["groups"])
+	}
+	_, res = do(t, h, "GET", "/Groups?filter="+url.QueryEscape(`members[value eq "`+b+`"]`), "")
+	if res["totalResults"] != 1.0 {
+		t.Errorf("expected 1 group with member b, got %v", res)
+	}
+
+	code, res = do(t, h, "PUT", "/Groups/"+id, `{"displayName": "Owners"}`)
+	if code != http.StatusOK || res["displayName"] != "Owners" || res["members"] != nil {
+		t.Errorf("unexpected replaced group %d: %v", code, res)
+	}
+	if code, _ = do(t, h, "DELETE", "/Groups/"+id, ""); code != http.StatusNoContent {
+		t.Errorf("expected status 204 No Content, got %d", code)
+	}
+	if code, _ = do(t, h, "GET", "/Groups/"+id, ""); code != http.StatusNotFound {
+		t.Errorf("expected status 404 Not Found, got %d", code)
+	}
+}
+
+func TestSCIMDiscovery(t *testing.T) {
+	h := setupSCIMRouter(t)
+
+	code, res := do(t, h, "GET", "/ServiceProviderConfig", "")
+	if code != http.StatusOK || res["patch"].(map[string]interface{})["supported"] != true {
+		t.Errorf("unexpected ServiceProviderConfig %d: %v", code, res)
+	}
+	_, res = do(t, h, "GET", "/ResourceTypes", "")
+	if res["totalResults"] != 2.0 {
+		t.Errorf("expected 2 resource types, got %v", res)
+	}
+	code, res = do(t, h, "GET", "/ResourceTypes/User", "")
+	if code != http.StatusOK || res["endpoint"] != "/Users" {
+		t.Errorf("unexpected User resource type %d: %v", code, res)
+	}
+	_, res = do(t, h, "GET", "/Schemas", "")
+	if res["totalResults"] != 3.0 {
+		t.Errorf("expected 3 schemas, got %v", res)
+	}
+	code, res = do(t, h, "GET", "/Schemas/"+GroupSchema, "")
+	if code != http.StatusOK || res["name"] != "Group" {
+		t.Errorf("unexpected Group schema %d: %v", code, res)
+	}
+	if code, _ = do(t, h, "GET", "/Schemas/urn:unknown", ""); code != http.StatusNotFound {
+		t.Errorf("expected status 404 Not Found for an unknown schema, got %d", code)
+	}
+}
+
+func TestToError(t *testing.T) {
+	tests := []struct {
+		err      error
+		status   int
+		scimType string
+	}{
+		{service.ErrConcurrentUpdate, http.StatusConflict, ""},
+		{fmt.Errorf("%w: active to pending", service.ErrInvalidTransition), http.StatusBadRequest, ScimTypeMutability},
+		{service.ErrAccountInactive, http.StatusBadRequest, ScimTypeMutability},
+		{service.ErrInvalidState, http.StatusBadRequest, ScimTypeInvalidValue},
+		{service.ErrUserNotFound, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		got := toError(tt.err)
+		if got == nil || got.Status != tt.status || got.ScimType != tt.scimType {
+			t.Errorf("%v: expected %d %q, got %+v", tt.err, tt.status, tt.scimType, got)
+		}
+	}
+	if got := toError(errors.New("disk on fire")); got != nil {
+		t.Errorf("expected unexpected errors not to be mapped, got %+v", got)
+	}
+}
@@ -0,0 +1,120 @@
+package scim
+
+import (
+	"net/http"
+	"strconv"
+	"user-service/internal/openapi"
+)
+
+// Describe adds the routes Register serves to doc, under Prefix.
+func Describe(doc *openapi.Document) {
+	for name, v := range map[string]interface{}{
+		"SCIMMeta":            Meta{},
+		"SCIMName":            Name{},
+		"SCIMMultiValue":      MultiValue{},
+		"SCIMUserExtension":   UserExtension{},
+		"SCIMAttribute":       Attribute{},
+		"SCIMSchemaExtension": SchemaExtension{},
+		"SCIMPatchOperation":  PatchOperation{},
+	} {
+		doc.Define(name, v)
+	}
+	user := doc.Define("SCIMUser", User{})
+	group := doc.Define("SCIMGroup", Group{})
+	list := doc.Define("SCIMListResponse", ListResponse{})
+	patch := doc.Define("SCIMPatchRequest", PatchRequest{})
+	schema := doc.Define("SCIMSchema", Schema{})
+	resourceType := doc.Define("SCIMResourceType", ResourceType{})
+	scimError := doc.DefineSchema("SCIMError", &openapi.Schema{
+		Type: openapi.Types{"object"},
+		Properties: map[string]*openapi.Schema{
+			"schemas":  openapi.ArrayOf(openapi.String()),
+			"status":   {Type: openapi.Types{"string"}, Description: "The HTTP status code."},
+			"scimType": openapi.String(),
+			"detail":   openapi.String(),
+		},
+		Required: []string{"schemas", "status"},
+	})
+
+	security := doc.BearerAuth("scimToken", "The SCIM_TOKEN. SCIM routes answer 403 when it is unset.")
+	respond := func(description string, s *openapi.Schema) *openapi.Response {
+		return openapi.RespondWith(description, ContentType, s)
+	}
+	fail := func(statuses ...int) map[string]*openapi.Response {
+		responses := map[string]*openapi.Response{
+			"401": openapi.RespondWith("Missing or invalid token", openapi.Text, openapi.String()),
+			"403": openapi.RespondWith("SCIM API disabled", openapi.Text, openapi.String()),
+			"500": respond("Internal error", scimError),
+		}
+		for _, status := range statuses {
+			responses[strconv.Itoa(status)] = respond(http.StatusText(status), scimError)
+		}
+		return responses
+	}
+	add := func(method, path, id, summary string, body *openapi.RequestBody, ok string, okResponse *openapi.Response, errors map[string]*openapi.Response) *openapi.Operation {
+		errors[ok] = okResponse
+		op := &openapi.Operation{
+			OperationID: id, Summary: summary, Tags: []string{"scim"},
+			RequestBody: body, Responses: errors, Security: security,
+		}
+		doc.Add(method, Prefix+path, op)
+		return op
+	}
+	listParams := []*openapi.Parameter{
+		{Name: "filter", In: "query", Description: "A SCIM filter expression.", Schema: openapi.String(), Example: `userName eq "alice@example.com"`},
+		{Name: "startIndex", In: "query", Description: "The 1-based index of the first result.", Schema: openapi.Integer()},
+		{Name: "count", In: "query", Description: "The maximum number of results, at most " + strconv.Itoa(MaxResults) + ".", Schema: openapi.Integer()},
+	}
+
+	userBody := openapi.Body(ContentType, user, map[string]interface{}{
+		"schemas":  []string{UserSchema},
+		"userName": "bob@example.com",
+		"name":     map[string]string{"formatted": "Bob"},
+		"active":   true,
+	})
+	groupBody := openapi.Body(ContentType, group, map[string]interface{}{
+		"schemas":     []string{GroupSchema},
+		"displayName": "Engineering",
+	})
+	patchBody := openapi.Body(ContentType, patch, map[string]interface{}{
+		"schemas":    []string{PatchOpSchema},
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "active", "value": false}},
+	})
+
+	add("GET", "/Users", "scimListUsers", "List or filter users", nil,
+		"200", respond("Matching users", list), fail(http.StatusBadRequest)).Parameters = listParams
+	add("POST", "/Users", "scimCreateUser", "Provision a user", userBody,
+		"201", respond("The created user", user), fail(http.StatusBadRequest, http.StatusConflict))
+	add("GET", "/Users/{id}", "scimGetUser", "Get a user by id", nil,
+		"200", respond("The user", user), fail(http.StatusNotFound))
+	add("PUT", "/Users/{id}", "scimReplaceUser", "Replace a user", userBody,
+		"200", respond("The updated user", user), fail(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict))
+	add("PATCH", "/Users/{id}", "scimPatchUser", "Modify a user", patchBody,
+		"200", respond("The updated user", user), fail(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict))
+	add("DELETE", "/Users/{id}", "scimDeleteUser", "Deprovision a user", nil,
+		"204", openapi.Respond("User deleted"), fail(http.StatusBadRequest, http.StatusNotFound))
+
+	add("GET", "/Groups", "scimListGroups", "List or filter groups", nil,
+		"200", respond("Matching groups", list), fail(http.StatusBadRequest)).Parameters = listParams
+	add("POST", "/Groups", "scimCreateGroup", "Create a group", groupBody,
+		"201", respond("The created group", group), fail(http.StatusBadRequest, http.StatusConflict))
+	add("GET", "/Groups/{id}", "scimGetGroup", "Get a group", nil,
+		"200", respond("The group", group), fail(http.StatusNotFound))
+	add("PUT", "/Groups/{id}", "scimReplaceGroup", "Replace a group", groupBody,
+		"200", respond("The updated group", group), fail(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict))
+	add("PATCH", "/Groups/{id}", "scimPatchGroup", "Modify a group", patchBody,
+		"200", respond("The updated group", group), fail(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict))
+	add("DELETE", "/Groups/{id}", "scimDeleteGroup", "Delete a group", nil,
+		"204", openapi.Respond("Group deleted"), fail(http.StatusNotFound))
+
+	add("GET", "/ServiceProviderConfig", "scimServiceProviderConfig", "Describe the SCIM features supported", nil,
+		"200", respond("The service provider configuration", openapi.MapOf(openapi.Any())), fail())
+	add("GET", "/ResourceTypes", "scimListResourceTypes", "List resource types", nil,
+		"200", respond("The resource types", list), fail())
+	add("GET", "/ResourceTypes/{id}", "scimGetResourceType", "Get a resource type", nil,
+		"200", respond("The resource type", resourceType), fail(http.StatusNotFound))
+	add("GET", "/Schemas", "scimListSchemas", "List schemas", nil,
+		"200", respond("The schemas", list), fail())
+	add("GET", "/Schemas/{id}", "scimGetSchema", "Get a schema", nil,
+		"200", respond("The schema", schema), fail(http.StatusNotFound))
+}
@@ -0,0 +1,301 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request (RFC 7644 section 3.5.2).
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// patchPath is the target of a patch operation: an attribute, optionally
+// narrowed to the elements matching filter, and a sub-attribute.
+type patchPath struct {
+	attrPath
+	filter Filter
+}
+
+func parsePatchPath(s string) (patchPath, error) {
+	open := strings.IndexByte(s, '[')
+	if open < 0 {
+		path, err := parseAttrPath(s)
+		return patchPath{attrPath: path}, err
+	}
+	end := strings.LastIndexByte(s, ']')
+	if end < open {
+		return patchPath{}, fmt.Errorf("invalid path %q", s)
+	}
+	path, err := parseAttrPath(s[:open])
+	if err != nil || path.sub != "" {
+		return patchPath{}, fmt.Errorf("invalid path %q", s)
+	}
+	filter, err := ParseFilter(s[open+1 : end])
+	if err != nil {
+		return patchPath{}, fmt.Errorf("invalid path %q: %v", s, err)
+	}
+	if rest := s[end+1:]; rest != "" {
+		if !strings.HasPrefix(rest, ".") || strings.ContainsAny(rest[1:], ".[]") || len(rest) == 1 {
+			return patchPath{}, fmt.Errorf("invalid path %q", s)
+		}
+		path.sub = rest[1:]
+	}
+	return patchPath{attrPath: path, filter: filter}, nil
+}
+
+// applyPatch applies operations to a resource decoded into generic JSON
+// values. Attributes the resource does not allow to change are ignored
+// when the result is decoded, not here.
+func applyPatch(res map[string]interface{}, ops []PatchOperation) error {
+	for _, op := range ops {
+		if err := applyOperation(res, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyOperation(res map[string]interface{}, op PatchOperation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidSyntax, Detail: fmt.Sprintf("unknown patch operation %q", op.Op)}
+	}
+	if op.Path == "" {
+		if kind == "remove" {
+			return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeNoTarget, Detail: "remove requires a path"}
+		}
+		attrs, ok := op.Value.(map[string]interface{})
+		if !ok {
+			return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidValue, Detail: "value must be an object when path is omitted"}
+		}
+		for name, value := range attrs {
+			if ext, ok := value.(map[string]interface{}); ok && strings.HasPrefix(strings.ToLower(name), "urn:") {
+				for attr, v := range ext {
+					if err := set(res, kind, patchPath{attrPath: attrPath{schema: name, attr: attr}}, v); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			path, err := parseAttrPath(name)
+			if err != nil {
+				return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidPath, Detail: err.Error()}
+			}
+			if err := set(res, kind, patchPath{attrPath: path}, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := parsePatchPath(op.Path)
+	if err != nil {
+		return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeInvalidPath, Detail: err.Error()}
+	}
+	if kind == "remove" {
+		return remove(res, path, op.Value)
+	}
+	return set(res, kind, path, op.Value)
+}
+
+// container returns the object holding the attributes of path's schema,
+// creating an extension object if create is set.
+func container(res map[string]interface{}, path attrPath, create bool) map[string]interface{} {
+	if path.schema == "" {
+		return res
+	}
+	key, ext := get(res, path.schema)
+	if m, ok := ext.(map[string]interface{}); ok {
+		return m
+	}
+	if !create {
+		return nil
+	}
+	if key == "" {
+		key = path.schema
+	}
+	m := map[string]interface{}{}
+	res[key] = m
+	return m
+}
+
+func set(res map[string]interface{}, kind string, path patchPath, value interface{}) error {
+	obj := container(res, path.attrPath, true)
+	key, existing := get(obj, path.attr)
+	if key == "" {
+		key = path.attr
+	}
+
+	if path.filter != nil {
+		elems, _ := existing.([]interface{})
+		matched := false
+		for i, e := range elems {
+			elem, ok := e.(map[string]interface{})
+			if !ok || !path.filter.Match(elem) {
+				continue
+			}
+			matched = true
+			switch {
+			case path.sub != "":
+				subKey, _ := get(elem, path.sub)
+				if subKey == "" {
+					subKey = path.sub
+				}
+				elem[subKey] = value
+			case kind == "add":
+				merge(elem, value)
+			default:
+				elems[i] = value
+			}
+		}
+		if !matched {
+			return &Error{Status: http.StatusBadRequest, ScimType: ScimTypeNoTarget, Detail: fmt.Sprintf("no values match %s", path)}
+		}
+		return nil
+	}
+
+	if path.sub != "" {
+		switch e := existing.(type) {
+		case map[string]interface{}:
+			subKey, _ := get(e, path.sub)
+			if subKey == "" {
+				subKey = path.sub
+			}
+			e[subKey] = value
+		case []interface{}:
+			for _, elem := range e {
+				if m, ok := elem.(map[string]interface{}); ok {
+					subKey, _ := get(m, path.sub)
+					if subKey == "" {
+						subKey = path.sub
+					}
+					m[subKey] = value
+				}
+			}
+		default:
+			obj[key] = map[string]interface{}{path.sub: value}
+		}
+		return nil
+	}
+
+	switch e := existing.(type) {
+	case []interface{}:
+		if kind == "add" {
+			for _, v := range asSlice(value) {
+				if !containsValue(e, v) {
+					e = append(e, v)
+				}
+			}
+			obj[key] = e
+			return nil
+		}
+	case map[string]interface{}:
+		if _, ok := value.(map[string]interface{}); ok {
+			merge(e, value)
+			return nil
+		}
+	}
+	obj[key] = value
+	return nil
+}
+
+func remove(res map[string]interface{}, path patchPath, value interface{}) error {
+	obj := container(res, path.attrPath, false)
+	if obj == nil {
+		return nil
+	}
+	key, existing := get(obj, path.attr)
+	if key == "" {
+		return nil
+	}
+
+	if path.filter != nil {
+		elems, _ := existing.([]interface{})
+		kept := elems[:0:0]
+		for _, e := range elems {
+			elem, ok := e.(map[string]interface{})
+			if !ok || !path.filter.Match(elem) {
+				kept = append(kept, e)
+				continue
+			}
+			if path.sub != "" {
+				subKey, _ := get(elem, path.sub)
+				delete(elem, subKey)
+				kept = append(kept, elem)
+			}
+		}
+		obj[key] = kept
+		return nil
+	}
+
+	if path.sub != "" {
+		for _, elem := range asSlice(existing) {
+			if m, ok := elem.(map[string]interface{}); ok {
+				subKey, _ := get(m, path.sub)
+				delete(m, subKey)
+			}
+		}
+		return nil
+	}
+
+	// Some clients name the values to remove from a multi-valued attribute
+	// in the value rather than with a filter.
+	if elems, ok := existing.([]interface{}); ok && value != nil {
+		remove := asSlice(value)
+		kept := elems[:0:0]
+		for _, e := range elems {
+			if !containsValue(remove, e) {
+				kept = append(kept, e)
+			}
+		}
+		obj[key] = kept
+		return nil
+	}
+	delete(obj, key)
+	return nil
+}
+
+// merge copies the attributes of value into elem, if value is an object.
+func merge(elem map[string]interface{}, value interface{}) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, v := range m {
+		key, _ := get(elem, k)
+		if key == "" {
+			key = k
+		}
+		elem[key] = v
+	}
+}
+
+// containsValue reports whether elems holds v. Complex values are the same
+// when their "value" sub-attributes are.
+func containsValue(elems []interface{}, v interface{}) bool {
+	vm, complex := v.(map[string]interface{})
+	for _, e := range elems {
+		if em, ok := e.(map[string]interface{}); ok && complex {
+			_, a := get(em, "value")
+			_, b := get(vm, "value")
+			if a != nil && reflect.DeepEqual(a, b) {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string
+		want string
+	}{
+		{
+			"replace attribute",
+			`[{"op": "Replace", "path": "displayName", "value": "Ops"}]`,
+			`{"displayName": "Ops", "members": [{"value": "a"}, {"value": "b"}], "name": {"formatted": "x"}}`,
+		},
+		{
+			"add members skips duplicates",
+			`[{"op": "add", "path": "members", "value": [{"value": "b"}, {"value": "c"}]}]`,
+			`{"displayName": "Admins", "members": [{"value": "a"}, {"value": "b"}, {"value": "c"}], "name": {"formatted": "x"}}`,
+		},
+		{
+			"remove member by filter",
+			`[{"op": "remove", "path": "members[value eq \"a\"]"}]`,
+			`{"displayName": "Admins", "members": [{"value": "b"}], "name": {"formatted": "x"}}`,
+		},
+		{
+			"remove member by value",
+			`[{"op": "remove", "path": "members", "value": [{"value": "b"}]}]`,
+			`{"displayName": "Admins", "members": [{"value": "a"}], "name": {"formatted": "x"}}`,
+		},
+		{
+			"replace sub-attribute of filtered values",
+			`[{"op": "replace", "path": "members[value eq \"b\"].display", "value": "Bob"}]`,
+			`{"displayName": "Admins", "members": [{"value": "a"}, {"value": "b", "display": "Bob"}], "name": {"formatted": "x"}}`,
+		},
+		{
+			"replace sub-attribute",
+			`[{"op": "replace", "path": "name.formatted", "value": "y"}]`,
+			`{"displayName": "Admins", "members": [{"value": "a"}, {"value": "b"}], "name": {"formatted": "y"}}`,
+		},
+		{
+			"replace without path",
+			`[{"op": "replace", "value": {"displayName": "Ops", "name": {"givenName": "g"}, "urn:x:User": {"age": 3}}}]`,
+			`{"displayName": "Ops", "members": [{"value": "a"}, {"value": "b"}], "name": {"formatted": "x", "givenName": "g"}, "urn:x:User": {"age": 3}}`,
+		},
+		{
+			"add extension attribute",
+			`[{"op": "add", "path": "urn:x:User:age", "value": 5}]`,
+			`{"displayName": "Admins", "members": [{"value": "a"}, {"value": "b"}], "name": {"formatted": "x"}, "urn:x:User": {"age": 5}}`,
+		},
+		{
+			"remove attribute",
+			`[{"op": "remove", "path": "members"}]`,
+			`{"displayName": "Admins", "name": {"formatted": "x"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res, want map[string]interface{}
+			_ = json.Unmarshal([]byte(`{"displayName": "Admins", "members": [{"value": "a"}, {"value": "b"}], "name": {"formatted": "x"}}`), &res)
+			_ = json.Unmarshal([]byte(tt.want), &want)
+			var ops []PatchOperation
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatalf("invalid operations: %v", err)
+			}
+			if err := applyPatch(res, ops); err != nil {
+				t.Fatalf("applyPatch failed: %v", err)
+			}
+			if !reflect.DeepEqual(res, want) {
+				t.Errorf("got %v, want %v", res, want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	tests := []struct {
+		ops      string
+		scimType string
+	}{
+		{`[{"op": "move", "path": "displayName"}]`, ScimTypeInvalidSyntax},
+		{`[{"op": "remove"}]`, ScimTypeNoTarget},
+		{`[{"op": "replace", "value": "x"}]`, ScimTypeInvalidValue},
+		{`[{"op": "replace", "path": "members[value eq", "value": "x"}]`, ScimTypeInvalidPath},
+		{`[{"op": "replace", "path": "members[value eq \"z\"]", "value": {"value": "y"}}]`, ScimTypeNoTarget},
+	}
+	for _, tt := range tests {
+		res := map[string]interface{}{"members": []interface{}{map[string]interface{}{"value": "a"}}}
+		var ops []PatchOperation
+		_ = json.Unmarshal([]byte(tt.ops), &ops)
+		err := applyPatch(res, ops)
+		scimErr, ok := err.(*Error)
+		if !ok || scimErr.ScimType != tt.scimType {
+			t.Errorf("%s: got %v, want scimType %s", tt.ops, err, tt.scimType)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package scim serves users and groups over SCIM 2.0 (RFC 7643 and RFC
+// 7644) so identity providers can provision them.
+package scim
+
+import (
+	"strings"
+	"time"
+	"user-service/internal/model"
+)
+
+const (
+	UserSchema          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	GroupSchema         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	UserExtensionSchema = "urn:user-service:params:scim:schemas:extension:2.0:User"
+	ListResponseSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema         = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// Meta is the common "meta" attribute of resources.
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+// User is a SCIM User. id is the ID the user was created with and
+// userName is their email; neither can be changed.
+type User struct {
+	Schemas     []string       `json:"schemas"`
+	ID          string         `json:"id,omitempty"`
+	UserName    string         `json:"userName"`
+	Name        *Name          `json:"name,omitempty"`
+	DisplayName string         `json:"displayName,omitempty"`
+	Emails      []MultiValue   `json:"emails,omitempty"`
+	Active      *bool          `json:"active,omitempty"`
+	Groups      []MultiValue   `json:"groups,omitempty"`
+	Extension   *UserExtension `json:"urn:user-service:params:scim:schemas:extension:2.0:User,omitempty"`
+	Meta        *Meta          `json:"meta,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// UserExtension holds the user attributes that have no core SCIM
+// counterpart.
+type UserExtension struct {
+	Age   int             `json:"age,omitempty"`
+	State model.UserState `json:"state,omitempty"`
+}
+
+// MultiValue is an element of a multi-valued attribute such as emails,
+// groups or members.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Group is a SCIM Group. Members are users, referenced by id.
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// ListResponse is the body of list and search responses.
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+func newListResponse(total, startIndex int, resources []interface{}) *ListResponse {
+	if resources == nil {
+		resources = []interface{}{}
+	}
+	return &ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// fromUser maps a user and the groups they belong to onto a SCIM User.
+func fromUser(u *model.User, groups []*model.Group, baseURL string) *User {
+	active := u.State == model.StateActive
+	res := &User{
+		Schemas:     []string{UserSchema, UserExtensionSchema},
+		ID:          u.ID,
+		UserName:    u.Email,
+		DisplayName: u.Name,
+		Emails:      []MultiValue{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Extension:   &UserExtension{Age: u.Age, State: u.State},
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     baseURL + "/Users/" + u.ID,
+		},
+	}
+	if u.Name != "" {
+		res.Name = &Name{Formatted: u.Name}
+	}
+	for _, g := range groups {
+		res.Groups = append(res.Groups, MultiValue{Value: g.ID, Display: g.DisplayName, Ref: baseURL + "/Groups/" + g.ID})
+	}
+	return res
+}
+
+// toUser returns the model user described by a SCIM User. The name is
+// taken from displayName, name.formatted or the given and family names,
+// preferring one that differs from current so that changing any of them
+// renames the user.
+func (u *User) toUser(current string) *model.User {
+	names := []string{u.DisplayName}
+	if u.Name != nil {
+		names = append(names, u.Name.Formatted, strings.TrimSpace(u.Name.GivenName+" "+u.Name.FamilyName))
+	}
+	user := &model.User{Email: u.UserName}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if user.Name == "" {
+			user.Name = name
+		}
+		if name != current {
+			user.Name = name
+			break
+		}
+	}
+	if u.Extension != nil {
+		user.Age = u.Extension.Age
+	}
+	return user
+}
+
+// fromGroup maps a group onto a SCIM Group. members maps member emails
+// to the users they belong to; members missing from it are referenced by
+// email.
+func fromGroup(g *model.Group, members map[string]*model.User, baseURL string) *Group {
+	created, modified := g.CreatedAt, g.UpdatedAt
+	res := &Group{
+		Schemas:     []string{GroupSchema},
+		ID:          g.ID,
+		DisplayName: g.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      &created,
+			LastModified: &modified,
+			Location:     baseURL + "/Groups/" + g.ID,
+		},
+	}
+	for _, email := range g.Members {
+		member := MultiValue{Value: email, Type: "User"}
+		if u, ok := members[email]; ok {
+			member.Value, member.Display, member.Ref = u.ID, u.Name, baseURL+"/Users/"+u.ID
+		}
+		res.Members = append(res.Members, member)
+	}
+	return res
+}
+
+// toGroup returns the model group described by a SCIM Group. emailOf
+// returns the email of the user with a member's id, or false if there is
+// none, in which case the member is taken to be an email.
+func (g *Group) toGroup(emailOf func(id string) (string, bool)) *model.Group {
+	group := &model.Group{ID: g.ID, DisplayName: g.DisplayName}
+	for _, m := range g.Members {
+		email, ok := emailOf(m.Value)
+		if !ok {
+			email = m.Value
+		}
+		group.Members = append(group.Members, email)
+	}
+	return group
+}
@@ -0,0 +1,440 @@
+// Package search keeps an in-memory full-text index of users' names and
+// emails, updated as users are written, to find them by partial or
+// misspelled words.
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+	"user-service/internal/model"
+)
+
+// Indexed fields, by the names highlights are keyed by.
+const (
+	FieldName  = "name"
+	FieldEmail = "email"
+)
+
+// fields are the indexed fields and how much a match in each counts:
+// email domains are shared by many users, so names rank higher.
+var fields = []struct {
+	name   string
+	weight float64
+	value  func(*model.User) string
+}{
+	{FieldName, 1, func(u *model.User) string { return u.Name }},
+	{FieldEmail, 0.8, func(u *model.User) string { return u.Email }},
+}
+
+// How much each way a query word can match an indexed word counts. Fuzzy
+// matches are further scaled by their similarity.
+const (
+	exactWeight  = 1.0
+	prefixWeight = 0.7
+	fuzzyWeight  = 0.6
+	// minSimilarity is the Dice coefficient of their trigrams two words
+	// need to match fuzzily.
+	minSimilarity = 0.4
+	// minFuzzyLength is the length of the shortest words matched fuzzily;
+	// shorter ones share trigrams with too many words.
+	minFuzzyLength = 3
+)
+
+// Highlighted spans are marked with these tags. The rest of the value is
+// HTML escaped.
+const (
+	HighlightStart = "<em>"
+	HighlightEnd   = "</em>"
+)
+
+// Hit is a user matching a search.
+type Hit struct {
+	Email string
+	Score float64
+	// Highlights are the values of the fields that matched, with the
+	// matching parts marked.
+	Highlights map[string]string
+}
+
+// Results are a page of the hits of a search, best first.
+type Results struct {
+	// Total is how many users match, across every page.
+	Total int
+	Hits  []Hit
+}
+
+// token is a word of a field value, lowercased, and where it is in the
+// value.
+type token struct {
+	word       string
+	start, end int
+}
+
+type document struct {
+	version uint64
+	values  map[string]string
+	tokens  map[string][]token
+	// words maps each word in the document to the fields it is in.
+	words map[string][]string
+}
+
+// Index is an inverted index of users by email. It is safe for concurrent
+// use.
+type Index struct {
+	mu   sync.RWMutex
+	docs map[string]*document
+	// tombstones are the Versions at which users were removed, so writes
+	// from before the removal are not indexed after it.
+	tombstones map[string]uint64
+	// postings maps each word to the emails of the users it is in.
+	postings map[string]map[string]bool
+	// words are the words in postings, sorted for prefix matching.
+	words []string
+	// trigrams maps each trigram to the words it is in, for fuzzy
+	// matching.
+	trigrams map[string]map[string]bool
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:       make(map[string]*document),
+		tombstones: make(map[string]uint64),
+		postings:   make(map[string]map[string]bool),
+		trigrams:   make(map[string]map[string]bool),
+	}
+}
+
+// Put indexes u, replacing the user with the same email unless that one
+// has a higher Version, so concurrent writes leave the latest indexed.
+// Users removed at their Version or a higher one are not indexed.
+func (idx *Index) Put(u *model.User) {
+	doc := &document{
+		version: u.Version,
+		values:  make(map[string]string),
+		tokens:  make(map[string][]token),
+		words:   make(map[string][]string),
+	}
+	for _, f := range fields {
+		value := f.value(u)
+		doc.values[f.name] = value
+		doc.tokens[f.name] = tokenize(value)
+		for _, t := range doc.tokens[f.name] {
+			if fs := doc.words[t.word]; len(fs) == 0 || fs[len(fs)-1] != f.name {
+				doc.words[t.word] = append(fs, f.name)
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if removed, ok := idx.tombstones[u.Email]; ok {
+		if removed >= u.Version {
+			return
+		}
+		delete(idx.tombstones, u.Email)
+	}
+	if old, ok := idx.docs[u.Email]; ok {
+		if old.version > u.Version {
+			return
+		}
+		idx.remove(u.Email, old)
+	}
+	idx.docs[u.Email] = doc
+	for word := range doc.words {
+		if idx.postings[word] == nil {
+			idx.addWord(word)
+		}
+		idx.postings[word][u.Email] = true
+	}
+}
+
+// Remove drops the user with email from the index as of version, the
+// Version of its removal. Users indexed at a higher Version were written
+// since and are kept, and Put ignores ones written before.
+func (idx *Index) Remove(email string, version uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if doc, ok := idx.docs[email]; ok {
+		if doc.version > version {
+			return
+		}
+		idx.remove(email, doc)
+	}
+	if version > idx.tombstones[email] {
+		idx.tombstones[email] = version
+	}
+}
+
+// Len returns the number of users indexed.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+func (idx *Index) remove(email string, doc *document) {
+	delete(idx.docs, email)
+	for word := range doc.words {
+		delete(idx.postings[word], email)
+		if len(idx.postings[word]) == 0 {
+			idx.removeWord(word)
+		}
+	}
+}
+
+func (idx *Index) addWord(word string) {
+	idx.postings[word] = make(map[string]bool)
+	i := sort.SearchStrings(idx.words, word)
+	idx.words = append(idx.words, "")
+	copy(idx.words[i+1:], idx.words[i:])
+	idx.words[i] = word
+	for _, g := range trigrams(word) {
+		if idx.trigrams[g] == nil {
+			idx.trigrams[g] = make(map[string]bool)
+		}
+		idx.trigrams[g][word] = true
+	}
+}
+
+func (idx *Index) removeWord(word string) {
+	delete(idx.postings, word)
+	i := sort.SearchStrings(idx.words, word)
+	idx.words = append(idx.words[:i], idx.words[i+1:]...)
+	for _, g := range trigrams(word) {
+		delete(idx.trigrams[g], word)
+		if len(idx.trigrams[g]) == 0 {
+			delete(idx.trigrams, g)
+		}
+	}
+}
+
+// match is how an indexed word matches a query word. Prefix matches
+// highlight the first prefix runes of the word, others all of it.
+type match struct {
+	weight float64
+	prefix int
+}
+
+// Search returns the page of users matching every word of query, from
+// offset and at most limit of them. Words match indexed words that are
+// equal to them, start with them, or are spelled similarly. Users rank by
+// how closely and in which fields each word matches, and how rare the
+// words it matches are.
+func (idx *Index) Search(query string, limit, offset int) Results {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var queryWords []string
+	seen := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if !seen[t.word] {
+			seen[t.word] = true
+			queryWords = append(queryWords, t.word)
+		}
+	}
+	if len(queryWords) == 0 {
+		return Results{}
+	}
+
+	// Each user must match every query word; its score sums the best
+	// match of each.
+	var scores map[string]float64
+	expansions := make([]map[string]match, len(queryWords))
+	for i, q := range queryWords {
+		expansions[i] = idx.expand(q)
+		best := make(map[string]float64)
+		for word, m := range expansions[i] {
+			idf := 1 + math.Log(float64(len(idx.docs))/float64(len(idx.postings[word])))
+			for email := range idx.postings[word] {
+				if scores != nil {
+					if _, ok := scores[email]; !ok {
+						continue
+					}
+				}
+				for _, field := range idx.docs[email].words[word] {
+					if s := m.weight * fieldWeight(field) * idf; s > best[email] {
+						best[email] = s
+					}
+				}
+			}
+		}
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for email := range scores {
+			if s, ok := best[email]; ok {
+				scores[email] += s
+			} else {
+				delete(scores, email)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for email, score := range scores {
+		hits = append(hits, Hit{Email: email, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Email < hits[j].Email
+	})
+	results := Results{Total: len(hits)}
+	if offset >= len(hits) {
+		return results
+	}
+	hits = hits[offset:]
+	if limit < len(hits) {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Highlights = idx.docs[hits[i].Email].highlight(expansions)
+	}
+	results.Hits = hits
+	return results
+}
+
+// expand returns the indexed words matching the query word q.
+func (idx *Index) expand(q string) map[string]match {
+	matches := make(map[string]match)
+	if idx.postings[q] != nil {
+		matches[q] = match{weight: exactWeight}
+	}
+	prefix := utf8.RuneCountInString(q)
+	for i := sort.SearchStrings(idx.words, q); i < len(idx.words) && strings.HasPrefix(idx.words[i], q); i++ {
+		if word := idx.words[i]; word != q {
+			matches[word] = match{weight: prefixWeight, prefix: prefix}
+		}
+	}
+	if prefix < minFuzzyLength {
+		return matches
+	}
+	grams := trigrams(q)
+	shared := make(map[string]int)
+	for _, g := range grams {
+		for word := range idx.trigrams[g] {
+			shared[word]++
+		}
+	}
+	for word, n := range shared {
+		if _, ok := matches[word]; ok || utf8.RuneCountInString(word) < minFuzzyLength {
+			continue
+		}
+		similarity := 2 * float64(n) / float64(len(grams)+len(trigrams(word)))
+		if similarity >= minSimilarity {
+			matches[word] = match{weight: fuzzyWeight * similarity}
+		}
+	}
+	return matches
+}
+
+// highlight returns the values of the fields of doc with words matching
+// any of expansions, with the matching parts marked.
+func (doc *document) highlight(expansions []map[string]match) map[string]string {
+	highlights := make(map[string]string)
+	for field, tokens := range doc.tokens {
+		var spans [][2]int
+		for _, t := range tokens {
+			end := -1
+			for _, matches := range expansions {
+				m, ok := matches[t.word]
+				if !ok {
+					continue
+				}
+				e := t.end
+				if m.prefix > 0 {
+					e = advance(doc.values[field], t.start, m.prefix)
+				}
+				if e > end {
+					end = e
+				}
+			}
+			if end >= 0 {
+				spans = append(spans, [2]int{t.start, end})
+			}
+		}
+		if len(spans) == 0 {
+			continue
+		}
+		value := doc.values[field]
+		var b strings.Builder
+		last := 0
+		for _, s := range spans {
+			b.WriteString(html.EscapeString(value[last:s[0]]))
+			b.WriteString(HighlightStart)
+			b.WriteString(html.EscapeString(value[s[0]:s[1]]))
+			b.WriteString(HighlightEnd)
+			last = s[1]
+		}
+		b.WriteString(html.EscapeString(value[last:]))
+		highlights[field] = b.String()
+	}
+	return highlights
+}
+
+func fieldWeight(name string) float64 {
+	for _, f := range fields {
+		if f.name == name {
+			return f.weight
+		}
+	}
+	return 0
+}
+
+// tokenize splits s into words of letters and digits, lowercased.
+func tokenize(s string) []token {
+	var tokens []token
+	var word strings.Builder
+	start := -1
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			word.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{word: word.String(), start: start, end: i})
+			word.Reset()
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{word: word.String(), start: start, end: len(s)})
+	}
+	return tokens
+}
+
+// trigrams returns the distinct runs of three runes in word, padded so
+// that its first and last runes start and end one.
+func trigrams(word string) []string {
+	runes := []rune("$" + word + "$")
+	seen := make(map[string]bool)
+	var grams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		g := string(runes[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+// advance returns the offset in s n runes after start.
+func advance(s string, start, n int) int {
+	i := start
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,202 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func newTestIndex(users ...*model.User) *Index {
+	idx := NewIndex()
+	for _, u := range users {
+		idx.Put(u)
+	}
+	return idx
+}
+
+func emails(r Results) []string {
+	var out []string
+	for _, h := range r.Hits {
+		out = append(out, h.Email)
+	}
+	return out
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Zoë O'Neil-Smith <zoe.smith@example.com>")
+	want := []string{"zoë", "o", "neil", "smith", "zoe", "smith", "example", "com"}
+	if len(tokens) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, tokens)
+	}
+	for i, tok := range tokens {
+		if tok.word != want[i] {
+			t.Errorf("token %d: expected %q, got %q", i, want[i], tok.word)
+		}
+	}
+	if tokens[2].start != 7 || tokens[2].end != 11 {
+		t.Errorf("expected neil at [7, 11), got [%d, %d)", tokens[2].start, tokens[2].end)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex(
+		&model.User{Email: "alice.smith@example.com", Name: "Alice Smith"},
+		&model.User{Email: "alicia@example.com", Name: "Alicia Keys"},
+		&model.User{Email: "bob@corp.example", Name: "Bob Smyth"},
+		&model.User{Email: "smith@example.com", Name: "Carol"},
+	)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"alice", []string{"alice.smith@example.com", "alicia@example.com"}},
+		{"ali", []string{"alice.smith@example.com", "alicia@example.com"}},
+		{"ALICE smith", []string{"alice.smith@example.com"}},
+		{"smith", []string{"alice.smith@example.com", "smith@example.com", "bob@corp.example"}},
+		{"smyth", []string{"bob@corp.example", "alice.smith@example.com", "smith@example.com"}},
+		{"corp", []string{"bob@corp.example"}},
+		{"nobody", nil},
+		{"  ", nil},
+	} {
+		got := emails(idx.Search(tc.query, 10, 0))
+		if len(got) != len(tc.want) {
+			t.Errorf("%q: expected %v, got %v", tc.query, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%q: expected %v, got %v", tc.query, tc.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	idx := newTestIndex(&model.User{Email: "al@example.com", Name: "Al <Alice> Smyth"})
+	hits := idx.Search("ali smith", 10, 0).Hits
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %+v", hits)
+	}
+	if got, want := hits[0].Highlights[FieldName], "Al &lt;<em>Ali</em>ce&gt; <em>Smyth</em>"; got != want {
+		t.Errorf("expected name highlighted as %q, got %q", want, got)
+	}
+	if _, ok := hits[0].Highlights[FieldEmail]; ok {
+		t.Errorf("expected the email not to be highlighted, got %q", hits[0].Highlights[FieldEmail])
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	idx := NewIndex()
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		idx.Put(&model.User{Email: email, Name: "Same Name"})
+	}
+	for _, tc := range []struct {
+		limit, offset int
+		want          []string
+	}{
+		{2, 0, []string{"a@example.com", "b@example.com"}},
+		{2, 2, []string{"c@example.com"}},
+		{2, 3, nil},
+	} {
+		r := idx.Search("same", tc.limit, tc.offset)
+		if got := emails(r); r.Total != 3 || len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Errorf("limit %d offset %d: expected %v of 3, got %v of %d", tc.limit, tc.offset, tc.want, got, r.Total)
+		}
+	}
+}
+
+func TestPutReplaces(t *testing.T) {
+	idx := newTestIndex(&model.User{Email: "a@example.com", Name: "Alice", Version: 2})
+	idx.Put(&model.User{Email: "a@example.com", Name: "Alicia", Version: 1})
+	if got := emails(idx.Search("alice", 10, 0)); len(got) != 1 {
+		t.Errorf("expected an older version to be ignored, got %v", got)
+	}
+
+	idx.Put(&model.User{Email: "a@example.com", Name: "Beatrice", Version: 3})
+	if got := emails(idx.Search("alice", 10, 0)); len(got) != 0 {
+		t.Errorf("expected the old name to be unindexed, got %v", got)
+	}
+	if len(idx.postings["alice"]) != 0 || len(idx.trigrams["lic"]) != 0 {
+		t.Errorf("expected words no user has to be dropped")
+	}
+	idx.Remove("a@example.com", 4)
+	if idx.Len() != 0 || len(idx.words) != 0 || len(idx.trigrams) != 0 {
+		t.Errorf("expected an empty index, got %d users and words %v", idx.Len(), idx.words)
+	}
+}
+
+func TestRemoveTombstones(t *testing.T) {
+	idx := newTestIndex(&model.User{Email: "a@example.com", Name: "Alice", Version: 5})
+	idx.Remove("a@example.com", 4)
+	if idx.Len() != 1 {
+		t.Errorf("expected a user written after the removal to be kept")
+	}
+
+	idx.Remove("a@example.com", 6)
+	idx.Put(&model.User{Email: "a@example.com", Name: "Alice", Version: 5})
+	if idx.Len() != 0 {
+		t.Errorf("expected a write from before the removal to be ignored")
+	}
+	idx.Put(&model.User{Email: "a@example.com", Name: "Alice", Version: 7})
+	if idx.Len() != 1 || len(idx.tombstones) != 0 {
+		t.Errorf("expected a later write to be indexed and clear the tombstone, got %d users and %v", idx.Len(), idx.tombstones)
+	}
+}
+
+func TestIndexingUserRepository(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	next := repository.NewUserRepository(db)
+	ctx := context.Background()
+	if err := next.Create(ctx, &model.User{Email: "existing@example.com", Name: "Existing"}); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	idx := NewIndex()
+	repo, err := NewIndexingUserRepository(ctx, next, idx)
+	if err != nil {
+		t.Fatalf("failed to index users: %v", err)
+	}
+	if got := emails(idx.Search("existing", 10, 0)); len(got) != 1 {
+		t.Errorf("expected existing users to be indexed, got %v", got)
+	}
+
+	a := &model.User{Email: "a@example.com", Name: "Alice"}
+	if err := repo.Create(ctx, a); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	a.Name = "Alicia"
+	if err := repo.Update(ctx, a); err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	if got := emails(idx.Search("alicia", 10, 0)); len(got) != 1 {
+		t.Errorf("expected the updated name to be indexed, got %v", got)
+	}
+
+	if err := repo.SoftDelete(ctx, a.Email, time.Now()); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if got := emails(idx.Search("alicia", 10, 0)); len(got) != 0 {
+		t.Errorf("expected deleted users not to be found, got %v", got)
+	}
+	if _, err := repo.Restore(ctx, a.Email); err != nil {
+		t.Fatalf("failed to restore user: %v", err)
+	}
+	if got := emails(idx.Search("alicia", 10, 0)); len(got) != 1 {
+		t.Errorf("expected restored users to be found, got %v", got)
+	}
+	if err := repo.Delete(ctx, a.Email); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if idx.Len() != 1 {
+		t.Errorf("expected only the existing user left, got %d", idx.Len())
+	}
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+)
+
+// indexingUserRepo keeps an Index current with the live users written
+// through it. Reads are passed through.
+type indexingUserRepo struct {
+	repository.UserRepository
+	idx *Index
+}
+
+// NewIndexingUserRepository wraps next, indexing users in idx as they are
+// created, updated and restored, and removing them as they are deleted.
+// Users already in next are indexed first.
+func NewIndexingUserRepository(ctx context.Context, next repository.UserRepository, idx *Index) (repository.UserRepository, error) {
+	users, err := next.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		idx.Put(u)
+	}
+	return &indexingUserRepo{UserRepository: next, idx: idx}, nil
+}
+
+func (r *indexingUserRepo) Create(ctx context.Context, user *model.User) error {
+	if err := r.UserRepository.Create(ctx, user); err != nil {
+		return err
+	}
+	return r.reindex(ctx, user.Email)
+}
+
+func (r *indexingUserRepo) Update(ctx context.Context, user *model.User) error {
+	if err := r.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	return r.reindex(ctx, user.Email)
+}
+
+func (r *indexingUserRepo) UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error {
+	if err := r.UserRepository.UpdateIfVersion(ctx, user, version); err != nil {
+		return err
+	}
+	return r.reindex(ctx, user.Email)
+}
+
+// reindex indexes the user with email as stored, with the Version the
+// write gave it. A user deleted since is left to the delete to remove.
+func (r *indexingUserRepo) reindex(ctx context.Context, email string) error {
+	stored, err := r.UserRepository.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.idx.Put(stored)
+	return nil
+}
+
+// Delete removes the user from the index as of the modification index
+// after the delete, which is at least the Version the delete was written
+// at, so writes from before it cannot be indexed again.
+func (r *indexingUserRepo) Delete(ctx context.Context, email string) error {
+	if err := r.UserRepository.Delete(ctx, email); err != nil {
+		return err
+	}
+	version, err := r.UserRepository.Index(ctx)
+	if err != nil {
+		return err
+	}
+	r.idx.Remove(email, version)
+	return nil
+}
+
+// SoftDelete removes the user from the index as of the Version of the
+// deleted user. A user restored since is left to the restore to index.
+func (r *indexingUserRepo) SoftDelete(ctx context.Context, email string, at time.Time) error {
+	if err := r.UserRepository.SoftDelete(ctx, email, at); err != nil {
+		return err
+	}
+	deleted, err := r.UserRepository.GetDeleted(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.idx.Remove(email, deleted.Version)
+	return nil
+}
+
+func (r *indexingUserRepo) Restore(ctx context.Context, email string) (*model.User, error) {
+	user, err := r.UserRepository.Restore(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	r.idx.Put(user)
+	return user, nil
+}
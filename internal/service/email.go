@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/pkg/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrEmailUnavailable = errors.New("email flows are not configured")
+	ErrInvalidToken     = errors.New("invalid or expired token")
+	ErrWeakPassword     = errors.New("password must be at least 8 characters")
+)
+
+const (
+	verificationTokenTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+	minPasswordLength    = 8
+)
+
+// WithMailer enables the email verification and password reset flows,
+// which also require WithTokenRepository.
+func WithMailer(m mailer.Mailer) Option {
+	return func(s *userService) { s.mailer = m }
+}
+
+// WithTokenRepository stores email verification and password reset tokens.
+func WithTokenRepository(repo repository.TokenRepository) Option {
+	return func(s *userService) { s.tokenRepo = repo }
+}
+
+// WithLinkBaseURL sets the URL that links in emails point to, e.g. the
+// frontend that submits tokens back to this service.
+func WithLinkBaseURL(base string) Option {
+	return func(s *userService) { s.linkBaseURL = base }
+}
+
+// RequestEmailVerification sends a verification link in the background,
+// as RequestPasswordReset does, so it cannot be used to discover accounts
+// either.
+func (s *userService) RequestEmailVerification(ctx context.Context, email string) error {
+	if s.mailer == nil || s.tokenRepo == nil {
+		return ErrEmailUnavailable
+	}
+	s.sendLater(ctx, email, model.TokenEmailVerification, verificationTokenTTL,
+		mailer.TemplateVerifyEmail, "/verify-email")
+	return nil
+}
+
+func (s *userService) VerifyEmail(ctx context.Context, token string) error {
+	t, err := s.consumeToken(ctx, model.TokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+	// Verifying and activating a pending user is a single write, so a
+	// user suspended or deactivated meanwhile is left as it is
+	return s.retryConflicts(func() error {
+		user, err := s.repo.GetByEmail(ctx, t.Email)
+		if err != nil {
+			return ErrInvalidToken
+		}
+		verified := *user
+		now := s.now()
+		verified.VerifiedAt = &now
+		verified.UpdatedAt = &now
+		if verified.State != model.StatePending {
+			return s.repo.UpdateIfVersion(ctx, &verified, user.Version)
+		}
+		_, err = s.transition(ctx, &verified, model.StateActive, "email verified")
+		return err
+	})
+}
+
+// Drainer is implemented by services that finish work in the background.
+type Drainer interface {
+	// Drain waits for the background work to finish, or for ctx to be
+	// done.
+	Drain(ctx context.Context) error
+}
+
+// RequestPasswordReset sends a reset link if email belongs to a user. The
+// user is looked up and emailed in the background, so the call takes as
+// long and succeeds the same whether or not the account exists, and it
+// cannot be used to discover accounts. Failures are only logged.
+func (s *userService) RequestPasswordReset(ctx context.Context, email string) error {
+	if s.mailer == nil || s.tokenRepo == nil {
+		return ErrEmailUnavailable
+	}
+	s.sendLater(ctx, email, model.TokenPasswordReset, passwordResetTTL,
+		mailer.TemplatePasswordReset, "/reset-password")
+	return nil
+}
+
+// sendLater sends a token for purpose to email in the background, if it
+// belongs to a user who can authenticate. Failures are only logged.
+func (s *userService) sendLater(ctx context.Context, email, purpose string, ttl time.Duration, tmpl, path string) {
+	log := s.log(ctx)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		// The request is over by the time the email is sent.
+		ctx := logger.NewContext(context.Background(), log)
+		user, err := s.repo.GetByEmail(ctx, email)
+		if err != nil || !canAuthenticate(user.State) {
+			return
+		}
+		if err := s.sendToken(ctx, user, purpose, ttl, tmpl, path); err != nil {
+			log.Error("Failed to send email", zap.String("purpose", purpose), zap.Error(err))
+		}
+	}()
+}
+
+// Drain waits for the emails being sent in the background.
+func (s *userService) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *userService) ResetPassword(ctx context.Context, token, password string) error {
+	if len(password) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	t, err := s.consumeToken(ctx, model.TokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	// The state is checked again on every attempt, so a user suspended or
+	// deactivated during the reset keeps both their state and password
+	err = s.retryConflicts(func() error {
+		user, err := s.repo.GetByEmail(ctx, t.Email)
+		if err != nil {
+			return ErrInvalidToken
+		}
+		if !canAuthenticate(user.State) {
+			return ErrAccountInactive
+		}
+		updated := *user
+		now := s.now()
+		updated.PasswordHash = string(hash)
+		updated.UpdatedAt = &now
+		return s.repo.UpdateIfVersion(ctx, &updated, user.Version)
+	})
+	if err != nil {
+		return err
+	}
+	// Any other outstanding reset links are no longer needed.
+	return s.tokenRepo.DeleteByEmail(ctx, t.Email, model.TokenPasswordReset)
+}
+
+// sendToken replaces any outstanding tokens of purpose for user with a new
+// one and emails it as a link to path.
+func (s *userService) sendToken(ctx context.Context, user *model.User, purpose string, ttl time.Duration, tmpl, path string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := s.tokenRepo.DeleteByEmail(ctx, user.Email, purpose); err != nil {
+		return err
+	}
+	now := s.now()
+	if err := s.tokenRepo.Create(ctx, &model.Token{
+		Hash:      hashToken(token),
+		Email:     user.Email,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}); err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render(tmpl, user.Email, mailer.TemplateData{
+		Name:    user.Name,
+		Link:    s.linkBaseURL + path + "?token=" + url.QueryEscape(token),
+		Expires: ttl.String(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+	s.log(ctx).Debug("Sent token email", zap.String("purpose", purpose), zap.String("email", user.Email))
+	return nil
+}
+
+func (s *userService) consumeToken(ctx context.Context, purpose, token string) (*model.Token, error) {
+	if s.tokenRepo == nil {
+		return nil, ErrEmailUnavailable
+	}
+	t, err := s.tokenRepo.Consume(ctx, purpose, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if !s.now().Before(t.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return t, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var linkPattern = regexp.MustCompile(`https://app\.example\.com\S+`)
+
+// tokenFromMessage extracts the token from the link in msg.
+func tokenFromMessage(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+	link := linkPattern.FindString(msg.Body)
+	u, err := url.Parse(link)
+	if err != nil || u.Query().Get("token") == "" {
+		t.Fatalf("no token link in message body: %q", msg.Body)
+	}
+	return u.Query().Get("token")
+}
+
+func setupEmailService(t *testing.T, now *time.Time) (UserService, *mailer.Outbox) {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	outbox := mailer.NewOutbox()
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithTokenRepository(repository.NewTokenRepository(db)),
+		WithMailer(outbox),
+		WithLinkBaseURL("https://app.example.com"),
+		WithClock(func() time.Time { return *now }),
+	)
+	if err := svc.CreateUser(context.Background(), &model.User{Email: "mail@example.com", Name: "Mail", Age: 30}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return svc, outbox
+}
+
+func TestEmailVerification(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, outbox := setupEmailService(t, &now)
+	ctx := context.Background()
+	email := "mail@example.com"
+
+	// Unknown emails succeed without sending anything
+	if err := svc.RequestEmailVerification(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("Expected no error for unknown email, got %v", err)
+	}
+	if err := svc.RequestEmailVerification(ctx, email); err != nil {
+		t.Fatalf("RequestEmailVerification failed: %v", err)
+	}
+	_ = svc.(Drainer).Drain(ctx)
+	msgs := outbox.Messages()
+	if len(msgs) != 1 || msgs[0].To != email {
+		t.Fatalf("Expected one message to %s, got %+v", email, msgs)
+	}
+	token := tokenFromMessage(t, msgs[0])
+
+	if err := svc.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	user, _ := svc.GetUser(ctx, email)
+	if user.VerifiedAt == nil || !user.VerifiedAt.Equal(now) {
+		t.Errorf("Expected verified_at %v, got %v", now, user.VerifiedAt)
+	}
+	if err := svc.VerifyEmail(ctx, token); err != ErrInvalidToken {
+		t.Errorf("Expected reused token to be rejected, got %v", err)
+	}
+
+	// Profile updates cannot clear or forge verification
+	if err := svc.UpdateUser(ctx, &model.User{Email: email, Name: "Renamed", Age: 31}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	user, _ = svc.GetUser(ctx, email)
+	if user.VerifiedAt == nil {
+		t.Error("Expected UpdateUser to keep verified_at")
+	}
+}
+
+func TestVerificationTokenExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, outbox := setupEmailService(t, &now)
+	ctx := context.Background()
+
+	_ = svc.RequestEmailVerification(ctx, "mail@example.com")
+	_ = svc.(Drainer).Drain(ctx)
+	first := tokenFromMessage(t, outbox.Messages()[0])
+	_ = svc.RequestEmailVerification(ctx, "mail@example.com")
+	_ = svc.(Drainer).Drain(ctx)
+	second := tokenFromMessage(t, outbox.Messages()[1])
+
+	// Requesting a new link invalidates the previous one
+	if err := svc.VerifyEmail(ctx, first); err != ErrInvalidToken {
+		t.Errorf("Expected superseded token to be rejected, got %v", err)
+	}
+	now = now.Add(verificationTokenTTL)
+	if err := svc.VerifyEmail(ctx, second); err != ErrInvalidToken {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, outbox := setupEmailService(t, &now)
+	ctx := context.Background()
+
+	// Unknown emails succeed without sending anything
+	if err := svc.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("Expected no error for unknown email, got %v", err)
+	}
+	_ = svc.(Drainer).Drain(ctx)
+	if len(outbox.Messages()) != 0 {
+		t.Errorf("Expected no message for unknown email")
+	}
+
+	if err := svc.RequestPasswordReset(ctx, "mail@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset failed: %v", err)
+	}
+	_ = svc.(Drainer).Drain(ctx)
+	token := tokenFromMessage(t, outbox.Messages()[0])
+
+	if err := svc.ResetPassword(ctx, token, "short"); err != ErrWeakPassword {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if err := svc.ResetPassword(ctx, token, "correct horse battery"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	user, _ := svc.GetUser(ctx, "mail@example.com")
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("correct horse battery")) != nil {
+		t.Error("Expected password hash to match new password")
+	}
+	if err := svc.ResetPassword(ctx, token, "another password"); err != ErrInvalidToken {
+		t.Errorf("Expected reused token to be rejected, got %v", err)
+	}
+}
+
+// failingMailer fails every send.
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	return errors.New("smtp: connection refused")
+}
+
+func TestPasswordResetMailerFailure(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithTokenRepository(repository.NewTokenRepository(db)),
+		WithMailer(failingMailer{}),
+		WithLinkBaseURL("https://app.example.com"),
+	)
+	ctx := context.Background()
+	if err := svc.CreateUser(ctx, &model.User{Email: "mail@example.com", Name: "Mail", Age: 30}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	// Existing accounts are indistinguishable even when sending fails
+	if err := svc.RequestPasswordReset(ctx, "mail@example.com"); err != nil {
+		t.Errorf("Expected mailer failures to be hidden, got %v", err)
+	}
+	if err := svc.(Drainer).Drain(ctx); err != nil {
+		t.Errorf("Drain failed: %v", err)
+	}
+}
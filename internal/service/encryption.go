@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+)
+
+var ErrEncryptionUnavailable = errors.New("encryption at rest is not configured")
+
+// WithKeyRotator enables RotateEncryptionKeys.
+func WithKeyRotator(rotator repository.KeyRotator) Option {
+	return func(s *userService) { s.keyRotator = rotator }
+}
+
+func (s *userService) RotateEncryptionKeys(ctx context.Context) (int, error) {
+	if s.keyRotator == nil {
+		return 0, ErrEncryptionUnavailable
+	}
+	n, err := s.keyRotator.RotateKeys(ctx)
+	if auditErr := s.audit(ctx, &model.AuditEvent{
+		Action: model.AuditKeysRotated,
+		Detail: fmt.Sprintf("%d records re-encrypted", n),
+	}); err == nil {
+		err = auditErr
+	}
+	return n, err
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("a group with this display name already exists")
+	ErrInvalidGroup       = errors.New("group display name is required")
+	ErrUnknownMember      = errors.New("group member is not an existing user")
+)
+
+// GroupService manages groups of users.
+type GroupService interface {
+	// CreateGroup assigns the group an ID and stores it.
+	CreateGroup(ctx context.Context, group *model.Group) error
+	GetGroup(ctx context.Context, id string) (*model.Group, error)
+	// UpdateGroup replaces the display name and members of a group.
+	UpdateGroup(ctx context.Context, group *model.Group) error
+	DeleteGroup(ctx context.Context, id string) error
+	ListGroups(ctx context.Context) ([]*model.Group, error)
+	// ListUserGroups returns the groups a user belongs to.
+	ListUserGroups(ctx context.Context, email string) ([]*model.Group, error)
+	// ListGroupsByMembers returns the groups of several users at once,
+	// keyed by email.
+	ListGroupsByMembers(ctx context.Context, emails []string) (map[string][]*model.Group, error)
+}
+
+type groupService struct {
+	groups repository.GroupRepository
+	users  repository.UserRepository
+	now    func() time.Time
+}
+
+func NewGroupService(groups repository.GroupRepository, users repository.UserRepository) GroupService {
+	return &groupService{groups: groups, users: users, now: time.Now}
+}
+
+// WithGroupRepository removes purged and erased users from their groups.
+func WithGroupRepository(repo repository.GroupRepository) Option {
+	return func(s *userService) { s.groupRepo = repo }
+}
+
+func (s *groupService) CreateGroup(ctx context.Context, group *model.Group) error {
+	if err := s.validate(ctx, group, nil); err != nil {
+		return err
+	}
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	group.ID = id
+	group.CreatedAt = now
+	group.UpdatedAt = now
+	return groupError(s.groups.Create(ctx, group))
+}
+
+func (s *groupService) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	group, err := s.groups.Get(ctx, id)
+	if err != nil {
+		return nil, groupError(err)
+	}
+	return group, nil
+}
+
+func (s *groupService) UpdateGroup(ctx context.Context, group *model.Group) error {
+	existing, err := s.groups.Get(ctx, group.ID)
+	if err != nil {
+		return groupError(err)
+	}
+	if err := s.validate(ctx, group, existing.Members); err != nil {
+		return err
+	}
+	group.CreatedAt = existing.CreatedAt
+	group.UpdatedAt = s.now()
+	return groupError(s.groups.Update(ctx, group))
+}
+
+func (s *groupService) DeleteGroup(ctx context.Context, id string) error {
+	return groupError(s.groups.Delete(ctx, id))
+}
+
+func (s *groupService) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	return s.groups.List(ctx)
+}
+
+func (s *groupService) ListUserGroups(ctx context.Context, email string) ([]*model.Group, error) {
+	return s.groups.ListByMember(ctx, email)
+}
+
+func (s *groupService) ListGroupsByMembers(ctx context.Context, emails []string) (map[string][]*model.Group, error) {
+	return s.groups.ListByMembers(ctx, emails)
+}
+
+// validate checks the display name and that every new member is a user,
+// and removes duplicate members. Current members are not checked again, as
+// deleted users stay in their groups until they are purged.
+func (s *groupService) validate(ctx context.Context, group *model.Group, current []string) error {
+	group.DisplayName = strings.TrimSpace(group.DisplayName)
+	if group.DisplayName == "" {
+		return ErrInvalidGroup
+	}
+	known := make(map[string]bool, len(current))
+	for _, email := range current {
+		known[email] = true
+	}
+	seen := make(map[string]bool, len(group.Members))
+	members := group.Members[:0]
+	for _, email := range group.Members {
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		if known[email] {
+			members = append(members, email)
+			continue
+		}
+		if _, err := s.users.GetByEmail(ctx, email); err != nil {
+			if errors.Is(err, repository.ErrUserNotFound) {
+				return fmt.Errorf("%w: %s", ErrUnknownMember, email)
+			}
+			return err
+		}
+		members = append(members, email)
+	}
+	sort.Strings(members)
+	group.Members = members
+	return nil
+}
+
+// groupError translates repository errors into service errors.
+func groupError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrGroupNotFound):
+		return ErrGroupNotFound
+	case errors.Is(err, repository.ErrGroupAlreadyExists):
+		return ErrGroupAlreadyExists
+	}
+	return err
+}
+
+// newID returns a random UUID (version 4).
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func TestGroupMembership(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	userRepo := repository.NewUserRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	users := NewUserService(userRepo,
+		WithGroupRepository(groupRepo),
+		WithRetention(time.Hour),
+		WithClock(func() time.Time { return now }),
+	)
+	groups := NewGroupService(groupRepo, userRepo)
+	ctx := context.Background()
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := users.CreateUser(ctx, &model.User{Email: email}); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+
+	group := &model.Group{DisplayName: " Admins ", Members: []string{"b@example.com", "a@example.com", "b@example.com"}}
+	if err := groups.CreateGroup(ctx, group); err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if group.ID == "" || group.DisplayName != "Admins" || len(group.Members) != 2 || group.Members[0] != "a@example.com" {
+		t.Errorf("Expected a trimmed, deduplicated and sorted group with an ID, got %+v", group)
+	}
+	if err := groups.CreateGroup(ctx, &model.Group{DisplayName: "admins"}); !errors.Is(err, ErrGroupAlreadyExists) {
+		t.Errorf("Expected ErrGroupAlreadyExists for a display name differing in case, got %v", err)
+	}
+	if err := groups.CreateGroup(ctx, &model.Group{DisplayName: "Ops", Members: []string{"nobody@example.com"}}); !errors.Is(err, ErrUnknownMember) {
+		t.Errorf("Expected ErrUnknownMember, got %v", err)
+	}
+	if _, err := groups.GetGroup(ctx, "missing"); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+
+	// Deleted users stay in their groups, and may stay there on update,
+	// until they are purged.
+	if err := users.DeleteUser(ctx, "b@example.com"); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	group.DisplayName = "Administrators"
+	if err := groups.UpdateGroup(ctx, group); err != nil {
+		t.Fatalf("UpdateGroup with a deleted member failed: %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := users.PurgeDeletedUsers(ctx); err != nil {
+		t.Fatalf("PurgeDeletedUsers failed: %v", err)
+	}
+	got, err := groups.GetGroup(ctx, group.ID)
+	if err != nil {
+		t.Fatalf("GetGroup failed: %v", err)
+	}
+	if got.DisplayName != "Administrators" || len(got.Members) != 1 || got.Members[0] != "a@example.com" {
+		t.Errorf("Expected the purged user removed from the group, got %+v", got)
+	}
+	memberOf, err := groups.ListUserGroups(ctx, "a@example.com")
+	if err != nil || len(memberOf) != 1 {
+		t.Errorf("Expected a@example.com in 1 group, got %d (%v)", len(memberOf), err)
+	}
+
+	if err := groups.DeleteGroup(ctx, group.ID); err != nil {
+		t.Fatalf("DeleteGroup failed: %v", err)
+	}
+	if err := groups.DeleteGroup(ctx, group.ID); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound deleting twice, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+)
+
+var (
+	ErrInvalidState      = errors.New("invalid user state")
+	ErrInvalidTransition = errors.New("state transition not allowed")
+	ErrAccountInactive   = errors.New("account is not active")
+	ErrConcurrentUpdate  = errors.New("user kept changing while being updated")
+)
+
+// maxWriteAttempts bounds how often a read-modify-write of a user is
+// retried when another write gets in between.
+const maxWriteAttempts = 3
+
+// transitions lists the states each state may move to.
+var transitions = map[model.UserState][]model.UserState{
+	model.StatePending:     {model.StateActive, model.StateDeactivated},
+	model.StateActive:      {model.StateSuspended, model.StateDeactivated},
+	model.StateSuspended:   {model.StateActive, model.StateDeactivated},
+	model.StateDeactivated: {model.StateActive},
+}
+
+func canTransition(from, to model.UserState) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// canAuthenticate reports whether a user in state may sign in. Pending
+// users may, so they can verify their email and set a password.
+func canAuthenticate(state model.UserState) bool {
+	return state == model.StateActive || state == model.StatePending
+}
+
+func (s *userService) TransitionUser(ctx context.Context, email string, to model.UserState, reason string) (*model.User, error) {
+	if !to.Valid() {
+		return nil, ErrInvalidState
+	}
+	var updated *model.User
+	err := s.retryConflicts(func() error {
+		user, err := s.repo.GetByEmail(ctx, email)
+		if err != nil {
+			return ErrUserNotFound
+		}
+		updated, err = s.transition(ctx, user, to, reason)
+		return err
+	})
+	return updated, err
+}
+
+// retryConflicts calls write, which reads a user and writes it back with
+// UpdateIfVersion, again while it fails with repository.ErrVersionConflict,
+// up to maxWriteAttempts times.
+func (s *userService) retryConflicts(write func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if !errors.Is(err, repository.ErrVersionConflict) {
+			return err
+		}
+		if attempt == maxWriteAttempts {
+			return ErrConcurrentUpdate
+		}
+	}
+}
+
+// transition moves user to state to, provided it is still at the Version
+// it was read at, so the check of the state it moves from holds when it is
+// written.
+func (s *userService) transition(ctx context.Context, user *model.User, to model.UserState, reason string) (*model.User, error) {
+	from := user.State
+	if !canTransition(from, to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	updated := *user
+	now := s.now()
+	updated.State = to
+	updated.StateChangedAt = &now
+	updated.StateReason = reason
+	updated.UpdatedAt = &now
+	if err := s.repo.UpdateIfVersion(ctx, &updated, user.Version); err != nil {
+		return nil, err
+	}
+
+	detail := fmt.Sprintf("%s -> %s", from, to)
+	if reason != "" {
+		detail += ": " + reason
+	}
+	if err := s.audit(ctx, &model.AuditEvent{Action: model.AuditStateChanged, Email: user.Email, Detail: detail}); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// requireActive returns ErrAccountInactive unless email belongs to a user
+// who may authenticate.
+func (s *userService) requireActive(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !canAuthenticate(user.State) {
+		return ErrAccountInactive
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func TestUserLifecycle(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	auditRepo := repository.NewAuditRepository(db)
+	now := time.Unix(1700000000, 0)
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithAuditRepository(auditRepo),
+		WithClock(func() time.Time { return now }),
+	)
+	ctx := context.Background()
+	email := "life@example.com"
+
+	// Clients cannot choose the initial state
+	if err := svc.CreateUser(ctx, &model.User{Email: email, Name: "Life", State: model.StateActive}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	user, _ := svc.GetUser(ctx, email)
+	if user.State != model.StatePending {
+		t.Errorf("Expected new user to be pending, got %s", user.State)
+	}
+
+	if _, err := svc.TransitionUser(ctx, email, model.StateSuspended, "spam"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected pending -> suspended to be rejected, got %v", err)
+	}
+	if _, err := svc.TransitionUser(ctx, email, "frozen", ""); err != ErrInvalidState {
+		t.Errorf("Expected ErrInvalidState, got %v", err)
+	}
+
+	if _, err := svc.TransitionUser(ctx, email, model.StateActive, "manual approval"); err != nil {
+		t.Fatalf("pending -> active failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+	user, err = svc.TransitionUser(ctx, email, model.StateSuspended, "chargeback")
+	if err != nil {
+		t.Fatalf("active -> suspended failed: %v", err)
+	}
+	if user.StateReason != "chargeback" || !user.StateChangedAt.Equal(now) {
+		t.Errorf("Expected reason and timestamp to be recorded, got %+v", user)
+	}
+
+	// Profile updates keep the state
+	if err := svc.UpdateUser(ctx, &model.User{Email: email, Name: "Renamed", State: model.StateActive}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	user, _ = svc.GetUser(ctx, email)
+	if user.State != model.StateSuspended {
+		t.Errorf("Expected UpdateUser to keep state suspended, got %s", user.State)
+	}
+
+	events, _ := auditRepo.ListByEmail(ctx, email)
+	if len(events) != 2 || events[1].Detail != "active -> suspended: chargeback" {
+		t.Errorf("Expected two state change audit events, got %+v", events)
+	}
+}
+
+// racingRepo writes the user with write before each conditional update,
+// as a concurrent request would between the read and the write.
+type racingRepo struct {
+	repository.UserRepository
+	write func(ctx context.Context, user *model.User)
+}
+
+func (r racingRepo) UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error {
+	if r.write != nil {
+		r.write(ctx, user)
+	}
+	return r.UserRepository.UpdateIfVersion(ctx, user, version)
+}
+
+func TestTransitionRaces(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := &racingRepo{UserRepository: repository.NewUserRepository(db)}
+	svc := NewUserService(repo)
+	ctx := context.Background()
+	email := "race@example.com"
+	_ = svc.CreateUser(ctx, &model.User{Email: email})
+	_, _ = svc.TransitionUser(ctx, email, model.StateActive, "")
+
+	// Another request suspends the user first: the retry sees it suspended
+	// and rejects suspending it again
+	raced := false
+	repo.write = func(ctx context.Context, user *model.User) {
+		if !raced {
+			raced = true
+			suspended, _ := repo.UserRepository.GetByEmail(ctx, user.Email)
+			suspended.State = model.StateSuspended
+			suspended.StateReason = "first"
+			_ = repo.UserRepository.Update(ctx, suspended)
+		}
+	}
+	if _, err := svc.TransitionUser(ctx, email, model.StateSuspended, "second"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected the second suspension to be rejected, got %v", err)
+	}
+	if user, _ := svc.GetUser(ctx, email); user.StateReason != "first" {
+		t.Errorf("Expected the first suspension to stand, got %+v", user)
+	}
+
+	// A user that keeps changing is given up on
+	repo.write = func(ctx context.Context, user *model.User) {
+		current, _ := repo.UserRepository.GetByEmail(ctx, user.Email)
+		_ = repo.UserRepository.Update(ctx, current)
+	}
+	if _, err := svc.TransitionUser(ctx, email, model.StateDeactivated, ""); !errors.Is(err, ErrConcurrentUpdate) {
+		t.Errorf("Expected ErrConcurrentUpdate, got %v", err)
+	}
+	if user, _ := svc.GetUser(ctx, email); user.State != model.StateSuspended {
+		t.Errorf("Expected the user to stay suspended, got %s", user.State)
+	}
+}
+
+// suspendOnce returns a racingRepo write that suspends the user, with the
+// repository underneath, before the first conditional update only.
+func suspendOnce(repo *racingRepo) func(ctx context.Context, user *model.User) {
+	raced := false
+	return func(ctx context.Context, user *model.User) {
+		if raced {
+			return
+		}
+		raced = true
+		suspended, _ := repo.UserRepository.GetByEmail(ctx, user.Email)
+		updated := *suspended
+		updated.State = model.StateSuspended
+		updated.StateReason = "raced"
+		_ = repo.UserRepository.Update(ctx, &updated)
+	}
+}
+
+func TestUpdateRacesTransition(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := &racingRepo{UserRepository: repository.NewUserRepository(db)}
+	svc := NewUserService(repo)
+	ctx := context.Background()
+	email := "update@example.com"
+	_ = svc.CreateUser(ctx, &model.User{Email: email, Name: "Before"})
+	_, _ = svc.TransitionUser(ctx, email, model.StateActive, "")
+
+	repo.write = suspendOnce(repo)
+	if err := svc.UpdateUser(ctx, &model.User{Email: email, Name: "After"}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	user, _ := svc.GetUser(ctx, email)
+	if user.Name != "After" || user.State != model.StateSuspended || user.StateReason != "raced" {
+		t.Errorf("Expected the update to keep the concurrent suspension, got %+v", user)
+	}
+}
+
+func TestPasswordResetRacesTransition(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	repo := &racingRepo{UserRepository: repository.NewUserRepository(db)}
+	outbox := mailer.NewOutbox()
+	svc := NewUserService(repo,
+		WithTokenRepository(repository.NewTokenRepository(db)),
+		WithMailer(outbox),
+		WithLinkBaseURL("https://app.example.com"),
+	)
+	ctx := context.Background()
+	email := "reset@example.com"
+	_ = svc.CreateUser(ctx, &model.User{Email: email})
+	_, _ = svc.TransitionUser(ctx, email, model.StateActive, "")
+	_ = svc.RequestPasswordReset(ctx, email)
+	_ = svc.(Drainer).Drain(ctx)
+	token := tokenFromMessage(t, outbox.Messages()[0])
+
+	repo.write = suspendOnce(repo)
+	if err := svc.ResetPassword(ctx, token, "correct horse battery"); !errors.Is(err, ErrAccountInactive) {
+		t.Errorf("Expected a user suspended during the reset to be rejected, got %v", err)
+	}
+	user, _ := svc.GetUser(ctx, email)
+	if user.State != model.StateSuspended || user.PasswordHash != "" {
+		t.Errorf("Expected the user to stay suspended without a password, got %+v", user)
+	}
+}
+
+func TestListUsersByState(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := NewUserService(repository.NewUserRepository(db))
+	ctx := context.Background()
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_ = svc.CreateUser(ctx, &model.User{Email: email})
+	}
+	_, _ = svc.TransitionUser(ctx, "b@example.com", model.StateActive, "")
+
+	active, err := svc.ListUsers(ctx, model.UserFilter{State: model.StateActive})
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if len(active) != 1 || active[0].Email != "b@example.com" {
+		t.Errorf("Expected only b@example.com to be active, got %v", active)
+	}
+	pending, _ := svc.ListUsers(ctx, model.UserFilter{State: model.StatePending})
+	if len(pending) != 2 {
+		t.Errorf("Expected 2 pending users, got %d", len(pending))
+	}
+	if _, err := svc.ListUsers(ctx, model.UserFilter{State: "bogus"}); err != ErrInvalidState {
+		t.Errorf("Expected ErrInvalidState, got %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"user-service/internal/model"
+)
+
+var ErrAccountLocked = errors.New("too many failed attempts")
+
+// LockedError is returned while an account or client IP is locked out. It
+// matches ErrAccountLocked with errors.Is.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrAccountLocked, e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// LockoutPolicy controls how failed authentication attempts lock out an
+// account or client IP. Once failures reach a threshold the key is locked
+// for BaseDuration, doubling with every further failure up to MaxDuration.
+// Failures are forgotten after MaxDuration without a new one.
+type LockoutPolicy struct {
+	AccountThreshold int
+	IPThreshold      int
+	BaseDuration     time.Duration
+	MaxDuration      time.Duration
+}
+
+// DefaultLockoutPolicy returns the policy used unless overridden with
+// WithLockoutPolicy.
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		AccountThreshold: 5,
+		IPThreshold:      20,
+		BaseDuration:     time.Minute,
+		MaxDuration:      time.Hour,
+	}
+}
+
+// WithLockoutPolicy overrides DefaultLockoutPolicy.
+func WithLockoutPolicy(policy LockoutPolicy) Option {
+	return func(s *userService) { s.lockout = newLockoutTracker(policy) }
+}
+
+type clientIPKey struct{}
+
+// ContextWithClientIP records the client IP used for per-IP lockouts.
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// maxLockoutEntries bounds memory used by attackers cycling through
+// nonexistent emails; stale entries are swept once it is reached.
+const maxLockoutEntries = 10000
+
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type lockoutTracker struct {
+	policy  LockoutPolicy
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+}
+
+func newLockoutTracker(policy LockoutPolicy) *lockoutTracker {
+	return &lockoutTracker{policy: policy, entries: make(map[string]*lockoutEntry)}
+}
+
+func accountKey(email string) string { return "account:" + email }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// lockoutKey is a key attempts are counted against, and the failures at
+// which it locks.
+type lockoutKey struct {
+	key       string
+	threshold int
+}
+
+// reservation is an attempt counted as a failure of each of its keys
+// before it is made. until holds the lock each failure caused, if any, and
+// prev the lock it replaced.
+type reservation struct {
+	keys  []lockoutKey
+	prev  []time.Time
+	until []time.Time
+}
+
+// reserve returns a LockedError if any of keys is currently locked, and
+// otherwise counts a failure against each of them in the same critical
+// section, so concurrent attempts cannot all pass the check before any of
+// them fails. Attempts that do not fail are taken back with release.
+func (l *lockoutTracker) reserve(now time.Time, keys ...lockoutKey) (*reservation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var until time.Time
+	for _, k := range keys {
+		if e, ok := l.entries[k.key]; ok && now.Before(e.lockedUntil) && e.lockedUntil.After(until) {
+			until = e.lockedUntil
+		}
+	}
+	if !until.IsZero() {
+		return nil, &LockedError{Until: until}
+	}
+
+	r := &reservation{keys: keys, prev: make([]time.Time, len(keys)), until: make([]time.Time, len(keys))}
+	for i, k := range keys {
+		r.prev[i], r.until[i] = l.fail(now, k.key, k.threshold)
+	}
+	return r, nil
+}
+
+// fail records a failure for key. It returns the end of the lock before
+// the failure, and of the new lock the failure caused, if any. l.mu must
+// be held.
+func (l *lockoutTracker) fail(now time.Time, key string, threshold int) (time.Time, time.Time) {
+	e, ok := l.entries[key]
+	if !ok || now.Sub(e.lastFailure) > l.policy.MaxDuration {
+		if len(l.entries) >= maxLockoutEntries {
+			l.sweep(now)
+		}
+		e = &lockoutEntry{}
+		l.entries[key] = e
+	}
+	prev := e.lockedUntil
+	e.failures++
+	e.lastFailure = now
+	if e.failures < threshold {
+		return prev, time.Time{}
+	}
+
+	d := l.policy.BaseDuration
+	for i := threshold; i < e.failures && d < l.policy.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > l.policy.MaxDuration {
+		d = l.policy.MaxDuration
+	}
+	e.lockedUntil = now.Add(d)
+	return prev, e.lockedUntil
+}
+
+// release takes back the failures counted by r. Entries reset or failed
+// again since are left alone but for the count.
+func (l *lockoutTracker) release(r *reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, k := range r.keys {
+		e, ok := l.entries[k.key]
+		if !ok || e.failures == 0 {
+			continue
+		}
+		e.failures--
+		if !r.until[i].IsZero() && e.lockedUntil.Equal(r.until[i]) {
+			e.lockedUntil = r.prev[i]
+		}
+		if e.failures == 0 && e.lockedUntil.IsZero() {
+			delete(l.entries, k.key)
+		}
+	}
+}
+
+func (l *lockoutTracker) reset(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.entries[key]
+	delete(l.entries, key)
+	return ok
+}
+
+func (l *lockoutTracker) sweep(now time.Time) {
+	for key, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > l.policy.MaxDuration {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// guardAttempt runs an authentication attempt for email, refusing it while
+// the account or client IP is locked and counting ErrInvalidMFACode results
+// as failures. Unknown emails are counted like real ones. Attempts are
+// counted before they are made, so concurrent attempts cannot exceed the
+// thresholds.
+func (s *userService) guardAttempt(ctx context.Context, email string, attempt func() error) error {
+	ip := clientIPFromContext(ctx)
+	keys := []lockoutKey{{accountKey(email), s.lockout.policy.AccountThreshold}}
+	if ip != "" {
+		keys = append(keys, lockoutKey{ipKey(ip), s.lockout.policy.IPThreshold})
+	}
+	r, err := s.lockout.reserve(s.now(), keys...)
+	if err != nil {
+		return err
+	}
+
+	err = attempt()
+	if err == nil {
+		s.lockout.release(r)
+		s.lockout.reset(accountKey(email))
+		return nil
+	}
+	if !errors.Is(err, ErrInvalidMFACode) {
+		s.lockout.release(r)
+		return err
+	}
+
+	if until := r.until[0]; !until.IsZero() {
+		if err := s.audit(ctx, &model.AuditEvent{
+			Action: model.AuditAccountLocked,
+			Email:  email,
+			IP:     ip,
+			Detail: "locked until " + until.UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+	}
+	if ip != "" && !r.until[1].IsZero() {
+		if err := s.audit(ctx, &model.AuditEvent{
+			Action: model.AuditIPLocked,
+			IP:     ip,
+			Detail: "locked until " + r.until[1].UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *userService) UnlockAccount(ctx context.Context, email string) error {
+	if !s.lockout.reset(accountKey(email)) {
+		return nil
+	}
+	return s.audit(ctx, &model.AuditEvent{Action: model.AuditAccountUnlocked, Email: email})
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func TestAccountLockout(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	auditRepo := repository.NewAuditRepository(db)
+	now := time.Unix(1700000000, 0)
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithMFARepository(repository.NewMFARepository(db)),
+		WithAuditRepository(auditRepo),
+		WithLockoutPolicy(LockoutPolicy{AccountThreshold: 3, IPThreshold: 100, BaseDuration: time.Minute, MaxDuration: time.Hour}),
+		WithClock(func() time.Time { return now }),
+	)
+	ctx := context.Background()
+
+	// The email does not exist, but is counted like any other account
+	email := "ghost@example.com"
+	for i := 0; i < 3; i++ {
+		if err := svc.VerifyTOTP(ctx, email, "000000"); err != ErrInvalidMFACode {
+			t.Fatalf("attempt %d: expected ErrInvalidMFACode, got %v", i, err)
+		}
+	}
+	err = svc.VerifyTOTP(ctx, email, "000000")
+	var locked *LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Expected LockedError, got %v", err)
+	}
+	if !locked.Until.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected lock until %v, got %v", now.Add(time.Minute), locked.Until)
+	}
+
+	// The next failure after the lock expires doubles the lock
+	now = now.Add(2 * time.Minute)
+	_ = svc.VerifyTOTP(ctx, email, "000000")
+	err = svc.VerifyTOTP(ctx, email, "000000")
+	if !errors.As(err, &locked) || !locked.Until.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("Expected lock to double to 2m, got %v", err)
+	}
+
+	if err := svc.UnlockAccount(ctx, email); err != nil {
+		t.Fatalf("UnlockAccount failed: %v", err)
+	}
+	if err := svc.VerifyTOTP(ctx, email, "000000"); err != ErrInvalidMFACode {
+		t.Errorf("Expected ErrInvalidMFACode after unlock, got %v", err)
+	}
+
+	events, err := auditRepo.ListByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("ListByEmail failed: %v", err)
+	}
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	expected := []string{model.AuditAccountLocked, model.AuditAccountLocked, model.AuditAccountUnlocked}
+	if len(actions) != len(expected) {
+		t.Fatalf("Expected audit actions %v, got %v", expected, actions)
+	}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Errorf("Expected audit actions %v, got %v", expected, actions)
+			break
+		}
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithMFARepository(repository.NewMFARepository(db)),
+		WithLockoutPolicy(LockoutPolicy{AccountThreshold: 100, IPThreshold: 2, BaseDuration: time.Minute, MaxDuration: time.Hour}),
+	)
+	ctx := ContextWithClientIP(context.Background(), "192.0.2.1")
+
+	// Spraying different accounts from one IP locks the IP
+	_ = svc.VerifyTOTP(ctx, "a@example.com", "000000")
+	_ = svc.VerifyTOTP(ctx, "b@example.com", "000000")
+	if err := svc.VerifyTOTP(ctx, "c@example.com", "000000"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected ErrAccountLocked for locked IP, got %v", err)
+	}
+
+	other := ContextWithClientIP(context.Background(), "192.0.2.2")
+	if err := svc.VerifyTOTP(other, "c@example.com", "000000"); errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected other IP not to be locked, got %v", err)
+	}
+}
+
+func TestConcurrentAttempts(t *testing.T) {
+	svc := NewUserService(nil,
+		WithLockoutPolicy(LockoutPolicy{AccountThreshold: 3, IPThreshold: 100, BaseDuration: time.Minute, MaxDuration: time.Hour}),
+	).(*userService)
+	ctx := context.Background()
+
+	// No attempt fails until all have started, yet only as many as the
+	// threshold are made
+	var made int32
+	proceed := make(chan struct{})
+	var refused, wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		refused.Add(1)
+		go func() {
+			defer wg.Done()
+			err := svc.guardAttempt(ctx, "a@example.com", func() error {
+				atomic.AddInt32(&made, 1)
+				refused.Done()
+				<-proceed
+				return ErrInvalidMFACode
+			})
+			if errors.Is(err, ErrAccountLocked) {
+				refused.Done()
+			}
+		}()
+	}
+	refused.Wait()
+	close(proceed)
+	wg.Wait()
+	if made != 3 {
+		t.Errorf("Expected 3 attempts made, got %d", made)
+	}
+
+	// Attempts that succeed or error otherwise are not counted
+	svc = NewUserService(nil,
+		WithLockoutPolicy(LockoutPolicy{AccountThreshold: 1, IPThreshold: 100, BaseDuration: time.Minute, MaxDuration: time.Hour}),
+	).(*userService)
+	ipCtx := ContextWithClientIP(ctx, "192.0.2.1")
+	for i := 0; i < 3; i++ {
+		if err := svc.guardAttempt(ipCtx, "a@example.com", func() error { return ErrMFANotEnrolled }); err != ErrMFANotEnrolled {
+			t.Fatalf("attempt %d: expected ErrMFANotEnrolled, got %v", i, err)
+		}
+	}
+	if len(svc.lockout.entries) != 0 {
+		t.Errorf("Expected released attempts to leave no entries, got %d", len(svc.lockout.entries))
+	}
+}
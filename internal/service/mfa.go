@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/pkg/totp"
+)
+
+var (
+	ErrMFAUnavailable     = errors.New("mfa is not configured")
+	ErrMFANotEnrolled     = errors.New("mfa is not enrolled")
+	ErrMFAAlreadyEnrolled = errors.New("mfa is already enrolled")
+	ErrInvalidMFACode     = errors.New("invalid mfa code")
+)
+
+const (
+	// totpSkew is the number of 30 second steps either side of the current
+	// one that are accepted, to tolerate clock drift on user devices.
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	mfaEnrollmentTTL  = time.Hour
+)
+
+var b32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// dummySecret is checked against codes submitted for unknown emails.
+var dummySecret = make([]byte, totp.SecretSize)
+
+func (s *userService) RequestMFAEnrollment(ctx context.Context, email string) error {
+	if s.mfaRepo == nil {
+		return ErrMFAUnavailable
+	}
+	if s.mailer == nil || s.tokenRepo == nil {
+		return ErrEmailUnavailable
+	}
+	s.sendLater(ctx, email, model.TokenMFAEnrollment, mfaEnrollmentTTL,
+		mailer.TemplateEnrollMFA, "/enroll-mfa")
+	return nil
+}
+
+func (s *userService) EnrollTOTP(ctx context.Context, email, token string) (*model.TOTPSetup, error) {
+	if s.mfaRepo == nil {
+		return nil, ErrMFAUnavailable
+	}
+	t, err := s.consumeToken(ctx, model.TokenMFAEnrollment, token)
+	if err != nil {
+		return nil, err
+	}
+	if t.Email != email {
+		return nil, ErrInvalidToken
+	}
+	if err := s.requireActive(ctx, email); err != nil {
+		return nil, err
+	}
+	existing, err := s.mfaRepo.Get(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.Confirmed {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	mfa := &model.MFA{Email: email, Secret: secret, CreatedAt: s.now()}
+	if err := s.mfaRepo.Save(ctx, mfa); err != nil {
+		return nil, err
+	}
+	return &model.TOTPSetup{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.ProvisioningURI(s.mfaIssuer, email, secret),
+	}, nil
+}
+
+func (s *userService) ConfirmTOTP(ctx context.Context, email, code string) ([]string, error) {
+	var codes []string
+	err := s.guardAttempt(ctx, email, func() error {
+		mfa, err := s.getMFA(ctx, email)
+		if err != nil {
+			return err
+		}
+		if mfa.Confirmed {
+			return ErrMFAAlreadyEnrolled
+		}
+		step, ok := totp.Validate(mfa.Secret, totp.NormalizeCode(code), s.now(), totpSkew)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		var hashes []string
+		if codes, hashes, err = generateRecoveryCodes(recoveryCodeCount); err != nil {
+			return err
+		}
+		confirmed := *mfa
+		confirmed.Confirmed = true
+		confirmed.ConfirmedAt = s.now()
+		confirmed.LastUsedStep = step
+		confirmed.RecoveryCodes = hashes
+		return s.mfaRepo.Save(ctx, &confirmed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *userService) VerifyTOTP(ctx context.Context, email, code string) error {
+	return s.guardAttempt(ctx, email, func() error {
+		mfa, err := s.getConfirmedMFA(ctx, email)
+		if err != nil {
+			return err
+		}
+		if mfa == nil {
+			// Do the same work as for a real enrollment so response times
+			// do not reveal which emails exist.
+			totp.Validate(dummySecret, totp.NormalizeCode(code), s.now(), totpSkew)
+			return ErrInvalidMFACode
+		}
+		step, ok := totp.Validate(mfa.Secret, totp.NormalizeCode(code), s.now(), totpSkew)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		if err := s.mfaRepo.UseStep(ctx, email, step); err != nil {
+			if errors.Is(err, repository.ErrMFAStepUsed) {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		// Only reveal the account state to callers holding a valid code.
+		return s.requireActive(ctx, email)
+	})
+}
+
+func (s *userService) VerifyRecoveryCode(ctx context.Context, email, code string) error {
+	return s.guardAttempt(ctx, email, func() error {
+		hash := hashRecoveryCode(code)
+		mfa, err := s.getConfirmedMFA(ctx, email)
+		if err != nil {
+			return err
+		}
+		if mfa == nil {
+			return ErrInvalidMFACode
+		}
+		if err := s.mfaRepo.UseRecoveryCode(ctx, email, hash); err != nil {
+			if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+		return s.requireActive(ctx, email)
+	})
+}
+
+func (s *userService) ResetMFA(ctx context.Context, email string) error {
+	if s.mfaRepo == nil {
+		return ErrMFAUnavailable
+	}
+	if err := s.mfaRepo.Delete(ctx, email); err != nil {
+		if errors.Is(err, repository.ErrMFANotFound) {
+			return ErrMFANotEnrolled
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *userService) getMFA(ctx context.Context, email string) (*model.MFA, error) {
+	if s.mfaRepo == nil {
+		return nil, ErrMFAUnavailable
+	}
+	mfa, err := s.mfaRepo.Get(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrMFANotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// getConfirmedMFA returns nil without an error when email has no confirmed
+// enrollment, so verification can fail the same way for unknown emails.
+func (s *userService) getConfirmedMFA(ctx context.Context, email string) (*model.MFA, error) {
+	mfa, err := s.getMFA(ctx, email)
+	if errors.Is(err, ErrMFANotEnrolled) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !mfa.Confirmed {
+		return nil, nil
+	}
+	return mfa, nil
+}
+
+// generateRecoveryCodes returns n random codes formatted as xxxxx-xxxxx
+// along with the hashes that are stored in their place.
+func generateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(b32NoPad.EncodeToString(buf))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(totp.NormalizeCode(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"user-service/internal/mailer"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/pkg/totp"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func setupMFAService(t *testing.T, now *time.Time) (UserService, *mailer.Outbox) {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	outbox := mailer.NewOutbox()
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithMFARepository(repository.NewMFARepository(db)),
+		WithTokenRepository(repository.NewTokenRepository(db)),
+		WithMailer(outbox),
+		WithLinkBaseURL("https://app.example.com"),
+		WithClock(func() time.Time { return *now }),
+	)
+	if err := svc.CreateUser(context.Background(), &model.User{Email: "mfa@example.com", Name: "MFA", Age: 30}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return svc, outbox
+}
+
+// enrollmentToken requests an MFA enrollment link for email and returns
+// the token it carries.
+func enrollmentToken(t *testing.T, svc UserService, outbox *mailer.Outbox, email string) string {
+	t.Helper()
+	if err := svc.RequestMFAEnrollment(context.Background(), email); err != nil {
+		t.Fatalf("RequestMFAEnrollment failed: %v", err)
+	}
+	_ = svc.(Drainer).Drain(context.Background())
+	msgs := outbox.Messages()
+	if len(msgs) == 0 {
+		t.Fatalf("no enrollment email sent to %s", email)
+	}
+	return tokenFromMessage(t, msgs[len(msgs)-1])
+}
+
+func decodeSecret(t *testing.T, secret string) []byte {
+	t.Helper()
+	raw, err := b32NoPad.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("failed to decode secret: %v", err)
+	}
+	return raw
+}
+
+func TestTOTPEnrollmentAndVerification(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, outbox := setupMFAService(t, &now)
+	ctx := context.Background()
+	email := "mfa@example.com"
+
+	// Enrolling takes a token proving the caller owns the account
+	if _, err := svc.EnrollTOTP(ctx, email, "forged"); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken without a valid token, got %v", err)
+	}
+	token := enrollmentToken(t, svc, outbox, email)
+	if _, err := svc.EnrollTOTP(ctx, "other@example.com", token); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken for another user's token, got %v", err)
+	}
+	token = enrollmentToken(t, svc, outbox, email)
+	setup, err := svc.EnrollTOTP(ctx, email, token)
+	if err != nil {
+		t.Fatalf("EnrollTOTP failed: %v", err)
+	}
+	if _, err := svc.EnrollTOTP(ctx, email, token); err != ErrInvalidToken {
+		t.Errorf("Expected a used token to be rejected, got %v", err)
+	}
+	secret := decodeSecret(t, setup.Secret)
+
+	// Verification is refused until enrollment is confirmed
+	if err := svc.VerifyTOTP(ctx, email, totp.Code(secret, totp.Step(now))); err != ErrInvalidMFACode {
+		t.Errorf("Expected ErrInvalidMFACode before confirmation, got %v", err)
+	}
+	if _, err := svc.ConfirmTOTP(ctx, email, "000000"); err != ErrInvalidMFACode {
+		t.Errorf("Expected ErrInvalidMFACode for wrong code, got %v", err)
+	}
+
+	codes, err := svc.ConfirmTOTP(ctx, email, totp.Code(secret, totp.Step(now)))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+	if _, err := svc.EnrollTOTP(ctx, email, enrollmentToken(t, svc, outbox, email)); err != ErrMFAAlreadyEnrolled {
+		t.Errorf("Expected ErrMFAAlreadyEnrolled, got %v", err)
+	}
+
+	// The code used for confirmation cannot be replayed
+	if err := svc.VerifyTOTP(ctx, email, totp.Code(secret, totp.Step(now))); err != ErrInvalidMFACode {
+		t.Errorf("Expected replayed code to be rejected, got %v", err)
+	}
+
+	// A code from the next step is accepted within the skew window, once
+	next := totp.Code(secret, totp.Step(now)+1)
+	if err := svc.VerifyTOTP(ctx, email, next); err != nil {
+		t.Errorf("Expected next step code to verify, got %v", err)
+	}
+	if err := svc.VerifyTOTP(ctx, email, next); err != ErrInvalidMFACode {
+		t.Errorf("Expected second use of code to be rejected, got %v", err)
+	}
+
+	// Recovery codes are single use
+	if err := svc.VerifyRecoveryCode(ctx, email, codes[0]); err != nil {
+		t.Errorf("VerifyRecoveryCode failed: %v", err)
+	}
+	if err := svc.VerifyRecoveryCode(ctx, email, codes[0]); err != ErrInvalidMFACode {
+		t.Errorf("Expected reused recovery code to be rejected, got %v", err)
+	}
+
+	// Admin reset allows enrolling again
+	if err := svc.ResetMFA(ctx, email); err != nil {
+		t.Fatalf("ResetMFA failed: %v", err)
+	}
+	if _, err := svc.EnrollTOTP(ctx, email, enrollmentToken(t, svc, outbox, email)); err != nil {
+		t.Errorf("Expected enrollment after reset to succeed, got %v", err)
+	}
+}
+
+func TestTOTPWithoutRepository(t *testing.T) {
+	repo := &mockUserRepo{users: make(map[string]*model.User)}
+	svc := NewUserService(repo)
+
+	if _, err := svc.EnrollTOTP(context.Background(), "a@example.com", "token"); err != ErrMFAUnavailable {
+		t.Errorf("Expected ErrMFAUnavailable, got %v", err)
+	}
+}
+
+func TestTOTPSuspendedUser(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, outbox := setupMFAService(t, &now)
+	ctx := context.Background()
+	email := "mfa@example.com"
+
+	setup, _ := svc.EnrollTOTP(ctx, email, enrollmentToken(t, svc, outbox, email))
+	secret := decodeSecret(t, setup.Secret)
+	if _, err := svc.ConfirmTOTP(ctx, email, totp.Code(secret, totp.Step(now))); err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+	_, _ = svc.TransitionUser(ctx, email, model.StateActive, "")
+	if _, err := svc.TransitionUser(ctx, email, model.StateSuspended, "abuse"); err != nil {
+		t.Fatalf("TransitionUser failed: %v", err)
+	}
+
+	if err := svc.VerifyTOTP(ctx, email, totp.Code(secret, totp.Step(now)+1)); err != ErrAccountInactive {
+		t.Errorf("Expected ErrAccountInactive for suspended user, got %v", err)
+	}
+}
+
+func TestConfirmTOTPLockout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, outbox := setupMFAService(t, &now)
+	ctx := context.Background()
+	email := "mfa@example.com"
+
+	setup, err := svc.EnrollTOTP(ctx, email, enrollmentToken(t, svc, outbox, email))
+	if err != nil {
+		t.Fatalf("EnrollTOTP failed: %v", err)
+	}
+	// Guessing confirmation codes locks the account like guessing codes
+	for i := 0; i < DefaultLockoutPolicy().AccountThreshold; i++ {
+		if _, err := svc.ConfirmTOTP(ctx, email, "000000"); err != ErrInvalidMFACode {
+			t.Fatalf("attempt %d: expected ErrInvalidMFACode, got %v", i, err)
+		}
+	}
+	secret := decodeSecret(t, setup.Secret)
+	if _, err := svc.ConfirmTOTP(ctx, email, totp.Code(secret, totp.Step(now))); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected ErrAccountLocked, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+)
+
+var (
+	ErrPrivacyUnavailable = errors.New("erasure is not configured")
+	ErrNotErased          = errors.New("no erasure recorded for this email")
+)
+
+// WithTombstoneRepository enables EraseUser.
+func WithTombstoneRepository(repo repository.TombstoneRepository) Option {
+	return func(s *userService) { s.tombstoneRepo = repo }
+}
+
+// WithPseudonymKey sets the key used to derive pseudonyms and tombstone
+// hashes from emails. It must stay the same across restarts for tombstones
+// to remain matchable; a random key is used if none is given.
+func WithPseudonymKey(key []byte) Option {
+	return func(s *userService) { s.pseudonymKey = key }
+}
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("service: cannot generate pseudonym key: " + err.Error())
+	}
+	return key
+}
+
+// subjectHash returns the keyed hash identifying email in tombstones.
+func (s *userService) subjectHash(email string) string {
+	mac := hmac.New(sha256.New, s.pseudonymKey)
+	mac.Write([]byte(email))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// findUser returns the user with email whether or not they are
+// soft-deleted.
+func (s *userService) findUser(ctx context.Context, email string) (*model.User, error) {
+	if user, err := s.repo.GetByEmail(ctx, email); err == nil {
+		return user, nil
+	}
+	if user, err := s.repo.GetDeleted(ctx, email); err == nil {
+		return user, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *userService) ExportUserData(ctx context.Context, email string) (*model.DataExport, error) {
+	user, err := s.findUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	export := &model.DataExport{
+		GeneratedAt: s.now(),
+		User:        user,
+		PasswordSet: user.PasswordHash != "",
+		Tokens:      []*model.Token{},
+		AuditEvents: []*model.AuditEvent{},
+	}
+	if s.mfaRepo != nil {
+		mfa, err := s.mfaRepo.Get(ctx, email)
+		if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+			return nil, err
+		}
+		export.MFA = mfa
+	}
+	if s.tokenRepo != nil {
+		tokens, err := s.tokenRepo.ListByEmail(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+		export.Tokens = append(export.Tokens, tokens...)
+	}
+	if s.auditRepo != nil {
+		events, err := s.auditRepo.ListByEmail(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+		export.AuditEvents = append(export.AuditEvents, events...)
+	}
+	if err := s.audit(ctx, &model.AuditEvent{Action: model.AuditUserExported, Email: email}); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *userService) EraseUser(ctx context.Context, email string) (*model.Tombstone, error) {
+	if s.tombstoneRepo == nil {
+		return nil, ErrPrivacyUnavailable
+	}
+	if _, err := s.findUser(ctx, email); err != nil {
+		return nil, err
+	}
+
+	if err := s.deleteEverywhere(ctx, email); err != nil {
+		return nil, err
+	}
+	s.lockout.reset(accountKey(email))
+
+	hash := s.subjectHash(email)
+	tombstone := &model.Tombstone{
+		SubjectHash: hash,
+		Pseudonym:   "erased-" + hash[:16],
+		ErasedAt:    s.now(),
+	}
+	if s.auditRepo != nil {
+		n, err := s.auditRepo.Pseudonymize(ctx, email, tombstone.Pseudonym)
+		if err != nil {
+			return nil, err
+		}
+		tombstone.AuditEventCount = n
+	}
+	if err := s.tombstoneRepo.Create(ctx, tombstone); err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, &model.AuditEvent{Action: model.AuditUserErased, Email: tombstone.Pseudonym}); err != nil {
+		return nil, err
+	}
+	return tombstone, nil
+}
+
+func (s *userService) GetErasure(ctx context.Context, email string) (*model.Tombstone, error) {
+	if s.tombstoneRepo == nil {
+		return nil, ErrPrivacyUnavailable
+	}
+	tombstone, err := s.tombstoneRepo.Get(ctx, s.subjectHash(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrTombstoneNotFound) {
+			return nil, ErrNotErased
+		}
+		return nil, err
+	}
+	return tombstone, nil
+}
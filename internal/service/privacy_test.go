@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func TestExportAndErasure(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	auditRepo := repository.NewAuditRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	now := time.Unix(1700000000, 0)
+	svc := NewUserService(
+		repository.NewUserRepository(db),
+		WithMFARepository(repository.NewMFARepository(db)),
+		WithAuditRepository(auditRepo),
+		WithTokenRepository(tokenRepo),
+		WithTombstoneRepository(repository.NewTombstoneRepository(db)),
+		WithPseudonymKey([]byte("test-key")),
+		WithClock(func() time.Time { return now }),
+	)
+	ctx := context.Background()
+	email := "subject@example.com"
+
+	_ = svc.CreateUser(ctx, &model.User{Email: email, Name: "Subject", Age: 40})
+	_, _ = svc.TransitionUser(ctx, email, model.StateActive, "")
+	_ = tokenRepo.Create(ctx, &model.Token{Hash: hashToken("enroll"), Email: email, Purpose: model.TokenMFAEnrollment, ExpiresAt: now.Add(time.Hour)})
+	_, _ = svc.EnrollTOTP(ctx, email, "enroll")
+	_ = tokenRepo.Create(ctx, &model.Token{Hash: "h", Email: email, Purpose: model.TokenEmailVerification})
+	_ = svc.DeleteUser(ctx, email)
+
+	// Soft-deleted users can still be exported
+	export, err := svc.ExportUserData(ctx, email)
+	if err != nil {
+		t.Fatalf("ExportUserData failed: %v", err)
+	}
+	if export.User.Name != "Subject" || export.MFA == nil || len(export.Tokens) != 0 {
+		t.Errorf("Unexpected export: %+v", export)
+	}
+	if len(export.AuditEvents) != 2 {
+		t.Errorf("Expected 2 audit events in export, got %d", len(export.AuditEvents))
+	}
+
+	tombstone, err := svc.EraseUser(ctx, email)
+	if err != nil {
+		t.Fatalf("EraseUser failed: %v", err)
+	}
+	if !strings.HasPrefix(tombstone.Pseudonym, "erased-") || tombstone.AuditEventCount != 3 {
+		t.Errorf("Unexpected tombstone: %+v", tombstone)
+	}
+	if _, err := svc.ExportUserData(ctx, email); err != ErrUserNotFound {
+		t.Errorf("Expected erased user to be gone, got %v", err)
+	}
+	if events, _ := auditRepo.ListByEmail(ctx, email); len(events) != 0 {
+		t.Errorf("Expected no audit events left under the email, got %d", len(events))
+	}
+	events, _ := auditRepo.ListByEmail(ctx, tombstone.Pseudonym)
+	if len(events) != 4 || events[3].Action != model.AuditUserErased {
+		t.Errorf("Expected pseudonymized history ending in erasure, got %+v", events)
+	}
+
+	got, err := svc.GetErasure(ctx, email)
+	if err != nil || got.SubjectHash != tombstone.SubjectHash {
+		t.Errorf("Expected tombstone lookup to match, got %+v, %v", got, err)
+	}
+	if _, err := svc.GetErasure(ctx, "other@example.com"); err != ErrNotErased {
+		t.Errorf("Expected ErrNotErased, got %v", err)
+	}
+}
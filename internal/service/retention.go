@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+)
+
+var ErrRetentionExpired = errors.New("user can no longer be restored")
+
+// DefaultRetention is how long deleted users can be restored before they
+// are purged, unless overridden with WithRetention.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// WithRetention sets how long deleted users are kept.
+func WithRetention(d time.Duration) Option {
+	return func(s *userService) { s.retention = d }
+}
+
+// WithEmailReuse lets a new user take the email of a deleted user, purging
+// the deleted user immediately. By default the email stays reserved until
+// the deleted user is purged.
+func WithEmailReuse(allow bool) Option {
+	return func(s *userService) { s.emailReuse = allow }
+}
+
+func (s *userService) UndeleteUser(ctx context.Context, email string) (*model.User, error) {
+	deleted, err := s.repo.GetDeleted(ctx, email)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if s.now().Sub(*deleted.DeletedAt) > s.retention {
+		return nil, ErrRetentionExpired
+	}
+	user, err := s.repo.Restore(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit(ctx, &model.AuditEvent{Action: model.AuditUserRestored, Email: email}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	users, err := s.repo.ListDeletedBefore(ctx, s.now().Add(-s.retention))
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		err := s.purge(ctx, user.Email, *user.DeletedAt, "retention expired")
+		if errors.Is(err, repository.ErrUserNotFound) {
+			// Restored or purged since it was listed
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purge hard deletes a user soft-deleted at or before deletedBy and
+// everything stored about them. It returns repository.ErrUserNotFound,
+// deleting nothing, if the user is live again or was deleted later.
+func (s *userService) purge(ctx context.Context, email string, deletedBy time.Time, reason string) error {
+	if err := s.repo.Purge(ctx, email, deletedBy); err != nil {
+		return err
+	}
+	if err := s.deleteRelated(ctx, email); err != nil {
+		return err
+	}
+	return s.audit(ctx, &model.AuditEvent{Action: model.AuditUserPurged, Email: email, Detail: reason})
+}
+
+// deleteEverywhere hard deletes email from every table except the audit
+// log.
+func (s *userService) deleteEverywhere(ctx context.Context, email string) error {
+	if err := s.repo.Delete(ctx, email); err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+	return s.deleteRelated(ctx, email)
+}
+
+// deleteRelated hard deletes what is stored about email outside the user
+// table, except the audit log.
+func (s *userService) deleteRelated(ctx context.Context, email string) error {
+	if s.mfaRepo != nil {
+		if err := s.mfaRepo.Delete(ctx, email); err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+			return err
+		}
+	}
+	if s.tokenRepo != nil {
+		if err := s.tokenRepo.DeleteByEmail(ctx, email, ""); err != nil {
+			return err
+		}
+	}
+	if s.groupRepo != nil {
+		if _, err := s.groupRepo.RemoveMember(ctx, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+func setupRetentionService(t *testing.T, now *time.Time, opts ...Option) (UserService, repository.AuditRepository) {
+	t.Helper()
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	auditRepo := repository.NewAuditRepository(db)
+	opts = append([]Option{
+		WithAuditRepository(auditRepo),
+		WithRetention(24 * time.Hour),
+		WithClock(func() time.Time { return *now }),
+	}, opts...)
+	svc := NewUserService(repository.NewUserRepository(db), opts...)
+	if err := svc.CreateUser(context.Background(), &model.User{Email: "gone@example.com", Name: "Gone"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return svc, auditRepo
+}
+
+func TestSoftDeleteAndUndelete(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, _ := setupRetentionService(t, &now)
+	ctx := context.Background()
+	email := "gone@example.com"
+
+	if err := svc.DeleteUser(ctx, email); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := svc.GetUser(ctx, email); err != ErrUserNotFound {
+		t.Errorf("Expected deleted user to be hidden, got %v", err)
+	}
+	if users, _ := svc.ListUsers(ctx, model.UserFilter{}); len(users) != 0 {
+		t.Errorf("Expected deleted user to be hidden from list, got %d users", len(users))
+	}
+	if err := svc.UpdateUser(ctx, &model.User{Email: email, Name: "X"}); err == nil {
+		t.Error("Expected UpdateUser of deleted user to fail")
+	}
+	// The email stays reserved by default
+	if err := svc.CreateUser(ctx, &model.User{Email: email}); err == nil {
+		t.Error("Expected CreateUser with a deleted user's email to fail")
+	}
+
+	now = now.Add(23 * time.Hour)
+	user, err := svc.UndeleteUser(ctx, email)
+	if err != nil {
+		t.Fatalf("UndeleteUser failed: %v", err)
+	}
+	if user.DeletedAt != nil || user.Name != "Gone" {
+		t.Errorf("Expected restored user, got %+v", user)
+	}
+	if _, err := svc.UndeleteUser(ctx, email); err != ErrUserNotFound {
+		t.Errorf("Expected ErrUserNotFound undeleting a live user, got %v", err)
+	}
+
+	_ = svc.DeleteUser(ctx, email)
+	now = now.Add(25 * time.Hour)
+	if _, err := svc.UndeleteUser(ctx, email); err != ErrRetentionExpired {
+		t.Errorf("Expected ErrRetentionExpired, got %v", err)
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, auditRepo := setupRetentionService(t, &now)
+	ctx := context.Background()
+	email := "gone@example.com"
+
+	_ = svc.CreateUser(ctx, &model.User{Email: "kept@example.com"})
+	_ = svc.DeleteUser(ctx, email)
+
+	if n, err := svc.PurgeDeletedUsers(ctx); err != nil || n != 0 {
+		t.Errorf("Expected nothing purged within retention, got %d, %v", n, err)
+	}
+	now = now.Add(25 * time.Hour)
+	if n, err := svc.PurgeDeletedUsers(ctx); err != nil || n != 1 {
+		t.Errorf("Expected 1 user purged, got %d, %v", n, err)
+	}
+	if _, err := svc.UndeleteUser(ctx, email); err != ErrUserNotFound {
+		t.Errorf("Expected purged user to be gone, got %v", err)
+	}
+	if err := svc.CreateUser(ctx, &model.User{Email: email}); err != nil {
+		t.Errorf("Expected email to be free after purge, got %v", err)
+	}
+
+	events, _ := auditRepo.ListByEmail(ctx, email)
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 2 || actions[0] != model.AuditUserDeleted || actions[1] != model.AuditUserPurged {
+		t.Errorf("Expected delete and purge audit events, got %v", actions)
+	}
+}
+
+// restoringRepo restores users as soon as they are listed for purging.
+type restoringRepo struct {
+	repository.UserRepository
+}
+
+func (r restoringRepo) ListDeletedBefore(ctx context.Context, t time.Time) ([]*model.User, error) {
+	users, err := r.UserRepository.ListDeletedBefore(ctx, t)
+	for _, u := range users {
+		_, _ = r.Restore(ctx, u.Email)
+	}
+	return users, err
+}
+
+func TestPurgeSkipsRestoredUsers(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := NewUserService(restoringRepo{repository.NewUserRepository(db)},
+		WithRetention(time.Hour), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+	email := "restored@example.com"
+	_ = svc.CreateUser(ctx, &model.User{Email: email})
+	_ = svc.DeleteUser(ctx, email)
+
+	now = now.Add(2 * time.Hour)
+	if n, err := svc.PurgeDeletedUsers(ctx); err != nil || n != 0 {
+		t.Errorf("Expected the restored user to be skipped, got %d, %v", n, err)
+	}
+	if _, err := svc.GetUser(ctx, email); err != nil {
+		t.Errorf("Expected the restored user to be kept, got %v", err)
+	}
+}
+
+func TestEmailReuse(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	svc, _ := setupRetentionService(t, &now, WithEmailReuse(true))
+	ctx := context.Background()
+	email := "gone@example.com"
+
+	_ = svc.DeleteUser(ctx, email)
+	if err := svc.CreateUser(ctx, &model.User{Email: email, Name: "New"}); err != nil {
+		t.Fatalf("Expected email reuse to be allowed, got %v", err)
+	}
+	user, _ := svc.GetUser(ctx, email)
+	if user.Name != "New" {
+		t.Errorf("Expected new user, got %+v", user)
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/search"
+)
+
+var ErrSearchUnavailable = errors.New("search is not configured")
+
+// WithSearchIndex enables SearchUsers. The index must be kept current, as
+// by wrapping the repository with search.NewIndexingUserRepository.
+func WithSearchIndex(idx *search.Index) Option {
+	return func(s *userService) { s.searchIndex = idx }
+}
+
+func (s *userService) SearchUsers(ctx context.Context, query string, limit, offset int) (*model.UserSearchResult, error) {
+	if s.searchIndex == nil {
+		return nil, ErrSearchUnavailable
+	}
+	results := s.searchIndex.Search(query, limit, offset)
+	found := &model.UserSearchResult{Hits: make([]model.UserHit, 0, len(results.Hits))}
+	total, skipped := results.Total, 0
+	for next := offset; ; {
+		next += len(results.Hits)
+		for _, hit := range results.Hits {
+			user, err := s.repo.GetByEmail(ctx, hit.Email)
+			if errors.Is(err, repository.ErrUserNotFound) {
+				// Deleted since it was indexed
+				skipped++
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			found.Hits = append(found.Hits, model.UserHit{User: user, Score: hit.Score, Highlights: hit.Highlights})
+		}
+		// Fill the page with the hits after those skipped
+		if len(found.Hits) >= limit || len(results.Hits) == 0 || next >= results.Total {
+			break
+		}
+		results = s.searchIndex.Search(query, limit-len(found.Hits), next)
+	}
+	found.Total = total - skipped
+	return found, nil
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/model"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingUserService struct {
+	next   UserService
+	tracer trace.Tracer
+}
+
+// NewTracingUserService wraps next so every method call is recorded as a
+// span. Emails and other PII are never added to spans.
+func NewTracingUserService(next UserService, tp trace.TracerProvider) UserService {
+	return &tracingUserService{next: next, tracer: tp.Tracer("user-service/internal/service")}
+}
+
+func (s *tracingUserService) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "UserService."+method, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *tracingUserService) CreateUser(ctx context.Context, user *model.User) error {
+	ctx, span := s.start(ctx, "CreateUser")
+	err := s.next.CreateUser(ctx, user)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) GetUser(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := s.start(ctx, "GetUser")
+	v, err := s.next.GetUser(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	ctx, span := s.start(ctx, "GetUserByID")
+	v, err := s.next.GetUserByID(ctx, id)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) UpdateUser(ctx context.Context, user *model.User) error {
+	ctx, span := s.start(ctx, "UpdateUser")
+	err := s.next.UpdateUser(ctx, user)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) DeleteUser(ctx context.Context, email string) error {
+	ctx, span := s.start(ctx, "DeleteUser")
+	err := s.next.DeleteUser(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) ListUsers(ctx context.Context, filter model.UserFilter) ([]*model.User, error) {
+	ctx, span := s.start(ctx, "ListUsers", attribute.String("filter.state", string(filter.State)))
+	v, err := s.next.ListUsers(ctx, filter)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) UsersVersion(ctx context.Context) (uint64, error) {
+	ctx, span := s.start(ctx, "UsersVersion")
+	v, err := s.next.UsersVersion(ctx)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) SearchUsers(ctx context.Context, query string, limit, offset int) (*model.UserSearchResult, error) {
+	ctx, span := s.start(ctx, "SearchUsers")
+	v, err := s.next.SearchUsers(ctx, query, limit, offset)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) TransitionUser(ctx context.Context, email string, to model.UserState, reason string) (*model.User, error) {
+	ctx, span := s.start(ctx, "TransitionUser", attribute.String("user.state", string(to)))
+	v, err := s.next.TransitionUser(ctx, email, to, reason)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) UndeleteUser(ctx context.Context, email string) (*model.User, error) {
+	ctx, span := s.start(ctx, "UndeleteUser")
+	v, err := s.next.UndeleteUser(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	ctx, span := s.start(ctx, "PurgeDeletedUsers")
+	v, err := s.next.PurgeDeletedUsers(ctx)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) RequestMFAEnrollment(ctx context.Context, email string) error {
+	ctx, span := s.start(ctx, "RequestMFAEnrollment")
+	err := s.next.RequestMFAEnrollment(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) EnrollTOTP(ctx context.Context, email, token string) (*model.TOTPSetup, error) {
+	ctx, span := s.start(ctx, "EnrollTOTP")
+	v, err := s.next.EnrollTOTP(ctx, email, token)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) ConfirmTOTP(ctx context.Context, email, code string) ([]string, error) {
+	ctx, span := s.start(ctx, "ConfirmTOTP")
+	v, err := s.next.ConfirmTOTP(ctx, email, code)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) VerifyTOTP(ctx context.Context, email, code string) error {
+	ctx, span := s.start(ctx, "VerifyTOTP")
+	err := s.next.VerifyTOTP(ctx, email, code)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) VerifyRecoveryCode(ctx context.Context, email, code string) error {
+	ctx, span := s.start(ctx, "VerifyRecoveryCode")
+	err := s.next.VerifyRecoveryCode(ctx, email, code)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) ResetMFA(ctx context.Context, email string) error {
+	ctx, span := s.start(ctx, "ResetMFA")
+	err := s.next.ResetMFA(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) UnlockAccount(ctx context.Context, email string) error {
+	ctx, span := s.start(ctx, "UnlockAccount")
+	err := s.next.UnlockAccount(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) RequestEmailVerification(ctx context.Context, email string) error {
+	ctx, span := s.start(ctx, "RequestEmailVerification")
+	err := s.next.RequestEmailVerification(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := s.start(ctx, "VerifyEmail")
+	err := s.next.VerifyEmail(ctx, token)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, span := s.start(ctx, "RequestPasswordReset")
+	err := s.next.RequestPasswordReset(ctx, email)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := s.start(ctx, "ResetPassword")
+	err := s.next.ResetPassword(ctx, token, password)
+	endSpan(span, err)
+	return err
+}
+
+func (s *tracingUserService) ExportUserData(ctx context.Context, email string) (*model.DataExport, error) {
+	ctx, span := s.start(ctx, "ExportUserData")
+	v, err := s.next.ExportUserData(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) EraseUser(ctx context.Context, email string) (*model.Tombstone, error) {
+	ctx, span := s.start(ctx, "EraseUser")
+	v, err := s.next.EraseUser(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) GetErasure(ctx context.Context, email string) (*model.Tombstone, error) {
+	ctx, span := s.start(ctx, "GetErasure")
+	v, err := s.next.GetErasure(ctx, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (s *tracingUserService) RotateEncryptionKeys(ctx context.Context) (int, error) {
+	ctx, span := s.start(ctx, "RotateEncryptionKeys")
+	v, err := s.next.RotateEncryptionKeys(ctx)
+	endSpan(span, err)
+	return v, err
+}
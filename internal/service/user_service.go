@@ -3,8 +3,16 @@ package service
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
+	"user-service/internal/filter"
+	"user-service/internal/mailer"
 	"user-service/internal/model"
 	"user-service/internal/repository"
+	"user-service/internal/search"
+	"user-service/pkg/logger"
+
+	"go.uber.org/zap"
 )
 
 // Error definitions
@@ -15,20 +23,172 @@ var (
 type UserService interface {
 	CreateUser(ctx context.Context, user *model.User) error
 	GetUser(ctx context.Context, email string) (*model.User, error)
+	// GetUserByID returns a user by the ID assigned when it was created.
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
 	UpdateUser(ctx context.Context, user *model.User) error
+	// DeleteUser soft-deletes a user. They can be restored with UndeleteUser
+	// until the retention window passes and PurgeDeletedUsers removes them.
 	DeleteUser(ctx context.Context, email string) error
-	ListUsers(ctx context.Context) ([]*model.User, error)
+	// ListUsers returns the users matching criteria. An Expression that
+	// does not parse fails with a *filter.Error.
+	ListUsers(ctx context.Context, criteria model.UserFilter) ([]*model.User, error)
+	// UsersVersion returns the version of the whole set of users, which
+	// changes whenever any user is written. A list is at least as new as
+	// the version read before it.
+	UsersVersion(ctx context.Context) (uint64, error)
+	// SearchUsers returns the page of users whose names and emails match
+	// the words of query, best match first, from offset and at most limit
+	// of them.
+	SearchUsers(ctx context.Context, query string, limit, offset int) (*model.UserSearchResult, error)
+
+	// TransitionUser moves a user to another lifecycle state, recording
+	// when and why. Only the transitions allowed by the state machine are
+	// accepted.
+	TransitionUser(ctx context.Context, email string, to model.UserState, reason string) (*model.User, error)
+
+	UndeleteUser(ctx context.Context, email string) (*model.User, error)
+	// PurgeDeletedUsers hard deletes users whose retention window has
+	// passed and returns how many were purged.
+	PurgeDeletedUsers(ctx context.Context) (int, error)
+
+	// RequestMFAEnrollment emails the user a link to enroll in MFA, if
+	// email belongs to a user. Like RequestPasswordReset, it succeeds
+	// either way.
+	RequestMFAEnrollment(ctx context.Context, email string) error
+	// EnrollTOTP starts TOTP enrollment, replacing any unconfirmed
+	// enrollment, once the user proves they own the account with a token
+	// from RequestMFAEnrollment. The returned secret is only shown once.
+	EnrollTOTP(ctx context.Context, email, token string) (*model.TOTPSetup, error)
+	// ConfirmTOTP activates a pending enrollment once the user proves they
+	// can generate codes, and returns one-time recovery codes. Wrong
+	// codes count toward lockout as VerifyTOTP's do.
+	ConfirmTOTP(ctx context.Context, email, code string) ([]string, error)
+	// VerifyTOTP checks a code from the user's authenticator.
+	VerifyTOTP(ctx context.Context, email, code string) error
+	// VerifyRecoveryCode checks and consumes a recovery code.
+	VerifyRecoveryCode(ctx context.Context, email, code string) error
+	// ResetMFA removes a user's enrollment so they can enroll again.
+	ResetMFA(ctx context.Context, email string) error
+
+	// UnlockAccount clears failed attempts and any lockout for email.
+	UnlockAccount(ctx context.Context, email string) error
+
+	// RequestEmailVerification emails the user a link to confirm they own
+	// their address. It succeeds whether or not the user exists.
+	RequestEmailVerification(ctx context.Context, email string) error
+	// VerifyEmail consumes a verification token and marks the user verified.
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword consumes a reset token and sets the user's password.
+	ResetPassword(ctx context.Context, token, password string) error
+
+	// ExportUserData assembles everything stored about a user, including
+	// soft-deleted users, for a data subject access request.
+	ExportUserData(ctx context.Context, email string) (*model.DataExport, error)
+	// EraseUser permanently deletes a user from every table, pseudonymizes
+	// their audit history and records a tombstone of the erasure.
+	EraseUser(ctx context.Context, email string) (*model.Tombstone, error)
+	// GetErasure returns the tombstone recorded when email was erased.
+	GetErasure(ctx context.Context, email string) (*model.Tombstone, error)
+
+	// RotateEncryptionKeys re-encrypts stored users with the current key
+	// and returns how many records were rewritten.
+	RotateEncryptionKeys(ctx context.Context) (int, error)
 }
 
 type userService struct {
-	repo repository.UserRepository
+	repo          repository.UserRepository
+	mfaRepo       repository.MFARepository
+	auditRepo     repository.AuditRepository
+	tokenRepo     repository.TokenRepository
+	tombstoneRepo repository.TombstoneRepository
+	groupRepo     repository.GroupRepository
+	keyRotator    repository.KeyRotator
+	searchIndex   *search.Index
+	mailer        mailer.Mailer
+	lockout       *lockoutTracker
+	logger        *zap.Logger
+	now           func() time.Time
+	// background tracks the emails being sent in the background.
+	background sync.WaitGroup
+
+	mfaIssuer    string
+	linkBaseURL  string
+	retention    time.Duration
+	emailReuse   bool
+	pseudonymKey []byte
+}
+
+// Option configures optional userService dependencies.
+type Option func(*userService)
+
+// WithMFARepository enables the TOTP operations.
+func WithMFARepository(repo repository.MFARepository) Option {
+	return func(s *userService) { s.mfaRepo = repo }
 }
 
-func NewUserService(repo repository.UserRepository) UserService {
-	return &userService{repo: repo}
+// WithAuditRepository records security events such as lockouts.
+func WithAuditRepository(repo repository.AuditRepository) Option {
+	return func(s *userService) { s.auditRepo = repo }
+}
+
+// WithMFAIssuer sets the issuer shown in authenticator apps.
+func WithMFAIssuer(issuer string) Option {
+	return func(s *userService) { s.mfaIssuer = issuer }
+}
+
+// WithLogger sets the logger used when a request does not carry one.
+func WithLogger(l *zap.Logger) Option {
+	return func(s *userService) { s.logger = l }
+}
+
+// WithClock overrides the time source, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(s *userService) { s.now = now }
+}
+
+func NewUserService(repo repository.UserRepository, opts ...Option) UserService {
+	s := &userService{
+		repo:      repo,
+		mfaIssuer: "user-service",
+		lockout:   newLockoutTracker(DefaultLockoutPolicy()),
+		logger:    zap.NewNop(),
+		now:       time.Now,
+		retention: DefaultRetention,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.pseudonymKey) == 0 {
+		s.pseudonymKey = randomKey()
+	}
+	return s
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *model.User) error {
+	// Verification is only set by VerifyEmail and state by TransitionUser.
+	// IDs and timestamps are always assigned here.
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	user.ID = id
+	user.CreatedAt = &now
+	user.UpdatedAt = &now
+	user.VerifiedAt = nil
+	user.State = model.StatePending
+	user.StateChangedAt = &now
+	user.StateReason = ""
+	user.DeletedAt = nil
+	if s.emailReuse {
+		if deleted, err := s.repo.GetDeleted(ctx, user.Email); err == nil {
+			err := s.purge(ctx, user.Email, *deleted.DeletedAt, "email reused")
+			if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+				return err
+			}
+		}
+	}
 	return s.repo.Create(ctx, user)
 }
 
@@ -40,14 +200,99 @@ func (s *userService) GetUser(ctx context.Context, email string) (*model.User, e
 	return user, nil
 }
 
+func (s *userService) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
 func (s *userService) UpdateUser(ctx context.Context, user *model.User) error {
-	return s.repo.Update(ctx, user)
+	// The fields kept are written only if they are still what was read, so
+	// a concurrent transition is not undone
+	return s.retryConflicts(func() error {
+		existing, err := s.repo.GetByEmail(ctx, user.Email)
+		if err != nil {
+			return err
+		}
+		// Fields managed by the service are kept from the stored user. Users
+		// created before IDs existed are given one.
+		user.ID = existing.ID
+		if user.ID == "" {
+			if user.ID, err = newID(); err != nil {
+				return err
+			}
+		}
+		now := s.now()
+		user.CreatedAt = existing.CreatedAt
+		user.UpdatedAt = &now
+		user.VerifiedAt = existing.VerifiedAt
+		user.PasswordHash = existing.PasswordHash
+		user.State = existing.State
+		user.StateChangedAt = existing.StateChangedAt
+		user.StateReason = existing.StateReason
+		user.DeletedAt = nil
+		return s.repo.UpdateIfVersion(ctx, user, existing.Version)
+	})
 }
 
 func (s *userService) DeleteUser(ctx context.Context, email string) error {
-	return s.repo.Delete(ctx, email)
+	if err := s.repo.SoftDelete(ctx, email, s.now()); err != nil {
+		return err
+	}
+	// Outstanding email links must not work for a deleted user. MFA is kept
+	// in case the user is restored.
+	if s.tokenRepo != nil {
+		if err := s.tokenRepo.DeleteByEmail(ctx, email, ""); err != nil {
+			return err
+		}
+	}
+	return s.audit(ctx, &model.AuditEvent{Action: model.AuditUserDeleted, Email: email})
+}
+
+func (s *userService) ListUsers(ctx context.Context, criteria model.UserFilter) ([]*model.User, error) {
+	if criteria.State != "" && !criteria.State.Valid() {
+		return nil, ErrInvalidState
+	}
+	if criteria.Expression == "" {
+		if criteria.State != "" {
+			return s.repo.ListByState(ctx, criteria.State)
+		}
+		return s.repo.List(ctx)
+	}
+	expr, err := filter.Parse(criteria.Expression)
+	if err != nil {
+		return nil, err
+	}
+	if criteria.State != "" {
+		expr = &filter.Logical{
+			Op:    filter.And,
+			Left:  &filter.Comparison{Field: "state", Op: filter.Eq, Value: string(criteria.State)},
+			Right: expr,
+		}
+	}
+	return s.repo.Query(ctx, expr)
+}
+
+func (s *userService) UsersVersion(ctx context.Context) (uint64, error) {
+	return s.repo.Index(ctx)
+}
+
+// audit appends event to the audit log if one is configured.
+func (s *userService) audit(ctx context.Context, event *model.AuditEvent) error {
+	if s.auditRepo == nil {
+		return nil
+	}
+	event.Time = s.now()
+	if err := s.auditRepo.Append(ctx, event); err != nil {
+		return err
+	}
+	s.log(ctx).Info("Audit event", zap.String("action", event.Action), zap.String("email", event.Email))
+	return nil
 }
 
-func (s *userService) ListUsers(ctx context.Context) ([]*model.User, error) {
-	return s.repo.List(ctx)
+// log returns the request's logger, falling back to the service's.
+func (s *userService) log(ctx context.Context) *zap.Logger {
+	return logger.FromContext(ctx, s.logger)
 }
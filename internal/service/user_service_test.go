@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
+	"user-service/internal/filter"
 	"user-service/internal/model"
 	"user-service/internal/repository"
+
+	"github.com/hashicorp/go-memdb"
 )
 
-// mockUserRepo implements UserRepository for testing
+// mockUserRepo implements UserRepository for testing. Methods not defined
+// below panic through the nil embedded interface.
 type mockUserRepo struct {
+	repository.UserRepository
 	users map[string]*model.User
 }
 
@@ -37,6 +43,18 @@ func (m *mockUserRepo) Update(ctx context.Context, user *model.User) error {
 	return nil
 }
 
+func (m *mockUserRepo) UpdateIfVersion(ctx context.Context, user *model.User, version uint64) error {
+	existing, ok := m.users[user.Email]
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+	if existing.Version != version {
+		return repository.ErrVersionConflict
+	}
+	m.users[user.Email] = user
+	return nil
+}
+
 func (m *mockUserRepo) Delete(ctx context.Context, email string) error {
 	if _, ok := m.users[email]; !ok {
 		return repository.ErrUserNotFound
@@ -45,6 +63,11 @@ func (m *mockUserRepo) Delete(ctx context.Context, email string) error {
 	return nil
 }
 
+// SoftDelete does not keep deleted users around in the mock.
+func (m *mockUserRepo) SoftDelete(ctx context.Context, email string, _ time.Time) error {
+	return m.Delete(ctx, email)
+}
+
 func (m *mockUserRepo) List(ctx context.Context) ([]*model.User, error) {
 	var list []*model.User
 	for _, u := range m.users {
@@ -78,6 +101,9 @@ func TestUserService(t *testing.T) {
 	if got.Name != user.Name {
 		t.Errorf("GetUser returned wrong name: got %s, want %s", got.Name, user.Name)
 	}
+	if got.ID == "" || got.CreatedAt == nil || got.UpdatedAt == nil {
+		t.Errorf("CreateUser did not assign an ID and timestamps: got %+v", got)
+	}
 
 	// Test UpdateUser
 	user.Name = "Updated Name"
@@ -100,7 +126,7 @@ func TestUserService(t *testing.T) {
 	// Test ListUsers
 	_ = svc.CreateUser(ctx, &model.User{Email: "a@example.com", Name: "A", Age: 20})
 	_ = svc.CreateUser(ctx, &model.User{Email: "b@example.com", Name: "B", Age: 30})
-	users, err := svc.ListUsers(ctx)
+	users, err := svc.ListUsers(ctx, model.UserFilter{})
 	if err != nil {
 		t.Fatalf("ListUsers failed: %v", err)
 	}
@@ -108,3 +134,41 @@ func TestUserService(t *testing.T) {
 		t.Errorf("ListUsers returned wrong count: got %d, want 2", len(users))
 	}
 }
+
+func TestListUsersFilter(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := NewUserService(repository.NewUserRepository(db))
+	ctx := context.Background()
+	for _, u := range []*model.User{
+		{Email: "alice@example.com", Name: "Alice", Age: 30},
+		{Email: "alan@example.com", Name: "Alan", Age: 16},
+		{Email: "bob@example.com", Name: "Bob", Age: 40},
+	} {
+		if err := svc.CreateUser(ctx, u); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	if _, err := svc.TransitionUser(ctx, "alice@example.com", model.StateActive, ""); err != nil {
+		t.Fatalf("TransitionUser failed: %v", err)
+	}
+
+	users, err := svc.ListUsers(ctx, model.UserFilter{Expression: `age ge 18 and name sw "Al"`})
+	if err != nil || len(users) != 1 || users[0].Email != "alice@example.com" {
+		t.Errorf("expected alice, got %v %v", users, err)
+	}
+	users, err = svc.ListUsers(ctx, model.UserFilter{State: model.StatePending, Expression: `name sw "Al"`})
+	if err != nil || len(users) != 1 || users[0].Email != "alan@example.com" {
+		t.Errorf("expected the state to narrow the filter to alan, got %v %v", users, err)
+	}
+
+	var fe *filter.Error
+	if _, err := svc.ListUsers(ctx, model.UserFilter{Expression: `age ge "18"`}); !errors.As(err, &fe) || fe.Token != `"18"` {
+		t.Errorf("expected a filter error at the string, got %v", err)
+	}
+	if _, err := svc.ListUsers(ctx, model.UserFilter{State: "frozen", Expression: `age pr`}); err != ErrInvalidState {
+		t.Errorf("expected ErrInvalidState, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package tracing sets up OpenTelemetry trace export.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted in Config.
+const (
+	// ExporterNone disables tracing.
+	ExporterNone = "none"
+	// ExporterOTLP sends spans over OTLP/HTTP. The endpoint and headers are
+	// read from the standard OTEL_EXPORTER_OTLP_* variables.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to Config.Writer, Config.File or
+	// stdout, for local debugging and offline tests.
+	ExporterStdout = "stdout"
+)
+
+// Config selects how spans are exported.
+type Config struct {
+	Exporter    string
+	ServiceName string
+	// File receives spans from ExporterStdout instead of stdout.
+	File string
+	// Writer receives spans from ExporterStdout, taking precedence over File.
+	Writer io.Writer
+}
+
+// Provider is a TracerProvider that must be shut down to flush spans.
+type Provider interface {
+	trace.TracerProvider
+	Shutdown(ctx context.Context) error
+}
+
+type noopProvider struct {
+	trace.TracerProvider
+}
+
+func (noopProvider) Shutdown(context.Context) error { return nil }
+
+// NewProvider returns a TracerProvider exporting spans as configured. With
+// ExporterNone, or no exporter, spans are not recorded at all.
+func NewProvider(ctx context.Context, cfg Config) (Provider, error) {
+	var (
+		exp    sdktrace.SpanExporter
+		closer io.Closer
+		err    error
+	)
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return noopProvider{trace.NewNoopTracerProvider()}, nil
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		w := cfg.Writer
+		if w == nil && cfg.File != "" {
+			f, ferr := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if ferr != nil {
+				return nil, ferr
+			}
+			w, closer = f, f
+		}
+		if w == nil {
+			w = os.Stdout
+		}
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = "user-service"
+	}
+	// Attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take
+	// precedence over the defaults.
+	res, err := resource.Merge(
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(name)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	if closer == nil {
+		return tp, nil
+	}
+	return &fileProvider{TracerProvider: tp, file: closer}, nil
+}
+
+// fileProvider closes the span file after flushing.
+type fileProvider struct {
+	*sdktrace.TracerProvider
+	file io.Closer
+}
+
+func (p *fileProvider) Shutdown(ctx context.Context) error {
+	err := p.TracerProvider.Shutdown(ctx)
+	if cerr := p.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
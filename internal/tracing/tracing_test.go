@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tp, err := NewProvider(context.Background(), Config{Exporter: ExporterStdout, Writer: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "operation")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct{ Name string }
+	if err := json.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("failed to decode exported span: %v", err)
+	}
+	if got.Name != "operation" {
+		t.Errorf("expected span named operation, got %q", got.Name)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	tp, err := NewProvider(context.Background(), Config{Exporter: ExporterStdout, File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "operation")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"Name":"operation"`)) {
+		t.Errorf("span not written to file: %s", data)
+	}
+}
+
+func TestNewProviderDisabled(t *testing.T) {
+	tp, err := NewProvider(context.Background(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "operation")
+	if span.IsRecording() {
+		t.Error("expected spans not to be recorded without an exporter")
+	}
+
+	if _, err := NewProvider(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+}
@@ -0,0 +1,102 @@
+// Package worker contains background jobs that run alongside the HTTP
+// server.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"user-service/internal/service"
+
+	"go.uber.org/zap"
+)
+
+// PurgeStats summarizes the purge runs so far.
+type PurgeStats struct {
+	Runs     int64     `json:"runs"`
+	Purged   int64     `json:"purged"`
+	Errors   int64     `json:"errors"`
+	LastRun  time.Time `json:"last_run"`
+	LastErr  string    `json:"last_error,omitempty"`
+	Duration float64   `json:"last_duration_seconds"`
+}
+
+// PurgeWorker periodically hard deletes users whose retention window has
+// passed.
+type PurgeWorker struct {
+	userService service.UserService
+	interval    time.Duration
+	logger      *zap.Logger
+
+	mu    sync.Mutex
+	stats PurgeStats
+}
+
+// NewPurgeWorker returns a worker purging every interval, which must be
+// positive.
+func NewPurgeWorker(userService service.UserService, interval time.Duration, logger *zap.Logger) (*PurgeWorker, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("worker: purge interval must be positive, got %s", interval)
+	}
+	return &PurgeWorker{userService: userService, interval: interval, logger: logger}, nil
+}
+
+// Run purges once immediately and then every interval until ctx is done.
+func (w *PurgeWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce performs a single purge and records its outcome.
+func (w *PurgeWorker) RunOnce(ctx context.Context) {
+	start := time.Now()
+	purged, err := w.userService.PurgeDeletedUsers(ctx)
+	elapsed := time.Since(start)
+
+	w.mu.Lock()
+	w.stats.Runs++
+	w.stats.Purged += int64(purged)
+	w.stats.LastRun = start
+	w.stats.Duration = elapsed.Seconds()
+	w.stats.LastErr = ""
+	if err != nil {
+		w.stats.Errors++
+		w.stats.LastErr = err.Error()
+	}
+	w.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil {
+		w.logger.Error("Purge of deleted users failed", zap.Int("purged", purged), zap.Error(err))
+		return
+	}
+	if purged > 0 {
+		w.logger.Info("Purged deleted users", zap.Int("purged", purged), zap.Duration("duration", elapsed))
+	}
+}
+
+// Stats returns a snapshot of the purge statistics.
+func (w *PurgeWorker) Stats() PurgeStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Check fails if the most recent purge failed, so a stuck purge shows up
+// in health reports.
+func (w *PurgeWorker) Check(ctx context.Context) error {
+	stats := w.Stats()
+	if stats.LastErr != "" {
+		return fmt.Errorf("last purge at %s failed: %s", stats.LastRun.Format(time.RFC3339), stats.LastErr)
+	}
+	return nil
+}
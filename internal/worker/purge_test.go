@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+	"user-service/internal/model"
+	"user-service/internal/repository"
+	"user-service/internal/service"
+
+	"github.com/hashicorp/go-memdb"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPurgeWorkerRunOnce(t *testing.T) {
+	db, err := memdb.NewMemDB(repository.Schema())
+	if err != nil {
+		t.Fatalf("failed to create memdb: %v", err)
+	}
+	svc := service.NewUserService(repository.NewUserRepository(db), service.WithRetention(0))
+	ctx := context.Background()
+	_ = svc.CreateUser(ctx, &model.User{Email: "a@example.com"})
+	_ = svc.CreateUser(ctx, &model.User{Email: "b@example.com"})
+	_ = svc.DeleteUser(ctx, "a@example.com")
+	_ = svc.DeleteUser(ctx, "b@example.com")
+
+	w, err := NewPurgeWorker(svc, time.Hour, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("NewPurgeWorker failed: %v", err)
+	}
+	w.RunOnce(ctx)
+
+	stats := w.Stats()
+	if stats.Runs != 1 || stats.Purged != 2 || stats.Errors != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestPurgeWorkerInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewPurgeWorker(nil, interval, zaptest.NewLogger(t)); err == nil {
+			t.Errorf("Expected interval %s to be rejected", interval)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l, typically a child logger
+// with request-scoped fields.
+func NewContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx by NewContext, or fallback
+// if there is none. If ctx carries a span, its trace and span IDs are
+// added to the returned logger.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	l := fallback
+	if cl, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		l = cl
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		l = l.With(zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
+	}
+	return l
+}
@@ -1,7 +1,160 @@
 package logger
 
-import "go.uber.org/zap"
+import (
+	"fmt"
+	"os"
+	"time"
 
-func NewLogger() (*zap.Logger, error) {
-	return zap.NewProduction()
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Encodings accepted by WithEncoding.
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+)
+
+// Rotation controls when a log file is rotated and how many old files are
+// kept. Zero values use lumberjack's defaults.
+type Rotation struct {
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+}
+
+type options struct {
+	level       zap.AtomicLevel
+	development bool
+	encoding    string
+	sampling    *zap.SamplingConfig
+	output      zapcore.WriteSyncer
+	redaction   RedactionConfig
+}
+
+// Option configures NewLogger.
+type Option func(*options) error
+
+// WithLevel sets the level through an AtomicLevel, which can be changed
+// while the logger is in use.
+func WithLevel(level zap.AtomicLevel) Option {
+	return func(o *options) error {
+		o.level = level
+		return nil
+	}
+}
+
+// WithDevelopment uses zap's development settings: console encoding, no
+// sampling and stack traces on warnings. Later options override them. The
+// level is left to WithLevel.
+func WithDevelopment() Option {
+	return func(o *options) error {
+		o.development = true
+		o.encoding = EncodingConsole
+		o.sampling = nil
+		return nil
+	}
+}
+
+// WithEncoding selects EncodingJSON or EncodingConsole.
+func WithEncoding(encoding string) Option {
+	return func(o *options) error {
+		if encoding != EncodingJSON && encoding != EncodingConsole {
+			return fmt.Errorf("unknown log encoding %q", encoding)
+		}
+		o.encoding = encoding
+		return nil
+	}
+}
+
+// WithSampling logs the first initial entries with the same level and
+// message each second, then every thereafter-th. An initial of zero
+// disables sampling.
+func WithSampling(initial, thereafter int) Option {
+	return func(o *options) error {
+		if initial <= 0 {
+			o.sampling = nil
+			return nil
+		}
+		o.sampling = &zap.SamplingConfig{Initial: initial, Thereafter: thereafter}
+		return nil
+	}
+}
+
+// WithOutput writes entries to w instead of stderr.
+func WithOutput(w zapcore.WriteSyncer) Option {
+	return func(o *options) error {
+		o.output = w
+		return nil
+	}
+}
+
+// WithFile writes entries to path, rotating it according to r.
+func WithFile(path string, r Rotation) Option {
+	return func(o *options) error {
+		if path == "" {
+			return fmt.Errorf("log file path is empty")
+		}
+		o.output = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    r.MaxSizeMB,
+			MaxBackups: r.MaxBackups,
+			MaxAge:     r.MaxAgeDays,
+			Compress:   r.Compress,
+		})
+		return nil
+	}
+}
+
+// WithRedaction replaces DefaultRedaction.
+func WithRedaction(cfg RedactionConfig) Option {
+	return func(o *options) error {
+		o.redaction = cfg
+		return nil
+	}
+}
+
+// NewLogger returns a logger that redacts sensitive fields. Without
+// options it behaves like zap.NewProduction: JSON to stderr at info level
+// with sampling.
+func NewLogger(opts ...Option) (*zap.Logger, error) {
+	o := &options{
+		level:     zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		encoding:  EncodingJSON,
+		sampling:  &zap.SamplingConfig{Initial: 100, Thereafter: 100},
+		output:    zapcore.Lock(os.Stderr),
+		redaction: DefaultRedaction(),
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	encCfg := zap.NewProductionEncoderConfig()
+	if o.development {
+		encCfg = zap.NewDevelopmentEncoderConfig()
+	}
+	var enc zapcore.Encoder
+	if o.encoding == EncodingConsole {
+		enc = zapcore.NewConsoleEncoder(encCfg)
+	} else {
+		enc = zapcore.NewJSONEncoder(encCfg)
+	}
+
+	var core zapcore.Core = zapcore.NewCore(enc, o.output, o.level)
+	if o.sampling != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, o.sampling.Initial, o.sampling.Thereafter)
+	}
+	core = NewRedactingCore(core, o.redaction)
+
+	zapOpts := []zap.Option{zap.ErrorOutput(zapcore.Lock(os.Stderr)), zap.AddCaller()}
+	if o.development {
+		zapOpts = append(zapOpts, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
+	} else {
+		zapOpts = append(zapOpts, zap.AddStacktrace(zapcore.ErrorLevel))
+	}
+	return zap.New(core, zapOpts...), nil
 }
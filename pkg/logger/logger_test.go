@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewLoggerLevelChanges(t *testing.T) {
+	var buf bytes.Buffer
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	log, err := NewLogger(WithLevel(level), WithOutput(zapcore.AddSync(&buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Debug("before")
+	level.SetLevel(zapcore.DebugLevel)
+	log.Debug("after")
+
+	out := buf.String()
+	if strings.Contains(out, "before") {
+		t.Errorf("debug entry logged at info level: %s", out)
+	}
+	if !strings.Contains(out, "after") {
+		t.Errorf("debug entry not logged after level change: %s", out)
+	}
+}
+
+func TestNewLoggerEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := NewLogger(WithEncoding(EncodingConsole), WithOutput(zapcore.AddSync(&buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("hello", zap.String("email", "alice@example.com"))
+
+	out := buf.String()
+	if strings.HasPrefix(out, "{") {
+		t.Errorf("expected console output, got %s", out)
+	}
+	if strings.Contains(out, "alice@example.com") {
+		t.Errorf("console output is not redacted: %s", out)
+	}
+
+	if _, err := NewLogger(WithEncoding("xml")); err == nil {
+		t.Error("expected error for unknown encoding")
+	}
+}
+
+func TestNewLoggerSampling(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := NewLogger(WithSampling(2, 0), WithOutput(zapcore.AddSync(&buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		log.Info("repeated")
+	}
+	if n := strings.Count(buf.String(), "repeated"); n != 2 {
+		t.Errorf("got %d sampled entries, want 2", n)
+	}
+
+	buf.Reset()
+	log, err = NewLogger(WithSampling(0, 0), WithOutput(zapcore.AddSync(&buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		log.Info("repeated")
+	}
+	if n := strings.Count(buf.String(), "repeated"); n != 10 {
+		t.Errorf("got %d entries with sampling off, want 10", n)
+	}
+}
+
+func TestNewLoggerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	log, err := NewLogger(WithFile(path, Rotation{MaxSizeMB: 1, MaxBackups: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Info("to file")
+	if err := log.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "to file") {
+		t.Errorf("log file does not contain entry: %s", data)
+	}
+}
@@ -0,0 +1,503 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Redaction modes
+const (
+	// Mask replaces a value with a fixed placeholder.
+	Mask = "mask"
+	// Hash replaces a value with a keyed hash, so entries about the same
+	// value can still be correlated.
+	Hash = "hash"
+)
+
+// Masked is what masked values are replaced with.
+const Masked = "[REDACTED]"
+
+// emailPattern matches email addresses embedded in free text such as error
+// messages.
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// RedactionConfig controls what the redacting core removes.
+type RedactionConfig struct {
+	// Fields maps lower case field keys to Mask or Hash. Keys are matched
+	// case-insensitively, both for log fields and for keys of logged maps.
+	Fields map[string]string
+	// HashKey keys the hashes produced by Hash. A random key is used if it
+	// is empty, so hashes only correlate within one process.
+	HashKey []byte
+	// ScrubEmails masks email addresses found anywhere in messages, string
+	// fields and errors.
+	ScrubEmails bool
+}
+
+// DefaultRedaction returns the configuration used by NewLogger.
+func DefaultRedaction() RedactionConfig {
+	return RedactionConfig{
+		Fields: map[string]string{
+			"email":         Hash,
+			"name":          Mask,
+			"password":      Mask,
+			"token":         Mask,
+			"secret":        Mask,
+			"code":          Mask,
+			"recovery_code": Mask,
+			"authorization": Mask,
+			"cookie":        Mask,
+			"set-cookie":    Mask,
+		},
+		ScrubEmails: true,
+	}
+}
+
+type redactor struct {
+	fields      map[string]string
+	hashKey     []byte
+	scrubEmails bool
+}
+
+func newRedactor(cfg RedactionConfig) *redactor {
+	r := &redactor{fields: make(map[string]string, len(cfg.Fields)), hashKey: cfg.HashKey, scrubEmails: cfg.ScrubEmails}
+	for k, mode := range cfg.Fields {
+		r.fields[strings.ToLower(k)] = mode
+	}
+	if len(r.hashKey) == 0 {
+		r.hashKey = make([]byte, 32)
+		if _, err := rand.Read(r.hashKey); err != nil {
+			panic("logger: cannot generate redaction key: " + err.Error())
+		}
+	}
+	return r
+}
+
+// NewRedactingCore wraps core so that every entry written through it has
+// sensitive values removed before reaching the encoder. Struct values are
+// redacted according to their `pii:"mask"` and `pii:"hash"` field tags, as
+// are the keys object marshalers add for tagged fields of their type.
+func NewRedactingCore(core zapcore.Core, cfg RedactionConfig) zapcore.Core {
+	return &redactingCore{Core: core, r: newRedactor(cfg)}
+}
+
+type redactingCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.redactFields(fields)), r: c.r}
+}
+
+// Check lets the wrapped core decide whether to log, so level checks and
+// sampling still apply, but routes the write through this core.
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Check(ent, nil) == nil {
+		return ce
+	}
+	return ce.AddCore(ent, c)
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.scrub(ent.Message)
+	return c.Core.Write(ent, c.r.redactFields(fields))
+}
+
+func (r *redactor) redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		out[i] = r.field(f)
+	}
+	return out
+}
+
+func (r *redactor) field(f zapcore.Field) zapcore.Field {
+	mode, sensitive := r.fields[strings.ToLower(f.Key)]
+
+	switch f.Type {
+	case zapcore.StringType:
+		if sensitive {
+			return stringField(f.Key, r.apply(mode, f.String))
+		}
+		f.String = r.scrub(f.String)
+		return f
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		if sensitive {
+			return stringField(f.Key, r.apply(mode, fmt.Sprintf("%s", f.Interface)))
+		}
+		if f.Type == zapcore.ByteStringType {
+			return stringField(f.Key, r.scrub(string(f.Interface.([]byte))))
+		}
+		return f
+	case zapcore.ErrorType:
+		err, _ := f.Interface.(error)
+		if err == nil {
+			return f
+		}
+		if sensitive {
+			return stringField(f.Key, r.apply(mode, err.Error()))
+		}
+		// Errors are flattened to their message so the redacted text is
+		// what gets encoded.
+		return stringField(f.Key, r.scrub(err.Error()))
+	case zapcore.StringerType:
+		s, ok := f.Interface.(fmt.Stringer)
+		if !ok {
+			return f
+		}
+		if sensitive {
+			return stringField(f.Key, r.apply(mode, s.String()))
+		}
+		return stringField(f.Key, r.scrub(s.String()))
+	case zapcore.ReflectType:
+		if sensitive {
+			return stringField(f.Key, r.apply(mode, fmt.Sprint(f.Interface)))
+		}
+		f.Interface = r.value(reflect.ValueOf(f.Interface))
+		return f
+	case zapcore.ObjectMarshalerType, zapcore.InlineMarshalerType:
+		obj, ok := f.Interface.(zapcore.ObjectMarshaler)
+		if !ok {
+			return f
+		}
+		if sensitive {
+			return stringField(f.Key, Masked)
+		}
+		f.Interface = r.object(obj)
+		return f
+	case zapcore.ArrayMarshalerType:
+		arr, ok := f.Interface.(zapcore.ArrayMarshaler)
+		if !ok {
+			return f
+		}
+		if sensitive {
+			return stringField(f.Key, Masked)
+		}
+		f.Interface = r.array(arr)
+		return f
+	case zapcore.SkipType, zapcore.NamespaceType:
+		return f
+	default:
+		// Numbers, times and durations are only redacted when their key
+		// is configured.
+		if sensitive {
+			return stringField(f.Key, Masked)
+		}
+		return f
+	}
+}
+
+// redactingObject marshals obj through a redactingEncoder.
+type redactingObject struct {
+	obj zapcore.ObjectMarshaler
+	r   *redactor
+}
+
+func (o redactingObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return o.obj.MarshalLogObject(&redactingEncoder{ObjectEncoder: enc, r: o.r, tags: piiTags(reflect.TypeOf(o.obj))})
+}
+
+// redactingArray marshals arr through a redactingArrayEncoder.
+type redactingArray struct {
+	arr zapcore.ArrayMarshaler
+	r   *redactor
+}
+
+func (a redactingArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	return a.arr.MarshalLogArray(&redactingArrayEncoder{ArrayEncoder: enc, r: a.r})
+}
+
+// object wraps obj so that what it adds is redacted as structValue
+// redacts structs: keys named by the `pii` tags of obj's type, or
+// configured, are redacted and other strings are scrubbed. Marshalers
+// write straight to the encoder, so it is the encoder that redacts.
+func (r *redactor) object(obj zapcore.ObjectMarshaler) zapcore.ObjectMarshaler {
+	return redactingObject{obj: obj, r: r}
+}
+
+// array wraps arr so that the elements it appends are redacted.
+func (r *redactor) array(arr zapcore.ArrayMarshaler) zapcore.ArrayMarshaler {
+	return redactingArray{arr: arr, r: r}
+}
+
+// redactingEncoder redacts the strings, objects, arrays and reflected
+// values added to the encoder it wraps. Other values are only masked when
+// their key is tagged or configured.
+type redactingEncoder struct {
+	zapcore.ObjectEncoder
+	r    *redactor
+	tags map[string]string
+}
+
+func (e *redactingEncoder) mode(key string) string {
+	if mode := e.tags[strings.ToLower(key)]; mode != "" {
+		return mode
+	}
+	return e.r.fields[strings.ToLower(key)]
+}
+
+func (e *redactingEncoder) AddString(key, val string) {
+	if mode := e.mode(key); mode != "" {
+		e.ObjectEncoder.AddString(key, e.r.apply(mode, val))
+		return
+	}
+	e.ObjectEncoder.AddString(key, e.r.scrub(val))
+}
+
+func (e *redactingEncoder) AddByteString(key string, val []byte) {
+	e.AddString(key, string(val))
+}
+
+func (e *redactingEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	if e.masked(key) {
+		return nil
+	}
+	return e.ObjectEncoder.AddObject(key, e.r.object(obj))
+}
+
+func (e *redactingEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	if e.masked(key) {
+		return nil
+	}
+	return e.ObjectEncoder.AddArray(key, e.r.array(arr))
+}
+
+func (e *redactingEncoder) AddReflected(key string, val interface{}) error {
+	if mode := e.mode(key); mode != "" {
+		e.ObjectEncoder.AddString(key, e.r.apply(mode, fmt.Sprint(val)))
+		return nil
+	}
+	return e.ObjectEncoder.AddReflected(key, e.r.value(reflect.ValueOf(val)))
+}
+
+func (e *redactingEncoder) AddInt(key string, val int) {
+	if !e.masked(key) {
+		e.ObjectEncoder.AddInt(key, val)
+	}
+}
+
+func (e *redactingEncoder) AddInt64(key string, val int64) {
+	if !e.masked(key) {
+		e.ObjectEncoder.AddInt64(key, val)
+	}
+}
+
+func (e *redactingEncoder) AddUint64(key string, val uint64) {
+	if !e.masked(key) {
+		e.ObjectEncoder.AddUint64(key, val)
+	}
+}
+
+func (e *redactingEncoder) AddFloat64(key string, val float64) {
+	if !e.masked(key) {
+		e.ObjectEncoder.AddFloat64(key, val)
+	}
+}
+
+func (e *redactingEncoder) AddBool(key string, val bool) {
+	if !e.masked(key) {
+		e.ObjectEncoder.AddBool(key, val)
+	}
+}
+
+func (e *redactingEncoder) AddTime(key string, val time.Time) {
+	if !e.masked(key) {
+		e.ObjectEncoder.AddTime(key, val)
+	}
+}
+
+// masked adds Masked for key and returns true if key is tagged or
+// configured.
+func (e *redactingEncoder) masked(key string) bool {
+	if e.mode(key) == "" {
+		return false
+	}
+	e.ObjectEncoder.AddString(key, Masked)
+	return true
+}
+
+// redactingArrayEncoder scrubs the strings appended to the encoder it
+// wraps, and redacts the objects, arrays and reflected values.
+type redactingArrayEncoder struct {
+	zapcore.ArrayEncoder
+	r *redactor
+}
+
+func (e *redactingArrayEncoder) AppendString(val string) {
+	e.ArrayEncoder.AppendString(e.r.scrub(val))
+}
+
+func (e *redactingArrayEncoder) AppendByteString(val []byte) {
+	e.AppendString(string(val))
+}
+
+func (e *redactingArrayEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	return e.ArrayEncoder.AppendObject(e.r.object(obj))
+}
+
+func (e *redactingArrayEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	return e.ArrayEncoder.AppendArray(e.r.array(arr))
+}
+
+func (e *redactingArrayEncoder) AppendReflected(val interface{}) error {
+	return e.ArrayEncoder.AppendReflected(e.r.value(reflect.ValueOf(val)))
+}
+
+// piiTags returns the `pii` tags of the fields of struct type t, or of the
+// struct t points to, by lower case JSON name.
+func piiTags(t reflect.Type) map[string]string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	tags := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if mode := sf.Tag.Get("pii"); mode != "" {
+			name, _, _ := jsonName(sf)
+			tags[strings.ToLower(name)] = mode
+		}
+	}
+	return tags
+}
+
+func stringField(key, val string) zapcore.Field {
+	return zapcore.Field{Key: key, Type: zapcore.StringType, String: val}
+}
+
+func (r *redactor) apply(mode, val string) string {
+	if mode == Hash {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(val))
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+	return Masked
+}
+
+func (r *redactor) scrub(s string) string {
+	if !r.scrubEmails {
+		return s
+	}
+	return emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		return r.apply(Hash, email)
+	})
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// value returns a copy of v that encodes like v but with sensitive struct
+// fields and map entries redacted.
+func (r *redactor) value(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	// Types that control their own encoding, like time.Time, are kept as
+	// they are.
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.value(v.Elem())
+	case reflect.Struct:
+		return r.structValue(v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if mode, ok := r.fields[strings.ToLower(key)]; ok {
+				out[key] = r.apply(mode, fmt.Sprint(iter.Value().Interface()))
+				continue
+			}
+			out[key] = r.value(iter.Value())
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = r.value(v.Index(i))
+		}
+		return out
+	case reflect.String:
+		return r.scrub(v.String())
+	default:
+		return v.Interface()
+	}
+}
+
+// structValue converts a struct to a map keyed like its JSON encoding,
+// applying `pii` tags and the configured field keys.
+func (r *redactor) structValue(v reflect.Value) interface{} {
+	t := v.Type()
+	out := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		name, omitEmpty, skip := jsonName(sf)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		mode := sf.Tag.Get("pii")
+		if mode == "" {
+			mode = r.fields[strings.ToLower(name)]
+		}
+		if mode != "" {
+			out[name] = r.apply(mode, fmt.Sprint(fv.Interface()))
+			continue
+		}
+		out[name] = r.value(fv)
+	}
+	return out
+}
+
+func jsonName(sf reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = sf.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty, false
+}
@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"user-service/internal/model"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	secretEmail = "alice@example.com"
+	secretName  = "Alice Liddell"
+)
+
+// newTestLogger returns a logger whose encoded output is written to buf.
+func newTestLogger(buf *bytes.Buffer, cfg RedactionConfig) *zap.Logger {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := zapcore.NewCore(enc, zapcore.AddSync(buf), zapcore.DebugLevel)
+	return zap.New(NewRedactingCore(core, cfg))
+}
+
+func assertClean(t *testing.T, out string) {
+	t.Helper()
+	for _, s := range []string{secretEmail, secretName, "s3cr3t-token", "Bearer abc"} {
+		if strings.Contains(out, s) {
+			t.Errorf("output contains %q: %s", s, out)
+		}
+	}
+}
+
+func TestRedactingCoreFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf, DefaultRedaction())
+
+	log.Info("user "+secretEmail+" created",
+		zap.String("email", secretEmail),
+		zap.String("Name", secretName),
+		zap.String("token", "s3cr3t-token"),
+		zap.Error(errors.New("lookup failed for "+secretEmail)),
+		zap.Any("headers", http.Header{"Authorization": {"Bearer abc"}, "Accept": {"application/json"}}),
+	)
+	log.With(zap.String("email", secretEmail)).Warn("with fields")
+
+	out := buf.String()
+	assertClean(t, out)
+	if !strings.Contains(out, Masked) || !strings.Contains(out, "sha256:") {
+		t.Errorf("expected masked and hashed values: %s", out)
+	}
+	if !strings.Contains(out, "application/json") {
+		t.Errorf("non-sensitive header was removed: %s", out)
+	}
+}
+
+func TestRedactingCoreUserTags(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf, RedactionConfig{})
+
+	user := &model.User{Email: secretEmail, Name: secretName, Age: 30, PasswordHash: "hash"}
+	log.Info("user", zap.Any("user", user), zap.Any("users", []*model.User{user}))
+
+	out := buf.String()
+	assertClean(t, out)
+	if strings.Contains(out, `"hash"`) {
+		t.Errorf("password hash was logged: %s", out)
+	}
+	if !strings.Contains(out, `"age":30`) {
+		t.Errorf("untagged field was removed: %s", out)
+	}
+}
+
+// loggedUser logs itself through zapcore.ObjectMarshaler.
+type loggedUser struct {
+	Email   string      `json:"email" pii:"hash"`
+	Name    string      `json:"name" pii:"mask"`
+	Age     int         `json:"age"`
+	Manager *loggedUser `json:"manager"`
+}
+
+func (u *loggedUser) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("email", u.Email)
+	enc.AddString("name", u.Name)
+	enc.AddInt("age", u.Age)
+	enc.AddString("note", "reach me at "+u.Email)
+	if u.Manager != nil {
+		return enc.AddObject("manager", u.Manager)
+	}
+	return nil
+}
+
+type loggedUsers []*loggedUser
+
+func (us loggedUsers) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, u := range us {
+		if err := enc.AppendObject(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRedactingCoreMarshalers(t *testing.T) {
+	var buf bytes.Buffer
+	log := newTestLogger(&buf, RedactionConfig{ScrubEmails: true})
+
+	// Tags of the marshaler's type apply without configured keys
+	user := &loggedUser{Email: secretEmail, Name: secretName, Age: 30}
+	log.Info("user", zap.Object("user", user), zap.Array("users", loggedUsers{user}), zap.Inline(user))
+	out := buf.String()
+	assertClean(t, out)
+	if !strings.Contains(out, `"age":30`) || strings.Count(out, Masked) != 3 {
+		t.Errorf("expected tagged fields redacted and others kept: %s", out)
+	}
+
+	// Nested objects and free text are redacted by key and scrubbed
+	buf.Reset()
+	log = newTestLogger(&buf, DefaultRedaction())
+	manager := &loggedUser{Email: "bob@example.com", Name: "Bob Builder", Age: 50}
+	log.Info("user", zap.Object("user", &loggedUser{Email: secretEmail, Name: secretName, Manager: manager}))
+	out = buf.String()
+	assertClean(t, out)
+	if strings.Contains(out, "bob@example.com") || strings.Contains(out, "Bob Builder") || !strings.Contains(out, `"age":50`) {
+		t.Errorf("expected the nested object redacted: %s", out)
+	}
+}
+
+func TestRedactingCoreHashIsStable(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := DefaultRedaction()
+	cfg.HashKey = []byte("key")
+	log := newTestLogger(&buf, cfg)
+
+	log.Info("a", zap.String("email", secretEmail))
+	log.Info("b", zap.Any("user", model.User{Email: secretEmail}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	r := newRedactor(cfg)
+	want := r.apply(Hash, secretEmail)
+	for _, line := range lines {
+		if !strings.Contains(line, want) {
+			t.Errorf("line %q does not contain hash %q", line, want)
+		}
+	}
+}
+
+func TestRedactingCoreRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := zapcore.NewCore(enc, zapcore.AddSync(&buf), zapcore.InfoLevel)
+	log := zap.New(NewRedactingCore(core, DefaultRedaction()))
+
+	log.Debug("hidden", zap.String("email", secretEmail))
+	if buf.Len() != 0 {
+		t.Errorf("debug entry was written: %s", buf.String())
+	}
+}
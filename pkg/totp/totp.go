@@ -0,0 +1,100 @@
+// Package totp implements RFC 6238 time-based one-time passwords using the
+// defaults understood by common authenticator apps (HMAC-SHA1, 6 digits,
+// 30 second period).
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits in a generated code.
+	Digits = 6
+	// Period is the lifetime of a single code.
+	Period = 30 * time.Second
+	// SecretSize is the size in bytes of secrets returned by GenerateSecret.
+	SecretSize = 20
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random shared secret.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns the unpadded base32 form of secret used by
+// authenticator apps.
+func EncodeSecret(secret []byte) string {
+	return b32.EncodeToString(secret)
+}
+
+// Step returns the time step counter for t.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the given time step.
+func Code(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
+
+// Validate reports whether code is valid at time t, accepting codes up to
+// skew steps before or after t. On success it returns the matched step so
+// callers can reject replays of the same code.
+func Validate(secret []byte, code string, t time.Time, skew int) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	matched, ok := int64(0), false
+	// Check every candidate so the time taken does not depend on which
+	// step matched.
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 && !ok {
+			matched, ok = step, true
+		}
+	}
+	return matched, ok
+}
+
+// ProvisioningURI returns the otpauth:// URI that authenticator apps use to
+// enroll secret for account under issuer.
+func ProvisioningURI(issuer, account string, secret []byte) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(Digits))
+	q.Set("period", fmt.Sprint(int(Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// NormalizeCode strips the spaces and dashes users commonly type into codes.
+func NormalizeCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
@@ -0,0 +1,57 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRFC6238Vectors checks the SHA1 test vectors from RFC 6238 Appendix B,
+// truncated to six digits.
+func TestRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		got := Code(secret, Step(time.Unix(v.unix, 0)))
+		if got != v.code {
+			t.Errorf("Code at %d: expected %s, got %s", v.unix, v.code, got)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	prev := Code(secret, Step(now)-1)
+
+	step, ok := Validate(secret, prev, now, 1)
+	if !ok || step != Step(now)-1 {
+		t.Errorf("Expected previous step code to validate with skew 1, got step=%d ok=%v", step, ok)
+	}
+	if _, ok := Validate(secret, prev, now, 0); ok {
+		t.Error("Expected previous step code to be rejected with skew 0")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Error("Expected short code to be rejected")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("user-service", "a@example.com", []byte("12345678901234567890"))
+	if !strings.HasPrefix(uri, "otpauth://totp/user-service:a@example.com?") {
+		t.Errorf("Unexpected URI prefix: %s", uri)
+	}
+	if !strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") {
+		t.Errorf("URI missing encoded secret: %s", uri)
+	}
+}